@@ -0,0 +1,216 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultAppConfigPollInterval is how often the configuration is polled by default.
+const defaultAppConfigPollInterval = time.Minute
+
+// AppConfigConfig configures a source of a configuration profile deployed by AWS AppConfig, see
+// WithAppConfig.
+type AppConfigConfig struct {
+	// Application, Environment and Profile identify the configuration profile by their names or
+	// IDs.
+	Application string
+	Environment string
+	Profile     string
+	// Format of the configuration, e.g. "yaml". Defaults to the format of its content type.
+	Format string
+	// PollInterval is how often the configuration is polled, at least 15 seconds. Defaults to a
+	// minute, or to the interval requested by AppConfig.
+	PollInterval time.Duration
+	// Region of AppConfig. Defaults to the AWS_REGION and AWS_DEFAULT_REGION environment
+	// variables.
+	Region string
+	// Endpoint of AppConfig, e.g. of the AppConfig agent. Defaults to the
+	// AWS_ENDPOINT_URL_APPCONFIGDATA and AWS_ENDPOINT_URL environment variables, or AppConfig.
+	Endpoint    string
+	Credentials AWSCredentials
+	// Client sends the requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// appConfigSource provides the configuration profile polled in a configuration session.
+type appConfigSource struct {
+	config AppConfigConfig
+
+	mu sync.Mutex
+	// token polls the next configuration of the session, or is empty if no session is started.
+	token string
+	// interval is the poll interval requested by AppConfig.
+	interval time.Duration
+	// body and contentType are of the latest configuration, which is only sent once it changes.
+	body        []byte
+	contentType string
+}
+
+func (s *appConfigSource) load(ctx context.Context, want func(rel string) bool) ([]document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.poll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get configuration (profile: %s): %w", s.config.Profile, err)
+	}
+
+	rel := s.config.Profile + contentTypeExtension(s.contentType)
+	if s.config.Format != "" {
+		rel = s.config.Profile + "." + s.config.Format
+	}
+	if !want(rel) {
+		return nil, nil
+	}
+
+	name := "appconfig:" + s.config.Application + "/" + s.config.Environment + "/" + s.config.Profile
+	return []document{{name: name, rel: rel, data: s.body}}, nil
+}
+
+// watch polls the configuration in the poll interval.
+func (s *appConfigSource) watch(ctx context.Context, changed func()) error {
+	// changes made before watching are caught up
+	changed()
+
+	for {
+		interval := s.config.PollInterval
+		s.mu.Lock()
+		if interval <= 0 {
+			interval = s.interval
+		}
+		s.mu.Unlock()
+		if interval <= 0 {
+			interval = defaultAppConfigPollInterval
+		}
+
+		select {
+		case <-time.After(interval):
+			changed()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// poll gets the latest configuration of the session, starting a session if none is started or
+// its token expired.
+func (s *appConfigSource) poll(ctx context.Context) error {
+	for attempt := 1; ; attempt++ {
+		started := false
+		if s.token == "" {
+			err := s.startSession(ctx)
+			if err != nil {
+				return err
+			}
+			started = true
+		}
+
+		query := url.Values{"configuration_token": {s.token}}
+		resp, err := s.send(ctx, http.MethodGet, "/configuration?"+query.Encode(), nil)
+		if err != nil {
+			return err
+		}
+
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("read response: %w", err)
+		}
+
+		if resp.StatusCode == http.StatusBadRequest && !started && attempt == 1 {
+			// tokens expire after 24 hours, or once they're used
+			s.token = ""
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status: %s: %s", resp.Status, bytes.TrimSpace(b))
+		}
+
+		s.token = resp.Header.Get("Next-Poll-Configuration-Token")
+		if seconds, err := strconv.Atoi(resp.Header.Get("Next-Poll-Interval-In-Seconds")); err == nil {
+			s.interval = time.Duration(seconds) * time.Second
+		}
+		if len(b) > 0 || s.body == nil {
+			// the configuration is only sent once it changes
+			s.body, s.contentType = b, resp.Header.Get("Content-Type")
+		}
+		return nil
+	}
+}
+
+// startSession starts a configuration session.
+func (s *appConfigSource) startSession(ctx context.Context) error {
+	input := map[string]any{
+		"ApplicationIdentifier":          s.config.Application,
+		"EnvironmentIdentifier":          s.config.Environment,
+		"ConfigurationProfileIdentifier": s.config.Profile,
+	}
+	if s.config.PollInterval > 0 {
+		input["RequiredMinimumPollIntervalInSeconds"] = max(int(s.config.PollInterval/time.Second), 15)
+	}
+	body, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+
+	resp, err := s.send(ctx, http.MethodPost, "/configurationsessions", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("start session: unexpected status: %s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+
+	var session struct {
+		InitialConfigurationToken string
+	}
+	err = json.NewDecoder(resp.Body).Decode(&session)
+	if err != nil {
+		return fmt.Errorf("decode session: %w", err)
+	}
+	s.token = session.InitialConfigurationToken
+	return nil
+}
+
+// send sends a signed request to AppConfig.
+func (s *appConfigSource) send(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	region := awsRegion(s.config.Region)
+	if region == "" {
+		region = "us-east-1"
+	}
+	u := "https://appconfigdata." + region + ".amazonaws.com"
+	if endpoint := awsEndpoint(s.config.Endpoint, "appconfigdata"); endpoint != "" {
+		u = strings.TrimSuffix(endpoint, "/")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	signAWS(req, body, "appconfig", region, s.config.Credentials.orEnv(), time.Now())
+
+	client := s.config.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	return resp, nil
+}
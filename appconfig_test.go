@@ -0,0 +1,213 @@
+package hydra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// appConfigTestServer is the AppConfig data API of the profile "myapp/prod/settings", whose
+// configuration tokens are used once.
+type appConfigTestServer struct {
+	mu          sync.Mutex
+	body        string
+	contentType string
+	version     int
+	// tokens are the versions of the configuration last sent by token.
+	tokens   map[string]int
+	sessions int
+	// minimum is the minimum poll interval requested by the last session.
+	minimum int
+}
+
+func newAppConfigTestServer(body, contentType string) *appConfigTestServer {
+	return &appConfigTestServer{body: body, contentType: contentType, version: 1, tokens: make(map[string]int)}
+}
+
+// put deploys the configuration.
+func (s *appConfigTestServer) put(body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.body = body
+	s.version++
+}
+
+// expire expires the tokens.
+func (s *appConfigTestServer) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.tokens)
+}
+
+func (s *appConfigTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/appconfig/aws4_request") {
+		http.Error(w, `{"Message":"invalid signature"}`, http.StatusForbidden)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/configurationsessions":
+		var input struct {
+			ApplicationIdentifier                string
+			EnvironmentIdentifier                string
+			ConfigurationProfileIdentifier       string
+			RequiredMinimumPollIntervalInSeconds int
+		}
+		json.NewDecoder(r.Body).Decode(&input)
+		if input.ApplicationIdentifier != "myapp" || input.EnvironmentIdentifier != "prod" || input.ConfigurationProfileIdentifier != "settings" {
+			http.Error(w, `{"Message":"profile not found"}`, http.StatusNotFound)
+			return
+		}
+		s.sessions++
+		s.minimum = input.RequiredMinimumPollIntervalInSeconds
+		token := fmt.Sprintf("session-%d", s.sessions)
+		s.tokens[token] = 0
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"InitialConfigurationToken":%q}`, token)
+	case "/configuration":
+		token := r.URL.Query().Get("configuration_token")
+		version, ok := s.tokens[token]
+		if !ok {
+			http.Error(w, `{"Message":"invalid token"}`, http.StatusBadRequest)
+			return
+		}
+		delete(s.tokens, token)
+		next := token + "+"
+		s.tokens[next] = s.version
+		w.Header().Set("Next-Poll-Configuration-Token", next)
+		w.Header().Set("Next-Poll-Interval-In-Seconds", "30")
+		w.Header().Set("Content-Type", s.contentType)
+		if version != s.version {
+			// the configuration is only sent once it changes
+			fmt.Fprint(w, s.body)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestAppConfigSourceLoad(t *testing.T) {
+	server := newAppConfigTestServer("port: 8080\n", "application/x-yaml")
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	// regions and endpoints default to the environment
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("AWS_ENDPOINT_URL_APPCONFIGDATA", srv.URL)
+	src := &appConfigSource{config: AppConfigConfig{
+		Application: "myapp",
+		Environment: "prod",
+		Profile:     "settings",
+		Credentials: AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret"},
+		Client:      srv.Client(),
+	}}
+
+	steps := []struct {
+		name   string
+		update func()
+		want   string
+		// sessions is the number of sessions started.
+		sessions int
+	}{
+		{name: "initial", want: "port: 8080\n", sessions: 1},
+		{name: "unchanged", want: "port: 8080\n", sessions: 1},
+		{name: "deployed", update: func() { server.put("port: 9090\n") }, want: "port: 9090\n", sessions: 1},
+		{name: "expired token", update: server.expire, want: "port: 9090\n", sessions: 2},
+		{name: "deployed again", update: func() { server.put("port: 9091\n") }, want: "port: 9091\n", sessions: 2},
+	}
+	for _, step := range steps {
+		if step.update != nil {
+			step.update()
+		}
+		docs, err := src.load(context.Background(), func(string) bool { return true })
+		if err != nil {
+			t.Fatalf("%s: load() error = %v", step.name, err)
+		}
+		want := document{name: "appconfig:myapp/prod/settings", rel: "settings.yaml", data: []byte(step.want)}
+		if len(docs) != 1 || docs[0].name != want.name || docs[0].rel != want.rel || string(docs[0].data) != step.want {
+			t.Errorf("%s: load() = %s, want %s", step.name, docs, []document{want})
+		}
+		if server.sessions != step.sessions {
+			t.Errorf("%s: started %d sessions, want %d", step.name, server.sessions, step.sessions)
+		}
+	}
+	if src.interval != 30*time.Second {
+		t.Errorf("interval = %s, want 30s", src.interval)
+	}
+}
+
+func TestAppConfigSourceLoadError(t *testing.T) {
+	server := newAppConfigTestServer("port: 8080\n", "application/x-yaml")
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		config  AppConfigConfig
+		wantErr string
+	}{
+		{
+			name:    "unknown profile",
+			config:  AppConfigConfig{Application: "myapp", Environment: "prod", Profile: "other", Region: "eu-west-1"},
+			wantErr: `get configuration (profile: other): start session: unexpected status: 404 Not Found: {"Message":"profile not found"}`,
+		},
+		{
+			name:    "other region",
+			config:  AppConfigConfig{Application: "myapp", Environment: "prod", Profile: "settings", Region: "us-east-1"},
+			wantErr: `get configuration (profile: settings): start session: unexpected status: 403 Forbidden: {"Message":"invalid signature"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Endpoint = srv.URL
+			tt.config.Client = srv.Client()
+			_, err := (&appConfigSource{config: tt.config}).load(context.Background(), func(string) bool { return true })
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("load() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAppConfigSourceWatch(t *testing.T) {
+	server := newAppConfigTestServer(`{"port": 8080}`, "text/plain")
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	// formats override the content type
+	h, err := New(WithAppConfig(AppConfigConfig{
+		Application:  "myapp",
+		Environment:  "prod",
+		Profile:      "settings",
+		Format:       "json",
+		PollInterval: 20 * time.Millisecond,
+		Region:       "eu-west-1",
+		Endpoint:     srv.URL,
+		Client:       srv.Client(),
+	}), WithAutoReload())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got, _ := Get[int](h, "port"); got != 8080 {
+		t.Fatalf("port = %d, want 8080", got)
+	}
+	// poll intervals requested are at least 15 seconds
+	if server.minimum != 15 {
+		t.Errorf("requested minimum poll interval = %d, want 15", server.minimum)
+	}
+	start(t, h)
+
+	server.put(`{"port": 9090}`)
+	eventually(t, "port 9090", func() bool {
+		got, _ := Get[int](h, "port")
+		return got == 9090
+	})
+}
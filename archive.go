@@ -0,0 +1,214 @@
+package hydra
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// archiveMaxFileSize limits the size of a file extracted from an archive.
+	archiveMaxFileSize = 16 << 20
+	// archiveMaxSize limits the total size of the files extracted from an archive, so archives
+	// decompressing into huge files can't exhaust memory.
+	archiveMaxSize = 64 << 20
+)
+
+// archiveSource provides the configuration files of a zip or tar archive, optionally
+// compressed with gzip, located at a path or URL, see WithArchive.
+type archiveSource struct {
+	location string
+	// id names the archive, the location without credentials if it's a URL.
+	id string
+	// name is the lowercased name of the archive, whose extension determines its format.
+	name string
+	// url fetches the archive if the location is a URL.
+	url *urlSource
+
+	mu sync.Mutex
+	// sum is the checksum of the archive whose documents are extracted, which are extracted
+	// again only once the archive changes.
+	sum  [sha256.Size]byte
+	docs []document
+}
+
+func newArchiveSource(location string) *archiveSource {
+	s := &archiveSource{location: location, id: location, name: strings.ToLower(path.Base(location))}
+	if u, err := url.Parse(location); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		s.id = redactURL(location)
+		s.url = &urlSource{url: location, id: s.id, client: http.DefaultClient}
+		s.name = strings.ToLower(path.Base(u.Path))
+	}
+	return s
+}
+
+func (s *archiveSource) load(ctx context.Context, want func(rel string) bool) ([]document, error) {
+	var b []byte
+	var err error
+	if s.url != nil {
+		b, _, err = s.url.fetch(ctx)
+	} else {
+		b, err = os.ReadFile(s.location)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read archive: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sum := sha256.Sum256(b)
+	if s.docs != nil && sum == s.sum {
+		return s.docs, nil
+	}
+
+	var docs []document
+	var size int
+	add := func(name string, r io.Reader) error {
+		rel := strings.TrimPrefix(path.Clean("/"+name), "/")
+		if !want(rel) {
+			return nil
+		}
+
+		data, err := io.ReadAll(io.LimitReader(r, archiveMaxFileSize+1))
+		if err != nil {
+			return fmt.Errorf("read file (path: %s): %w", name, err)
+		}
+		if len(data) > archiveMaxFileSize {
+			return fmt.Errorf("read file (path: %s): larger than %d bytes", name, archiveMaxFileSize)
+		}
+		size += len(data)
+		if size > archiveMaxSize {
+			return fmt.Errorf("read file (path: %s): files larger than %d bytes in total", name, archiveMaxSize)
+		}
+		docs = append(docs, document{name: s.id + "/" + rel, rel: rel, data: data})
+		return nil
+	}
+
+	switch {
+	case strings.HasSuffix(s.name, ".zip"):
+		err = extractZip(b, add)
+	case strings.HasSuffix(s.name, ".tar.gz"), strings.HasSuffix(s.name, ".tgz"):
+		var zr *gzip.Reader
+		zr, err = gzip.NewReader(bytes.NewReader(b))
+		if err == nil {
+			err = extractTar(zr, add)
+		}
+	case strings.HasSuffix(s.name, ".tar"):
+		err = extractTar(bytes.NewReader(b), add)
+	default:
+		err = errors.New("unsupported archive format, expected .zip, .tar, .tar.gz or .tgz")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("extract archive: %w", err)
+	}
+
+	if docs == nil {
+		// the archive is extracted
+		docs = []document{}
+	}
+	s.sum, s.docs = sum, docs
+	return docs, nil
+}
+
+// watch watches the directory of an archive at a path, so archives replaced by renaming are
+// noticed as created. Archives at URLs can't be watched.
+func (s *archiveSource) watch(ctx context.Context, changed func()) error {
+	if s.url != nil {
+		return ErrWatchUnsupported
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("create a new watcher: %w", err)
+	}
+	defer w.Close()
+
+	location := filepath.Clean(s.location)
+	err = w.Add(filepath.Dir(location))
+	if err != nil {
+		return fmt.Errorf("watch directory (path: %s): %w", filepath.Dir(location), err)
+	}
+	changed()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-w.Events:
+			if !ok {
+				return errors.New("watcher closed")
+			}
+			if filepath.Clean(ev.Name) == location && ev.Op&(fsnotify.Create|fsnotify.Write) != 0 {
+				changed()
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return errors.New("watcher closed")
+			}
+			return err
+		}
+	}
+}
+
+// extractZip passes the regular files of the zip archive to add.
+func extractZip(b []byte, add func(name string, r io.Reader) error) error {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return err
+	}
+
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("open file (path: %s): %w", f.Name, err)
+		}
+		err = add(f.Name, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractTar passes the regular files of the tar archive to add.
+func extractTar(r io.Reader, add func(name string, r io.Reader) error) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		err = add(hdr.Name, tr)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package hydra
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// archiveFile is a file of an archive built by writeTarGz or writeZip.
+type archiveFile struct {
+	name string
+	data []byte
+}
+
+// writeTarGz writes the files as a gzip compressed tar archive at the path.
+func writeTarGz(t *testing.T, path string, files ...archiveFile) {
+	t.Helper()
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	tw := tar.NewWriter(zw)
+	for _, f := range files {
+		err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.data)), Typeflag: tar.TypeReg})
+		if err == nil {
+			_, err = tw.Write(f.data)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, b.String())
+}
+
+// writeZip writes the files as a zip archive at the path.
+func writeZip(t *testing.T, path string, files ...archiveFile) {
+	t.Helper()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err == nil {
+			_, err = w.Write(f.data)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, b.String())
+}
+
+func TestArchiveSourceLoad(t *testing.T) {
+	files := []archiveFile{
+		{name: "app.yaml", data: []byte("port: 8080\n")},
+		{name: "conf/db.json", data: []byte(`{"host": "db"}`)},
+		{name: "README.md", data: []byte("# config\n")},
+	}
+	tests := []struct {
+		name  string
+		write func(t *testing.T, path string, files ...archiveFile)
+	}{
+		{name: "config.tar.gz", write: writeTarGz},
+		{name: "config.zip", write: writeZip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.name)
+			tt.write(t, path, files...)
+
+			s := newArchiveSource(path)
+			docs, err := s.load(context.Background(), func(rel string) bool { return !strings.HasSuffix(rel, ".md") })
+			if err != nil {
+				t.Fatalf("load() error = %v", err)
+			}
+			want := []document{
+				{name: path + "/app.yaml", rel: "app.yaml", data: []byte("port: 8080\n")},
+				{name: path + "/conf/db.json", rel: "conf/db.json", data: []byte(`{"host": "db"}`)},
+			}
+			if !reflect.DeepEqual(docs, want) {
+				t.Errorf("load() = %+v, want %+v", docs, want)
+			}
+		})
+	}
+}
+
+func TestArchiveSourceLimits(t *testing.T) {
+	big := make([]byte, archiveMaxFileSize+1)
+	part := make([]byte, archiveMaxFileSize)
+	tests := []struct {
+		name    string
+		files   []archiveFile
+		wantErr string
+	}{
+		{
+			name:    "file",
+			files:   []archiveFile{{name: "app.yaml", data: big}},
+			wantErr: "read file (path: app.yaml): larger than",
+		},
+		{
+			name: "total",
+			files: []archiveFile{
+				{name: "a.yaml", data: part}, {name: "b.yaml", data: part}, {name: "c.yaml", data: part},
+				{name: "d.yaml", data: part}, {name: "e.yaml", data: part},
+			},
+			wantErr: "read file (path: e.yaml): files larger than",
+		},
+	}
+	for _, tt := range tests {
+		for _, format := range []string{"config.tar.gz", "config.zip"} {
+			t.Run(tt.name+"/"+format, func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), format)
+				if strings.HasSuffix(format, ".zip") {
+					writeZip(t, path, tt.files...)
+				} else {
+					writeTarGz(t, path, tt.files...)
+				}
+
+				_, err := newArchiveSource(path).load(context.Background(), func(string) bool { return true })
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("load() error = %v, want %q", err, tt.wantErr)
+				}
+			})
+		}
+	}
+}
+
+func TestWithArchiveWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.tar.gz")
+	writeTarGz(t, path, archiveFile{name: "app.yaml", data: []byte("port: 8080\n")})
+
+	h, err := New(WithArchive(path), WithAutoReload())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got, _ := Get[int](h, "port"); got != 8080 {
+		t.Fatalf("port = %d, want 8080", got)
+	}
+	start(t, h)
+
+	// the archive is replaced by renaming a new one over it
+	tmp := filepath.Join(dir, "config.tar.gz.tmp")
+	writeTarGz(t, tmp, archiveFile{name: "app.yaml", data: []byte("port: 9090\n")})
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "port 9090", func() bool {
+		got, _ := Get[int](h, "port")
+		return got == 9090
+	})
+}
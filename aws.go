@@ -0,0 +1,212 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// AWSCredentials are credentials of AWS requests. Empty credentials default to the
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is set for temporary credentials.
+	SessionToken string
+}
+
+func (c AWSCredentials) orEnv() AWSCredentials {
+	if c.AccessKeyID != "" {
+		return c
+	}
+	return AWSCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// awsRegion returns the region, defaulting to the AWS_REGION and AWS_DEFAULT_REGION
+// environment variables.
+func awsRegion(region string) string {
+	if region != "" {
+		return region
+	}
+	if region = os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
+
+// awsEndpoint returns the endpoint, defaulting to the AWS_ENDPOINT_URL_<SERVICE> and
+// AWS_ENDPOINT_URL environment variables, or "" for the endpoint of AWS.
+func awsEndpoint(endpoint, service string) string {
+	if endpoint != "" {
+		return endpoint
+	}
+	if endpoint = os.Getenv("AWS_ENDPOINT_URL_" + strings.ToUpper(service)); endpoint != "" {
+		return endpoint
+	}
+	return os.Getenv("AWS_ENDPOINT_URL")
+}
+
+// awsJSON sends a signed request of the AWS JSON protocol for the target, e.g.
+// "AmazonSSM.GetParametersByPath", and decodes the response into output.
+func awsJSON(ctx context.Context, client *http.Client, service, region, endpoint string, creds AWSCredentials, target string, input, output any) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+
+	region = awsRegion(region)
+	if region == "" {
+		region = "us-east-1"
+	}
+	u := "https://" + service + "." + region + ".amazonaws.com/"
+	if endpoint := awsEndpoint(endpoint, service); endpoint != "" {
+		u = strings.TrimSuffix(endpoint, "/") + "/"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	signAWS(req, body, service, region, creds.orEnv(), time.Now())
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Type    string `json:"__type"`
+			Message string
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		if e.Type != "" {
+			return fmt.Errorf("unexpected status: %s: %s: %s", resp.Status, e.Type, e.Message)
+		}
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(output)
+	if err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// signAWS signs the request with AWS Signature Version 4. All headers set on the request, and
+// its host, are signed.
+func signAWS(req *http.Request, body []byte, service, region string, c AWSCredentials, now time.Time) {
+	now = now.UTC()
+	date := now.Format("20060102")
+	payload := sha256.Sum256(body)
+
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payload[:]))
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		awsPath(req.URL),
+		awsQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payload[:]),
+	}, "\n")
+	canonicalSum := sha256.Sum256([]byte(canonical))
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + scope + "\n" +
+		hex.EncodeToString(canonicalSum[:])
+
+	key := []byte("AWS4" + c.SecretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsQuery returns the canonical query string of the values.
+func awsQuery(values url.Values) string {
+	var params []string
+	for name, vs := range values {
+		for _, v := range vs {
+			params = append(params, awsEscape(name, true)+"="+awsEscape(v, true))
+		}
+	}
+	slices.Sort(params)
+	return strings.Join(params, "&")
+}
+
+// awsPath returns the canonical path of the URL.
+func awsPath(u *url.URL) string {
+	if u.Path == "" {
+		return "/"
+	}
+	return awsEscape(u.Path, false)
+}
+
+// awsEscape percent-encodes all but unreserved characters, and slashes unless encodeSlash is set.
+func awsEscape(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&15])
+		}
+	}
+	return b.String()
+}
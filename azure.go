@@ -0,0 +1,439 @@
+package hydra
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// azureIMDSToken is the endpoint of the instance metadata service providing access tokens
+	// of the managed identity on Azure, e.g. on VMs, AKS or App Service.
+	azureIMDSToken = "http://169.254.169.254/metadata/identity/oauth2/token"
+	// azureKeyVault is the resource of access tokens of Key Vault.
+	azureKeyVault = "https://vault.azure.net"
+	// azureKeyVaultRef is the content type of key-values referencing secrets of Key Vault.
+	azureKeyVaultRef = "application/vnd.microsoft.appconfig.keyvaultref+json"
+	// defaultAzureRefresh is how often key-values are checked for changes by default.
+	defaultAzureRefresh = 30 * time.Second
+)
+
+// AzureConfig configures a source of key-values stored in Azure App Configuration, see
+// WithAzureAppConfig.
+type AzureConfig struct {
+	// ConnectionString of the store, e.g. "Endpoint=https://myapp.azconfig.io;Id=...;Secret=...",
+	// authorizing requests with its access key. If empty, requests to Endpoint are authorized by
+	// Token.
+	ConnectionString string
+	// Endpoint of the store, e.g. "https://myapp.azconfig.io".
+	Endpoint string
+	// Token returns the OAuth 2.0 access token of requests for the resource, e.g. of a credential
+	// of github.com/Azure/azure-sdk-for-go/sdk/azidentity. It's used for the store unless a
+	// connection string is set, and for Key Vault. Defaults to the token of the managed identity
+	// provided by the instance metadata service on Azure.
+	Token func(ctx context.Context, resource string) (string, error)
+	// KeyFilter selects the keys, e.g. "myapp:*". Defaults to all keys.
+	KeyFilter string
+	// Label selects the key-values with it, e.g. "prod". Defaults to key-values without a label.
+	Label string
+	// TrimKeyPrefix is trimmed from the keys, e.g. "myapp:".
+	TrimKeyPrefix string
+	// Separator separates the keys of the hierarchy of a key, e.g. "database:host" is placed
+	// under "database.host". Defaults to ":".
+	Separator string
+	// Sentinel is a key-value updated after changing others, so only it is checked for changes
+	// and all key-values are loaded again once it changes. Defaults to checking all key-values.
+	Sentinel string
+	// Refresh is how often key-values are checked for changes. Defaults to 30 seconds.
+	Refresh time.Duration
+	// Client sends the requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// azureSource provides the key-values of a store as a configuration document.
+type azureSource struct {
+	config AzureConfig
+
+	mu sync.Mutex
+	// tokens are the access tokens of the instance metadata service, by resource, cached until
+	// they expire.
+	tokens map[string]azureToken
+}
+
+type azureToken struct {
+	token   string
+	expires time.Time
+}
+
+type azureKeyValue struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	ContentType string `json:"content_type"`
+	ETag        string `json:"etag"`
+}
+
+func (s *azureSource) load(ctx context.Context, want func(rel string) bool) ([]document, error) {
+	endpoint, _, _, err := s.store()
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parse endpoint: %w", err)
+	}
+	rel := strings.Split(u.Hostname(), ".")[0] + ".json"
+	if !want(rel) {
+		// key-values are decoded as JSON
+		return nil, nil
+	}
+
+	separator := s.config.Separator
+	if separator == "" {
+		separator = ":"
+	}
+
+	settings := make(map[string]any)
+	next := "/kv?" + url.Values{"key": {s.keyFilter()}, "label": {s.label()}, "api-version": {"1.0"}}.Encode()
+	for next != "" {
+		var list struct {
+			Items    []azureKeyValue `json:"items"`
+			NextLink string          `json:"@nextLink"`
+		}
+		err := s.get(ctx, next, func(body io.Reader) error {
+			return json.NewDecoder(body).Decode(&list)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list key-values (key: %s): %w", s.keyFilter(), err)
+		}
+
+		for _, kv := range list.Items {
+			if strings.HasPrefix(kv.Key, ".appconfig.") {
+				// feature flags
+				continue
+			}
+
+			value, err := s.value(ctx, kv)
+			if err != nil {
+				return nil, fmt.Errorf("resolve key-value (key: %s): %w", kv.Key, err)
+			}
+
+			key := strings.TrimPrefix(kv.Key, s.config.TrimKeyPrefix)
+			setPath(settings, strings.Split(strings.ToLower(key), separator), value)
+		}
+		next = list.NextLink
+	}
+
+	b, err := json.Marshal(settings)
+	if err != nil {
+		return nil, fmt.Errorf("encode key-values: %w", err)
+	}
+	return []document{{name: "azappconfig:" + u.Host, rel: rel, data: b}}, nil
+}
+
+// watch checks the key-values, or only the sentinel if it's set, for changes in the refresh
+// interval.
+func (s *azureSource) watch(ctx context.Context, changed func()) error {
+	refresh := s.config.Refresh
+	if refresh <= 0 {
+		refresh = defaultAzureRefresh
+	}
+
+	var etag string
+	if s.config.Sentinel != "" {
+		var err error
+		etag, err = s.sentinel(ctx)
+		if err != nil {
+			return fmt.Errorf("get sentinel (key: %s): %w", s.config.Sentinel, err)
+		}
+	}
+	// changes made before watching are caught up
+	changed()
+
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if s.config.Sentinel == "" {
+			changed()
+			continue
+		}
+
+		next, err := s.sentinel(ctx)
+		if err != nil {
+			return fmt.Errorf("get sentinel (key: %s): %w", s.config.Sentinel, err)
+		}
+		if next != etag {
+			etag = next
+			changed()
+		}
+	}
+}
+
+// sentinel returns the ETag of the sentinel, or "" if it doesn't exist.
+func (s *azureSource) sentinel(ctx context.Context) (string, error) {
+	var kv azureKeyValue
+	path := "/kv/" + url.PathEscape(s.config.Sentinel) + "?" + url.Values{"label": {s.label()}, "api-version": {"1.0"}}.Encode()
+	err := s.get(ctx, path, func(body io.Reader) error {
+		return json.NewDecoder(body).Decode(&kv)
+	})
+	var status azureStatusError
+	if errors.As(err, &status) && status.code == http.StatusNotFound {
+		return "", nil
+	}
+	return kv.ETag, err
+}
+
+// value returns the value of the key-value, decoding JSON values and resolving references of
+// secrets of Key Vault.
+func (s *azureSource) value(ctx context.Context, kv azureKeyValue) (any, error) {
+	mediaType, _, _ := mime.ParseMediaType(kv.ContentType)
+	switch {
+	case mediaType == azureKeyVaultRef:
+		var ref struct {
+			URI string `json:"uri"`
+		}
+		err := json.Unmarshal([]byte(kv.Value), &ref)
+		if err != nil {
+			return nil, fmt.Errorf("decode reference: %w", err)
+		}
+		return s.secret(ctx, ref.URI)
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var v any
+		err := json.Unmarshal([]byte(kv.Value), &v)
+		if err != nil {
+			return nil, fmt.Errorf("decode value: %w", err)
+		}
+		return v, nil
+	default:
+		return kv.Value, nil
+	}
+}
+
+// secret returns the value of the secret of Key Vault, e.g.
+// "https://myvault.vault.azure.net/secrets/password".
+func (s *azureSource) secret(ctx context.Context, uri string) (string, error) {
+	token, err := s.accessToken(ctx, azureKeyVault)
+	if err != nil {
+		return "", fmt.Errorf("get token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri+"?api-version=7.4", nil)
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("get secret (uri: %s): unexpected status: %s", uri, resp.Status)
+	}
+
+	var secret struct {
+		Value string `json:"value"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&secret)
+	if err != nil {
+		return "", fmt.Errorf("decode secret: %w", err)
+	}
+	return secret.Value, nil
+}
+
+// azureStatusError is an unexpected status of a response of the store.
+type azureStatusError struct {
+	code   int
+	status string
+}
+
+func (e azureStatusError) Error() string {
+	return "unexpected status: " + e.status
+}
+
+// get sends an authorized GET request for the path of the store and passes the response body
+// to read.
+func (s *azureSource) get(ctx context.Context, path string, read func(body io.Reader) error) error {
+	endpoint, id, secret, err := s.store()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(endpoint, "/")+path, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	if secret != nil {
+		signAzure(req, id, secret, time.Now())
+	} else {
+		token, err := s.accessToken(ctx, strings.TrimSuffix(endpoint, "/"))
+		if err != nil {
+			return fmt.Errorf("get token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return azureStatusError{code: resp.StatusCode, status: resp.Status}
+	}
+	return read(resp.Body)
+}
+
+// azureSourceID returns the ID of the source of the store in errors and options like Priority,
+// e.g. "azappconfig:myapp.azconfig.io/myapp:*/prod". Only the endpoint of a connection string is
+// included, never its secret.
+func azureSourceID(c AzureConfig) string {
+	endpoint := c.Endpoint
+	if c.ConnectionString != "" {
+		endpoint = ""
+		for _, part := range strings.Split(c.ConnectionString, ";") {
+			name, value, _ := strings.Cut(part, "=")
+			if strings.EqualFold(strings.TrimSpace(name), "endpoint") {
+				endpoint = value
+			}
+		}
+	}
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		endpoint = u.Host
+	}
+	return "azappconfig:" + endpoint + "/" + c.KeyFilter + "/" + c.Label
+}
+
+// store returns the endpoint of the store and, if a connection string is set, the ID and the
+// secret of its access key.
+func (s *azureSource) store() (endpoint, id string, secret []byte, err error) {
+	if s.config.ConnectionString == "" {
+		return s.config.Endpoint, "", nil, nil
+	}
+
+	for _, part := range strings.Split(s.config.ConnectionString, ";") {
+		name, value, _ := strings.Cut(part, "=")
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "endpoint":
+			endpoint = value
+		case "id":
+			id = value
+		case "secret":
+			secret, err = base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return "", "", nil, fmt.Errorf("decode secret of connection string: %w", err)
+			}
+		}
+	}
+	if endpoint == "" || id == "" || secret == nil {
+		return "", "", nil, errors.New("connection string missing Endpoint, Id or Secret")
+	}
+	return endpoint, id, secret, nil
+}
+
+// accessToken returns the access token for the resource.
+func (s *azureSource) accessToken(ctx context.Context, resource string) (string, error) {
+	if s.config.Token != nil {
+		return s.config.Token(ctx, resource)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.tokens[resource]; ok && time.Now().Before(t.expires) {
+		return t.token, nil
+	}
+
+	query := url.Values{"api-version": {"2018-02-01"}, "resource": {resource}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, azureIMDSToken+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Metadata", "true")
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var token struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresIn   json.Number `json:"expires_in"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return "", fmt.Errorf("decode token: %w", err)
+	}
+
+	// the token is refreshed a minute before it expires
+	expiresIn, _ := token.ExpiresIn.Int64()
+	if s.tokens == nil {
+		s.tokens = make(map[string]azureToken)
+	}
+	s.tokens[resource] = azureToken{
+		token:   token.AccessToken,
+		expires: time.Now().Add(time.Duration(expiresIn)*time.Second - time.Minute),
+	}
+	return token.AccessToken, nil
+}
+
+func (s *azureSource) keyFilter() string {
+	if s.config.KeyFilter == "" {
+		return "*"
+	}
+	return s.config.KeyFilter
+}
+
+func (s *azureSource) label() string {
+	if s.config.Label == "" {
+		// key-values without a label
+		return "\x00"
+	}
+	return s.config.Label
+}
+
+func (s *azureSource) client() *http.Client {
+	if s.config.Client == nil {
+		return http.DefaultClient
+	}
+	return s.config.Client
+}
+
+// signAzure signs the request of App Configuration with the access key, see
+// https://learn.microsoft.com/azure/azure-app-configuration/rest-api-authentication-hmac.
+func signAzure(req *http.Request, id string, secret []byte, now time.Time) {
+	date := now.UTC().Format(http.TimeFormat)
+	hash := sha256.Sum256(nil)
+	contentHash := base64.StdEncoding.EncodeToString(hash[:])
+
+	req.Header.Set("X-Ms-Date", date)
+	req.Header.Set("X-Ms-Content-Sha256", contentHash)
+
+	stringToSign := req.Method + "\n" + req.URL.RequestURI() + "\n" + date + ";" + req.URL.Host + ";" + contentHash
+	signature := base64.StdEncoding.EncodeToString(hmacSHA256(secret, stringToSign))
+	req.Header.Set("Authorization", "HMAC-SHA256 Credential="+id+"&SignedHeaders=x-ms-date;host;x-ms-content-sha256&Signature="+signature)
+}
@@ -0,0 +1,125 @@
+package hydra
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAzureSourceID(t *testing.T) {
+	secret := base64.StdEncoding.EncodeToString([]byte("s3cret"))
+	tests := []struct {
+		name   string
+		config AzureConfig
+		want   string
+	}{
+		{
+			name:   "endpoint",
+			config: AzureConfig{Endpoint: "https://myapp.azconfig.io"},
+			want:   "azappconfig:myapp.azconfig.io//",
+		},
+		{
+			name: "connection string",
+			config: AzureConfig{
+				ConnectionString: "Endpoint=https://myapp.azconfig.io;Id=abc;Secret=" + secret,
+				KeyFilter:        "myapp:*",
+				Label:            "prod",
+			},
+			want: "azappconfig:myapp.azconfig.io/myapp:*/prod",
+		},
+		{
+			name:   "connection string without endpoint",
+			config: AzureConfig{ConnectionString: "Id=abc;Secret=" + secret},
+			want:   "azappconfig://",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := azureSourceID(tt.config)
+			if got != tt.want {
+				t.Errorf("azureSourceID() = %q, want %q", got, tt.want)
+			}
+			if strings.Contains(got, secret) || strings.Contains(got, "Secret") {
+				t.Errorf("azureSourceID() = %q contains the secret", got)
+			}
+
+			var o options
+			WithAzureAppConfig(tt.config)(&o)
+			if o.sources[0].id != tt.want {
+				t.Errorf("source id = %q, want %q", o.sources[0].id, tt.want)
+			}
+		})
+	}
+}
+
+func TestAzureSourceLoad(t *testing.T) {
+	secret := []byte("s3cret")
+	mux := http.NewServeMux()
+	var srv *httptest.Server
+	mux.HandleFunc("/kv", func(w http.ResponseWriter, r *http.Request) {
+		// the request is signed with the access key of the connection string
+		date, err := http.ParseTime(r.Header.Get("X-Ms-Date"))
+		signed := r.Clone(r.Context())
+		signed.URL.Host = r.Host
+		signAzure(signed, "abc", secret, date)
+		if err != nil || r.Header.Get("Authorization") != signed.Header.Get("Authorization") {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("key") != "myapp:*" || r.URL.Query().Get("label") != "prod" {
+			http.Error(w, "unexpected filter", http.StatusBadRequest)
+			return
+		}
+
+		items := []azureKeyValue{
+			{Key: "myapp:db:host", Value: "localhost"},
+			{Key: "myapp:db:port", Value: "5432", ContentType: "application/json"},
+			{Key: "myapp:db:password", Value: `{"uri":"` + srv.URL + `/secrets/pw"}`, ContentType: azureKeyVaultRef},
+			{Key: ".appconfig.featureflag/beta", Value: "{}"},
+		}
+		page := map[string]any{"items": items[:2]}
+		if r.URL.Query().Get("page") == "" {
+			page["@nextLink"] = "/kv?key=myapp%3A%2A&label=prod&page=2"
+		} else {
+			page["items"] = items[2:]
+		}
+		_ = json.NewEncoder(w).Encode(page)
+	})
+	mux.HandleFunc("/secrets/pw", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer vault-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"value": "hunter2"})
+	})
+	srv = httptest.NewServer(mux)
+	defer srv.Close()
+
+	h, err := New(WithAzureAppConfig(AzureConfig{
+		ConnectionString: "Endpoint=" + srv.URL + ";Id=abc;Secret=" + base64.StdEncoding.EncodeToString(secret),
+		KeyFilter:        "myapp:*",
+		Label:            "prod",
+		TrimKeyPrefix:    "myapp:",
+		Token: func(_ context.Context, resource string) (string, error) {
+			return "vault-token", nil
+		},
+	}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	want := map[string]any{"db.host": "localhost", "db.port": 5432.0, "db.password": "hunter2"}
+	for key, want := range want {
+		if got, err := Get[any](h, key); err != nil || got != want {
+			t.Errorf("Get(%s) = %v, %v, want %v", key, got, err, want)
+		}
+	}
+	if _, ok := Lookup[any](h, "appconfig"); ok {
+		t.Error("feature flags are loaded")
+	}
+}
@@ -0,0 +1,98 @@
+package hydra
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// Codec decodes and encodes configuration files of a format, e.g. a proprietary one, see
+// RegisterCodec. It's a viper.Codec.
+type Codec interface {
+	Decode(b []byte, v map[string]any) error
+	Encode(v map[string]any) ([]byte, error)
+}
+
+var (
+	codecsMu sync.Mutex
+	// codecs are the codecs of the formats hydra supports in addition to viper's by their
+	// extensions, including the ones registered by RegisterCodec.
+	codecs = map[string]Codec{
+		"ini":        iniCodec{},
+		"hcl":        hclCodec{},
+		"tfvars":     hclCodec{},
+		"cue":        cueCodec{},
+		"dhall":      dhallCodec{},
+		"xml":        xmlCodec{},
+		"properties": propertiesCodec{},
+		"props":      propertiesCodec{},
+		"prop":       propertiesCodec{},
+		"json5":      json5Codec{},
+		"jsonc":      json5Codec{},
+		"nt":         nestedTextCodec{},
+		"star":       starlarkCodec{},
+		"kdl":        kdlCodec{},
+		"plist":      plistCodec{},
+	}
+	// extensions are the extensions of the codecs registered by RegisterCodec, in the order they
+	// were registered. Files of the formats hydra supports in addition to viper's are only
+	// found when enabled, e.g. by WithCUE.
+	extensions []string
+	// registered are the extensions of the codecs registered by RegisterCodec, including the
+	// ones already supported.
+	registered = map[string]bool{}
+)
+
+// RegisterCodec registers the codec of the format of configuration files with the extension,
+// e.g. "conf", so it's supported by instances created afterwards, which decode them with the
+// default decoder registry and find them unless WithExtensions sets other extensions. Codecs
+// registered for extensions already supported replace the codec of the format, including
+// viper's, e.g. for "yaml". Options configuring the codecs of the default decoder registry, e.g.
+// WithYAMLDocuments, make New fail for extensions whose codecs are registered.
+func RegisterCodec(ext string, codec Codec) {
+	ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[ext] = codec
+	registered[ext] = true
+	if !slices.Contains(viper.SupportedExts, ext) && !slices.Contains(extensions, ext) {
+		extensions = append(extensions, ext)
+	}
+}
+
+// supportedExtensions returns the extensions of configuration files supported by default,
+// viper's and the ones of the codecs registered by RegisterCodec.
+func supportedExtensions() []string {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	return append(slices.Clone(viper.SupportedExts), extensions...)
+}
+
+// checkRegisteredCodecs returns an error if a codec is registered by RegisterCodec for one of
+// the extensions, whose codecs an option configures.
+func checkRegisteredCodecs(exts ...string) error {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	for _, ext := range exts {
+		if registered[ext] {
+			return fmt.Errorf("configure codec (extension: %s): registered by RegisterCodec", ext)
+		}
+	}
+	return nil
+}
+
+// newCodecRegistry returns viper's codec registry with the codecs of the formats hydra supports
+// in addition to viper's registered.
+func newCodecRegistry() *viper.DefaultCodecRegistry {
+	r := viper.NewCodecRegistry()
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	for ext, codec := range codecs {
+		// registering codecs doesn't fail
+		_ = r.RegisterCodec(ext, codec)
+	}
+	return r
+}
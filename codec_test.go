@@ -0,0 +1,215 @@
+package hydra
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestFormatsOptIn(t *testing.T) {
+	files := map[string]string{
+		"app.yaml":    "yamlkey: 1\n",
+		"app.xml":     "<config><xmlkey>1</xmlkey></config>",
+		"app.jsonnet": "{jsonnetkey: 1}",
+		"app.dhall":   "{ dhallkey = 1 }",
+		"app.json5":   "{json5key: 1}",
+		"app.jsonc":   "{\"jsonckey\": 1 // comment\n}",
+		"app.nt":      "ntkey: 1\n",
+		"app.kdl":     "kdlkey 1\n",
+		"app.plist":   `<?xml version="1.0"?><plist version="1.0"><dict><key>plistkey</key><integer>1</integer></dict></plist>`,
+		"app.cue":     "cuekey: 1\n",
+		"app.star":    "starkey = 1\n",
+	}
+	dir := t.TempDir()
+	for name, data := range files {
+		writeFile(t, filepath.Join(dir, name), data)
+	}
+
+	tests := []struct {
+		name string
+		opt  Option
+		keys []string
+	}{
+		{name: "default"},
+		{name: "xml", opt: WithXML(XMLConfig{}), keys: []string{"xmlkey"}},
+		{name: "jsonnet", opt: WithJsonnet(), keys: []string{"jsonnetkey"}},
+		{name: "dhall", opt: WithDhall(), keys: []string{"dhallkey"}},
+		{name: "json5", opt: WithJSON5(), keys: []string{"json5key", "jsonckey"}},
+		{name: "nestedtext", opt: WithNestedText(), keys: []string{"ntkey"}},
+		{name: "kdl", opt: WithKDL(), keys: []string{"kdlkey"}},
+		{name: "plist", opt: WithPlist(), keys: []string{"plistkey"}},
+		{name: "cue", opt: WithCUE(), keys: []string{"cuekey"}},
+		{name: "starlark", opt: WithStarlark(), keys: []string{"starkey"}},
+		{name: "extensions", opt: WithExtensions("yaml", "kdl"), keys: []string{"kdlkey"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []Option{WithPaths(dir)}
+			if tt.opt != nil {
+				opts = append(opts, tt.opt)
+			}
+			h, err := New(opts...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer h.Close()
+
+			want := append([]string{"yamlkey"}, tt.keys...)
+			slices.Sort(want)
+			if got := h.viper.AllKeys(); !slices.Equal(sorted(got), want) {
+				t.Errorf("keys = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestDefaultExtensions(t *testing.T) {
+	if got := supportedExtensions(); !slices.Equal(got, viper.SupportedExts) {
+		t.Errorf("supportedExtensions() = %v, want viper's %v", got, viper.SupportedExts)
+	}
+}
+
+func sorted(s []string) []string {
+	s = slices.Clone(s)
+	slices.Sort(s)
+	return s
+}
+
+// lineCodec decodes files of "key=value" lines.
+type lineCodec struct{}
+
+func (lineCodec) Decode(b []byte, v map[string]any) error {
+	for _, line := range strings.Fields(string(b)) {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("invalid line: %s", line)
+		}
+		v[key] = value
+	}
+	return nil
+}
+
+func (lineCodec) Encode(v map[string]any) ([]byte, error) {
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	var b strings.Builder
+	for _, key := range sorted(keys) {
+		fmt.Fprintf(&b, "%s=%v\n", key, v[key])
+	}
+	return []byte(b.String()), nil
+}
+
+// registerCodec registers the codec like RegisterCodec until the test ends, so the codecs
+// registered by default are restored for other tests.
+func registerCodec(t *testing.T, ext string, codec Codec) {
+	t.Helper()
+	codecsMu.Lock()
+	saved, savedExtensions, savedRegistered := maps.Clone(codecs), slices.Clone(extensions), maps.Clone(registered)
+	codecsMu.Unlock()
+	t.Cleanup(func() {
+		codecsMu.Lock()
+		defer codecsMu.Unlock()
+		codecs, extensions, registered = saved, savedExtensions, savedRegistered
+	})
+	RegisterCodec(ext, codec)
+}
+
+func TestRegisterCodec(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.hydratest"), "port=8080 host=localhost\n")
+	writeFile(t, filepath.Join(dir, "app.yaml"), "name: myapp\n")
+
+	registerCodec(t, ".HydraTest", lineCodec{})
+	if got := supportedExtensions(); !slices.Contains(got, "hydratest") {
+		t.Errorf("supportedExtensions() = %v, want hydratest", got)
+	}
+
+	h, err := New(WithPaths(dir))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+	if got, _ := Get[string](h, "port"); got != "8080" {
+		t.Errorf("port = %s, want 8080", got)
+	}
+	if got, _ := Get[string](h, "name"); got != "myapp" {
+		t.Errorf("name = %s, want myapp", got)
+	}
+
+	// extensions set by WithExtensions replace the registered ones
+	h, err = New(WithPaths(dir), WithExtensions("yaml"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+	if slices.Contains(h.viper.AllKeys(), "port") {
+		t.Error("port is set, want the registered extension skipped")
+	}
+}
+
+func TestRegisterCodecReplaces(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.yaml"), "port=8080\n")
+
+	registerCodec(t, "yaml", lineCodec{})
+	if got := supportedExtensions(); !slices.Equal(got, viper.SupportedExts) {
+		t.Errorf("supportedExtensions() = %v, want viper's %v", got, viper.SupportedExts)
+	}
+
+	h, err := New(WithPaths(dir))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+	if got, _ := Get[string](h, "port"); got != "8080" {
+		t.Errorf("port = %s, want 8080", got)
+	}
+
+	// the registered codec isn't replaced by the codec configured by the option
+	_, err = New(WithPaths(dir), WithYAMLDocuments(YAMLMergeDocuments))
+	if want := "configure codec (extension: yaml): registered by RegisterCodec"; err == nil || err.Error() != want {
+		t.Errorf("New() error = %v, want %q", err, want)
+	}
+}
+
+func TestWithExtensionAlias(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.conf"), "conf = 1\n")
+	writeFile(t, filepath.Join(dir, "b.YML.TPL"), "tpl: yaml\n")
+	writeFile(t, filepath.Join(dir, "c.tpl"), `{"tpl_json": 1}`)
+	writeFile(t, filepath.Join(dir, "d.settings"), "settings=1\n")
+
+	registerCodec(t, "hydratest", lineCodec{})
+	h, err := New(
+		WithPaths(dir),
+		WithExtensionAlias(".conf", "TOML"),
+		WithExtensionAlias("yml.tpl", "yaml"),
+		WithExtensionAlias("tpl", "json"),
+		WithExtensionAlias("settings", "hydratest"),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	// the longest alias decodes b.YML.TPL as YAML rather than JSON
+	want := []string{"conf", "settings", "tpl", "tpl_json"}
+	if got := h.viper.AllKeys(); !slices.Equal(sorted(got), want) {
+		t.Errorf("keys = %v, want %v", got, want)
+	}
+	if got, _ := Get[string](h, "tpl"); got != "yaml" {
+		t.Errorf("tpl = %s, want yaml", got)
+	}
+
+	_, err = New(WithPaths(dir), WithExtensionAlias("conf", "nope"))
+	if err == nil || !strings.HasPrefix(err.Error(), "alias extension (extension: conf, format: nope): ") {
+		t.Errorf("New() error = %v, want unsupported format", err)
+	}
+}
@@ -0,0 +1,164 @@
+package hydra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// consulWait is how long a blocking query of Consul waits for a change before it's sent again.
+const consulWait = 5 * time.Minute
+
+// ConsulConfig configures a source of configuration documents stored as keys of the Consul KV
+// store, see WithConsul.
+type ConsulConfig struct {
+	// Address of the Consul agent, e.g. "http://localhost:8500". Defaults to the
+	// CONSUL_HTTP_ADDR environment variable, or "http://127.0.0.1:8500".
+	Address string
+	// Prefix selects the keys starting with it, e.g. "myapp/config/", or a single key holding a
+	// document, e.g. "myapp/config.yaml". Names of the keys relative to the prefix are used like
+	// relative paths, see ByRelativePath, and their extensions determine their formats.
+	Prefix string
+	// Datacenter to query. Defaults to the datacenter of the agent.
+	Datacenter string
+	// Token authorizes requests. Defaults to the CONSUL_HTTP_TOKEN environment variable.
+	Token string
+	// Client sends the requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// consulSource provides the configuration documents stored as keys under a prefix.
+type consulSource struct {
+	config ConsulConfig
+}
+
+type consulKeyValue struct {
+	Key   string
+	Value []byte
+}
+
+func (s *consulSource) load(ctx context.Context, want func(rel string) bool) ([]document, error) {
+	kvs, _, err := s.get(ctx, 0)
+	if err != nil {
+		return nil, fmt.Errorf("get keys (prefix: %s): %w", s.config.Prefix, err)
+	}
+
+	var docs []document
+	for _, kv := range kvs {
+		if strings.HasSuffix(kv.Key, "/") {
+			// folder
+			continue
+		}
+
+		// keys are returned without the leading slash of the prefix
+		rel := strings.TrimPrefix(strings.TrimPrefix(kv.Key, strings.TrimPrefix(s.config.Prefix, "/")), "/")
+		if rel == "" {
+			// the prefix is the key of a single document
+			rel = path.Base(kv.Key)
+		}
+		if !want(rel) {
+			continue
+		}
+
+		docs = append(docs, document{name: "consul:" + kv.Key, rel: rel, data: kv.Value})
+	}
+	return docs, nil
+}
+
+// watch watches the keys under the prefix with blocking queries, which respond once the index
+// of the keys changes or the wait time elapses.
+func (s *consulSource) watch(ctx context.Context, changed func()) error {
+	var index uint64
+	for {
+		_, next, err := s.get(ctx, index)
+		if err != nil {
+			return fmt.Errorf("get keys (prefix: %s): %w", s.config.Prefix, err)
+		}
+
+		// changes made before the watch was started are caught up by the first query
+		if next != index {
+			changed()
+		}
+
+		// the index going backwards, e.g. by restoring a snapshot, is a change too, and blocking
+		// queries continue from the new index rather than starting over with a query notifying it
+		// again
+		index = next
+		if index == 0 {
+			// queries with index 0 don't block
+			index = 1
+		}
+	}
+}
+
+// get returns the keys under the prefix and their index. If the index is greater than 0, it's
+// a blocking query responding once the index of the keys changes.
+func (s *consulSource) get(ctx context.Context, index uint64) ([]consulKeyValue, uint64, error) {
+	address := s.config.Address
+	if address == "" {
+		address = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+	if address == "" {
+		address = "http://127.0.0.1:8500"
+	}
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+
+	query := url.Values{"recurse": {"true"}}
+	if s.config.Datacenter != "" {
+		query.Set("dc", s.config.Datacenter)
+	}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", consulWait.String())
+	}
+
+	u := strings.TrimSuffix(address, "/") + "/v1/kv/" + strings.TrimPrefix(s.config.Prefix, "/") + "?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("create request: %w", err)
+	}
+
+	token := s.config.Token
+	if token == "" {
+		token = os.Getenv("CONSUL_HTTP_TOKEN")
+	}
+	if token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+
+	client := s.config.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	next, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		// no keys under the prefix
+		return nil, next, nil
+	default:
+		return nil, 0, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var kvs []consulKeyValue
+	err = json.NewDecoder(resp.Body).Decode(&kvs)
+	if err != nil {
+		return nil, 0, fmt.Errorf("decode response: %w", err)
+	}
+	return kvs, next, nil
+}
@@ -0,0 +1,221 @@
+package hydra
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// consulTestServer is the KV API of a Consul agent, whose keys are kept by name, answering
+// blocking queries.
+type consulTestServer struct {
+	// token is the ACL token required, if set.
+	token string
+
+	mu    sync.Mutex
+	keys  map[string]string
+	index uint64
+	// changes is closed when the index changes.
+	changes chan struct{}
+}
+
+func newConsulTestServer(keys map[string]string) *consulTestServer {
+	return &consulTestServer{keys: keys, index: 10, changes: make(chan struct{})}
+}
+
+// put sets the key, or deletes it if the value is empty, and sets the index.
+func (s *consulTestServer) put(key, value string, index uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if value == "" {
+		delete(s.keys, key)
+	} else {
+		s.keys[key] = value
+	}
+	s.index = index
+	close(s.changes)
+	s.changes = make(chan struct{})
+}
+
+func (s *consulTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.token != "" && r.Header.Get("X-Consul-Token") != s.token {
+		http.Error(w, "ACL not found", http.StatusForbidden)
+		return
+	}
+	q := r.URL.Query()
+	prefix, ok := strings.CutPrefix(r.URL.Path, "/v1/kv/")
+	if !ok || q.Get("recurse") != "true" || (q.Get("dc") != "" && q.Get("dc") != "dc1") {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	if index, _ := strconv.ParseUint(q.Get("index"), 10, 64); index > 0 && index == s.index {
+		// blocking queries respond once the index changes
+		changes := s.changes
+		s.mu.Unlock()
+		select {
+		case <-changes:
+		case <-r.Context().Done():
+			return
+		}
+		s.mu.Lock()
+	}
+	defer s.mu.Unlock()
+
+	var kvs []consulKeyValue
+	for key, value := range s.keys {
+		if strings.HasPrefix(key, prefix) {
+			kvs = append(kvs, consulKeyValue{Key: key, Value: []byte(value)})
+		}
+	}
+	slices.SortFunc(kvs, func(a, b consulKeyValue) int { return strings.Compare(a.Key, b.Key) })
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(s.index, 10))
+	if len(kvs) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(kvs)
+}
+
+func TestConsulSourceLoad(t *testing.T) {
+	keys := map[string]string{
+		"myapp/":            "",
+		"myapp/app.yaml":    "port: 8080\n",
+		"myapp/db/":         "",
+		"myapp/db/db.json":  `{"host": "localhost"}`,
+		"myapp.yaml":        "single: true\n",
+		"myapp/readme.text": "ignored",
+	}
+	tests := []struct {
+		name    string
+		config  ConsulConfig
+		token   string
+		docs    []document
+		wantErr string
+	}{
+		{
+			name:   "prefix",
+			config: ConsulConfig{Prefix: "/myapp/"},
+			docs: []document{
+				{name: "consul:myapp/app.yaml", rel: "app.yaml", data: []byte("port: 8080\n")},
+				{name: "consul:myapp/db/db.json", rel: "db/db.json", data: []byte(`{"host": "localhost"}`)},
+			},
+		},
+		{
+			name:   "single key",
+			config: ConsulConfig{Prefix: "myapp.yaml", Datacenter: "dc1"},
+			docs:   []document{{name: "consul:myapp.yaml", rel: "myapp.yaml", data: []byte("single: true\n")}},
+		},
+		{
+			name:   "no keys",
+			config: ConsulConfig{Prefix: "missing/"},
+		},
+		{
+			name:   "token",
+			config: ConsulConfig{Prefix: "myapp.yaml", Token: "s3cret"},
+			token:  "s3cret",
+			docs:   []document{{name: "consul:myapp.yaml", rel: "myapp.yaml", data: []byte("single: true\n")}},
+		},
+		{
+			name:    "forbidden",
+			config:  ConsulConfig{Prefix: "myapp/", Token: "wrong"},
+			token:   "s3cret",
+			wantErr: "get keys (prefix: myapp/): unexpected status: 403 Forbidden",
+		},
+		{
+			name:    "unknown datacenter",
+			config:  ConsulConfig{Prefix: "myapp/", Datacenter: "dc2"},
+			wantErr: "get keys (prefix: myapp/): unexpected status: 400 Bad Request",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newConsulTestServer(keys)
+			server.token = tt.token
+			srv := httptest.NewServer(server)
+			defer srv.Close()
+
+			// addresses default to the environment
+			t.Setenv("CONSUL_HTTP_ADDR", strings.TrimPrefix(srv.URL, "http://"))
+			tt.config.Client = srv.Client()
+			docs, err := (&consulSource{config: tt.config}).load(context.Background(), func(rel string) bool { return !strings.HasSuffix(rel, ".text") })
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("load() error = %v", err)
+			}
+			if !reflect.DeepEqual(docs, tt.docs) {
+				t.Errorf("load() = %+v, want %+v", docs, tt.docs)
+			}
+		})
+	}
+}
+
+func TestConsulSourceWatch(t *testing.T) {
+	server := newConsulTestServer(map[string]string{"myapp/app.yaml": "port: 8080\n"})
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var changes atomic.Int32
+	done := make(chan error)
+	go func() {
+		src := &consulSource{config: ConsulConfig{Address: srv.URL, Prefix: "myapp/", Client: srv.Client()}}
+		done <- src.watch(ctx, func() { changes.Add(1) })
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	// the first query catches up on changes made before
+	eventually(t, "watch started", func() bool { return changes.Load() == 1 })
+	steps := []struct {
+		value string
+		index uint64
+	}{
+		{value: "port: 9090\n", index: 11},
+		{value: "port: 9091\n", index: 12},
+		// the index going backwards, e.g. by restoring a snapshot, starts over
+		{value: "port: 9092\n", index: 5},
+		{value: "port: 9093\n", index: 6},
+	}
+	for i, step := range steps {
+		server.put("myapp/app.yaml", step.value, step.index)
+		eventually(t, "change "+strconv.Itoa(i), func() bool { return changes.Load() == int32(i+2) })
+	}
+}
+
+func TestWithConsul(t *testing.T) {
+	server := newConsulTestServer(map[string]string{"myapp/app.yaml": "port: 8080\n"})
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	h, err := New(WithConsul(ConsulConfig{Address: srv.URL, Prefix: "myapp/", Client: srv.Client()}), WithAutoReload())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got, _ := Get[int](h, "port"); got != 8080 {
+		t.Fatalf("port = %d, want 8080", got)
+	}
+	start(t, h)
+
+	server.put("myapp/app.yaml", "port: 9090\n", 11)
+	eventually(t, "port 9090", func() bool {
+		got, _ := Get[int](h, "port")
+		return got == 9090
+	})
+}
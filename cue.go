@@ -0,0 +1,115 @@
+package hydra
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	cueerrors "cuelang.org/go/cue/errors"
+)
+
+// cueCodec decodes CUE files by evaluating them in-process, exporting their concrete values,
+// so constraints of the files are checked. Files failing evaluation, e.g. with conflicting or
+// incomplete values, fail to decode with the errors reported by CUE. Since .cue files next to
+// configuration files are often schemas, they're only found with WithCUE.
+type cueCodec struct{}
+
+func (cueCodec) Decode(b []byte, v map[string]any) error {
+	// a context isn't safe for concurrent use, and values of one keep growing its memory
+	value := cuecontext.New().CompileBytes(b)
+	err := value.Validate(cue.Concrete(true))
+	if err != nil {
+		return fmt.Errorf("evaluate: %w", cueError(err))
+	}
+
+	var settings map[string]any
+	err = value.Decode(&settings)
+	if err != nil {
+		return fmt.Errorf("decode exported value: %w", cueError(err))
+	}
+	for key, value := range settings {
+		v[key] = value
+	}
+	return nil
+}
+
+func (cueCodec) Encode(v map[string]any) ([]byte, error) {
+	// JSON is valid CUE
+	return json.MarshalIndent(v, "", "  ")
+}
+
+// cueError returns the errors of CUE prefixed with the position of the first one, e.g.
+// "line 2, column 4: a: conflicting values 2 and 1".
+func cueError(err error) error {
+	errs := cueerrors.Errors(err)
+	if len(errs) == 0 {
+		return err
+	}
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	msg := strings.Join(msgs, "; ")
+	for _, e := range errs {
+		for _, pos := range cueerrors.Positions(e) {
+			if pos.Line() > 0 {
+				return fmt.Errorf("line %d, column %d: %s", pos.Line(), pos.Column(), msg)
+			}
+		}
+	}
+	return errors.New(msg)
+}
+
+// cueSchemaFile is the name positions in the schema set by WithCUESchema are reported with.
+const cueSchemaFile = "schema.cue"
+
+// compileCUESchema compiles the CUE schema set by WithCUESchema, so invalid schemas fail New.
+func compileCUESchema(schema []byte) error {
+	value := cuecontext.New().CompileBytes(schema, cue.Filename(cueSchemaFile))
+	if value.Err() != nil {
+		return cueError(value.Err())
+	}
+	return nil
+}
+
+// unifyCUESchema unifies the settings with the CUE schema set by WithCUESchema, returning the
+// exported value with the defaults of the schema filled in.
+func unifyCUESchema(schema []byte, settings map[string]any) (map[string]any, error) {
+	ctx := cuecontext.New()
+	value := ctx.CompileBytes(schema, cue.Filename(cueSchemaFile)).Unify(ctx.Encode(settings))
+	err := value.Validate(cue.Concrete(true))
+	if err != nil {
+		return nil, fmt.Errorf("config doesn't unify with cue schema: %s", cueSchemaError(err))
+	}
+
+	var unified map[string]any
+	err = value.Decode(&unified)
+	if err != nil {
+		return nil, fmt.Errorf("decode exported value: %w", cueError(err))
+	}
+	return toLowerKeys(unified), nil
+}
+
+// cueSchemaError returns the errors of unifying the settings with the schema, with the
+// positions in the schema, e.g. "port: invalid value 80 (out of bound >1024) (schema line 1,
+// column 7)". Settings are encoded without positions.
+func cueSchemaError(err error) string {
+	var msgs []string
+	for _, e := range cueerrors.Errors(err) {
+		msg := e.Error()
+		for _, pos := range cueerrors.Positions(e) {
+			if pos.Filename() == cueSchemaFile && pos.Line() > 0 {
+				msg += fmt.Sprintf(" (schema line %d, column %d)", pos.Line(), pos.Column())
+				break
+			}
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) == 0 {
+		return err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
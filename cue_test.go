@@ -0,0 +1,243 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCUECodecDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]any
+	}{
+		{
+			name: "values",
+			in:   "server: {\n\thost: \"localhost\"\n\tport: 8080\n}\ndebug: true\n",
+			want: map[string]any{
+				"server": map[string]any{"host": "localhost", "port": 8080},
+				"debug":  true,
+			},
+		},
+		{
+			name: "defaults and constraints",
+			in:   "port: int & >1024 | *8080\nname: string | *\"app\"\n",
+			want: map[string]any{"port": 8080, "name": "app"},
+		},
+		{
+			name: "references and lists",
+			in:   "base: \"/srv\"\npaths: [base + \"/a\", base + \"/b\"]\n",
+			want: map[string]any{"base": "/srv", "paths": []any{"/srv/a", "/srv/b"}},
+		},
+		{
+			name: "hidden fields",
+			in:   "_tmp: 1\nx: _tmp + 1\n",
+			want: map[string]any{"x": 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]any{}
+			err := cueCodec{}.Decode([]byte(tt.in), got)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCUECodecDecodeError(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		line   int
+		column int
+	}{
+		{name: "syntax", in: "a: 1\nb: {\n", line: 2, column: 6},
+		{name: "conflict", in: "a: 1\na: 2\n", line: 1, column: 4},
+		{name: "incomplete", in: "a: 1\nb: int\n", line: 2, column: 4},
+		{name: "constraint", in: "port: >1024\nport: 80\n", line: 1, column: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := cueCodec{}.Decode([]byte(tt.in), map[string]any{})
+			if err == nil {
+				t.Fatal("Decode() error = nil")
+			}
+			line, column := errorPosition(err, []byte(tt.in))
+			if line != tt.line || column != tt.column {
+				t.Errorf("position of %q = %d:%d, want %d:%d", err, line, column, tt.line, tt.column)
+			}
+		})
+	}
+}
+
+func TestCUECodecRoundTrip(t *testing.T) {
+	in := map[string]any{"server": map[string]any{"port": 8080, "hosts": []any{"a", "b"}}}
+	b, err := cueCodec{}.Encode(in)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	got := map[string]any{}
+	err = cueCodec{}.Decode(b, got)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, in) {
+		t.Errorf("Decode(Encode()) = %v, want %v", got, in)
+	}
+}
+
+func TestWithCUE(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{name: "default", want: []string{"app.yaml"}},
+		{name: "opt-in", opts: []Option{WithCUE()}, want: []string{"app.yaml", "schema.cue"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, filepath.Join(dir, "app.yaml"), "port: 8080\n")
+			// a schema, not a concrete configuration
+			writeFile(t, filepath.Join(dir, "schema.cue"), "port: int\n")
+
+			h, err := New(append([]Option{WithPaths(dir)}, tt.opts...)...)
+			if tt.opts == nil {
+				if err != nil {
+					t.Fatalf("New() error = %v", err)
+				}
+				defer h.Close()
+				if got := baseNames(h.ConfigFiles()); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("ConfigFiles() = %v, want %v", got, tt.want)
+				}
+				return
+			}
+			// the incomplete schema fails to evaluate once CUE files are found
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) || filepath.Base(parseErr.File) != "schema.cue" {
+				t.Errorf("New() error = %v, want parse error of schema.cue", err)
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path, []byte(data), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func baseNames(paths []string) []string {
+	names := make([]string, len(paths))
+	for i, path := range paths {
+		names[i] = filepath.Base(path)
+	}
+	return names
+}
+
+func TestWithCUESchema(t *testing.T) {
+	schema := []byte("port: int & >1024 | *8080\nhost: string\n")
+	tests := []struct {
+		name    string
+		config  string
+		want    map[string]any
+		wantErr string
+	}{
+		{
+			name:   "defaults",
+			config: "host: localhost\n",
+			want:   map[string]any{"host": "localhost", "port": 8080},
+		},
+		{
+			name:   "values",
+			config: "host: localhost\nport: 9090\n",
+			want:   map[string]any{"host": "localhost", "port": 9090},
+		},
+		{
+			name:    "constraint",
+			config:  "host: localhost\nport: 80\n",
+			wantErr: "config doesn't unify with cue schema: port: 2 errors in empty disjunction:",
+		},
+		{
+			name:    "incomplete",
+			config:  "port: 9090\n",
+			wantErr: "config doesn't unify with cue schema: host: incomplete value string (schema line 2, column 7)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, filepath.Join(dir, "app.yaml"), tt.config)
+
+			h, err := New(WithPaths(dir), WithCUESchema(schema))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("New() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer h.Close()
+			for key, want := range tt.want {
+				got, err := Get[any](h, key)
+				if err != nil || got != want {
+					t.Errorf("Get(%s) = %v, %v, want %v", key, got, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWithCUESchemaInvalid(t *testing.T) {
+	_, err := New(WithPaths(t.TempDir()), WithCUESchema([]byte("port: int &\n")))
+	if err == nil || !strings.HasPrefix(err.Error(), "compile cue schema: line ") {
+		t.Errorf("New() error = %v, want compile error with position", err)
+	}
+}
+
+func TestWithCUESchemaReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yaml")
+	writeFile(t, path, "port: 9090\n")
+	h, err := New(WithPaths(dir), WithCUESchema([]byte("port: int & >1024\n")))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	writeFile(t, path, "port: 80\n")
+	var reloadErr *ReloadError
+	if err := h.Reload(context.Background()); !errors.As(err, &reloadErr) {
+		t.Fatalf("Reload() error = %v, want ReloadError", err)
+	}
+	if got, _ := Get[int](h, "port"); got != 9090 {
+		t.Errorf("port after rejected reload = %d, want 9090", got)
+	}
+
+	writeFile(t, path, "port: 8443\n")
+	if err := h.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if got, _ := Get[int](h, "port"); got != 8443 {
+		t.Errorf("port after reload = %d, want 8443", got)
+	}
+}
@@ -0,0 +1,99 @@
+package hydra
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// debouncer coalesces bursts of events per file. Operations of events received for the same
+// file within the debounce window are combined and released once the window closes.
+type debouncer struct {
+	delay   time.Duration
+	timer   *time.Timer
+	pending map[string]*pendingEvent
+}
+
+type pendingEvent struct {
+	op       fsnotify.Op
+	deadline time.Time
+}
+
+func newDebouncer(delay time.Duration) *debouncer {
+	t := time.NewTimer(delay)
+	t.Stop()
+
+	return &debouncer{
+		delay:   delay,
+		timer:   t,
+		pending: make(map[string]*pendingEvent),
+	}
+}
+
+// C returns the channel that is signaled when some pending events are due.
+func (d *debouncer) C() <-chan time.Time {
+	return d.timer.C
+}
+
+// add records the event and (re)starts the debounce window of its file.
+func (d *debouncer) add(ev fsnotify.Event) {
+	p, ok := d.pending[ev.Name]
+	if !ok {
+		p = &pendingEvent{}
+		d.pending[ev.Name] = p
+	}
+	p.op |= ev.Op
+	p.deadline = time.Now().Add(d.delay)
+
+	d.schedule()
+}
+
+// has reports whether an event for the file is pending.
+func (d *debouncer) has(name string) bool {
+	_, ok := d.pending[name]
+	return ok
+}
+
+// flush returns coalesced events whose debounce window has closed.
+func (d *debouncer) flush() []fsnotify.Event {
+	now := time.Now()
+
+	var due []fsnotify.Event
+	for name, p := range d.pending {
+		if p.deadline.After(now) {
+			continue
+		}
+		due = append(due, fsnotify.Event{Name: name, Op: p.op})
+		delete(d.pending, name)
+	}
+
+	slices.SortFunc(due, func(a, b fsnotify.Event) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	d.schedule()
+	return due
+}
+
+// schedule arms the timer for the earliest pending deadline.
+func (d *debouncer) schedule() {
+	d.timer.Stop()
+
+	var next time.Time
+	for _, p := range d.pending {
+		if next.IsZero() || p.deadline.Before(next) {
+			next = p.deadline
+		}
+	}
+	if next.IsZero() {
+		return
+	}
+
+	d.timer.Reset(time.Until(next))
+}
+
+func (d *debouncer) stop() {
+	d.timer.Stop()
+}
@@ -0,0 +1,157 @@
+package hydra
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/philandstuff/dhall-golang/v6"
+)
+
+// dhallCodec decodes Dhall expressions by type checking and normalizing them in-process.
+// Expressions failing to type check fail to decode with the errors reported by Dhall, which are
+// reported as ReloadError like other files failing to decode. Imports of relative paths are
+// resolved relative to the working directory.
+type dhallCodec struct{}
+
+// dhallSyntaxError matches syntax errors of dhall-golang, e.g.
+// `-:2:6 (14): no match found, expected: "(", ...`, whose list of expected tokens is dropped.
+var dhallSyntaxError = regexp.MustCompile(`^-:(\d+):(\d+) \(\d+\): ([^,]*)`)
+
+func (dhallCodec) Decode(b []byte, v map[string]any) error {
+	var value any
+	err := dhall.Unmarshal(b, &value)
+	if m := dhallSyntaxError.FindStringSubmatch(fmt.Sprint(err)); m != nil {
+		return fmt.Errorf("normalize: line %s, column %s: %s", m[1], m[2], m[3])
+	}
+	if err != nil {
+		return fmt.Errorf("normalize: %w", err)
+	}
+
+	settings, ok := value.(map[string]any)
+	if !ok {
+		return fmt.Errorf("decode normalized expression: %v is not a record", value)
+	}
+	for key, value := range settings {
+		v[key] = value
+	}
+	return nil
+}
+
+func (dhallCodec) Encode(v map[string]any) ([]byte, error) {
+	var b strings.Builder
+	err := encodeDhall(&b, v)
+	if err != nil {
+		return nil, err
+	}
+	b.WriteByte('\n')
+	return []byte(b.String()), nil
+}
+
+// dhallKeywords are the keywords and builtins of Dhall which labels are quoted as.
+var dhallKeywords = []string{
+	"if", "then", "else", "let", "in", "as", "using", "merge", "missing", "Infinity", "NaN",
+	"Some", "None", "toMap", "assert", "forall", "with", "showConstructor",
+}
+
+// dhallLabel matches labels of records which needn't be quoted.
+var dhallLabel = regexp.MustCompile(`^[a-z_][A-Za-z0-9_/-]*$`)
+
+// encodeDhall writes the value as a Dhall expression. Records are written as record literals,
+// lists as list literals and numbers as Natural, Integer or Double literals.
+func encodeDhall(b *strings.Builder, v any) error {
+	switch v := v.(type) {
+	case map[string]any:
+		if len(v) == 0 {
+			b.WriteString("{=}")
+			return nil
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		b.WriteString("{ ")
+		for i, key := range keys {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			if dhallLabel.MatchString(key) && !slices.Contains(dhallKeywords, key) {
+				b.WriteString(key)
+			} else if !strings.Contains(key, "`") {
+				b.WriteString("`" + key + "`")
+			} else {
+				return fmt.Errorf("encode key %q: not a dhall label", key)
+			}
+			b.WriteString(" = ")
+			err := encodeDhall(b, v[key])
+			if err != nil {
+				return err
+			}
+		}
+		b.WriteString(" }")
+	case []any:
+		if len(v) == 0 {
+			// the element type of empty lists is lost on decoding
+			b.WriteString("[] : List {}")
+			return nil
+		}
+		b.WriteString("[ ")
+		for i, elem := range v {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			err := encodeDhall(b, elem)
+			if err != nil {
+				return err
+			}
+		}
+		b.WriteString(" ]")
+	case string:
+		s, _ := json.Marshal(v)
+		// interpolations are escaped
+		b.WriteString(strings.ReplaceAll(string(s), "${", `\${`))
+	case bool:
+		if v {
+			b.WriteString("True")
+		} else {
+			b.WriteString("False")
+		}
+	case nil:
+		return errors.New("encode null: dhall has no null")
+	default:
+		rv := reflect.ValueOf(v)
+		switch {
+		case rv.CanInt():
+			// non-negative integers are Naturals, negative ones Integers
+			b.WriteString(strconv.FormatInt(rv.Int(), 10))
+		case rv.CanUint():
+			b.WriteString(strconv.FormatUint(rv.Uint(), 10))
+		case rv.CanFloat():
+			f := rv.Float()
+			switch {
+			case math.IsNaN(f):
+				b.WriteString("NaN")
+			case math.IsInf(f, 1):
+				b.WriteString("Infinity")
+			case math.IsInf(f, -1):
+				b.WriteString("-Infinity")
+			default:
+				s := strconv.FormatFloat(f, 'g', -1, 64)
+				if !strings.ContainsAny(s, ".e") {
+					s += ".0"
+				}
+				b.WriteString(s)
+			}
+		default:
+			return fmt.Errorf("encode %T: unsupported type", v)
+		}
+	}
+	return nil
+}
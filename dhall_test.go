@@ -0,0 +1,106 @@
+package hydra
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDhallCodecDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]any
+	}{
+		{
+			name: "literals",
+			in:   `{ port = 8080, offset = -2, ratio = 1.5, name = "app", debug = True }`,
+			want: map[string]any{"port": 8080, "offset": -2, "ratio": 1.5, "name": "app", "debug": true},
+		},
+		{
+			name: "nested and lists",
+			in:   `{ server = { hosts = [ "a", "b" ], tags = [] : List Text } }`,
+			want: map[string]any{"server": map[string]any{"hosts": []any{"a", "b"}, "tags": []any{}}},
+		},
+		{
+			name: "let and functions",
+			in:   "let port = \\(n : Natural) -> n + 8000\nin { http = port 80, https = port 443 }",
+			want: map[string]any{"http": 8080, "https": 8443},
+		},
+		{
+			name: "optionals",
+			in:   `{ some = Some 1, none = None Natural }`,
+			want: map[string]any{"some": 1, "none": nil},
+		},
+		{
+			name: "interpolation",
+			in:   "let host = \"localhost\" in { url = \"http://${host}:8080\" }",
+			want: map[string]any{"url": "http://localhost:8080"},
+		},
+		{
+			name: "maps",
+			in:   `{ env = toMap { HOME = "/root" } }`,
+			want: map[string]any{"env": map[string]any{"HOME": "/root"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]any{}
+			err := dhallCodec{}.Decode([]byte(tt.in), got)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDhallCodecDecodeError(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		wantErr string
+		line    int
+		column  int
+	}{
+		{name: "syntax", in: "{ a = 1,\n  b = }", wantErr: "normalize: line 2, column 7: no match found", line: 2, column: 7},
+		{name: "type", in: "{ a = 1 + True }", wantErr: "normalize: ❰+❱ only works on ❰Natural❱s"},
+		{name: "not a record", in: "[ 1, 2 ]", wantErr: "decode normalized expression: [1 2] is not a record"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := dhallCodec{}.Decode([]byte(tt.in), map[string]any{})
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("Decode() error = %v, want %q", err, tt.wantErr)
+			}
+			line, column := errorPosition(err, []byte(tt.in))
+			if line != tt.line || column != tt.column {
+				t.Errorf("position = %d:%d, want %d:%d", line, column, tt.line, tt.column)
+			}
+		})
+	}
+}
+
+func TestDhallCodecRoundTrip(t *testing.T) {
+	in := map[string]any{
+		"server": map[string]any{"port": 8080, "hosts": []any{"a", "b"}, "empty": map[string]any{}},
+		"offset": -2,
+		"ratio":  2.0,
+		"motd":   "costs ${price}\n\t\"quoted\"",
+		"if":     true,
+		"a b":    []any{},
+	}
+	b, err := dhallCodec{}.Encode(in)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	got := map[string]any{}
+	err = dhallCodec{}.Decode(b, got)
+	if err != nil {
+		t.Fatalf("Decode(%s) error = %v", b, err)
+	}
+	if !reflect.DeepEqual(got, in) {
+		t.Errorf("Decode(Encode()) = %#v, want %#v", got, in)
+	}
+}
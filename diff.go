@@ -0,0 +1,53 @@
+package hydra
+
+import "reflect"
+
+// diff compares two configuration trees and returns added, removed and modified keys.
+func diff(from, to map[string]any) (added, removed map[string]any, modified map[string]Values) {
+	before := flatten(from)
+	after := flatten(to)
+
+	added = make(map[string]any)
+	removed = make(map[string]any)
+	modified = make(map[string]Values)
+
+	for key, value := range after {
+		prev, ok := before[key]
+		if !ok {
+			added[key] = value
+			continue
+		}
+		if !reflect.DeepEqual(prev, value) {
+			modified[key] = Values{Old: prev, New: value}
+		}
+	}
+
+	for key, value := range before {
+		if _, ok := after[key]; !ok {
+			removed[key] = value
+		}
+	}
+
+	return added, removed, modified
+}
+
+// flatten converts a nested configuration tree into a map of dot delimited keys and leaf values.
+func flatten(m map[string]any) map[string]any {
+	out := make(map[string]any)
+	flattenInto(out, "", m)
+	return out
+}
+
+func flattenInto(out map[string]any, prefix string, m map[string]any) {
+	for key, value := range m {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		if sub, ok := value.(map[string]any); ok && len(sub) > 0 {
+			flattenInto(out, key, sub)
+			continue
+		}
+		out[key] = value
+	}
+}
@@ -0,0 +1,137 @@
+package hydra
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// DotEnvMode decides how the entries of .env files are exposed, see WithDotEnv.
+type DotEnvMode int
+
+const (
+	// DotEnvKeys merges the entries of .env files as keys like other configuration files, e.g.
+	// "DATABASE_URL" as "database_url".
+	DotEnvKeys DotEnvMode = iota
+	// DotEnvEnvironment sets the entries of .env files as environment variables bound to viper,
+	// so they take precedence over configuration files like other environment variables, see
+	// EnvPrecedence. Entries are merged as keys as well, so their changes are notified.
+	// Variables set in the environment of the process take precedence over entries, and
+	// entries removed from .env files are unset.
+	DotEnvEnvironment
+)
+
+// envEntry is an entry of a .env file.
+type envEntry struct {
+	// key is the key of the entry in the merged configuration, e.g. "database_url".
+	key   string
+	value string
+}
+
+// isDotEnv reports whether the format is the format of .env files.
+func isDotEnv(format string) bool {
+	return format == "env" || format == "dotenv"
+}
+
+// configExt returns the extension of the configuration file determining its format, e.g.
+// "yaml" for "app.yaml". Variants of .env files like ".env.local" or ".env.production" are
+// .env files, unless their extensions are supported formats themselves.
+func (h *Hydra) configExt(name string) string {
+	base := filepath.Base(name)
+	if alias, ok := h.extensionAlias(base); ok {
+		return alias
+	}
+	ext := strings.TrimPrefix(filepath.Ext(base), ".")
+	if slices.Contains(h.options.supportedExtensions, ext) {
+		return ext
+	}
+	if strings.HasPrefix(base, ".env.") && slices.Contains(h.options.supportedExtensions, "env") {
+		return "env"
+	}
+	return ext
+}
+
+// extensionAlias returns the longest extension of the file name aliased by WithExtensionAlias,
+// e.g. "yml.tpl" for "app.yml.tpl".
+func (h *Hydra) extensionAlias(base string) (string, bool) {
+	lower := strings.ToLower(base)
+	alias := ""
+	for ext := range h.options.extensionAliases {
+		if len(ext) > len(alias) && len(lower) > len(ext)+1 && strings.HasSuffix(lower, "."+ext) {
+			alias = ext
+		}
+	}
+	return alias, alias != ""
+}
+
+// trimConfigExt returns the name of the configuration file without the extension determining
+// its format, which is empty for variants of .env files, see configExt.
+func (h *Hydra) trimConfigExt(name string) string {
+	if alias, ok := h.extensionAlias(filepath.Base(name)); ok {
+		return name[:len(name)-len(alias)-1]
+	}
+	ext := filepath.Ext(name)
+	if h.configExt(name) == "env" && !strings.EqualFold(ext, ".env") {
+		return strings.TrimSuffix(name, filepath.Base(name))
+	}
+	return strings.TrimSuffix(name, ext)
+}
+
+// envEntries returns the entries of the .env file by their names, whose keys are kept in the
+// layer, see DotEnvEnvironment.
+func (h *Hydra) envEntries(path string, settings map[string]any, l *layer) map[string]envEntry {
+	flat := flatten(l.settings)
+	prefix := slices.Concat(h.keyPrefix(), h.namespace(path))
+
+	entries := make(map[string]envEntry, len(settings))
+	for name, value := range settings {
+		key := strings.Join(append(slices.Clip(prefix), strings.ToLower(name)), ".")
+		if _, ok := flat[key]; !ok {
+			// filtered, see OnlyKeys
+			continue
+		}
+		entries[name] = envEntry{key: key, value: cast.ToString(value)}
+	}
+	return entries
+}
+
+// applyDotEnv sets the entries of the .env files of the staged configuration as environment
+// variables bound to viper, see DotEnvEnvironment. Variables set for entries that are gone are
+// unset.
+func (h *Hydra) applyDotEnv(st *staged) error {
+	entries := make(map[string]envEntry)
+	for _, path := range h.mergeOrder(st.files) {
+		// entries of files merged later take precedence
+		for name, e := range st.layers[path].env {
+			entries[name] = e
+		}
+	}
+
+	for name := range h.dotEnv {
+		if _, ok := entries[name]; !ok {
+			os.Unsetenv(name)
+			delete(h.dotEnv, name)
+		}
+	}
+	for name, e := range entries {
+		err := h.viper.BindEnv(e.key, name)
+		if err != nil {
+			return fmt.Errorf("bind environment variable (name: %s): %w", name, err)
+		}
+		if _, ok := os.LookupEnv(name); ok && !h.dotEnv[name] {
+			// set in the environment of the process
+			continue
+		}
+
+		err = os.Setenv(name, e.value)
+		if err != nil {
+			return fmt.Errorf("set environment variable (name: %s): %w", name, err)
+		}
+		h.dotEnv[name] = true
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package hydra
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDotEnvFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  map[string]any
+	}{
+		{
+			name:  "env",
+			files: map[string]string{".env": "DATABASE_URL=postgres://db\n# comment\nexport PORT=8080\n"},
+			want:  map[string]any{"database_url": "postgres://db", "port": "8080"},
+		},
+		{
+			name: "variants",
+			files: map[string]string{
+				".env":            "NAME=app\nPORT=8080\n",
+				".env.local":      "PORT=9090\n",
+				".env.production": "LEVEL=warn\n",
+			},
+			want: map[string]any{"name": "app", "port": "9090", "level": "warn"},
+		},
+		{
+			name: "quoted values",
+			files: map[string]string{
+				"app.env": "A=\"double \\\"quoted\\\"\"\nB='single'\nC=unquoted # comment\n",
+			},
+			want: map[string]any{"a": "double \"quoted\"", "b": "single", "c": "unquoted"},
+		},
+		{
+			name:  "supported extension of variant",
+			files: map[string]string{".env.yaml": "server:\n  port: 8080\n"},
+			want:  map[string]any{"server.port": 8080},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, data := range tt.files {
+				writeFile(t, filepath.Join(dir, name), data)
+			}
+			h, err := New(WithPaths(dir))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer h.Close()
+			for key, want := range tt.want {
+				if got, err := Get[any](h, key); err != nil || got != want {
+					t.Errorf("Get(%s) = %v, %v, want %v", key, got, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDotEnvEnvironment(t *testing.T) {
+	t.Setenv("HYDRA_TEST_SET", "process")
+	for _, name := range []string{"HYDRA_TEST_PORT", "HYDRA_TEST_NAME"} {
+		t.Cleanup(func() { os.Unsetenv(name) })
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".env")
+	writeFile(t, filepath.Join(dir, "app.yaml"), "hydra_test_port: 1\n")
+	writeFile(t, path, "HYDRA_TEST_PORT=8080\nHYDRA_TEST_NAME=app\nHYDRA_TEST_SET=file\n")
+	h, err := New(WithPaths(dir), WithDotEnv(DotEnvEnvironment))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	steps := []struct {
+		env     string
+		wantErr bool
+		want    map[string]string
+		unset   []string
+	}{
+		{
+			env:  "HYDRA_TEST_PORT=8080\nHYDRA_TEST_NAME=app\nHYDRA_TEST_SET=file\n",
+			want: map[string]string{"HYDRA_TEST_PORT": "8080", "HYDRA_TEST_NAME": "app", "HYDRA_TEST_SET": "process"},
+		},
+		{
+			env:   "HYDRA_TEST_PORT=9090\n",
+			want:  map[string]string{"HYDRA_TEST_PORT": "9090", "HYDRA_TEST_SET": "process"},
+			unset: []string{"HYDRA_TEST_NAME"},
+		},
+		{
+			env:     "HYDRA_TEST_PORT='unterminated\n",
+			wantErr: true,
+			want:    map[string]string{"HYDRA_TEST_PORT": "9090", "HYDRA_TEST_SET": "process"},
+			unset:   []string{"HYDRA_TEST_NAME"},
+		},
+		{
+			env:  "HYDRA_TEST_NAME=again\n",
+			want: map[string]string{"HYDRA_TEST_NAME": "again", "HYDRA_TEST_SET": "process"},
+			// the key of the entry is set by app.yaml again
+			unset: []string{"HYDRA_TEST_PORT"},
+		},
+	}
+	for i, step := range steps {
+		if i > 0 {
+			writeFile(t, path, step.env)
+			err := h.Reload(context.Background())
+			if (err != nil) != step.wantErr {
+				t.Fatalf("step %d: Reload() error = %v, want error %t", i, err, step.wantErr)
+			}
+		}
+		for name, want := range step.want {
+			if got := os.Getenv(name); got != want {
+				t.Errorf("step %d: %s = %q, want %q", i, name, got, want)
+			}
+		}
+		if port, ok := step.want["HYDRA_TEST_PORT"]; ok {
+			if got, err := Get[string](h, "hydra_test_port"); err != nil || got != port {
+				t.Errorf("step %d: Get(hydra_test_port) = %v, %v, want %s", i, got, err, port)
+			}
+		}
+		for _, name := range step.unset {
+			if got, ok := os.LookupEnv(name); ok {
+				t.Errorf("step %d: %s = %q, want unset", i, name, got)
+			}
+		}
+	}
+	if got, err := Get[int](h, "hydra_test_port"); err != nil || got != 1 {
+		t.Errorf("Get(hydra_test_port) = %v, %v, want 1 of app.yaml", got, err)
+	}
+	if got, err := Get[string](h, "hydra_test_set"); err != nil || got != "process" {
+		t.Errorf("Get(hydra_test_set) = %v, %v, want process", got, err)
+	}
+}
@@ -0,0 +1,70 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// drift walks all paths again and compares the configuration files found in them with their
+// last known state. It returns synthesized events for files that were created, written or
+// removed in the meantime, e.g. while events were lost, sorted in the load order.
+func (h *Hydra) drift(ctx context.Context) ([]fsnotify.Event, error) {
+	_, layers := h.state()
+
+	var events []fsnotify.Event
+	seen := make(map[string]bool)
+	for _, root := range h.options.paths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// directories created while events were lost aren't watched yet
+		found, err := h.watchPath(ctx, root)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("walk path (path: %s): %w", root, err)
+		}
+
+		for _, path := range found {
+			sum, err := h.checksum(path)
+			if errors.Is(err, os.ErrNotExist) {
+				// file was removed while walking, which is handled as not found
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("checksum config file (path: %s): %w", path, err)
+			}
+			seen[path] = true
+
+			l, ok := layers[path]
+			switch {
+			case !ok:
+				events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Create})
+			case l.sum != sum:
+				events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Write})
+			}
+		}
+	}
+
+	for path := range layers {
+		if _, ok := h.document(path); ok {
+			// documents of sources aren't found in the paths
+			continue
+		}
+		if !seen[path] {
+			events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Remove})
+		}
+	}
+
+	slices.SortFunc(events, func(a, b fsnotify.Event) int {
+		return h.compareLoadOrder(a.Name, b.Name)
+	})
+	return events, nil
+}
@@ -0,0 +1,63 @@
+package hydra
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ValidationReport is the aggregated result of Validate and DryRun, listing all errors of the
+// configuration rather than the first one.
+type ValidationReport struct {
+	// Files are the paths of the merged configuration files in load order.
+	Files []string
+	Errs  []error
+}
+
+func (r *ValidationReport) Error() string {
+	msgs := make([]string, len(r.Errs))
+	for i, err := range r.Errs {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("invalid config (files: %d): %s", len(r.Files), strings.Join(msgs, "; "))
+}
+
+func (r *ValidationReport) Unwrap() []error {
+	return r.Errs
+}
+
+// Validate walks all paths again, loads all sources again, reads and merges all configuration
+// files found in them and runs all checks of a reload on the result, without changing the
+// configuration. It returns nil if a reload would succeed, or a ValidationReport with all
+// failed checks, e.g. in pre-deploy checks using the same code path as a reload.
+func (h *Hydra) Validate(ctx context.Context) error {
+	h.reloadMu.Lock()
+	defer h.reloadMu.Unlock()
+
+	st, err := h.stageScan(ctx)
+	defer h.unstage()
+	if err != nil {
+		return &ValidationReport{Errs: []error{err}}
+	}
+	return h.report(st)
+}
+
+// DryRun loads the configuration like NewWithContext and runs all checks of the initial load on
+// it, without changing the viper instance set by WithViper or watching the paths. It returns nil
+// if NewWithContext would succeed, or a ValidationReport with all failed checks, e.g. to check
+// configuration files in CI pipelines.
+func DryRun(ctx context.Context, opts ...Option) error {
+	_, err := NewWithContext(ctx, append(opts, func(o *options) {
+		o.dryRun = true
+	})...)
+	return err
+}
+
+// report runs all checks on the staged configuration, returning a ValidationReport if any fails.
+func (h *Hydra) report(st *staged) error {
+	errs := h.check(st, true)
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ValidationReport{Files: st.files, Errs: errs}
+}
@@ -0,0 +1,123 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		change   string
+		wantErrs int
+	}{
+		{name: "valid", change: "port: 9090\nhost: b\n"},
+		{name: "parse error", change: "port: [\n", wantErrs: 1},
+		{
+			name: "all errors",
+			opts: []Option{
+				WithRequiredKeys("name"),
+				WithValidator(func(s Snapshot) error {
+					if s.Get("port") != 8080 {
+						return errors.New("port changed")
+					}
+					return nil
+				}),
+			},
+			change:   "port: 9090\n",
+			wantErrs: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "app.yaml")
+			writeFile(t, path, "port: 8080\nhost: a\nname: app\ndb:\n  host: db\n")
+			h, err := New(append([]Option{WithPaths(dir)}, tt.opts...)...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer h.Close()
+
+			writeFile(t, path, tt.change)
+			err = h.Validate(context.Background())
+			var report *ValidationReport
+			switch {
+			case tt.wantErrs == 0 && err != nil:
+				t.Errorf("Validate() error = %v", err)
+			case tt.wantErrs > 0 && (!errors.As(err, &report) || len(report.Errs) != tt.wantErrs):
+				t.Errorf("Validate() error = %v, want %d errors", err, tt.wantErrs)
+			}
+			// the configuration isn't changed
+			if got, _ := Get[int](h, "port"); got != 8080 {
+				t.Errorf("port after Validate() = %d, want 8080", got)
+			}
+		})
+	}
+}
+
+// TestValidatePolledSource checks that a change of a polled source seen by Validate is still
+// reloaded, since Validate doesn't commit the documents it loads.
+func TestValidatePolledSource(t *testing.T) {
+	src := newMemSource(Document{Path: "app.yaml", Data: []byte("x: 1\n")})
+	h, err := New(WithSource(src, PollEvery(10*time.Millisecond)), WithAutoReload())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	src.set(Document{Path: "app.yaml", Data: []byte("x: 2\n")})
+	if err := h.Validate(context.Background()); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if got, _ := Get[int](h, "x"); got != 1 {
+		t.Fatalf("x after Validate() = %d, want 1", got)
+	}
+
+	start(t, h)
+	eventually(t, "x reloaded as 2", func() bool {
+		x, _ := Get[int](h, "x")
+		return x == 2
+	})
+}
+
+func TestValidateWatches(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.yaml"), "x: 1\n")
+	h, err := New(WithPaths(dir))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(sub, "db.yaml"), "y: 2\n")
+
+	if err := h.Validate(context.Background()); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if slices.Contains(h.watcher.WatchList(), sub) {
+		t.Error("Validate() added a watch")
+	}
+	if len(h.ConfigFiles()) != 1 {
+		t.Errorf("ConfigFiles() after Validate() = %v, want 1 file", h.ConfigFiles())
+	}
+
+	if err := h.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if !slices.Contains(h.watcher.WatchList(), sub) {
+		t.Error("Reload() didn't add a watch")
+	}
+	if got, _ := Get[int](h, "y"); got != 2 {
+		t.Errorf("y after Reload() = %d, want 2", got)
+	}
+}
@@ -0,0 +1,56 @@
+package hydra
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// overlay returns the base configuration file and the environment of an environment overlay
+// file or document, e.g. "config.yaml" and "prod" for "config.prod.yaml", see WithEnvironment.
+// The file is an overlay only if it's named after one of the environments, whether or not its
+// base file exists.
+func (h *Hydra) overlay(path string) (base, env string, ok bool) {
+	if h.options.environment == "" {
+		return "", "", false
+	}
+
+	ext := filepath.Ext(path)
+	if alias, ok := h.extensionAlias(filepath.Base(path)); ok {
+		ext = path[len(path)-len(alias)-1:]
+	}
+	stem := strings.TrimSuffix(path, ext)
+	i := strings.LastIndex(stem, ".")
+	if i < 0 || i < strings.LastIndexAny(stem, "/"+string(filepath.Separator)) {
+		return "", "", false
+	}
+
+	env = stem[i+1:]
+	if !h.isEnvironment(env) {
+		return "", "", false
+	}
+	return stem[:i] + ext, env, true
+}
+
+// isEnvironment reports whether the name is one of the environments named by WithEnvironment.
+func (h *Hydra) isEnvironment(name string) bool {
+	return strings.EqualFold(name, h.options.environment) || slices.ContainsFunc(h.options.environments, func(env string) bool {
+		return strings.EqualFold(name, env)
+	})
+}
+
+// overlayBase returns the base configuration file of an environment overlay file, or the path
+// itself if it's not an overlay.
+func (h *Hydra) overlayBase(path string) string {
+	if base, _, ok := h.overlay(path); ok {
+		return base
+	}
+	return path
+}
+
+// isOtherEnvironment reports whether the file is an environment overlay file of an environment
+// other than the one set by WithEnvironment, so it's not loaded.
+func (h *Hydra) isOtherEnvironment(path string) bool {
+	_, env, ok := h.overlay(path)
+	return ok && !strings.EqualFold(env, h.options.environment)
+}
@@ -0,0 +1,94 @@
+package hydra
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWithEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"app.yaml":              "port: 8080\nlog: info\n",
+		"app.prod.yaml":         "port: 443\n",
+		"app.staging.yaml":      "port: 8443\n",
+		"database.yaml":         "host: db\n",
+		"database.replica.yaml": "host: replica\n",
+		"cache.prod.yaml":       "size: 10\n",
+	}
+	for name, data := range files {
+		writeFile(t, filepath.Join(dir, name), data)
+	}
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		wantFiles []string
+		want      map[string]any
+	}{
+		{
+			name:      "prod",
+			opts:      []Option{WithEnvironment("prod", "staging")},
+			wantFiles: []string{"app.yaml", "app.prod.yaml", "cache.prod.yaml", "database.replica.yaml", "database.yaml"},
+			want:      map[string]any{"port": 443, "log": "info", "host": "db", "size": 10},
+		},
+		{
+			// overlays of other environments aren't loaded, and the overlay of an environment
+			// not named by the option is a regular file
+			name:      "staging",
+			opts:      []Option{WithEnvironment("STAGING")},
+			wantFiles: []string{"app.prod.yaml", "app.yaml", "app.staging.yaml", "cache.prod.yaml", "database.replica.yaml", "database.yaml"},
+			want:      map[string]any{"port": 8443, "log": "info", "host": "db", "size": 10},
+		},
+		{
+			// names with dots which aren't environments aren't overlays, so they don't collide
+			// with the namespaces of their base files
+			name:      "namespaces",
+			opts:      []Option{WithEnvironment("prod", "staging"), WithKeyNamespace(ByFileName)},
+			wantFiles: []string{"app.yaml", "app.prod.yaml", "cache.prod.yaml", "database.replica.yaml", "database.yaml"},
+			want: map[string]any{
+				"app":      map[string]any{"port": 443, "log": "info"},
+				"cache":    map[string]any{"size": 10},
+				"database": map[string]any{"host": "db", "replica": map[string]any{"host": "replica"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := New(append([]Option{WithPaths(dir)}, tt.opts...)...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer h.Close()
+
+			if got := relFiles(t, h, dir); !reflect.DeepEqual(got, tt.wantFiles) {
+				t.Errorf("ConfigFiles() = %v, want %v", got, tt.wantFiles)
+			}
+			if got := h.viper.AllSettings(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("settings = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithEnvironmentSource(t *testing.T) {
+	src := newMemSource(
+		Document{Path: "app.prod.yaml", Data: []byte("port: 443\n")},
+		Document{Path: "app.yaml", Data: []byte("port: 8080\nlog: info\n")},
+		Document{Path: "app.staging.yaml", Data: []byte("port: 8443\n")},
+	)
+	h, err := New(WithSource(src), WithEnvironment("prod", "staging"), WithKeyNamespace(ByFileName))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	// overlays of documents are merged on top of their base documents
+	if want := []string{"mem/app.yaml", "mem/app.prod.yaml"}; !reflect.DeepEqual(h.ConfigFiles(), want) {
+		t.Errorf("ConfigFiles() = %v, want %v", h.ConfigFiles(), want)
+	}
+	want := map[string]any{"app": map[string]any{"port": 443, "log": "info"}}
+	if got := h.viper.AllSettings(); !reflect.DeepEqual(got, want) {
+		t.Errorf("settings = %v, want %v", got, want)
+	}
+}
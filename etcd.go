@@ -0,0 +1,212 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// EtcdConfig configures a source of configuration documents stored as keys of etcd v3, see
+// WithEtcd. Requests are sent to the gRPC gateway of etcd, so no etcd client is needed.
+type EtcdConfig struct {
+	// Endpoints of the etcd cluster, e.g. "http://localhost:2379". Requests are sent to the
+	// endpoints in order until one of them responds.
+	Endpoints []string
+	// Prefix selects the keys starting with it, e.g. "/myapp/config/", or a single key holding
+	// a document, e.g. "/myapp/config.yaml". Names of the keys relative to the prefix are used
+	// like relative paths, see ByRelativePath, and their extensions determine their formats.
+	Prefix string
+	// Username and Password authenticate requests if authentication is enabled.
+	Username string
+	Password string
+	// Client sends the requests, e.g. with TLS client certificates. Defaults to
+	// http.DefaultClient.
+	Client *http.Client
+}
+
+// etcdSource provides the configuration documents stored as keys under a prefix.
+type etcdSource struct {
+	config EtcdConfig
+
+	mu sync.Mutex
+	// endpoint is the endpoint that responded last, which is requested first.
+	endpoint int
+}
+
+type etcdKeyValue struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+func (s *etcdSource) load(ctx context.Context, want func(rel string) bool) ([]document, error) {
+	var resp struct {
+		Kvs []etcdKeyValue `json:"kvs"`
+	}
+	err := s.post(ctx, "/v3/kv/range", s.keyRange(), func(d *json.Decoder) error {
+		return d.Decode(&resp)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get keys (prefix: %s): %w", s.config.Prefix, err)
+	}
+
+	var docs []document
+	for _, kv := range resp.Kvs {
+		key := string(kv.Key)
+		rel := strings.TrimPrefix(strings.TrimPrefix(key, s.config.Prefix), "/")
+		if rel == "" {
+			// the prefix is the key of a single document
+			rel = path.Base(key)
+		}
+		if !want(rel) {
+			continue
+		}
+
+		docs = append(docs, document{name: "etcd:" + key, rel: rel, data: kv.Value})
+	}
+	return docs, nil
+}
+
+// watch watches the keys under the prefix with the watch API of etcd.
+func (s *etcdSource) watch(ctx context.Context, changed func()) error {
+	req := map[string]any{"create_request": s.keyRange()}
+	return s.post(ctx, "/v3/watch", req, func(d *json.Decoder) error {
+		for {
+			var resp struct {
+				Result struct {
+					Created bool              `json:"created"`
+					Events  []json.RawMessage `json:"events"`
+				} `json:"result"`
+				Error *struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			err := d.Decode(&resp)
+			if err != nil {
+				return fmt.Errorf("decode watch response: %w", err)
+			}
+			if resp.Error != nil {
+				return errors.New(resp.Error.Message)
+			}
+
+			// changes made before the watch was created are caught up on its creation
+			if resp.Result.Created || len(resp.Result.Events) > 0 {
+				changed()
+			}
+		}
+	})
+}
+
+// keyRange returns the request of the keys under the prefix.
+func (s *etcdSource) keyRange() map[string]any {
+	key := []byte(s.config.Prefix)
+	if len(key) == 0 {
+		// all keys
+		return map[string]any{"key": []byte{0}, "range_end": []byte{0}}
+	}
+
+	// all keys greater or equal to the prefix and less than the prefix incremented
+	end := []byte{0}
+	for i := len(key) - 1; i >= 0; i-- {
+		if key[i] < 0xff {
+			end = append(bytes.Clone(key[:i]), key[i]+1)
+			break
+		}
+	}
+	return map[string]any{"key": key, "range_end": end}
+}
+
+// post sends the request to the endpoints in order until one of them responds, and passes the
+// decoder of the response body to read.
+func (s *etcdSource) post(ctx context.Context, path string, body any, read func(d *json.Decoder) error) error {
+	if len(s.config.Endpoints) == 0 {
+		return errors.New("no endpoints")
+	}
+
+	s.mu.Lock()
+	first := s.endpoint
+	s.mu.Unlock()
+
+	var errs []error
+	for n := range len(s.config.Endpoints) {
+		i := (first + n) % len(s.config.Endpoints)
+		endpoint := strings.TrimSuffix(s.config.Endpoints[i], "/")
+
+		resp, err := s.send(ctx, endpoint, path, body)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("endpoint %s: %w", endpoint, err))
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+
+		s.mu.Lock()
+		s.endpoint = i
+		s.mu.Unlock()
+
+		defer resp.Body.Close()
+		return read(json.NewDecoder(resp.Body))
+	}
+	return errors.Join(errs...)
+}
+
+// send sends the request to the endpoint, authenticated with a token if a username is set.
+func (s *etcdSource) send(ctx context.Context, endpoint, path string, body any) (*http.Response, error) {
+	var token string
+	if s.config.Username != "" {
+		var auth struct {
+			Token string `json:"token"`
+		}
+		resp, err := s.do(ctx, endpoint+"/v3/auth/authenticate", "", map[string]string{
+			"name":     s.config.Username,
+			"password": s.config.Password,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("authenticate: %w", err)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&auth)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode token: %w", err)
+		}
+		token = auth.Token
+	}
+
+	return s.do(ctx, endpoint+path, token, body)
+}
+
+func (s *etcdSource) do(ctx context.Context, url, token string, body any) (*http.Response, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	client := s.config.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,231 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// etcdTestServer is the gRPC gateway of an etcd member, whose keys are kept by name.
+type etcdTestServer struct {
+	// auth is the "username:password" required, if set.
+	auth string
+
+	mu   sync.Mutex
+	keys map[string]string
+	// watches are notified of changes of keys.
+	watches []chan struct{}
+}
+
+func (s *etcdTestServer) put(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if value == "" {
+		delete(s.keys, key)
+	} else {
+		s.keys[key] = value
+	}
+	for _, w := range s.watches {
+		select {
+		case w <- struct{}{}:
+		default:
+			// a change is pending already
+		}
+	}
+}
+
+func (s *etcdTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.URL.Path == "/v3/auth/authenticate" {
+		var name, password string
+		json.Unmarshal(req["name"], &name)
+		json.Unmarshal(req["password"], &password)
+		if name+":"+password != s.auth {
+			http.Error(w, `{"error":"authentication failed"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"token": "token-" + name})
+		return
+	}
+	if s.auth != "" && r.Header.Get("Authorization") != "token-"+strings.Split(s.auth, ":")[0] {
+		http.Error(w, `{"error":"invalid auth token"}`, http.StatusUnauthorized)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		var key, end []byte
+		json.Unmarshal(req["key"], &key)
+		json.Unmarshal(req["range_end"], &end)
+		s.mu.Lock()
+		var kvs []etcdKeyValue
+		for k, v := range s.keys {
+			if bytes.Compare([]byte(k), key) >= 0 && (bytes.Equal(end, []byte{0}) || bytes.Compare([]byte(k), end) < 0) {
+				kvs = append(kvs, etcdKeyValue{Key: []byte(k), Value: []byte(v)})
+			}
+		}
+		s.mu.Unlock()
+		slices.SortFunc(kvs, func(a, b etcdKeyValue) int { return bytes.Compare(a.Key, b.Key) })
+		json.NewEncoder(w).Encode(map[string]any{"kvs": kvs})
+	case "/v3/watch":
+		changes := make(chan struct{}, 1)
+		s.mu.Lock()
+		s.watches = append(s.watches, changes)
+		s.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{"result": map[string]any{"created": true}})
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case <-changes:
+				json.NewEncoder(w).Encode(map[string]any{"result": map[string]any{"events": []any{map[string]any{"type": "PUT"}}}})
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestEtcdKeyRange(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		key, end []byte
+	}{
+		{prefix: "", key: []byte{0}, end: []byte{0}},
+		{prefix: "/myapp/", key: []byte("/myapp/"), end: []byte("/myapp0")},
+		{prefix: "a\xff", key: []byte("a\xff"), end: []byte("b")},
+		{prefix: "\xff\xff", key: []byte("\xff\xff"), end: []byte{0}},
+	}
+	for _, tt := range tests {
+		got := (&etcdSource{config: EtcdConfig{Prefix: tt.prefix}}).keyRange()
+		if want := map[string]any{"key": tt.key, "range_end": tt.end}; !reflect.DeepEqual(got, want) {
+			t.Errorf("keyRange(%q) = %q, want %q", tt.prefix, got, want)
+		}
+	}
+}
+
+func TestEtcdSourceLoad(t *testing.T) {
+	keys := map[string]string{
+		"/myapp/app.yaml":    "port: 8080\n",
+		"/myapp/db/db.json":  `{"host": "localhost"}`,
+		"/myapp0":            "after the prefix",
+		"/myapp.yaml":        "single: true\n",
+		"/other/app.yaml":    "port: 1\n",
+		"/myapp/extra.toml":  "extra = true\n",
+		"/myapp/readme.text": "ignored",
+	}
+	tests := []struct {
+		name    string
+		config  EtcdConfig
+		auth    string
+		docs    []document
+		wantErr string
+	}{
+		{
+			name:   "prefix",
+			config: EtcdConfig{Prefix: "/myapp/"},
+			docs: []document{
+				{name: "etcd:/myapp/app.yaml", rel: "app.yaml", data: []byte("port: 8080\n")},
+				{name: "etcd:/myapp/db/db.json", rel: "db/db.json", data: []byte(`{"host": "localhost"}`)},
+				{name: "etcd:/myapp/extra.toml", rel: "extra.toml", data: []byte("extra = true\n")},
+			},
+		},
+		{
+			name:   "single key",
+			config: EtcdConfig{Prefix: "/myapp.yaml"},
+			docs:   []document{{name: "etcd:/myapp.yaml", rel: "myapp.yaml", data: []byte("single: true\n")}},
+		},
+		{
+			name:   "authenticated",
+			config: EtcdConfig{Prefix: "/other/", Username: "root", Password: "s3cret"},
+			auth:   "root:s3cret",
+			docs:   []document{{name: "etcd:/other/app.yaml", rel: "app.yaml", data: []byte("port: 1\n")}},
+		},
+		{
+			name:    "authentication failed",
+			config:  EtcdConfig{Prefix: "/other/", Username: "root", Password: "wrong"},
+			auth:    "root:s3cret",
+			wantErr: "authenticate: unexpected status: 400 Bad Request",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(&etcdTestServer{auth: tt.auth, keys: keys})
+			defer srv.Close()
+			down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			}))
+			defer down.Close()
+
+			tt.config.Endpoints = []string{down.URL, srv.URL + "/"}
+			tt.config.Client = srv.Client()
+			src := &etcdSource{config: tt.config}
+			docs, err := src.load(context.Background(), func(rel string) bool { return !strings.HasSuffix(rel, ".text") })
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasSuffix(err.Error(), tt.wantErr) {
+					t.Fatalf("load() error = %v, want suffix %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("load() error = %v", err)
+			}
+			if !reflect.DeepEqual(docs, tt.docs) {
+				t.Errorf("load() = %+v, want %+v", docs, tt.docs)
+			}
+			// the endpoint that responded is requested first
+			if src.endpoint != 1 {
+				t.Errorf("endpoint = %d, want 1", src.endpoint)
+			}
+		})
+	}
+}
+
+func TestEtcdSourceNoEndpoints(t *testing.T) {
+	_, err := (&etcdSource{config: EtcdConfig{Prefix: "/myapp/"}}).load(context.Background(), func(string) bool { return true })
+	if want := "get keys (prefix: /myapp/): no endpoints"; err == nil || err.Error() != want {
+		t.Errorf("load() error = %v, want %q", err, want)
+	}
+}
+
+func TestEtcdSourceWatch(t *testing.T) {
+	server := &etcdTestServer{keys: map[string]string{"/myapp/app.yaml": "port: 8080\n"}}
+	srv := httptest.NewServer(server)
+	// the server is closed once watching stopped, which closes the watch request
+	t.Cleanup(srv.Close)
+
+	h, err := New(WithEtcd(EtcdConfig{Endpoints: []string{srv.URL}, Prefix: "/myapp/", Client: srv.Client()}), WithAutoReload())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got, _ := Get[int](h, "port"); got != 8080 {
+		t.Fatalf("port = %d, want 8080", got)
+	}
+	start(t, h)
+	eventually(t, "watch created", func() bool {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		return len(server.watches) > 0
+	})
+
+	for _, port := range []string{"9090", "9091"} {
+		server.put("/myapp/app.yaml", "port: "+port+"\n")
+		eventually(t, "port "+port, func() bool {
+			got, _ := Get[string](h, "port")
+			return got == port
+		})
+	}
+}
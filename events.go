@@ -0,0 +1,190 @@
+package hydra
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Event is a configuration change or an error delivered by a channel returned by Events.
+type Event struct {
+	Change
+	// Err is set if the event reports an error, e.g. of the watcher, instead of a change.
+	Err error
+}
+
+// BackpressurePolicy decides what happens when an event is published to a full channel.
+type BackpressurePolicy int
+
+const (
+	// Block waits until the receiver makes room in the channel. It stalls processing of further
+	// changes until the event is delivered.
+	Block BackpressurePolicy = iota
+	// DropNewest discards the event that doesn't fit into the channel.
+	DropNewest
+	// DropOldest discards the oldest buffered event to make room for the new one.
+	DropOldest
+)
+
+type stream struct {
+	ch     chan Event
+	policy BackpressurePolicy
+
+	mu     sync.Mutex
+	closed bool
+	done   chan struct{}
+	once   sync.Once
+}
+
+type streamOptions struct {
+	buffer int
+	policy BackpressurePolicy
+	ctx    context.Context
+}
+
+// StreamOption configures a channel returned by Events.
+type StreamOption func(*streamOptions)
+
+// BufferSize sets the capacity of the channel. Defaults to 16.
+func BufferSize(n int) StreamOption {
+	return func(o *streamOptions) {
+		o.buffer = n
+	}
+}
+
+// Backpressure sets the policy applied when the channel is full. Defaults to Block.
+func Backpressure(p BackpressurePolicy) StreamOption {
+	return func(o *streamOptions) {
+		o.policy = p
+	}
+}
+
+// CloseOn makes the channel close once the context is done, in addition to when hydra is closed.
+func CloseOn(ctx context.Context) StreamOption {
+	return func(o *streamOptions) {
+		o.ctx = ctx
+	}
+}
+
+// Events returns a channel delivering the same changes as the NotifyFunc passed to Start, and
+// errors reported while watching. Each call returns a new channel, so multiple consumers don't
+// compete for events.
+//
+// The channel is closed when Start returns or hydra is closed, or when the context given by
+// CloseOn is done.
+func (h *Hydra) Events(opts ...StreamOption) <-chan Event {
+	o := streamOptions{
+		buffer: 16,
+		policy: Block,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	s := &stream{
+		ch:     make(chan Event, o.buffer),
+		policy: o.policy,
+		done:   make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	if h.isClosed() {
+		h.mu.Unlock()
+		s.close()
+		return s.ch
+	}
+	h.streams = append(h.streams, s)
+	h.mu.Unlock()
+
+	if o.ctx != nil {
+		context.AfterFunc(o.ctx, func() {
+			h.removeStream(s)
+		})
+	}
+
+	return s.ch
+}
+
+// broadcast delivers the event to all channels returned by Events.
+func (h *Hydra) broadcast(ev Event) {
+	h.mu.Lock()
+	streams := slices.Clone(h.streams)
+	h.mu.Unlock()
+
+	for _, s := range streams {
+		s.send(ev)
+	}
+}
+
+// closeStreams closes all channels returned by Events.
+func (h *Hydra) closeStreams() {
+	h.mu.Lock()
+	streams := h.streams
+	h.streams = nil
+	h.mu.Unlock()
+
+	for _, s := range streams {
+		s.close()
+	}
+}
+
+func (h *Hydra) removeStream(s *stream) {
+	h.mu.Lock()
+	h.streams = slices.DeleteFunc(h.streams, func(other *stream) bool {
+		return other == s
+	})
+	h.mu.Unlock()
+
+	s.close()
+}
+
+func (s *stream) send(ev Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	switch s.policy {
+	case DropNewest:
+		select {
+		case s.ch <- ev:
+		default:
+		}
+	case DropOldest:
+		for {
+			select {
+			case s.ch <- ev:
+				return
+			default:
+			}
+			if cap(s.ch) == 0 {
+				// there is no buffered event to drop
+				return
+			}
+
+			select {
+			case <-s.ch:
+			default:
+			}
+		}
+	default:
+		select {
+		case s.ch <- ev:
+		case <-s.done:
+		}
+	}
+}
+
+func (s *stream) close() {
+	s.once.Do(func() {
+		// unblock a pending send before taking the lock
+		close(s.done)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.closed = true
+		close(s.ch)
+	})
+}
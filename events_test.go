@@ -0,0 +1,163 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newCounter returns hydra loading the file "n: 0" of a temporary directory and a function
+// rewriting it with n and reloading the configuration.
+func newCounter(t *testing.T, opts ...Option) (*Hydra, func(n int)) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	writeFile(t, path, "n: 0\n")
+	h, err := New(append([]Option{WithPaths(filepath.Dir(path))}, opts...)...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { h.Close() })
+
+	return h, func(n int) {
+		t.Helper()
+		writeFile(t, path, "n: "+strconv.Itoa(n)+"\n")
+		err := h.Reload(context.Background())
+		if err != nil {
+			t.Errorf("Reload() error = %v", err)
+		}
+	}
+}
+
+// drain returns the values of n of the events buffered in the channel.
+func drain(ch <-chan Event) []any {
+	var values []any
+	for {
+		select {
+		case ev := <-ch:
+			values = append(values, ev.Modified["n"].New)
+		default:
+			return values
+		}
+	}
+}
+
+func TestEventsBackpressure(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy BackpressurePolicy
+		want   []any
+	}{
+		{name: "drop newest", policy: DropNewest, want: []any{1, 2}},
+		{name: "drop oldest", policy: DropOldest, want: []any{3, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, set := newCounter(t)
+			ch := h.Events(BufferSize(2), Backpressure(tt.policy))
+			for n := 1; n <= 4; n++ {
+				// the consumer is too slow, so reloads don't wait for it
+				set(n)
+			}
+			if got := drain(ch); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventsBlock(t *testing.T) {
+	h, set := newCounter(t)
+	ch := h.Events(BufferSize(1))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		set(1)
+		set(2)
+	}()
+	select {
+	case <-done:
+		t.Fatal("reload didn't wait for the consumer")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// the consumer catches up and every event is delivered in order
+	var got []any
+	for range 2 {
+		got = append(got, (<-ch).Modified["n"].New)
+	}
+	<-done
+	if want := []any{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
+
+func TestEventsClose(t *testing.T) {
+	h, set := newCounter(t)
+	ch := h.Events(BufferSize(1))
+	set(1)
+
+	// a reload blocked on a full channel is released by Close
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		set(2)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err := h.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reload blocked after Close")
+	}
+
+	// buffered events are still received before the channel is closed
+	if ev, ok := <-ch; !ok || ev.Modified["n"].New != 1 {
+		t.Errorf("event = %+v, %t, want n 1", ev, ok)
+	}
+	if _, ok := <-ch; ok {
+		t.Error("channel not closed by Close")
+	}
+	if _, ok := <-h.Events(); ok {
+		t.Error("channel returned after Close not closed")
+	}
+}
+
+func TestEventsCloseOn(t *testing.T) {
+	h, set := newCounter(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := h.Events(CloseOn(ctx))
+	other := h.Events()
+
+	cancel()
+	eventually(t, "channel closed", func() bool {
+		select {
+		case _, ok := <-ch:
+			return !ok
+		default:
+			return false
+		}
+	})
+
+	// other consumers keep receiving events
+	set(1)
+	if got := drain(other); !reflect.DeepEqual(got, []any{1}) {
+		t.Errorf("events of other channel = %v, want [1]", got)
+	}
+}
+
+func TestEventsErrors(t *testing.T) {
+	h, _ := newCounter(t)
+	ch := h.Events()
+	err := errors.New("watch failed")
+	h.reportError(err)
+	if ev := <-ch; ev.Err != err {
+		t.Errorf("event error = %v, want %v", ev.Err, err)
+	}
+}
@@ -0,0 +1,126 @@
+package hydra
+
+import (
+	"path"
+	"strings"
+)
+
+// keyFilter restricts the keys configuration files of a path contribute, see OnlyKeys and
+// ExcludeKeys.
+type keyFilter struct {
+	only    []string
+	exclude []string
+}
+
+// OnlyKeys restricts the keys configuration files found in the path contribute to the keys
+// matching any of the patterns, e.g. "credentials.*". Patterns are matched against dotted keys
+// like path.Match with dots separating the parts, and a pattern matching a key matches all
+// keys nested under it as well. Other keys are dropped.
+func OnlyKeys(patterns ...string) PathOption {
+	return func(o *options, path string) {
+		f := o.keyFilter(path)
+		f.only = append(f.only, lowerAll(patterns)...)
+	}
+}
+
+// ExcludeKeys drops keys matching any of the patterns from configuration files found in the
+// path. Patterns are matched like by OnlyKeys.
+func ExcludeKeys(patterns ...string) PathOption {
+	return func(o *options, path string) {
+		f := o.keyFilter(path)
+		f.exclude = append(f.exclude, lowerAll(patterns)...)
+	}
+}
+
+func (o *options) keyFilter(path string) *keyFilter {
+	if o.keyFilters == nil {
+		o.keyFilters = make(map[string]*keyFilter)
+	}
+	f, ok := o.keyFilters[path]
+	if !ok {
+		f = &keyFilter{}
+		o.keyFilters[path] = f
+	}
+	return f
+}
+
+// filterKeys drops keys the configuration file isn't allowed to contribute by the filter of
+// the path it was found in.
+func (h *Hydra) filterKeys(file string, settings map[string]any) map[string]any {
+	id, ok := h.pathID(h.pathIndex(file))
+	if !ok {
+		return settings
+	}
+	f, ok := h.options.keyFilters[id]
+	if !ok {
+		return settings
+	}
+	return f.apply(settings, "")
+}
+
+func (f *keyFilter) apply(settings map[string]any, prefix string) map[string]any {
+	filtered := make(map[string]any)
+	for name, value := range settings {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		if matchKey(f.exclude, key) {
+			continue
+		}
+		allowed := len(f.only) == 0 || matchKey(f.only, key)
+		sub, ok := value.(map[string]any)
+		if !ok || (allowed && !matchParent(f.exclude, key)) {
+			if allowed {
+				filtered[name] = value
+			}
+			continue
+		}
+
+		// keys nested in the value may be allowed or excluded
+		if sub = f.apply(sub, key); len(sub) > 0 {
+			filtered[name] = sub
+		}
+	}
+	return filtered
+}
+
+// matchKey reports whether any of the patterns matches the dotted key or a key it's nested in.
+func matchKey(patterns []string, key string) bool {
+	parts := strings.Split(key, ".")
+	for _, pattern := range patterns {
+		p := strings.ReplaceAll(pattern, ".", "/")
+		n := strings.Count(p, "/") + 1
+		if n > len(parts) {
+			continue
+		}
+		if ok, _ := path.Match(p, strings.Join(parts[:n], "/")); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchParent reports whether any of the patterns may match keys nested in the dotted key.
+func matchParent(patterns []string, key string) bool {
+	parts := strings.Split(key, ".")
+	for _, pattern := range patterns {
+		p := strings.Split(pattern, ".")
+		if len(p) <= len(parts) {
+			continue
+		}
+		if ok, _ := path.Match(strings.Join(p[:len(parts)], "/"), strings.Join(parts, "/")); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func lowerAll(s []string) []string {
+	lower := make([]string, len(s))
+	for i, v := range s {
+		lower[i] = strings.ToLower(v)
+	}
+	return lower
+}
@@ -0,0 +1,88 @@
+package hydra
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestKeyFilters(t *testing.T) {
+	dir := t.TempDir()
+	secrets, team := filepath.Join(dir, "secrets"), filepath.Join(dir, "team")
+	writeFile(t, filepath.Join(secrets, "db.yaml"), "credentials:\n  db:\n    password: secret\nport: 1\n")
+	writeFile(t, filepath.Join(team, "app.yaml"), "port: 8080\nsecrets:\n  token: leaked\nlog:\n  level: info\n  file: app.log\n")
+	src := newMemSource(Document{Path: "remote.yaml", Data: []byte("feature:\n  a: true\n  b: true\nport: 2\n")})
+
+	h, err := New(
+		WithPath(secrets, OnlyKeys("Credentials.*")),
+		WithPath(team, ExcludeKeys("secrets", "log.f*")),
+		WithSource(src, OnlyKeys("feature.a")),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	want := []string{"credentials.db.password", "feature.a", "log.level", "port"}
+	if got := h.viper.AllKeys(); !slices.Equal(sorted(got), want) {
+		t.Errorf("keys = %v, want %v", sorted(got), want)
+	}
+	if got, _ := Get[int](h, "port"); got != 8080 {
+		t.Errorf("port = %d, want 8080 of the team", got)
+	}
+
+	// reloads are filtered too
+	writeFile(t, filepath.Join(secrets, "db.yaml"), "credentials:\n  api: key\nlog:\n  level: debug\n")
+	if err := h.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	want = []string{"credentials.api", "feature.a", "log.level", "port"}
+	if got := h.viper.AllKeys(); !slices.Equal(sorted(got), want) {
+		t.Errorf("keys = %v, want %v", sorted(got), want)
+	}
+	if got, _ := Get[string](h, "log.level"); got != "info" {
+		t.Errorf("log.level = %s, want info", got)
+	}
+}
+
+func TestMatchKey(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		key      string
+		want     bool
+	}{
+		{patterns: []string{"credentials.*"}, key: "credentials.db", want: true},
+		{patterns: []string{"credentials.*"}, key: "credentials.db.password", want: true},
+		{patterns: []string{"credentials.*"}, key: "credentials", want: false},
+		{patterns: []string{"credentials"}, key: "credentials.db", want: true},
+		{patterns: []string{"*.password"}, key: "db.password", want: true},
+		{patterns: []string{"*.password"}, key: "db.user", want: false},
+		{patterns: []string{"log", "db"}, key: "db.host", want: true},
+		{patterns: []string{"data"}, key: "database", want: false},
+	}
+	for _, tt := range tests {
+		if got := matchKey(tt.patterns, tt.key); got != tt.want {
+			t.Errorf("matchKey(%v, %s) = %v, want %v", tt.patterns, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestMatchParent(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		key      string
+		want     bool
+	}{
+		{patterns: []string{"log.f*"}, key: "log", want: true},
+		{patterns: []string{"*.password"}, key: "db", want: true},
+		{patterns: []string{"log.f*"}, key: "log.file", want: false},
+		{patterns: []string{"log"}, key: "log", want: false},
+		{patterns: []string{"db.password"}, key: "log", want: false},
+	}
+	for _, tt := range tests {
+		if got := matchParent(tt.patterns, tt.key); got != tt.want {
+			t.Errorf("matchParent(%v, %s) = %v, want %v", tt.patterns, tt.key, got, tt.want)
+		}
+	}
+}
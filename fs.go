@@ -0,0 +1,88 @@
+package hydra
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// fsSource provides the configuration files found in a directory of an fs.FS, see WithFS.
+type fsSource struct {
+	fsys fs.FS
+	root string
+	// prefix is prepended to the paths of the files to name the documents, e.g. "sftp://host/".
+	prefix string
+}
+
+var _ Source = (*fsSource)(nil)
+
+// NewFSSource returns a Source of the configuration files found in the root of the filesystem,
+// searched recursively, which are named by their paths in the filesystem, e.g.
+// "fs/config/app.yaml". The source can't be watched, see WithFS.
+func NewFSSource(fsys fs.FS, root string) Source {
+	return &fsSource{fsys: fsys, root: root}
+}
+
+// Load returns all files found in the root.
+func (s *fsSource) Load(ctx context.Context) ([]Document, error) {
+	docs, err := s.load(ctx, func(string) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]Document, 0, len(docs))
+	for _, doc := range docs {
+		files = append(files, Document{Name: doc.name, Path: doc.rel, Data: doc.data})
+	}
+	return files, nil
+}
+
+// Watch returns ErrWatchUnsupported, since an fs.FS can't be watched.
+func (s *fsSource) Watch(context.Context, func()) error {
+	return ErrWatchUnsupported
+}
+
+func (s *fsSource) String() string {
+	return "fs"
+}
+
+func (s *fsSource) load(ctx context.Context, want func(rel string) bool) ([]document, error) {
+	var docs []document
+	err := fs.WalkDir(s.fsys, s.root, func(name string, d fs.DirEntry, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" && name != s.root {
+			// metadata of a Git repository
+			return fs.SkipDir
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel := path.Base(name)
+		if name != s.root {
+			rel = strings.TrimPrefix(name, s.root+"/")
+			if s.root == "." {
+				rel = name
+			}
+		}
+		if !want(rel) {
+			return nil
+		}
+
+		b, err := fs.ReadFile(s.fsys, name)
+		if err != nil {
+			return fmt.Errorf("read file (path: %s): %w", name, err)
+		}
+
+		docs = append(docs, document{name: s.prefix + name, rel: rel, data: b})
+		return nil
+	})
+	return docs, err
+}
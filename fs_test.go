@@ -0,0 +1,98 @@
+package hydra
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWithFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app.yaml":            {Data: []byte("name: app\n")},
+		"config/server.yaml":  {Data: []byte("port: 8080\n")},
+		"config/db/main.json": {Data: []byte(`{"host": "db"}`)},
+		"config/notes.txt":    {Data: []byte("ignored")},
+		"config/.git/x.yaml":  {Data: []byte("git: true\n")},
+	}
+	tests := []struct {
+		name  string
+		opts  []Option
+		files []string
+		want  map[string]any
+	}{
+		{
+			name:  "root",
+			opts:  []Option{WithFS(fsys, ".")},
+			files: []string{"fs/app.yaml", "fs/config/db/main.json", "fs/config/server.yaml"},
+			want:  map[string]any{"name": "app", "port": 8080, "host": "db"},
+		},
+		{
+			name:  "directory",
+			opts:  []Option{WithFS(fsys, "config")},
+			files: []string{"fs/config/db/main.json", "fs/config/server.yaml"},
+			want:  map[string]any{"port": 8080, "host": "db"},
+		},
+		{
+			name:  "file",
+			opts:  []Option{WithFS(fsys, "config/server.yaml")},
+			files: []string{"fs/config/server.yaml"},
+			want:  map[string]any{"port": 8080},
+		},
+		{
+			name: "same root",
+			opts: []Option{
+				WithFS(fsys, "config/server.yaml"),
+				WithFS(fstest.MapFS{"config/server.yaml": {Data: []byte("port: 9090\n")}}, "config/server.yaml"),
+			},
+			files: []string{"fs/config/server.yaml", "fs#2/config/server.yaml"},
+			want:  map[string]any{"port": 9090},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := New(tt.opts...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer h.Close()
+			if got := h.ConfigFiles(); !reflect.DeepEqual(got, tt.files) {
+				t.Errorf("ConfigFiles() = %v, want %v", got, tt.files)
+			}
+			for key, want := range tt.want {
+				if got, err := Get[any](h, key); err != nil || got != want {
+					t.Errorf("Get(%s) = %v, %v, want %v", key, got, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWithFSIgnoresWorkingDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "stray.yaml"), "stray: true\nname: stray\n")
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	h, err := New(WithFS(fstest.MapFS{"app.yaml": {Data: []byte("name: app\n")}}, "."))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+	if got := h.ConfigFiles(); !reflect.DeepEqual(got, []string{"fs/app.yaml"}) {
+		t.Errorf("ConfigFiles() = %v, want [fs/app.yaml]", got)
+	}
+	if got, _ := Get[string](h, "name"); got != "app" {
+		t.Errorf("name = %q, want app", got)
+	}
+	if _, ok := Lookup[bool](h, "stray"); ok {
+		t.Error("stray.yaml of the working directory merged")
+	}
+}
@@ -0,0 +1,213 @@
+package hydra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gcsMetadataToken is the endpoint of the metadata server providing access tokens of the
+// default service account on Google Cloud, e.g. on GCE, GKE or Cloud Run.
+const gcsMetadataToken = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// GCSConfig configures a source of the configuration files stored as objects in a Google Cloud
+// Storage bucket, see WithGCS.
+type GCSConfig struct {
+	Bucket string
+	// Prefix selects the objects whose names start with it, e.g. "myapp/". Names of the objects
+	// relative to the prefix are used like relative paths, see ByRelativePath.
+	Prefix string
+	// Endpoint of the storage API, e.g. of an emulator, to which requests are sent without
+	// authorization unless Token is set. Defaults to the STORAGE_EMULATOR_HOST environment
+	// variable, or Cloud Storage.
+	Endpoint string
+	// Token returns the OAuth 2.0 access token of requests, e.g. of a token source of
+	// golang.org/x/oauth2/google. Defaults to the token of the default service account provided
+	// by the metadata server on Google Cloud.
+	Token func(ctx context.Context) (string, error)
+	// Client sends the requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// gcsSource provides the configuration files stored as objects under a prefix of a bucket.
+type gcsSource struct {
+	config GCSConfig
+
+	mu sync.Mutex
+	// objects are the documents of the objects last downloaded, by name, which are downloaded
+	// again only if their generation changes.
+	objects map[string]gcsObject
+	// token is the access token of the metadata server, cached until it expires.
+	token   string
+	expires time.Time
+}
+
+type gcsObject struct {
+	generation string
+	doc        document
+}
+
+type gcsListResult struct {
+	Items []struct {
+		Name       string `json:"name"`
+		Generation string `json:"generation"`
+	} `json:"items"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+func (s *gcsSource) load(ctx context.Context, want func(rel string) bool) ([]document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	objects := make(map[string]gcsObject)
+	var docs []document
+	token := ""
+	for {
+		query := url.Values{"prefix": {s.config.Prefix}, "fields": {"items(name,generation),nextPageToken"}}
+		if token != "" {
+			query.Set("pageToken", token)
+		}
+
+		var list gcsListResult
+		err := s.get(ctx, "/storage/v1/b/"+url.PathEscape(s.config.Bucket)+"/o", query, func(body io.Reader) error {
+			return json.NewDecoder(body).Decode(&list)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list objects (bucket: %s): %w", s.config.Bucket, err)
+		}
+
+		for _, item := range list.Items {
+			rel := strings.TrimPrefix(strings.TrimPrefix(item.Name, s.config.Prefix), "/")
+			if strings.HasSuffix(item.Name, "/") || !want(rel) {
+				continue
+			}
+
+			o, ok := s.objects[item.Name]
+			if !ok || o.generation != item.Generation {
+				var b []byte
+				path := "/storage/v1/b/" + url.PathEscape(s.config.Bucket) + "/o/" + url.PathEscape(item.Name)
+				query := url.Values{"alt": {"media"}, "generation": {item.Generation}}
+				err := s.get(ctx, path, query, func(body io.Reader) error {
+					b, err = io.ReadAll(body)
+					return err
+				})
+				if err != nil {
+					return nil, fmt.Errorf("get object (name: %s): %w", item.Name, err)
+				}
+
+				name := "gs://" + s.config.Bucket + "/" + item.Name
+				o = gcsObject{generation: item.Generation, doc: document{name: name, rel: rel, data: b}}
+			}
+			objects[item.Name] = o
+			docs = append(docs, o.doc)
+		}
+
+		if list.NextPageToken == "" {
+			break
+		}
+		token = list.NextPageToken
+	}
+
+	s.objects = objects
+	return docs, nil
+}
+
+// get sends an authorized GET request to the escaped path of the storage API and passes the
+// response body to read.
+func (s *gcsSource) get(ctx context.Context, path string, query url.Values, read func(body io.Reader) error) error {
+	endpoint, emulated := s.endpoint()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	// emulators don't require authorization
+	if s.config.Token != nil || !emulated {
+		token, err := s.accessToken(ctx)
+		if err != nil {
+			return fmt.Errorf("get access token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return read(resp.Body)
+}
+
+// accessToken returns the access token of requests, see GCSConfig.Token.
+func (s *gcsSource) accessToken(ctx context.Context) (string, error) {
+	if s.config.Token != nil {
+		return s.config.Token(ctx)
+	}
+	if s.token != "" && time.Now().Before(s.expires) {
+		return s.token, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcsMetadataToken, nil)
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return "", fmt.Errorf("decode token: %w", err)
+	}
+
+	// the token is refreshed a minute before it expires
+	s.token = token.AccessToken
+	s.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return s.token, nil
+}
+
+// endpoint returns the endpoint of the storage API and whether it's set by GCSConfig.Endpoint or
+// STORAGE_EMULATOR_HOST.
+func (s *gcsSource) endpoint() (string, bool) {
+	endpoint := s.config.Endpoint
+	if endpoint == "" {
+		endpoint = os.Getenv("STORAGE_EMULATOR_HOST")
+	}
+	if endpoint == "" {
+		return "https://storage.googleapis.com", false
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	return strings.TrimSuffix(endpoint, "/"), true
+}
+
+func (s *gcsSource) client() *http.Client {
+	if s.config.Client != nil {
+		return s.config.Client
+	}
+	return http.DefaultClient
+}
@@ -0,0 +1,247 @@
+package hydra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// gcsTestServer is a storage API of the bucket "config", listing objects by pages of two, and
+// a metadata server providing access tokens.
+type gcsTestServer struct {
+	// token is the access token required, if set.
+	token string
+
+	mu          sync.Mutex
+	objects     map[string]string
+	generations map[string]int
+	// gets counts the objects downloaded by name, and tokens the tokens provided.
+	gets   map[string]int
+	tokens int
+}
+
+func newGCSTestServer(objects map[string]string) *gcsTestServer {
+	s := &gcsTestServer{objects: map[string]string{}, generations: map[string]int{}, gets: map[string]int{}}
+	for name, data := range objects {
+		s.put(name, data)
+	}
+	return s
+}
+
+func (s *gcsTestServer) put(name, data string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[name] = data
+	s.generations[name]++
+}
+
+func (s *gcsTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Host == "metadata.google.internal" {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "missing flavor", http.StatusForbidden)
+			return
+		}
+		s.tokens++
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "metadata-token", "expires_in": 3600})
+		return
+	}
+	if got := r.Header.Get("Authorization"); (s.token == "" && got != "") || (s.token != "" && got != "Bearer "+s.token) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	name, ok := strings.CutPrefix(r.URL.EscapedPath(), "/storage/v1/b/config/o")
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	if name != "" {
+		name, err := url.PathUnescape(strings.TrimPrefix(name, "/"))
+		if err != nil || strings.Contains(strings.TrimPrefix(r.URL.EscapedPath(), "/storage/v1/b/config/o/"), "/") || q.Get("alt") != "media" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if q.Get("generation") != strconv.Itoa(s.generations[name]) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		s.gets[name]++
+		fmt.Fprint(w, s.objects[name])
+		return
+	}
+
+	var names []string
+	for name := range s.objects {
+		if strings.HasPrefix(name, q.Get("prefix")) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	start, _ := strconv.Atoi(q.Get("pageToken"))
+	end := min(start+2, len(names))
+	var list gcsListResult
+	for _, name := range names[start:end] {
+		list.Items = append(list.Items, struct {
+			Name       string `json:"name"`
+			Generation string `json:"generation"`
+		}{name, strconv.Itoa(s.generations[name])})
+	}
+	if end < len(names) {
+		list.NextPageToken = strconv.Itoa(end)
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+func TestGCSSourceLoad(t *testing.T) {
+	server := newGCSTestServer(map[string]string{
+		"myapp/app.yaml":   "port: 8080\n",
+		"myapp/db/db.json": `{"host": "localhost"}`,
+		"myapp/dir/":       "",
+		"myapp/extra.toml": "extra = true\n",
+		"other/app.yaml":   "port: 1\n",
+	})
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	// emulators are requested without authorization
+	t.Setenv("STORAGE_EMULATOR_HOST", strings.TrimPrefix(srv.URL, "http://"))
+	src := &gcsSource{config: GCSConfig{Bucket: "config", Prefix: "myapp/", Client: srv.Client()}}
+
+	steps := []struct {
+		put  map[string]string
+		docs []document
+		gets map[string]int
+	}{
+		{
+			docs: []document{
+				{name: "gs://config/myapp/app.yaml", rel: "app.yaml", data: []byte("port: 8080\n")},
+				{name: "gs://config/myapp/db/db.json", rel: "db/db.json", data: []byte(`{"host": "localhost"}`)},
+				{name: "gs://config/myapp/extra.toml", rel: "extra.toml", data: []byte("extra = true\n")},
+			},
+			gets: map[string]int{"myapp/app.yaml": 1, "myapp/db/db.json": 1, "myapp/extra.toml": 1},
+		},
+		{
+			// objects of unchanged generations aren't downloaded again
+			put: map[string]string{"myapp/app.yaml": "port: 9090\n"},
+			docs: []document{
+				{name: "gs://config/myapp/app.yaml", rel: "app.yaml", data: []byte("port: 9090\n")},
+				{name: "gs://config/myapp/db/db.json", rel: "db/db.json", data: []byte(`{"host": "localhost"}`)},
+				{name: "gs://config/myapp/extra.toml", rel: "extra.toml", data: []byte("extra = true\n")},
+			},
+			gets: map[string]int{"myapp/app.yaml": 2, "myapp/db/db.json": 1, "myapp/extra.toml": 1},
+		},
+	}
+	for i, step := range steps {
+		for name, data := range step.put {
+			server.put(name, data)
+		}
+		docs, err := src.load(context.Background(), func(string) bool { return true })
+		if err != nil {
+			t.Fatalf("step %d: load() error = %v", i, err)
+		}
+		if !reflect.DeepEqual(docs, step.docs) {
+			t.Errorf("step %d: load() = %+v, want %+v", i, docs, step.docs)
+		}
+		server.mu.Lock()
+		if !reflect.DeepEqual(server.gets, step.gets) {
+			t.Errorf("step %d: downloaded %v, want %v", i, server.gets, step.gets)
+		}
+		server.mu.Unlock()
+	}
+}
+
+// gcsMetadataTransport sends the requests of the metadata server to the test server.
+type gcsMetadataTransport struct {
+	url *url.URL
+}
+
+func (t gcsMetadataTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Host = req.URL.Host
+	req.URL.Scheme, req.URL.Host = t.url.Scheme, t.url.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestGCSSourceAccessToken(t *testing.T) {
+	tests := []struct {
+		name string
+		// token is the token of GCSConfig.Token, or the metadata server's if empty.
+		token      string
+		wantTokens int
+	}{
+		{name: "token", token: "configured-token"},
+		{name: "metadata server", wantTokens: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newGCSTestServer(map[string]string{"app.yaml": "port: 8080\n"})
+			server.token = tt.token
+			if tt.token == "" {
+				server.token = "metadata-token"
+			}
+			srv := httptest.NewServer(server)
+			defer srv.Close()
+			u, _ := url.Parse(srv.URL)
+
+			config := GCSConfig{Bucket: "config", Client: &http.Client{Transport: gcsMetadataTransport{url: u}}}
+			if tt.token != "" {
+				config.Endpoint = srv.URL
+				config.Token = func(context.Context) (string, error) { return tt.token, nil }
+			}
+			src := &gcsSource{config: config}
+			for i := range 2 {
+				docs, err := src.load(context.Background(), func(string) bool { return true })
+				if err != nil || len(docs) != 1 {
+					t.Fatalf("load %d = %+v, %v, want app.yaml", i, docs, err)
+				}
+			}
+			// tokens of the metadata server are cached until they expire
+			if server.tokens != tt.wantTokens {
+				t.Errorf("metadata server provided %d tokens, want %d", server.tokens, tt.wantTokens)
+			}
+		})
+	}
+}
+
+func TestGCSSourceLoadError(t *testing.T) {
+	srv := httptest.NewServer(&gcsTestServer{token: "s3cret"})
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		config GCSConfig
+		want   string
+	}{
+		{
+			name:   "unauthorized",
+			config: GCSConfig{Bucket: "config", Token: func(context.Context) (string, error) { return "wrong", nil }},
+			want:   "list objects (bucket: config): unexpected status: 401 Unauthorized",
+		},
+		{
+			name:   "token",
+			config: GCSConfig{Bucket: "config", Token: func(context.Context) (string, error) { return "", fmt.Errorf("no credentials") }},
+			want:   "list objects (bucket: config): get access token: no credentials",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Endpoint, tt.config.Client = srv.URL, srv.Client()
+			_, err := (&gcsSource{config: tt.config}).load(context.Background(), func(string) bool { return true })
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("load() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
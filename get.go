@@ -0,0 +1,113 @@
+package hydra
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/spf13/viper"
+)
+
+// ErrKeyNotSet is returned by Get for keys that aren't set.
+var ErrKeyNotSet = errors.New("key not set")
+
+// Get returns the value of the key, e.g. "server.timeout", decoded into T, e.g.
+// Get[time.Duration](h, "server.timeout") or Get[[]Route](h, "routes"). Strings are decoded
+// into durations, times in RFC 3339 format, ByteSize and other types implementing
+// encoding.TextUnmarshaler, and comma-separated strings into slices. Values of environment
+// variables and defaults of viper are decoded too. It returns ErrKeyNotSet if the key isn't set,
+// or an error if the value can't be decoded into T. It's safe to call while the configuration is
+// reloaded.
+func Get[T any](h *Hydra, key string) (T, error) {
+	var v T
+	// the value is copied under the lock, so it's decoded while the configuration is reloaded
+	h.viperMu.RLock()
+	set := h.viper.IsSet(key)
+	value := copyValue(h.viper.Get(key))
+	h.viperMu.RUnlock()
+	if !set {
+		return v, fmt.Errorf("get key (key: %s): %w", key, ErrKeyNotSet)
+	}
+
+	hook := viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToTimeHookFunc(time.RFC3339),
+		mapstructure.TextUnmarshallerHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	))
+	err := decode(value, &v, hook)
+	if err != nil {
+		return v, fmt.Errorf("decode key (key: %s, type: %T): %w", key, v, err)
+	}
+	return v, nil
+}
+
+// Lookup is like Get, but reports whether the key is set and its value decoded into T instead
+// of returning an error.
+func Lookup[T any](h *Hydra, key string) (T, bool) {
+	v, err := Get[T](h, key)
+	return v, err == nil
+}
+
+// ByteSize is a number of bytes decoded from a size with a unit, e.g. "512", "64KB" or
+// "1.5 GiB". Units are case-insensitive, with decimal units (KB, MB, GB, TB, PB) multiplying by
+// powers of 1000 and binary units (KiB, MiB, GiB, TiB, PiB) by powers of 1024.
+type ByteSize uint64
+
+var byteUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"pb":  1e15,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+	"pib": 1 << 50,
+}
+
+func (s *ByteSize) UnmarshalText(text []byte) error {
+	str := strings.TrimSpace(string(text))
+	i := strings.IndexFunc(str, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(str)
+	}
+	n, err := strconv.ParseFloat(str[:i], 64)
+	if err != nil {
+		return fmt.Errorf("invalid byte size: %s", text)
+	}
+	unit, ok := byteUnits[strings.ToLower(strings.TrimSpace(str[i:]))]
+	if !ok {
+		return fmt.Errorf("invalid byte size unit: %s", text)
+	}
+	n *= unit
+	if n >= math.MaxUint64 {
+		return fmt.Errorf("byte size out of range: %s", text)
+	}
+	*s = ByteSize(n)
+	return nil
+}
+
+// String returns the size in the largest binary unit dividing it, e.g. "64KiB".
+func (s ByteSize) String() string {
+	for _, unit := range []string{"PiB", "TiB", "GiB", "MiB", "KiB"} {
+		size := uint64(byteUnits[strings.ToLower(unit)])
+		if s != 0 && uint64(s)%size == 0 {
+			return strconv.FormatUint(uint64(s)/size, 10) + unit
+		}
+	}
+	return strconv.FormatUint(uint64(s), 10) + "B"
+}
+
+func (s ByteSize) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
@@ -0,0 +1,168 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// GitConfig configures a source of the configuration files of a Git repository, see WithGit.
+// The repository is cloned and pulled with the git command, so authentication is configured
+// like for git, e.g. by SSH keys or credential helpers.
+type GitConfig struct {
+	// URL of the repository, e.g. "https://github.com/org/config.git".
+	URL string
+	// Ref is the branch or tag checked out. Defaults to the default branch.
+	Ref string
+	// Path is the directory in the repository searched for configuration files, e.g.
+	// "services/myapp". Defaults to the root of the repository.
+	Path string
+	// Dir is the directory the repository is cloned into. Defaults to a temporary directory,
+	// which is removed once hydra is closed. A Dir containing a repository must have been
+	// cloned by hydra, since the checked out ref is reset to the ref fetched.
+	Dir string
+}
+
+// gitSource provides the configuration files of a directory of a Git repository.
+type gitSource struct {
+	config GitConfig
+
+	mu sync.Mutex
+	// dir is the directory the repository is cloned into.
+	dir string
+	// temp is whether dir is a temporary directory.
+	temp bool
+	// commit is the commit checked out, whose documents are loaded again only once the
+	// commit changes.
+	commit string
+	docs   []document
+}
+
+func (s *gitSource) load(ctx context.Context, want func(rel string) bool) ([]document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.pull(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := s.git(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	if commit == s.commit {
+		return s.docs, nil
+	}
+
+	root := filepath.ToSlash(filepath.Clean(s.config.Path))
+	fsys := &fsSource{fsys: os.DirFS(s.dir), root: strings.Trim(root, "/"), prefix: s.prefix()}
+	if fsys.root == "" {
+		fsys.root = "."
+	}
+
+	docs, err := fsys.load(ctx, want)
+	if err != nil {
+		return nil, err
+	}
+
+	s.commit, s.docs = commit, docs
+	return docs, nil
+}
+
+// pull clones the repository, or fetches the ref again and checks it out if it's cloned.
+func (s *gitSource) pull(ctx context.Context) error {
+	if s.dir == "" {
+		s.dir = s.config.Dir
+	}
+	if s.dir == "" {
+		dir, err := os.MkdirTemp("", "hydra-git-")
+		if err != nil {
+			return fmt.Errorf("create clone directory: %w", err)
+		}
+		s.dir, s.temp = dir, true
+	}
+
+	if _, err := os.Stat(filepath.Join(s.dir, ".git")); errors.Is(err, os.ErrNotExist) {
+		// clones are marked, so repositories which weren't cloned by hydra aren't reset
+		args := []string{"clone", "--depth", "1", "--config", gitCloneKey + "=true"}
+		if s.config.Ref != "" {
+			args = append(args, "--branch", s.config.Ref)
+		}
+		_, err := s.git(ctx, append(args, "--", s.config.URL, s.dir)...)
+		return err
+	}
+
+	if marked, _ := s.git(ctx, "config", "--local", "--get", gitCloneKey); marked != "true" {
+		return fmt.Errorf("pull repository (dir: %s): not cloned by hydra", s.dir)
+	}
+
+	ref := s.config.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	_, err := s.git(ctx, "fetch", "--depth", "1", "origin", ref)
+	if err != nil {
+		return err
+	}
+	_, err = s.git(ctx, "reset", "--hard", "FETCH_HEAD")
+	return err
+}
+
+// gitCloneKey is the key of the Git configuration marking the clones of hydra.
+const gitCloneKey = "hydra.clone"
+
+// close removes the clone directory if it's a temporary directory.
+func (s *gitSource) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.temp {
+		return nil
+	}
+	err := os.RemoveAll(s.dir)
+	s.dir, s.temp, s.commit, s.docs = "", false, "", nil
+	return err
+}
+
+// git runs the git command in the clone directory and returns its trimmed output.
+func (s *gitSource) git(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	if args[0] != "clone" {
+		cmd.Dir = s.dir
+	}
+	// credentials can't be prompted for
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("run git %s: %w: %s", args[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return string(bytes.TrimSpace(out)), nil
+}
+
+// prefix returns the prefix of the names of the documents, e.g.
+// "git:https://github.com/org/config.git/".
+func (s *gitSource) prefix() string {
+	return gitSourceID(s.config) + "/"
+}
+
+// gitSourceID returns the ID of the source of the repository in errors and options like
+// Priority, e.g. "git:https://github.com/org/config.git". Credentials in the userinfo of the
+// URL are never included.
+func gitSourceID(c GitConfig) string {
+	id := strings.TrimSuffix(c.URL, "/")
+	if u, err := url.Parse(id); err == nil && u.User != nil {
+		u.User = nil
+		id = u.String()
+	}
+	return "git:" + id
+}
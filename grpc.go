@@ -0,0 +1,175 @@
+package hydra
+
+//go:generate protoc --go_out=. --go_opt=module=github.com/ciric92/hydra --go-grpc_out=. --go-grpc_opt=module=github.com/ciric92/hydra config.proto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/ciric92/hydra/configpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+)
+
+// GRPCConfig configures a source of a configuration document served by a gRPC service, see
+// WithGRPC. The service is defined by config.proto.
+type GRPCConfig struct {
+	// Address of the service as a gRPC target, e.g. "config.internal:8443" or
+	// "dns:///config.internal:8443".
+	Address string
+	// Name of the document requested, e.g. "myapp".
+	Name string
+	// Metadata is sent with the calls, e.g. "authorization" to "Bearer ...".
+	Metadata map[string]string
+	// Credentials secure the connection. Defaults to TLS verified with the system's roots.
+	// insecure.NewCredentials of google.golang.org/grpc/credentials/insecure calls services
+	// without TLS, over HTTP/2 in plaintext.
+	Credentials credentials.TransportCredentials
+	// Keepalive sets how the connection is kept alive while streaming updates, e.g. through
+	// load balancers dropping idle connections. Keepalive pings are disabled by default.
+	Keepalive keepalive.ClientParameters
+	// MaxMessageSize limits the size of the messages received in bytes. Defaults to 4 MiB.
+	MaxMessageSize int
+	// DialOptions are applied after the options set by the other fields, e.g. interceptors.
+	DialOptions []grpc.DialOption
+}
+
+// grpcSource provides the configuration document served by a gRPC service.
+type grpcSource struct {
+	config GRPCConfig
+
+	mu     sync.Mutex
+	conn   *grpc.ClientConn
+	client configpb.ConfigServiceClient
+	// latest is the document last pushed by the service while streaming, which is loaded
+	// instead of fetching the document.
+	latest    *configpb.Document
+	streaming bool
+}
+
+func (s *grpcSource) load(ctx context.Context, want func(rel string) bool) ([]document, error) {
+	s.mu.Lock()
+	doc := s.latest
+	if !s.streaming {
+		doc = nil
+	}
+	s.mu.Unlock()
+
+	if doc == nil {
+		client, err := s.connect()
+		if err != nil {
+			return nil, err
+		}
+		doc, err = client.Fetch(s.outgoing(ctx), &configpb.FetchRequest{Name: s.config.Name})
+		if err != nil {
+			return nil, fmt.Errorf("fetch document (name: %s): %w", s.config.Name, err)
+		}
+	}
+
+	rel := doc.GetName()
+	if rel == "" {
+		rel = s.config.Name
+	}
+	if doc.GetFormat() != "" {
+		rel += "." + strings.ToLower(doc.GetFormat())
+	}
+	if !want(rel) {
+		return nil, nil
+	}
+	return []document{{name: s.name(), rel: rel, data: doc.GetData()}}, nil
+}
+
+// watch streams the updates of the document pushed by the service.
+func (s *grpcSource) watch(ctx context.Context, changed func()) error {
+	client, err := s.connect()
+	if err != nil {
+		return err
+	}
+	stream, err := client.StreamUpdates(s.outgoing(ctx), &configpb.FetchRequest{Name: s.config.Name})
+	if err != nil {
+		return fmt.Errorf("stream updates (name: %s): %w", s.config.Name, err)
+	}
+
+	defer func() {
+		s.mu.Lock()
+		s.streaming, s.latest = false, nil
+		s.mu.Unlock()
+	}()
+
+	for {
+		// the stream starts with the current version of the document, catching up changes
+		// made before watching
+		doc, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return errors.New("stream ended")
+		}
+		if err != nil {
+			return fmt.Errorf("stream updates (name: %s): %w", s.config.Name, err)
+		}
+
+		s.mu.Lock()
+		s.streaming, s.latest = true, doc
+		s.mu.Unlock()
+		changed()
+	}
+}
+
+// connect returns the client of the service, creating the connection on first use. The
+// connection is established by the first call and re-established by gRPC once it fails.
+func (s *grpcSource) connect() (configpb.ConfigServiceClient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil {
+		return s.client, nil
+	}
+
+	creds := s.config.Credentials
+	if creds == nil {
+		creds = credentials.NewTLS(nil)
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if s.config.Keepalive.Time > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(s.config.Keepalive))
+	}
+	if s.config.MaxMessageSize > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(s.config.MaxMessageSize)))
+	}
+	opts = append(opts, s.config.DialOptions...)
+
+	conn, err := grpc.NewClient(s.config.Address, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("create client (address: %s): %w", s.config.Address, err)
+	}
+	s.conn, s.client = conn, configpb.NewConfigServiceClient(conn)
+	return s.client, nil
+}
+
+// outgoing returns the context of a call sending the metadata.
+func (s *grpcSource) outgoing(ctx context.Context) context.Context {
+	if len(s.config.Metadata) == 0 {
+		return ctx
+	}
+	return metadata.NewOutgoingContext(ctx, metadata.New(s.config.Metadata))
+}
+
+// close closes the connection to the service.
+func (s *grpcSource) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn, s.client = nil, nil
+	return err
+}
+
+func (s *grpcSource) name() string {
+	return "grpc:" + s.config.Address + "/" + s.config.Name
+}
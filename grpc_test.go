@@ -0,0 +1,226 @@
+package hydra
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ciric92/hydra/configpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcTestServer serves ConfigService, handling fetches by fetch and pushing the documents sent
+// on updates to streams.
+type grpcTestServer struct {
+	configpb.UnimplementedConfigServiceServer
+
+	fetch   func(ctx context.Context, name string) (*configpb.Document, error)
+	updates chan *configpb.Document
+}
+
+func (s *grpcTestServer) Fetch(ctx context.Context, req *configpb.FetchRequest) (*configpb.Document, error) {
+	return s.fetch(ctx, req.GetName())
+}
+
+func (s *grpcTestServer) StreamUpdates(req *configpb.FetchRequest, stream grpc.ServerStreamingServer[configpb.Document]) error {
+	doc, err := s.fetch(stream.Context(), req.GetName())
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(doc); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case doc := <-s.updates:
+			if err := stream.Send(doc); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// newGRPCTestServer starts a gRPC server with the options and returns the config of a source
+// calling it without TLS.
+func newGRPCTestServer(t *testing.T, s *grpcTestServer, opts ...grpc.ServerOption) GRPCConfig {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(opts...)
+	configpb.RegisterConfigServiceServer(srv, s)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+	return GRPCConfig{Address: lis.Addr().String(), Name: "myapp", Credentials: insecure.NewCredentials()}
+}
+
+func TestGRPCSourceLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		fetch   func(ctx context.Context, name string) (*configpb.Document, error)
+		config  func(c *GRPCConfig)
+		wantRel string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "document",
+			fetch: func(_ context.Context, name string) (*configpb.Document, error) {
+				return &configpb.Document{Name: name, Format: "YAML", Data: []byte("port: 8080\n")}, nil
+			},
+			wantRel: "myapp.yaml",
+			want:    "port: 8080\n",
+		},
+		{
+			name: "unnamed document",
+			fetch: func(context.Context, string) (*configpb.Document, error) {
+				return &configpb.Document{Format: "json", Data: []byte("{}")}, nil
+			},
+			wantRel: "myapp.json",
+			want:    "{}",
+		},
+		{
+			name: "metadata",
+			fetch: func(ctx context.Context, name string) (*configpb.Document, error) {
+				md, _ := metadata.FromIncomingContext(ctx)
+				if got := md.Get("authorization"); len(got) != 1 || got[0] != "Bearer token" {
+					return nil, status.Error(codes.Unauthenticated, "no token")
+				}
+				return &configpb.Document{Name: name, Format: "yaml", Data: []byte("a: 1\n")}, nil
+			},
+			config:  func(c *GRPCConfig) { c.Metadata = map[string]string{"authorization": "Bearer token"} },
+			wantRel: "myapp.yaml",
+			want:    "a: 1\n",
+		},
+		{
+			name: "status",
+			fetch: func(context.Context, string) (*configpb.Document, error) {
+				return nil, status.Error(codes.NotFound, "no such document")
+			},
+			wantErr: "code = NotFound desc = no such document",
+		},
+		{
+			name: "message too large",
+			fetch: func(_ context.Context, name string) (*configpb.Document, error) {
+				return &configpb.Document{Name: name, Format: "yaml", Data: make([]byte, 100)}, nil
+			},
+			config:  func(c *GRPCConfig) { c.MaxMessageSize = 64 },
+			wantErr: "code = ResourceExhausted",
+		},
+		{
+			name: "keepalive",
+			fetch: func(_ context.Context, name string) (*configpb.Document, error) {
+				return &configpb.Document{Name: name, Format: "yaml", Data: []byte("a: 1\n")}, nil
+			},
+			config:  func(c *GRPCConfig) { c.Keepalive = keepalive.ClientParameters{Time: time.Minute} },
+			wantRel: "myapp.yaml",
+			want:    "a: 1\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newGRPCTestServer(t, &grpcTestServer{fetch: tt.fetch})
+			if tt.config != nil {
+				tt.config(&c)
+			}
+			s := &grpcSource{config: c}
+			defer s.close()
+			docs, err := s.load(context.Background(), func(string) bool { return true })
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("load() error = %v", err)
+			}
+			if len(docs) != 1 || docs[0].rel != tt.wantRel || string(docs[0].data) != tt.want {
+				t.Errorf("load() = %+v, want %s with %q", docs, tt.wantRel, tt.want)
+			}
+			if docs[0].name != "grpc:"+c.Address+"/myapp" {
+				t.Errorf("name = %s, want grpc:%s/myapp", docs[0].name, c.Address)
+			}
+		})
+	}
+}
+
+func TestGRPCSourceTLS(t *testing.T) {
+	// the certificate of httptest is valid for example.com and 127.0.0.1
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+	cert := ts.TLS.Certificates[0]
+	roots := ts.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	fetch := func(_ context.Context, name string) (*configpb.Document, error) {
+		return &configpb.Document{Name: name, Format: "yaml", Data: []byte("a: 1\n")}, nil
+	}
+	c := newGRPCTestServer(t, &grpcTestServer{fetch: fetch}, grpc.Creds(credentials.NewServerTLSFromCert(&cert)))
+
+	c.Credentials = credentials.NewTLS(&tls.Config{RootCAs: roots})
+	s := &grpcSource{config: c}
+	defer s.close()
+	if _, err := s.load(context.Background(), func(string) bool { return true }); err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+
+	// the default credentials verify the certificate with the system's roots
+	c.Credentials = nil
+	s = &grpcSource{config: c}
+	defer s.close()
+	_, err := s.load(context.Background(), func(string) bool { return true })
+	if err == nil || !strings.Contains(err.Error(), "code = Unavailable") {
+		t.Fatalf("load() error = %v, want Unavailable", err)
+	}
+}
+
+func TestGRPCSourceStream(t *testing.T) {
+	var mu sync.Mutex
+	current := &configpb.Document{Format: "yaml", Data: []byte("port: 8080\n")}
+	server := &grpcTestServer{
+		fetch: func(context.Context, string) (*configpb.Document, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return current, nil
+		},
+		updates: make(chan *configpb.Document),
+	}
+	c := newGRPCTestServer(t, server)
+	h, err := New(WithGRPC(c), WithAutoReload())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got, _ := Get[int](h, "port"); got != 8080 {
+		t.Fatalf("port = %d, want 8080", got)
+	}
+	start(t, h)
+
+	steps := []string{"port: 9090\n", "port: 9091\n"}
+	for _, data := range steps {
+		doc := &configpb.Document{Format: "yaml", Data: []byte(data)}
+		mu.Lock()
+		current = doc
+		mu.Unlock()
+		server.updates <- doc
+		want := strings.TrimSuffix(strings.TrimPrefix(data, "port: "), "\n")
+		eventually(t, "port "+want, func() bool {
+			got, _ := Get[string](h, "port")
+			return got == want
+		})
+	}
+}
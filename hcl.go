@@ -0,0 +1,379 @@
+package hydra
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+// hclCodec decodes and encodes files of the native syntax of HCL2, e.g. Terraform or Nomad
+// configuration, parsed and evaluated with github.com/hashicorp/hcl/v2. Attributes are keys,
+// and blocks are nested under their types and labels, e.g. `service "web" { port = 80 }` as
+// "service.web.port", while repeated blocks without labels are lists.
+//
+// Expressions of attributes are evaluated, including operators, conditionals, templates,
+// heredocs, for expressions and calls of common functions like upper or merge. Variables refer
+// to the attributes and blocks at the top level of the file, e.g. "${port}" or
+// "service.web.port".
+type hclCodec struct{}
+
+func (hclCodec) Decode(b []byte, v map[string]any) error {
+	file, diags := hclsyntax.ParseConfig(b, "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return fmt.Errorf("parse: %w", hclDiagnostics(diags))
+	}
+	body := file.Body.(*hclsyntax.Body)
+
+	s := &hclScope{
+		attributes: body.Attributes,
+		blocks:     make(map[string][]*hclsyntax.Block),
+		values:     make(map[string]cty.Value),
+		evaluating: make(map[string]bool),
+	}
+	for _, block := range body.Blocks {
+		if attr, ok := body.Attributes[block.Type]; ok {
+			return fmt.Errorf("duplicate attribute (name: %s, line: %d)", block.Type, attr.SrcRange.Start.Line)
+		}
+		s.blocks[block.Type] = append(s.blocks[block.Type], block)
+	}
+
+	for _, name := range s.names() {
+		value, err := s.value(name)
+		if err != nil {
+			return err
+		}
+		v[name], err = hclGoValue(value)
+		if err != nil {
+			return fmt.Errorf("decode key (key: %s): %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (hclCodec) Encode(v map[string]any) ([]byte, error) {
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var b bytes.Buffer
+	for _, key := range keys {
+		// JSON values are valid expressions
+		value, err := json.MarshalIndent(v[key], "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("encode key (key: %s): %w", key, err)
+		}
+		if !hclsyntax.ValidIdentifier(key) {
+			return nil, fmt.Errorf("encode key (key: %s): not an identifier", key)
+		}
+		fmt.Fprintf(&b, "%s = %s\n", key, value)
+	}
+	return b.Bytes(), nil
+}
+
+// hclScope evaluates the attributes and blocks at the top level of a file, which variables
+// refer to, once they are referred to.
+type hclScope struct {
+	attributes hclsyntax.Attributes
+	blocks     map[string][]*hclsyntax.Block
+	values     map[string]cty.Value
+	evaluating map[string]bool
+}
+
+// names returns the names of the attributes and block types at the top level, in the order
+// they appear in, so the first error of the file is reported.
+func (s *hclScope) names() []string {
+	names := make([]string, 0, len(s.attributes)+len(s.blocks))
+	for _, attr := range hclAttributes(s.attributes) {
+		names = append(names, attr.Name)
+	}
+	for name := range s.blocks {
+		names = append(names, name)
+	}
+	slices.SortStableFunc(names, func(a, b string) int {
+		return s.offset(a) - s.offset(b)
+	})
+	return names
+}
+
+// offset returns the byte offset of the attribute or the first block with the name.
+func (s *hclScope) offset(name string) int {
+	if attr, ok := s.attributes[name]; ok {
+		return attr.SrcRange.Start.Byte
+	}
+	return s.blocks[name][0].TypeRange.Start.Byte
+}
+
+// hclAttributes returns the attributes in the order they appear in.
+func hclAttributes(attrs hclsyntax.Attributes) []*hclsyntax.Attribute {
+	sorted := make([]*hclsyntax.Attribute, 0, len(attrs))
+	for _, attr := range attrs {
+		sorted = append(sorted, attr)
+	}
+	slices.SortFunc(sorted, func(a, b *hclsyntax.Attribute) int {
+		return a.SrcRange.Start.Byte - b.SrcRange.Start.Byte
+	})
+	return sorted
+}
+
+// value returns the value of the attribute or the blocks at the top level with the name.
+func (s *hclScope) value(name string) (cty.Value, error) {
+	if v, ok := s.values[name]; ok {
+		return v, nil
+	}
+	s.evaluating[name] = true
+	defer delete(s.evaluating, name)
+
+	var v cty.Value
+	var err error
+	if attr, ok := s.attributes[name]; ok {
+		v, err = s.evalAttribute(attr)
+	} else {
+		v, err = s.evalBlocks(s.blocks[name])
+	}
+	if err != nil {
+		return cty.NilVal, err
+	}
+	s.values[name] = v
+	return v, nil
+}
+
+// evalAttribute returns the value of the expression of the attribute.
+func (s *hclScope) evalAttribute(attr *hclsyntax.Attribute) (cty.Value, error) {
+	vars := make(map[string]cty.Value)
+	for _, traversal := range attr.Expr.Variables() {
+		name := traversal.RootName()
+		if _, ok := vars[name]; ok {
+			continue
+		}
+		if _, ok := s.attributes[name]; !ok && len(s.blocks[name]) == 0 {
+			// unknown variables are reported by the evaluation
+			continue
+		}
+		if s.evaluating[name] {
+			start := traversal.SourceRange().Start
+			return cty.NilVal, fmt.Errorf("line %d, column %d: cycle in references of %s", start.Line, start.Column, name)
+		}
+		v, err := s.value(name)
+		if err != nil {
+			return cty.NilVal, err
+		}
+		vars[name] = v
+	}
+
+	v, diags := attr.Expr.Value(&hcl.EvalContext{Variables: vars, Functions: hclFunctions})
+	if diags.HasErrors() {
+		return cty.NilVal, fmt.Errorf("evaluate attribute (name: %s): %w", attr.Name, hclDiagnostics(diags))
+	}
+	return v, nil
+}
+
+// evalBlocks returns the value of the blocks of the same type.
+func (s *hclScope) evalBlocks(blocks []*hclsyntax.Block) (cty.Value, error) {
+	var list []cty.Value
+	labeled := make(map[string]any)
+	for _, block := range blocks {
+		body, err := s.evalBody(block.Body)
+		if err != nil {
+			return cty.NilVal, err
+		}
+		if len(block.Labels) == 0 {
+			list = append(list, cty.ObjectVal(body))
+			continue
+		}
+
+		m := labeled
+		for _, label := range block.Labels[:len(block.Labels)-1] {
+			next, ok := m[label].(map[string]any)
+			if !ok {
+				next = make(map[string]any)
+				m[label] = next
+			}
+			m = next
+		}
+		last := block.Labels[len(block.Labels)-1]
+		if prev, ok := m[last].(map[string]cty.Value); ok {
+			// blocks with the same labels are merged
+			for k, v := range body {
+				prev[k] = v
+			}
+			continue
+		}
+		m[last] = body
+	}
+
+	switch {
+	case len(list) == 1 && len(labeled) == 0:
+		return list[0], nil
+	case len(list) > 0 && len(labeled) == 0:
+		return cty.TupleVal(list), nil
+	case len(list) > 0:
+		return cty.NilVal, fmt.Errorf("blocks with and without labels (type: %s, line: %d)", blocks[0].Type, blocks[0].TypeRange.Start.Line)
+	default:
+		return hclLabeledValue(labeled), nil
+	}
+}
+
+// hclLabeledValue returns the object of the blocks nested under their labels.
+func hclLabeledValue(labeled map[string]any) cty.Value {
+	attrs := make(map[string]cty.Value, len(labeled))
+	for label, v := range labeled {
+		switch v := v.(type) {
+		case map[string]any:
+			attrs[label] = hclLabeledValue(v)
+		case map[string]cty.Value:
+			attrs[label] = cty.ObjectVal(v)
+		}
+	}
+	return cty.ObjectVal(attrs)
+}
+
+// evalBody returns the attributes and blocks of the body of a block.
+func (s *hclScope) evalBody(body *hclsyntax.Body) (map[string]cty.Value, error) {
+	m := make(map[string]cty.Value, len(body.Attributes))
+	for _, attr := range hclAttributes(body.Attributes) {
+		v, err := s.evalAttribute(attr)
+		if err != nil {
+			return nil, err
+		}
+		m[attr.Name] = v
+	}
+
+	byType := make(map[string][]*hclsyntax.Block)
+	var types []string
+	for _, block := range body.Blocks {
+		if attr, ok := body.Attributes[block.Type]; ok {
+			return nil, fmt.Errorf("duplicate attribute (name: %s, line: %d)", block.Type, attr.SrcRange.Start.Line)
+		}
+		if len(byType[block.Type]) == 0 {
+			types = append(types, block.Type)
+		}
+		byType[block.Type] = append(byType[block.Type], block)
+	}
+	for _, typ := range types {
+		v, err := s.evalBlocks(byType[typ])
+		if err != nil {
+			return nil, err
+		}
+		m[typ] = v
+	}
+	return m, nil
+}
+
+// hclDiagnostics returns the first error of the diagnostics with its position, e.g.
+// "line 2, column 6: Missing expression; Expected the start of an expression".
+func hclDiagnostics(diags hcl.Diagnostics) error {
+	for _, diag := range diags {
+		if diag.Severity != hcl.DiagError {
+			continue
+		}
+		msg := diag.Summary
+		if diag.Detail != "" {
+			msg += "; " + diag.Detail
+		}
+		if diag.Subject != nil {
+			return fmt.Errorf("line %d, column %d: %s", diag.Subject.Start.Line, diag.Subject.Start.Column, msg)
+		}
+		return errors.New(msg)
+	}
+	return diags
+}
+
+// hclGoValue converts the value to strings, int64 or float64 numbers, bools, maps and slices.
+func hclGoValue(v cty.Value) (any, error) {
+	if v.IsNull() {
+		return nil, nil
+	}
+	if !v.IsWhollyKnown() {
+		return nil, errors.New("unknown value")
+	}
+
+	ty := v.Type()
+	switch {
+	case ty == cty.String:
+		return v.AsString(), nil
+	case ty == cty.Bool:
+		return v.True(), nil
+	case ty == cty.Number:
+		f := v.AsBigFloat()
+		if n, acc := f.Int64(); acc == big.Exact {
+			return n, nil
+		}
+		n, _ := f.Float64()
+		return n, nil
+	case ty.IsObjectType() || ty.IsMapType():
+		m := make(map[string]any, v.LengthInt())
+		for it := v.ElementIterator(); it.Next(); {
+			key, elem := it.Element()
+			value, err := hclGoValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			m[key.AsString()] = value
+		}
+		return m, nil
+	case ty.IsTupleType() || ty.IsListType() || ty.IsSetType():
+		list := make([]any, 0, v.LengthInt())
+		for it := v.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			value, err := hclGoValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %s", ty.FriendlyName())
+	}
+}
+
+// hclFunctions are the functions expressions can call, named like Terraform's.
+var hclFunctions = map[string]function.Function{
+	"upper":      stdlib.UpperFunc,
+	"lower":      stdlib.LowerFunc,
+	"trimspace":  stdlib.TrimSpaceFunc,
+	"tostring":   stdlib.MakeToFunc(cty.String),
+	"tonumber":   stdlib.MakeToFunc(cty.Number),
+	"tobool":     stdlib.MakeToFunc(cty.Bool),
+	"join":       stdlib.JoinFunc,
+	"split":      stdlib.SplitFunc,
+	"replace":    stdlib.ReplaceFunc,
+	"format":     stdlib.FormatFunc,
+	"length":     hclLengthFunc,
+	"concat":     stdlib.ConcatFunc,
+	"contains":   stdlib.ContainsFunc,
+	"merge":      stdlib.MergeFunc,
+	"keys":       stdlib.KeysFunc,
+	"lookup":     stdlib.LookupFunc,
+	"coalesce":   stdlib.CoalesceFunc,
+	"min":        stdlib.MinFunc,
+	"max":        stdlib.MaxFunc,
+	"abs":        stdlib.AbsoluteFunc,
+	"jsonencode": stdlib.JSONEncodeFunc,
+}
+
+// hclLengthFunc returns the number of characters of a string or the number of elements of a
+// collection, like Terraform's length.
+var hclLengthFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "value", Type: cty.DynamicPseudoType, AllowDynamicType: true, AllowMarked: true},
+	},
+	Type: function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+		if args[0].Type() == cty.String {
+			return stdlib.Strlen(args[0])
+		}
+		return stdlib.Length(args[0])
+	},
+})
@@ -0,0 +1,162 @@
+package hydra
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHCLCodecDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]any
+	}{
+		{
+			name: "attributes",
+			in:   "name = \"app\"\nport = 8080\nratio = 0.5\ndebug = true\nnothing = null\n",
+			want: map[string]any{"name": "app", "port": int64(8080), "ratio": 0.5, "debug": true, "nothing": nil},
+		},
+		{
+			name: "labeled blocks",
+			in:   "service \"web\" {\n  port = 80\n}\nservice \"api\" {\n  port = 8080\n}\n",
+			want: map[string]any{"service": map[string]any{
+				"web": map[string]any{"port": int64(80)},
+				"api": map[string]any{"port": int64(8080)},
+			}},
+		},
+		{
+			name: "nested labels",
+			in:   "resource \"aws_instance\" \"web\" {\n  ami = \"abc\"\n}\n",
+			want: map[string]any{"resource": map[string]any{
+				"aws_instance": map[string]any{"web": map[string]any{"ami": "abc"}},
+			}},
+		},
+		{
+			name: "merged blocks",
+			in:   "service \"web\" {\n  port = 80\n}\nservice \"web\" {\n  host = \"h\"\n}\n",
+			want: map[string]any{"service": map[string]any{"web": map[string]any{"port": int64(80), "host": "h"}}},
+		},
+		{
+			name: "block",
+			in:   "server {\n  port = 80\n  tls {\n    enabled = true\n  }\n}\n",
+			want: map[string]any{"server": map[string]any{"port": int64(80), "tls": map[string]any{"enabled": true}}},
+		},
+		{
+			name: "repeated blocks",
+			in:   "rule {\n  path = \"/a\"\n}\nrule {\n  path = \"/b\"\n}\n",
+			want: map[string]any{"rule": []any{map[string]any{"path": "/a"}, map[string]any{"path": "/b"}}},
+		},
+		{
+			name: "expressions",
+			in: "base = 8000\nport = base + 80\nhost = \"${name}.local\"\nname = upper(\"app\")\n" +
+				"prod = port > 8000 ? \"yes\" : \"no\"\nlist = [for i in [1, 2] : i * 2]\n",
+			want: map[string]any{
+				"base": int64(8000), "port": int64(8080), "host": "APP.local", "name": "APP",
+				"prod": "yes", "list": []any{int64(2), int64(4)},
+			},
+		},
+		{
+			name: "references to blocks",
+			in:   "service \"web\" {\n  port = 80\n}\nurl = \"http://web:${service.web.port}\"\n",
+			want: map[string]any{
+				"service": map[string]any{"web": map[string]any{"port": int64(80)}},
+				"url":     "http://web:80",
+			},
+		},
+		{
+			name: "heredoc and functions",
+			in: "motd = <<-EOT\n  hello\n  EOT\nn = length(\"héllo\")\nm = merge({a = 1}, {b = 2})\n" +
+				"j = join(\",\", [\"a\", \"b\"])\nk = keys({x = 1, y = 2})\n",
+			want: map[string]any{
+				"motd": "hello\n", "n": int64(5), "m": map[string]any{"a": int64(1), "b": int64(2)},
+				"j": "a,b", "k": []any{"x", "y"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]any{}
+			err := hclCodec{}.Decode([]byte(tt.in), got)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHCLCodecDecodeError(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		want   string
+		line   int
+		column int
+	}{
+		{name: "syntax", in: "a = 1\nb = \n", want: "parse: line 2, column 5: Invalid expression", line: 2, column: 5},
+		{name: "duplicate attribute", in: "a = 1\na = 2\n", want: "Attribute redefined", line: 2, column: 1},
+		{name: "unknown variable", in: "a = 1\nb = c + 1\n", want: "evaluate attribute (name: b)", line: 2, column: 5},
+		{name: "cycle", in: "a = b\nb = a\n", want: "cycle in references of a", line: 2, column: 5},
+		{name: "type", in: "a = \"x\" * 2\n", want: "Invalid operand", line: 1, column: 5},
+		{name: "unknown function", in: "a = nope(1)\n", want: "Call to unknown function", line: 1, column: 5},
+		{name: "blocks with and without labels", in: "s {}\ns \"x\" {}\n", want: "blocks with and without labels (type: s, line: 1)", line: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := hclCodec{}.Decode([]byte(tt.in), map[string]any{})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Decode() error = %v, want %q", err, tt.want)
+			}
+			line, column := errorPosition(err, []byte(tt.in))
+			if line != tt.line || column != tt.column {
+				t.Errorf("position of %q = %d:%d, want %d:%d", err, line, column, tt.line, tt.column)
+			}
+		})
+	}
+}
+
+func TestHCLCodecRoundTrip(t *testing.T) {
+	in := map[string]any{
+		"name":   "app",
+		"port":   int64(8080),
+		"ratio":  0.5,
+		"hosts":  []any{"a", "b"},
+		"server": map[string]any{"tls": true},
+	}
+	b, err := hclCodec{}.Encode(in)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	got := map[string]any{}
+	err = hclCodec{}.Decode(b, got)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, in) {
+		t.Errorf("Decode(Encode()) = %v, want %v", got, in)
+	}
+}
+
+func TestHCLFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.hcl"), "service \"web\" {\n  port = 80\n}\n")
+	writeFile(t, filepath.Join(dir, "prod.tfvars"), "region = \"eu-west-1\"\nzones = [\"a\", \"b\"]\n")
+	h, err := New(WithPaths(dir))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+	if got, err := Get[int](h, "service.web.port"); err != nil || got != 80 {
+		t.Errorf("Get(service.web.port) = %d, %v, want 80", got, err)
+	}
+	if got, err := Get[[]string](h, "zones"); err != nil || !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("Get(zones) = %v, %v, want [a b]", got, err)
+	}
+	if got, _ := Get[string](h, "region"); got != "eu-west-1" {
+		t.Errorf("Get(region) = %q, want eu-west-1", got)
+	}
+}
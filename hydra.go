@@ -4,15 +4,32 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"reflect"
 	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
 )
 
+// replaceWindow is how long a renamed or removed configuration file may take to be recreated
+// before it's treated as removed. Editors and tools like sed -i save files atomically by
+// renaming a temporary file over the original one.
+const replaceWindow = 100 * time.Millisecond
+
+// volumeDataLink is the symlink kubelet swaps to update ConfigMap and Secret volumes.
+const volumeDataLink = "..data"
+
+// ErrClosed is returned by Start when hydra has been closed.
+var ErrClosed = errors.New("hydra closed")
+
 // Hydra extends Viper's functionality by adding support for watching and loading multiple
 // configuration files.
 //
@@ -25,21 +42,149 @@ type Hydra struct {
 	watcher     *fsnotify.Watcher
 	options     *options
 	configFiles []string
+	layers      map[string]*layer
+	settings    map[string]any
+	origins     map[string]string
+	polled      map[string]fileState
+	// documents are the loaded documents of sources, see WithFS.
+	documents map[string]sourcedDocument
+	// stagedDocuments are the documents loaded by a rescan being staged, which are looked up
+	// instead of the loaded ones until they're committed or discarded, see stageScan.
+	stagedDocuments map[string]sourcedDocument
+	// dotEnv are the names of the environment variables set for entries of .env files, see
+	// DotEnvEnvironment.
+	dotEnv map[string]bool
+	// jsonnetImports are the files imported by Jsonnet files, see evalJsonnet.
+	jsonnetImports map[string][]string
+
+	// reloadMu serializes reloads of the configuration.
+	reloadMu sync.Mutex
+	paused   atomic.Bool
+	// viperMu guards the configuration of viper, which commit replaces while it's held, so
+	// readers never see it half replaced.
+	viperMu sync.RWMutex
+	// prefixed is the subtree placed under the key prefix in viper, which is held by viper and
+	// replaced in place, see installPrefixed.
+	prefixed map[string]any
+
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu          sync.Mutex
+	notify      NotifyFunc
+	subscribers []*subscriber
+	streams     []*stream
+	// changeHandlers are registered by OnChange.
+	changeHandlers []*changeHandler
+	// unwatchable are paths polled because they couldn't be added to the watcher.
+	unwatchable []string
+	// validatedStructs are registered by UnmarshalValidated.
+	validatedStructs []validatedStruct
 }
 
 // New creates a new hydra instance.
 func New(opts ...Option) (*Hydra, error) {
+	return NewWithContext(context.Background(), opts...)
+}
 
+// NewWithContext creates a new hydra instance. Searching the paths for configuration files and
+// loading them stops once the context is done, even if blocked by an unresponsive filesystem.
+func NewWithContext(ctx context.Context, opts ...Option) (*Hydra, error) {
+	registry := newCodecRegistry()
 	o := options{
-		supportedExtensions: viper.SupportedExts,
-		paths:               []string{"."},
+		supportedExtensions: supportedExtensions(),
+		decoderRegistry:     registry,
+		ops:                 fsnotify.Create | fsnotify.Write | fsnotify.Remove | fsnotify.Rename,
 	}
 	for _, opt := range opts {
 		opt(&o)
 	}
+	if o.xml != nil && o.decoderRegistry == viper.DecoderRegistry(registry) {
+		if err := checkRegisteredCodecs("xml"); err != nil {
+			return nil, err
+		}
+		// registering codecs doesn't fail
+		_ = registry.RegisterCodec("xml", xmlCodec{config: *o.xml})
+	}
+	if o.yamlDocuments != YAMLFirstDocument && o.decoderRegistry == viper.DecoderRegistry(registry) {
+		if err := checkRegisteredCodecs("yaml", "yml"); err != nil {
+			return nil, err
+		}
+		c := yamlCodec{mode: o.yamlDocuments, merge: o.mergeStrategy}
+		_ = registry.RegisterCodec("yaml", c)
+		_ = registry.RegisterCodec("yml", c)
+	}
+	if o.textProto != nil {
+		c, err := newTextProtoCodec(*o.textProto)
+		if err != nil {
+			return nil, err
+		}
+		if o.decoderRegistry == viper.DecoderRegistry(registry) {
+			if err := checkRegisteredCodecs("textproto", "txtpb"); err != nil {
+				return nil, err
+			}
+			_ = registry.RegisterCodec("textproto", c)
+			_ = registry.RegisterCodec("txtpb", c)
+		}
+	}
+	for _, t := range o.strictKeys {
+		if t == nil || t.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("strict keys (type: %v): not a struct", t)
+		}
+	}
+	for _, s := range o.structs {
+		if s.typ == nil || s.typ.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("decode config (type: %v): not a struct", s.typ)
+		}
+	}
+	if o.cueSchema != nil {
+		err := compileCUESchema(o.cueSchema)
+		if err != nil {
+			return nil, fmt.Errorf("compile cue schema: %w", err)
+		}
+	}
+	if o.jsonSchema != nil {
+		schema, err := compileJSONSchema(o.jsonSchema)
+		if err != nil {
+			return nil, fmt.Errorf("compile json schema: %w", err)
+		}
+		o.schema = schema
+	}
+	for _, ext := range o.formats {
+		if !slices.Contains(o.supportedExtensions, ext) {
+			o.supportedExtensions = append(slices.Clone(o.supportedExtensions), ext)
+		}
+	}
+	for ext, format := range o.extensionAliases {
+		if !isJsonnet(format) {
+			_, err := o.decoderRegistry.Decoder(format)
+			if err != nil {
+				return nil, fmt.Errorf("alias extension (extension: %s, format: %s): %w", ext, format, err)
+			}
+		}
+		if !slices.Contains(o.supportedExtensions, ext) {
+			o.supportedExtensions = append(slices.Clone(o.supportedExtensions), ext)
+		}
+	}
+	if o.paths == nil && len(o.sources) == 0 {
+		// hydra configured with sources only doesn't pick up files of the working directory
+		o.paths = []string{"."}
+	}
+	if len(o.defaultsFiles) > 0 {
+		o.paths = append(slices.Clone(o.defaultsFiles), o.paths...)
+		for _, path := range o.defaultsFiles {
+			Priority(math.MinInt)(&o, path)
+		}
+	}
+	if len(o.overrideFiles) > 0 {
+		o.paths = append(slices.Clone(o.paths), o.overrideFiles...)
+		for _, path := range o.overrideFiles {
+			Priority(math.MaxInt)(&o, path)
+		}
+	}
 
 	if o.viper == nil {
-		o.viper = viper.New()
+		o.viper = viper.NewWithOptions(o.viperOptions...)
 	}
 
 	w, err := fsnotify.NewWatcher()
@@ -48,101 +193,654 @@ func New(opts ...Option) (*Hydra, error) {
 	}
 
 	h := Hydra{
-		viper:   o.viper,
-		watcher: w,
-		options: &o,
+		viper:     o.viper,
+		watcher:   w,
+		options:   &o,
+		layers:    make(map[string]*layer),
+		documents: make(map[string]sourcedDocument),
+		dotEnv:    make(map[string]bool),
+		closed:    make(chan struct{}),
+
+		jsonnetImports: make(map[string][]string),
+	}
+
+	// loading runs separately, so it can be abandoned if stuck in a blocking filesystem call
+	loaded := make(chan error, 1)
+	go func() {
+		loaded <- h.load(ctx)
+	}()
+
+	select {
+	case err = <-loaded:
+	case <-ctx.Done():
+		// the sources are released once the abandoned loading returns
+		w.Close()
+		go func() {
+			<-loaded
+			h.closeSources()
+		}()
+		if h.options.dryRun {
+			// the files found so far are still being loaded
+			return nil, &ValidationReport{Errs: []error{ctx.Err()}}
+		}
+		return nil, ctx.Err()
+	}
+	if err != nil && h.options.dryRun {
+		h.release()
+		return nil, &ValidationReport{Files: h.configFiles, Errs: []error{err}}
+	}
+	if err != nil {
+		h.release()
+		return nil, err
 	}
 
-	for _, path := range o.paths {
-		err := h.addPath(path)
+	st, err := h.stage(h.configFiles, h.layers)
+	if h.options.dryRun {
+		h.release()
+		if err != nil {
+			return nil, &ValidationReport{Files: h.configFiles, Errs: []error{err}}
+		}
+		return nil, h.report(st)
+	}
+	if err == nil {
+		err = h.validate(st)
 		if err != nil {
-			return nil, fmt.Errorf("add path (path: %s): %w", path, err)
+			h.release()
+			return nil, err
 		}
+		err = h.commit(st)
+	}
+	if err != nil {
+		h.release()
+		return nil, fmt.Errorf("merge config files: %w", err)
+	}
+	for _, err := range st.conflicts {
+		h.reportError(err)
 	}
 
 	return &h, nil
 }
 
-// Start starts watching for changes in the configuration.
+// release releases the resources of hydra failing to be created.
+func (h *Hydra) release() {
+	h.watcher.Close()
+	h.closeSources()
+}
+
+// load searches the paths for configuration files and reads them.
+func (h *Hydra) load(ctx context.Context) error {
+	for _, path := range h.options.paths {
+		err := h.addPath(ctx, path)
+		if errors.Is(err, os.ErrNotExist) && slices.Contains(h.options.overrideFiles, path) {
+			// override files are optional
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("add path (path: %s): %w", path, err)
+		}
+	}
+	for i, s := range h.options.sources {
+		err := h.addSource(ctx, i)
+		if err != nil {
+			return fmt.Errorf("add source (source: %s): %w", s.id, err)
+		}
+	}
+	h.sortLoadOrder(h.configFiles)
+
+	_, err := h.poll(ctx)
+	if err != nil {
+		return fmt.Errorf("poll paths: %w", err)
+	}
+
+	return nil
+}
+
+// Start starts watching for changes in the configuration. notify may be nil if changes are
+// consumed by subscribers only (see Subscribe). It blocks until the context is done or hydra
+// is closed, and releases all resources of hydra, like Close, before returning.
+//
+// Calling Start is optional, hydra merges the configuration files on creation. Without
+// Start, Close should be called to release the watcher once hydra isn't needed anymore.
+//
+// If auto reload is enabled by WithAutoReload, the changed file is merged into viper before
+// notify is invoked and the change contains the keys affected by the reload. If debouncing is
+// enabled by WithDebounce, bursts of events for the same file are coalesced and notify is
+// invoked once the debounce window of the file closes. If the rate of reloads is limited by
+// WithMaxReloadRate, changes exceeding the limit are collapsed into a single trailing reload.
+//
+// Directories created in watched paths are watched as well, and configuration files found in
+// them are handled as if they were just created. A configuration file that is atomically
+// replaced, i.e. another file is renamed over it, or it's renamed or removed and recreated
+// shortly after, is handled as written. When
+// changes are detected by Hash, a configuration file found empty is read again shortly after,
+// so a file truncated before being rewritten in place isn't applied half written.
 func (h *Hydra) Start(ctx context.Context, notify NotifyFunc) error {
+	if h.isClosed() {
+		return ErrClosed
+	}
+	defer h.Close()
+
+	h.mu.Lock()
+	h.notify = notify
+	h.mu.Unlock()
+
+	var debounced <-chan time.Time
+	var d *debouncer
+	if h.options.debounce > 0 {
+		d = newDebouncer(h.options.debounce)
+		defer d.stop()
+		debounced = d.C()
+	}
+
+	replaced := newDebouncer(replaceWindow)
+	defer replaced.stop()
+
+	var polling <-chan time.Time
+	if interval := h.pollInterval(); interval > 0 {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		polling = t.C
+	}
+
+	var rescanning <-chan time.Time
+	if h.options.rescanInterval > 0 {
+		t := time.NewTicker(h.options.rescanInterval)
+		defer t.Stop()
+		rescanning = t.C
+	}
+
+	// sources are watched separately, so a slow source doesn't block handling other changes
+	sourceEvents := make(chan []fsnotify.Event)
+	sourceCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	h.watchSources(sourceCtx, sourceEvents)
+
+	var limited <-chan time.Time
+	var l *rateLimiter
+	if h.options.maxReloads > 0 {
+		l = newRateLimiter(h.options.maxReloads, h.options.reloadWindow)
+		defer l.stop()
+		limited = l.C()
+	}
+
+	reload := func(ev fsnotify.Event) {
+		if l != nil && !l.allow() {
+			l.hold(ev)
+			return
+		}
+		h.handle(ev)
+	}
+
+	process := func(ev fsnotify.Event) {
+		if d != nil {
+			d.add(ev)
+			return
+		}
+		reload(ev)
+	}
+
+	watchErrors := h.watcher.Errors
 	for {
 		select {
 		case ev, ok := <-h.watcher.Events:
+			if !ok && h.isClosed() {
+				return nil
+			}
 			if !ok {
-				return errors.New("watcher unexpectedly closed")
+				cause := errors.New("watcher unexpectedly closed")
+				if !h.options.watcherRecovery {
+					return cause
+				}
+
+				err := h.recoverWatcher()
+				if err != nil {
+					return fmt.Errorf("recover watcher (cause: %w): %w", cause, err)
+				}
+
+				watchErrors = h.watcher.Errors
+				if h.options.onRecover != nil {
+					h.options.onRecover(cause)
+				}
+				continue
+			}
+
+			if h.options.kubernetesVolumes && isVolumeInternal(ev.Name) {
+				if filepath.Base(ev.Name) == volumeDataLink && ev.Op&fsnotify.Create != 0 {
+					// the payload of the volume has been swapped
+					process(fsnotify.Event{Name: filepath.Dir(ev.Name), Op: fsnotify.Write})
+				}
+				continue
 			}
 
-			ext := strings.TrimPrefix(filepath.Ext(ev.Name), ".")
-			if !slices.Contains(h.options.supportedExtensions, ext) {
+			if ev.Op&h.options.ops != 0 {
+				for _, importer := range h.importers(ev.Name) {
+					// Jsonnet files importing the file are rendered again
+					process(fsnotify.Event{Name: importer, Op: fsnotify.Write})
+				}
+			}
+
+			if !h.isWatched(ev.Name) {
+				// event about another file in the directory of a configured file
+				continue
+			}
+
+			if ev.Op&fsnotify.Create != 0 && isDir(ev.Name) {
+				files, err := h.watchPath(ctx, ev.Name)
+				if err != nil && ctx.Err() != nil {
+					// stopping
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("watch created directory (path: %s): %w", ev.Name, err)
+				}
+
+				for _, file := range files {
+					process(fsnotify.Event{Name: file, Op: fsnotify.Create})
+				}
+				continue
+			}
+
+			if !slices.Contains(h.options.supportedExtensions, h.configExt(ev.Name)) {
 				// file extension is not supported, so no config is loaded
 				continue
 			}
 
-			if ev.Op&(fsnotify.Remove|fsnotify.Create|fsnotify.Rename|fsnotify.Write) == 0 {
+			if ev.Op&fsnotify.Create != 0 && h.isConfigFile(ev.Name) {
+				// another file has been renamed over the configuration file
+				ev.Op = ev.Op&^fsnotify.Create | fsnotify.Write
+			}
+
+			if ev.Op&h.options.ops == 0 {
 				// operation does not trigger the file change
 				continue
 			}
 
-			notify(ev.Name, ev.Op)
+			if h.isOtherEnvironment(ev.Name) {
+				// overlay of another environment isn't loaded
+				continue
+			}
+
+			if replaced.has(ev.Name) || (ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0 && h.isConfigFile(ev.Name)) {
+				// wait for the file to be recreated
+				replaced.add(ev)
+				continue
+			}
+
+			if h.truncated(ev) {
+				// wait for the file to be rewritten, it's read again in any case
+				replaced.add(ev)
+				continue
+			}
+
+			process(ev)
+		case <-replaced.C():
+			for _, ev := range replaced.flush() {
+				if _, err := os.Stat(ev.Name); err != nil {
+					ev.Op &= fsnotify.Remove | fsnotify.Rename
+				} else {
+					ev.Op = fsnotify.Write
+				}
+
+				process(ev)
+			}
+		case err, ok := <-watchErrors:
+			if !ok {
+				// the watcher is closed, which is handled on closing of its events channel
+				watchErrors = nil
+				continue
+			}
+
+			h.reportError(err)
+
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				// events were lost, so changes are detected by comparing the files with their
+				// last known state
+				events, err := h.drift(ctx)
+				if err != nil && ctx.Err() != nil {
+					// stopping
+					continue
+				}
+				if err != nil {
+					h.reportError(fmt.Errorf("detect changes after event overflow: %w", err))
+					continue
+				}
+
+				for _, ev := range events {
+					process(ev)
+				}
+			}
+		case <-polling:
+			if h.paused.Load() {
+				continue
+			}
+
+			events, err := h.poll(ctx)
+			if err != nil && ctx.Err() != nil {
+				// stopping
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("poll paths: %w", err)
+			}
+
+			for _, ev := range events {
+				if ev.Op&h.options.ops != 0 {
+					process(ev)
+				}
+			}
+		case events := <-sourceEvents:
+			for _, ev := range events {
+				if ev.Op&h.options.ops != 0 {
+					process(ev)
+				}
+			}
+		case <-rescanning:
+			if h.paused.Load() {
+				continue
+			}
+
+			events, err := h.drift(ctx)
+			if err != nil && ctx.Err() != nil {
+				// stopping
+				continue
+			}
+			if err != nil {
+				h.reportError(fmt.Errorf("detect changes by rescan: %w", err))
+				continue
+			}
+
+			if len(events) > 0 {
+				h.handleRescan()
+			}
+		case <-debounced:
+			for _, ev := range d.flush() {
+				reload(ev)
+			}
+		case <-limited:
+			events := l.release()
+			if len(events) > 1 && h.options.autoReload {
+				// changes of multiple files are collapsed into a single reload
+				h.handleRescan()
+				continue
+			}
+
+			for _, ev := range events {
+				h.handle(ev)
+			}
+		case <-h.closed:
+			return nil
 		case <-ctx.Done():
-			err := h.watcher.Close()
+			err := h.Close()
 			if err != nil {
-				return fmt.Errorf("close watcher: %w", err)
+				return fmt.Errorf("close: %w", err)
 			}
 			return nil
 		}
 	}
 }
 
-// ConfigFiles returns paths to loaded configuration files.
+// Close stops watching and releases all resources. Channels returned by Events are closed and
+// Start returns. The configuration loaded in viper is kept.
+func (h *Hydra) Close() error {
+	var err error
+	h.closeOnce.Do(func() {
+		h.mu.Lock()
+		close(h.closed)
+		w := h.watcher
+		h.mu.Unlock()
+
+		err = errors.Join(w.Close(), h.closeSources())
+		h.closeStreams()
+	})
+	return err
+}
+
+func (h *Hydra) isClosed() bool {
+	select {
+	case <-h.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// recoverWatcher replaces the watcher with a new one watching all paths again and rescans them
+// to catch up with changes missed in the meantime.
+func (h *Hydra) recoverWatcher() error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("create a new watcher: %w", err)
+	}
+
+	h.reloadMu.Lock()
+	defer h.reloadMu.Unlock()
+
+	h.mu.Lock()
+	if h.isClosed() {
+		h.mu.Unlock()
+		w.Close()
+		return ErrClosed
+	}
+	h.watcher.Close()
+	h.watcher = w
+	h.mu.Unlock()
+
+	change, err := h.rescan(context.Background())
+	if err != nil {
+		return fmt.Errorf("rescan paths: %w", err)
+	}
+
+	if !change.Empty() {
+		h.dispatch(change)
+	}
+	return nil
+}
+
+// reportError delivers the error to the error handler set by WithErrorHandler and channels
+// returned by Events.
+func (h *Hydra) reportError(err error) {
+	if h.options.errorHandler != nil {
+		h.options.errorHandler(err)
+	}
+	h.broadcast(Event{Err: err})
+}
+
+// isConfigFile reports whether the file is a tracked configuration file.
+func (h *Hydra) isConfigFile(path string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return slices.Contains(h.configFiles, path)
+}
+
+// isWatched reports whether the path is one of the configured paths or is located under one.
+func (h *Hydra) isWatched(path string) bool {
+	return h.pathIndex(path) < len(h.options.paths)
+}
+
+// ConfigFiles returns paths to loaded configuration files in the order they are merged, see
+// WithFileOrder.
 func (h *Hydra) ConfigFiles() []string {
-	return h.configFiles
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return slices.Clone(h.configFiles)
 }
 
-func (h *Hydra) addPath(path string) error {
-	h.watcher.Add(path)
-	return filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+func (h *Hydra) addPath(ctx context.Context, path string) error {
+	files, err := h.watchPath(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// config file found
+		l, err := h.readConfigFile(path)
 		if err != nil {
+			return fmt.Errorf("read config file (path: %s): %w", path, err)
+		}
+
+		h.configFiles = append(h.configFiles, path)
+		h.layers[path] = l
+	}
+
+	return nil
+}
+
+func (h *Hydra) addSource(ctx context.Context, i int) error {
+	files, err := h.sourceFiles(ctx, i)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range files {
+		l, err := h.readConfigFile(path)
+		if err != nil {
+			return fmt.Errorf("read config file (path: %s): %w", path, err)
+		}
+
+		h.configFiles = append(h.configFiles, path)
+		h.layers[path] = l
+	}
+
+	return nil
+}
+
+// WatchError is reported when a path can't be added to the watcher, so its changes aren't
+// detected unless it's polled.
+type WatchError struct {
+	Path string
+	// Polled is set if the path is polled instead, see WithPollingFallback.
+	Polled bool
+	Err    error
+}
+
+func (e *WatchError) Error() string {
+	if e.Polled {
+		return fmt.Sprintf("watch path (path: %s, polled instead): %s", e.Path, e.Err)
+	}
+	return fmt.Sprintf("watch path (path: %s): %s", e.Path, e.Err)
+}
+
+func (e *WatchError) Unwrap() error {
+	return e.Err
+}
+
+// watchPath adds the path and all directories under it to the watcher and returns
+// configuration files found in them. Paths that are polled aren't added to the watcher.
+//
+// If the path is a file, its directory is watched instead. A watch of the file itself is lost
+// once the file is removed, so it would miss the file being replaced or recreated.
+func (h *Hydra) watchPath(ctx context.Context, root string) ([]string, error) {
+	return h.walkPath(ctx, root, func(path string) {
+		h.watch(root, path)
+	})
+}
+
+// watch adds the path found in the root to the watcher, unless it's polled.
+func (h *Hydra) watch(root, path string) {
+	if h.isPolled(path) {
+		return
+	}
+
+	dir := path
+	if path == root && !isDir(path) {
+		dir = filepath.Dir(path)
+	}
+
+	err := h.watcher.Add(dir)
+	if err == nil || errors.Is(err, os.ErrNotExist) || errors.Is(err, fsnotify.ErrClosed) {
+		return
+	}
+
+	werr := &WatchError{Path: dir, Err: err}
+	if h.options.pollFallback && isWatchLimit(err) {
+		h.mu.Lock()
+		h.unwatchable = append(h.unwatchable, path)
+		h.mu.Unlock()
+
+		werr.Path, werr.Polled = path, true
+	}
+	h.reportError(werr)
+}
+
+// isWatchLimit reports whether the error is caused by reaching the limit of watches or open
+// files, e.g. fs.inotify.max_user_watches on Linux.
+func isWatchLimit(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EMFILE)
+}
+
+// walkPath returns configuration files found in the path. If the path is a directory, it's
+// searched recursively and watch is invoked for the path and each directory found in it.
+func (h *Hydra) walkPath(ctx context.Context, root string, watch func(path string)) ([]string, error) {
+	if watch == nil {
+		watch = func(string) {}
+	}
+
+	var files []string
+
+	watch(root)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err := ctx.Err(); err != nil {
 			return err
 		}
 
-		if info.IsDir() {
-			// watching isn't recursive so the path needs to be added to the watcher.
-			h.watcher.Add(path)
+		if err != nil {
+			if path != root && errors.Is(err, os.ErrNotExist) {
+				// path was removed while walking
+				return nil
+			}
+			return err
 		}
 
-		ext := strings.TrimPrefix(filepath.Ext(path), ".")
-		if !slices.Contains(h.options.supportedExtensions, ext) {
-			// file extension is not supported
+		if h.options.kubernetesVolumes && path != root && isVolumeInternal(path) {
+			// files are loaded through the symlinks pointing into the volume internals
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
-		if info.Mode()&os.ModeSymlink != 0 {
-			// if config file is symlink then read the real path
-			path, err = os.Readlink(path)
-			if err != nil {
-				return fmt.Errorf("read config file link (path: %s): %w", path, err)
-			}
+		if info.IsDir() {
+			// watching isn't recursive so the path needs to be added to the watcher.
+			watch(path)
+			return nil
 		}
 
-		// config file found
-		h.configFiles = append(h.configFiles, path)
-		firstConfigFile := h.viper.ConfigFileUsed() == ""
-		h.viper.SetConfigFile(path)
+		if !slices.Contains(h.options.supportedExtensions, h.configExt(path)) {
+			// file extension is not supported
+			return nil
+		}
 
-		if firstConfigFile {
-			err := h.viper.ReadInConfig()
-			if err != nil {
-				return fmt.Errorf("read in config file (path: %s): %w", path, err)
-			}
+		if h.isOtherEnvironment(path) {
 			return nil
 		}
 
-		err = h.viper.MergeInConfig()
-		if err != nil {
-			return fmt.Errorf("merge in config file (path: %s): %w", path, err)
+		if path != root && h.explicitPathIndex(path) >= 0 {
+			// file is loaded through its own configured path
+			return nil
 		}
 
+		// config files behind symlinks are tracked by the link path, so the events about
+		// the link are matched with the file and the file is read through the link.
+		files = append(files, path)
 		return nil
 	})
+
+	return files, err
+}
+
+// isVolumeInternal reports whether the path is one of the entries kubelet uses to update
+// volumes atomically. Files of a ConfigMap or Secret volume are symlinks pointing through the
+// "..data" symlink into a timestamped directory, e.g. "..2006_01_02_15_04_05.000000000".
+// An update writes a new timestamped directory and swaps the "..data" symlink.
+func isVolumeInternal(path string) bool {
+	return strings.HasPrefix(filepath.Base(path), "..")
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
 }
@@ -0,0 +1,382 @@
+package hydra
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// startNotify starts watching the configuration of hydra until the test ends, and returns the
+// channel the changes are notified on.
+func startNotify(t *testing.T, h *Hydra) <-chan Change {
+	t.Helper()
+	changes := make(chan Change, 64)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = h.Start(ctx, func(c Change) { changes <- c })
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return changes
+}
+
+// receive returns the next change, failing the test unless it's notified within a few seconds.
+func receive(t *testing.T, changes <-chan Change) Change {
+	t.Helper()
+	select {
+	case c := <-changes:
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a change")
+		return Change{}
+	}
+}
+
+// quiet fails the test if a change is notified within the duration.
+func quiet(t *testing.T, changes <-chan Change, d time.Duration) {
+	t.Helper()
+	select {
+	case c := <-changes:
+		t.Fatalf("unexpected change %+v", c)
+	case <-time.After(d):
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	const debounce = 200 * time.Millisecond
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yaml")
+	writeFile(t, path, "n: 0\n")
+
+	h, err := New(WithPaths(dir), WithAutoReload(), WithDebounce(debounce))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	changes := startNotify(t, h)
+
+	for _, burst := range []int{1, 2} {
+		// a burst of writes is notified as a single change once the file is quiet
+		var last time.Time
+		for i := 1; i <= 5; i++ {
+			writeFile(t, path, "n: "+strconv.Itoa(burst*10+i)+"\n")
+			last = time.Now()
+			time.Sleep(20 * time.Millisecond)
+		}
+
+		c := receive(t, changes)
+		if elapsed := time.Since(last); elapsed < debounce {
+			t.Errorf("burst %d: notified %v after the last write, want at least %v", burst, elapsed, debounce)
+		}
+		if c.Path != path {
+			t.Errorf("burst %d: path = %s, want %s", burst, c.Path, path)
+		}
+		if got, _ := Get[int](h, "n"); got != burst*10+5 {
+			t.Errorf("burst %d: n = %d, want %d", burst, got, burst*10+5)
+		}
+		quiet(t, changes, 2*debounce)
+	}
+}
+
+func TestDebouncePerFile(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml")
+	writeFile(t, a, "a: 0\n")
+	writeFile(t, b, "b: 0\n")
+
+	h, err := New(WithPaths(dir), WithAutoReload(), WithDebounce(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	changes := startNotify(t, h)
+
+	// bursts of different files are notified separately
+	for i := 1; i <= 3; i++ {
+		writeFile(t, a, "a: "+strconv.Itoa(i)+"\n")
+		writeFile(t, b, "b: "+strconv.Itoa(i)+"\n")
+		time.Sleep(10 * time.Millisecond)
+	}
+	got := map[string]bool{receive(t, changes).Path: true, receive(t, changes).Path: true}
+	if !got[a] || !got[b] {
+		t.Errorf("changed paths = %v, want %s and %s", got, a, b)
+	}
+	quiet(t, changes, 300*time.Millisecond)
+}
+
+func TestWithDefaultsFile(t *testing.T) {
+	dir := t.TempDir()
+	defaults := filepath.Join(dir, "defaults.yaml")
+	writeFile(t, filepath.Join(dir, "app.yaml"), "port: 8080\n")
+	etc := filepath.Join(t.TempDir(), "app.yaml")
+	writeFile(t, etc, "log: debug\n")
+
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "last wins", opts: []Option{WithPath(dir), WithPath(etc, Priority(-10))}},
+		{name: "first wins", opts: []Option{WithPath(dir), WithPath(etc, Priority(-10)), WithPrecedence(FirstWins)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeFile(t, defaults, "port: 80\nlog: info\ntimeout: 5s\n")
+			// the defaults file is found in a path as well, but merged first only
+			h, err := New(append([]Option{WithPaths(), WithDefaultsFile(defaults)}, tt.opts...)...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer h.Close()
+
+			if got := h.ConfigFiles(); len(got) != 3 || got[0] != defaults {
+				t.Errorf("ConfigFiles() = %v, want %s first and once", got, defaults)
+			}
+			want := map[string]any{"port": 8080, "log": "debug", "timeout": "5s"}
+			check := func(when string) {
+				t.Helper()
+				if got := h.viper.AllSettings(); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: settings = %v, want %v", when, got, want)
+				}
+			}
+			check("load")
+
+			// reloaded defaults don't override the other files
+			writeFile(t, defaults, "port: 81\nlog: warn\ntimeout: 10s\n")
+			if err := h.Reload(context.Background()); err != nil {
+				t.Fatalf("Reload() error = %v", err)
+			}
+			want["timeout"] = "10s"
+			check("reload")
+		})
+	}
+}
+
+func TestWithOverrideFile(t *testing.T) {
+	dir := t.TempDir()
+	override := filepath.Join(dir, "local.override.yaml")
+	writeFile(t, filepath.Join(dir, "app.yaml"), "port: 8080\nlog: info\n")
+
+	// the override file is optional
+	h, err := New(WithPath(dir, Priority(100)), WithOverrideFile(override), WithPrecedence(FirstWins), WithAutoReload())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	changes := startNotify(t, h)
+
+	// once created, it overrides the files regardless of their priorities and the precedence
+	writeFile(t, override, "port: 9090\n")
+	eventually(t, "port 9090", func() bool {
+		got, _ := Get[int](h, "port")
+		return got == 9090
+	})
+	receive(t, changes)
+	if got := h.ConfigFiles(); len(got) != 2 || got[1] != override {
+		t.Errorf("ConfigFiles() = %v, want %s last", got, override)
+	}
+
+	// reloads of other files don't override it either
+	rewrite(t, filepath.Join(dir, "app.yaml"), "port: 1\nlog: debug\n")
+	eventually(t, "log debug", func() bool {
+		got, _ := Get[string](h, "log")
+		return got == "debug"
+	})
+	if got, _ := Get[int](h, "port"); got != 9090 {
+		t.Errorf("port = %d, want 9090", got)
+	}
+}
+
+func TestStartReplaced(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yaml")
+	writeFile(t, path, "port: 8080\n")
+
+	h, err := New(WithPaths(dir), WithAutoReload())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	changes := startNotify(t, h)
+
+	steps := []struct {
+		name   string
+		change func()
+		op     fsnotify.Op
+		port   int
+	}{
+		{name: "renamed over", change: func() { replaceFile(t, path, "port: 9090\n") }, op: fsnotify.Write, port: 9090},
+		{
+			name: "removed and recreated",
+			change: func() {
+				if err := os.Remove(path); err != nil {
+					t.Fatal(err)
+				}
+				writeFile(t, path, "port: 9091\n")
+			},
+			op:   fsnotify.Write,
+			port: 9091,
+		},
+		{
+			name: "removed",
+			change: func() {
+				if err := os.Remove(path); err != nil {
+					t.Fatal(err)
+				}
+			},
+			op: fsnotify.Remove,
+		},
+		{name: "created", change: func() { replaceFile(t, path, "port: 9092\n") }, op: fsnotify.Create, port: 9092},
+	}
+	for _, step := range steps {
+		step.change()
+		c := receive(t, changes)
+		if c.Path != path || c.Op != step.op {
+			t.Fatalf("%s: change = %s %s, want %s %s", step.name, c.Op, c.Path, step.op, path)
+		}
+		if got, _ := Get[int](h, "port"); got != step.port {
+			t.Errorf("%s: port = %d, want %d", step.name, got, step.port)
+		}
+	}
+}
+
+func TestWatcherRecovery(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yaml")
+	writeFile(t, path, "port: 8080\n")
+
+	recovered := make(chan error, 1)
+	h, err := New(WithPaths(dir), WithAutoReload(), WithWatcherRecovery(func(cause error) { recovered <- cause }))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	changes := startNotify(t, h)
+
+	// the change made while the watcher is closed is caught up by the rescan
+	h.mu.Lock()
+	h.watcher.Close()
+	h.mu.Unlock()
+	replaceFile(t, path, "port: 9090\n")
+
+	select {
+	case cause := <-recovered:
+		if cause == nil || cause.Error() != "watcher unexpectedly closed" {
+			t.Errorf("cause = %v, want watcher unexpectedly closed", cause)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the recovery")
+	}
+	eventually(t, "port 9090", func() bool {
+		got, _ := Get[int](h, "port")
+		return got == 9090
+	})
+	for len(changes) > 0 {
+		<-changes
+	}
+
+	// the new watcher watches the paths
+	replaceFile(t, path, "port: 9091\n")
+	if c := receive(t, changes); c.Path != path {
+		t.Errorf("change = %s, want %s", c.Path, path)
+	}
+	if got, _ := Get[int](h, "port"); got != 9091 {
+		t.Errorf("port = %d, want 9091", got)
+	}
+}
+
+func TestWatcherClosed(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.yaml"), "port: 8080\n")
+
+	h, err := New(WithPaths(dir))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- h.Start(context.Background(), nil) }()
+
+	// without recovery, Start fails
+	h.mu.Lock()
+	h.watcher.Close()
+	h.mu.Unlock()
+	select {
+	case err := <-done:
+		if err == nil || err.Error() != "watcher unexpectedly closed" {
+			t.Errorf("Start() error = %v, want watcher unexpectedly closed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for Start to return")
+	}
+}
+
+// updateVolume updates the files of the volume like kubelet, writing them to a new timestamped
+// directory and swapping the "..data" symlink to it.
+func updateVolume(t *testing.T, dir, version string, files map[string]string) {
+	t.Helper()
+	ts := filepath.Join(dir, "..2024_01_01_00_00_0"+version)
+	for name, data := range files {
+		writeFile(t, filepath.Join(ts, name), data)
+	}
+	prev, _ := os.Readlink(filepath.Join(dir, volumeDataLink))
+	tmp := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(filepath.Base(ts), tmp); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, volumeDataLink)); err != nil {
+		t.Fatal(err)
+	}
+	for name := range files {
+		link := filepath.Join(dir, name)
+		if _, err := os.Lstat(link); err != nil {
+			if err := os.Symlink(filepath.Join(volumeDataLink, name), link); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if prev != "" {
+		if err := os.RemoveAll(filepath.Join(dir, prev)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestKubernetesVolumes(t *testing.T) {
+	dir := t.TempDir()
+	updateVolume(t, dir, "1", map[string]string{"app.yaml": "port: 8080\n", "log.yaml": "level: info\n"})
+
+	h, err := New(WithPaths(dir), WithKubernetesVolumes(), WithAutoReload())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	// the internals of the volume aren't loaded
+	want := []string{filepath.Join(dir, "app.yaml"), filepath.Join(dir, "log.yaml")}
+	if got := h.ConfigFiles(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ConfigFiles() = %v, want %v", got, want)
+	}
+	changes := startNotify(t, h)
+
+	for i, port := range []int{9090, 9091} {
+		updateVolume(t, dir, strconv.Itoa(i+2), map[string]string{"app.yaml": "port: " + strconv.Itoa(port) + "\n", "log.yaml": "level: debug\n"})
+
+		// the update is reloaded once for the volume
+		c := receive(t, changes)
+		if c.Path != dir || c.Op != fsnotify.Write {
+			t.Errorf("change = %s %s, want WRITE %s", c.Op, c.Path, dir)
+		}
+		if got, _ := Get[int](h, "port"); got != port {
+			t.Errorf("port = %d, want %d", got, port)
+		}
+		if got, _ := Get[string](h, "level"); got != "debug" {
+			t.Errorf("level = %s, want debug", got)
+		}
+		quiet(t, changes, 100*time.Millisecond)
+	}
+	if got := h.ConfigFiles(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ConfigFiles() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,149 @@
+package hydra
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// iniCodec decodes and encodes INI files. Keys of sections are nested under the sections, e.g.
+// "port" of "[server]" is "server.port", as are keys of sections named with dots, e.g. "[a.b]".
+// Keys before the first section are at the top level. Lines starting with ";" or "#" are
+// comments, and values may be quoted. Keys named like sections, e.g. "b" of "[a]" and "[a.b]",
+// fail to decode.
+type iniCodec struct{}
+
+func (iniCodec) Decode(b []byte, v map[string]any) error {
+	section, path := v, ""
+	// lines are the lines setting the keys and naming the sections by their paths, e.g. "a.b"
+	lines := make(map[string]int)
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if n == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			name, ok := strings.CutSuffix(line, "]")
+			name = strings.TrimSpace(name[1:])
+			if !ok || name == "" {
+				return fmt.Errorf("invalid section (line: %d): %s", n, line)
+			}
+
+			section, path = v, ""
+			for _, part := range strings.Split(name, ".") {
+				path = iniPath(path, part)
+				next, ok := section[part].(map[string]any)
+				if !ok {
+					if _, set := section[part]; set {
+						return fmt.Errorf("section conflicts with key (line: %d, key line: %d): %s", n, lines[path], path)
+					}
+					next = make(map[string]any)
+					section[part] = next
+					lines[path] = n
+				}
+				section = next
+			}
+			continue
+		}
+
+		i := strings.IndexAny(line, "=:")
+		if i <= 0 {
+			return fmt.Errorf("invalid key (line: %d): %s", n, line)
+		}
+		key := strings.TrimSpace(line[:i])
+		if _, ok := section[key].(map[string]any); ok {
+			key = iniPath(path, key)
+			return fmt.Errorf("key conflicts with section (line: %d, section line: %d): %s", n, lines[key], key)
+		}
+		section[key] = iniValue(strings.TrimSpace(line[i+1:]))
+		lines[iniPath(path, key)] = n
+	}
+	return s.Err()
+}
+
+// iniPath returns the path of the key in the section at the path, e.g. "a.b" for "b" of "a".
+func iniPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// iniValue returns the value without its quotes or, if it's not quoted, without an inline
+// comment, e.g. "8080" for "8080 ; port".
+func iniValue(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+		if end := strings.IndexByte(value[1:], value[0]); end >= 0 {
+			return value[1 : end+1]
+		}
+	}
+	for _, comment := range []string{" ;", " #", "\t;", "\t#"} {
+		if i := strings.Index(value, comment); i >= 0 {
+			value = value[:i]
+		}
+	}
+	return strings.TrimSpace(value)
+}
+
+func (iniCodec) Encode(v map[string]any) ([]byte, error) {
+	var b bytes.Buffer
+	var sections []string
+	flat := make(map[string]map[string]any)
+
+	var visit func(section string, m map[string]any)
+	visit = func(section string, m map[string]any) {
+		for key, value := range m {
+			if sub, ok := value.(map[string]any); ok {
+				name := key
+				if section != "" {
+					name = section + "." + key
+				}
+				visit(name, sub)
+				continue
+			}
+			if flat[section] == nil {
+				flat[section] = make(map[string]any)
+				sections = append(sections, section)
+			}
+			flat[section][key] = value
+		}
+	}
+	visit("", v)
+
+	// keys at the top level precede the first section
+	slices.Sort(sections)
+	for _, section := range sections {
+		if section != "" {
+			if b.Len() > 0 {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "[%s]\n", section)
+		}
+		keys := make([]string, 0, len(flat[section]))
+		for key := range flat[section] {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			value, err := cast.ToStringE(flat[section][key])
+			if err != nil {
+				return nil, fmt.Errorf("encode key (key: %s): %w", key, err)
+			}
+			if strings.ContainsAny(value, ";#") || value != strings.TrimSpace(value) {
+				// quoted values aren't cut by inline comments
+				value = `"` + value + `"`
+			}
+			fmt.Fprintf(&b, "%s = %s\n", key, value)
+		}
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,114 @@
+package hydra
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestINICodecDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]any
+	}{
+		{
+			name: "sections",
+			in:   "name = app\n\n[server]\nhost = localhost\nport: 8080\n",
+			want: map[string]any{
+				"name":   "app",
+				"server": map[string]any{"host": "localhost", "port": "8080"},
+			},
+		},
+		{
+			name: "dotted sections",
+			in:   "[a]\nb = 1\n[a.c]\nd = 2\n",
+			want: map[string]any{"a": map[string]any{"b": "1", "c": map[string]any{"d": "2"}}},
+		},
+		{
+			name: "reopened section",
+			in:   "[a]\nb = 1\n[c]\nd = 2\n[a]\ne = 3\n",
+			want: map[string]any{"a": map[string]any{"b": "1", "e": "3"}, "c": map[string]any{"d": "2"}},
+		},
+		{
+			name: "comments and quotes",
+			in:   "\ufeff; comment\n# comment\n[s]\na = 1 ; inline\nb = \"x ; y\"\nc = ' padded '\n",
+			want: map[string]any{"s": map[string]any{"a": "1", "b": "x ; y", "c": " padded "}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]any{}
+			err := iniCodec{}.Decode([]byte(tt.in), got)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestINICodecDecodeError(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+		line int
+	}{
+		{
+			name: "section conflicts with key",
+			in:   "[a]\nb=1\n[a.b]\nd=2\n",
+			want: "section conflicts with key (line: 3, key line: 2): a.b",
+			line: 3,
+		},
+		{
+			name: "key conflicts with section",
+			in:   "[a.b]\nd=2\n\n[a]\nb=1\n",
+			want: "key conflicts with section (line: 5, section line: 1): a.b",
+			line: 5,
+		},
+		{
+			name: "top-level key conflicts with section",
+			in:   "a=1\n[a]\nb=2\n",
+			want: "section conflicts with key (line: 2, key line: 1): a",
+			line: 2,
+		},
+		{name: "invalid section", in: "a=1\n[a\n", want: "invalid section (line: 2): [a", line: 2},
+		{name: "invalid key", in: "[a]\n= 1\n", want: "invalid key (line: 2): = 1", line: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := iniCodec{}.Decode([]byte(tt.in), map[string]any{})
+			if err == nil || err.Error() != tt.want {
+				t.Fatalf("Decode() error = %v, want %q", err, tt.want)
+			}
+			if line, _ := errorPosition(err, []byte(tt.in)); line != tt.line {
+				t.Errorf("line of %q = %d, want %d", err, line, tt.line)
+			}
+		})
+	}
+}
+
+func TestINICodecRoundTrip(t *testing.T) {
+	in := map[string]any{
+		"name":   "app",
+		"server": map[string]any{"host": "localhost", "tls": map[string]any{"cert": "a; b"}},
+	}
+	b, err := iniCodec{}.Encode(in)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if !strings.HasPrefix(string(b), "name = app\n") {
+		t.Errorf("Encode() = %q, want top-level keys first", b)
+	}
+	got := map[string]any{}
+	err = iniCodec{}.Decode(b, got)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, in) {
+		t.Errorf("Decode(Encode()) = %v, want %v", got, in)
+	}
+}
@@ -0,0 +1,372 @@
+package hydra
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// json5Codec decodes JSON5 and JSONC files, JSON with comments and trailing commas, and encodes
+// them as JSON. JSON5 also allows unquoted keys, single quoted strings, strings continued on the
+// next line, hexadecimal numbers, Infinity and NaN. Errors include their lines and columns.
+type json5Codec struct{}
+
+func (json5Codec) Decode(b []byte, v map[string]any) error {
+	p := &json5Parser{s: strings.TrimPrefix(string(b), "\ufeff")}
+	p.skip()
+	if p.eof() {
+		// empty files have no configuration
+		return nil
+	}
+	value, err := p.value()
+	if err == nil {
+		p.skip()
+		if !p.eof() {
+			err = p.errorf("unexpected %s after top-level value", p.quote())
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	m, ok := value.(map[string]any)
+	if !ok {
+		return fmt.Errorf("top-level value is not an object: %T", value)
+	}
+	for key, value := range m {
+		v[key] = value
+	}
+	return nil
+}
+
+func (json5Codec) Encode(v map[string]any) ([]byte, error) {
+	return json.MarshalIndent(v, "", "  ")
+}
+
+// json5Parser parses JSON5 documents.
+type json5Parser struct {
+	s string
+	i int
+}
+
+// json5Error is an error parsing JSON5 at a line and column.
+type json5Error struct {
+	line, column int
+	msg          string
+}
+
+func (e *json5Error) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.line, e.column, e.msg)
+}
+
+func (p *json5Parser) errorf(format string, args ...any) error {
+	line := strings.Count(p.s[:p.i], "\n") + 1
+	column := utf8.RuneCountInString(p.s[strings.LastIndexByte(p.s[:p.i], '\n')+1:p.i]) + 1
+	return &json5Error{line: line, column: column, msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *json5Parser) eof() bool {
+	return p.i >= len(p.s)
+}
+
+// quote returns the next character quoted for errors, or "end of file".
+func (p *json5Parser) quote() string {
+	if p.eof() {
+		return "end of file"
+	}
+	r, _ := utf8.DecodeRuneInString(p.s[p.i:])
+	return strconv.QuoteRune(r)
+}
+
+// skip skips whitespace and comments.
+func (p *json5Parser) skip() {
+	for !p.eof() {
+		r, n := utf8.DecodeRuneInString(p.s[p.i:])
+		switch {
+		case unicode.IsSpace(r) || r == '\ufeff':
+			p.i += n
+		case strings.HasPrefix(p.s[p.i:], "//"):
+			end := strings.IndexByte(p.s[p.i:], '\n')
+			if end < 0 {
+				p.i = len(p.s)
+			} else {
+				p.i += end + 1
+			}
+		case strings.HasPrefix(p.s[p.i:], "/*"):
+			end := strings.Index(p.s[p.i+2:], "*/")
+			if end < 0 {
+				// unterminated comments are reported by the next value
+				return
+			}
+			p.i += end + 4
+		default:
+			return
+		}
+	}
+}
+
+func (p *json5Parser) value() (any, error) {
+	if p.eof() {
+		return nil, p.errorf("unexpected end of file, expected value")
+	}
+	if strings.HasPrefix(p.s[p.i:], "/*") {
+		return nil, p.errorf("unterminated comment")
+	}
+
+	switch c := p.s[p.i]; {
+	case c == '{':
+		return p.object()
+	case c == '[':
+		return p.array()
+	case c == '"' || c == '\'':
+		return p.string()
+	case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+		return p.number()
+	}
+
+	start := p.i
+	word := p.identifier()
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	case "Infinity", "NaN":
+		p.i = start
+		return p.number()
+	}
+	p.i = start
+	return nil, p.errorf("unexpected %s, expected value", p.quote())
+}
+
+func (p *json5Parser) object() (any, error) {
+	m := make(map[string]any)
+	p.i++
+	for {
+		p.skip()
+		if !p.eof() && p.s[p.i] == '}' {
+			p.i++
+			return m, nil
+		}
+
+		var key string
+		switch {
+		case p.eof():
+			return nil, p.errorf("unexpected end of file, expected key or \"}\"")
+		case p.s[p.i] == '"' || p.s[p.i] == '\'':
+			s, err := p.string()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		default:
+			key = p.identifier()
+			if key == "" {
+				return nil, p.errorf("unexpected %s, expected key or \"}\"", p.quote())
+			}
+		}
+
+		p.skip()
+		if p.eof() || p.s[p.i] != ':' {
+			return nil, p.errorf("unexpected %s, expected \":\" after key %q", p.quote(), key)
+		}
+		p.i++
+		p.skip()
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		m[key] = value
+
+		p.skip()
+		switch {
+		case p.eof():
+			return nil, p.errorf("unexpected end of file, expected \",\" or \"}\"")
+		case p.s[p.i] == ',':
+			p.i++
+		case p.s[p.i] != '}':
+			return nil, p.errorf("unexpected %s, expected \",\" or \"}\"", p.quote())
+		}
+	}
+}
+
+func (p *json5Parser) array() (any, error) {
+	list := []any{}
+	p.i++
+	for {
+		p.skip()
+		if !p.eof() && p.s[p.i] == ']' {
+			p.i++
+			return list, nil
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+
+		p.skip()
+		switch {
+		case p.eof():
+			return nil, p.errorf("unexpected end of file, expected \",\" or \"]\"")
+		case p.s[p.i] == ',':
+			p.i++
+		case p.s[p.i] != ']':
+			return nil, p.errorf("unexpected %s, expected \",\" or \"]\"", p.quote())
+		}
+	}
+}
+
+// identifier parses an unquoted key or a literal, e.g. true, or returns "" if there's none.
+func (p *json5Parser) identifier() string {
+	start := p.i
+	for !p.eof() {
+		r, n := utf8.DecodeRuneInString(p.s[p.i:])
+		if r != '_' && r != '$' && !unicode.IsLetter(r) && (p.i == start || !unicode.IsDigit(r)) {
+			break
+		}
+		p.i += n
+	}
+	return p.s[start:p.i]
+}
+
+func (p *json5Parser) string() (string, error) {
+	quote := p.s[p.i]
+	p.i++
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.s[p.i]
+		switch {
+		case c == quote:
+			p.i++
+			return b.String(), nil
+		case c == '\n':
+			return "", p.errorf("unterminated string, use \\ to continue strings on the next line")
+		case c != '\\':
+			b.WriteByte(c)
+			p.i++
+			continue
+		}
+
+		p.i++
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		c = p.s[p.i]
+		p.i++
+		switch c {
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'v':
+			b.WriteByte('\v')
+		case '0':
+			b.WriteByte(0)
+		case '\r':
+			// strings continue on the next line
+			if !p.eof() && p.s[p.i] == '\n' {
+				p.i++
+			}
+		case '\n':
+		case 'x':
+			r, ok := p.hex(2)
+			if !ok {
+				return "", p.errorf("invalid \\x escape")
+			}
+			b.WriteRune(r)
+		case 'u':
+			r, ok := p.hex(4)
+			if !ok {
+				return "", p.errorf("invalid \\u escape")
+			}
+			if utf16.IsSurrogate(r) && strings.HasPrefix(p.s[p.i:], `\u`) {
+				start := p.i
+				p.i += 2
+				if low, ok := p.hex(4); ok && utf16.DecodeRune(r, low) != utf8.RuneError {
+					r = utf16.DecodeRune(r, low)
+				} else {
+					p.i = start
+				}
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+// hex parses the hexadecimal digits of an escape.
+func (p *json5Parser) hex(n int) (rune, bool) {
+	if p.i+n > len(p.s) {
+		return 0, false
+	}
+	r, err := strconv.ParseUint(p.s[p.i:p.i+n], 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	p.i += n
+	return rune(r), true
+}
+
+func (p *json5Parser) number() (any, error) {
+	start := p.i
+	sign := 1.0
+	if p.s[p.i] == '-' || p.s[p.i] == '+' {
+		if p.s[p.i] == '-' {
+			sign = -1
+		}
+		p.i++
+	}
+
+	rest := p.s[p.i:]
+	switch {
+	case strings.HasPrefix(rest, "Infinity"):
+		p.i += len("Infinity")
+		return sign * math.Inf(1), nil
+	case strings.HasPrefix(rest, "NaN"):
+		p.i += len("NaN")
+		return math.NaN(), nil
+	case strings.HasPrefix(rest, "0x") || strings.HasPrefix(rest, "0X"):
+		p.i += 2
+		digits := p.i
+		for !p.eof() && strings.IndexByte("0123456789abcdefABCDEF", p.s[p.i]) >= 0 {
+			p.i++
+		}
+		n, err := strconv.ParseUint(p.s[digits:p.i], 16, 64)
+		if err != nil {
+			p.i = start
+			return nil, p.errorf("invalid hexadecimal number")
+		}
+		return sign * float64(n), nil
+	}
+
+	for !p.eof() && strings.IndexByte("0123456789.eE+-", p.s[p.i]) >= 0 {
+		if (p.s[p.i] == '+' || p.s[p.i] == '-') && p.s[p.i-1] != 'e' && p.s[p.i-1] != 'E' {
+			break
+		}
+		p.i++
+	}
+	f, err := strconv.ParseFloat(p.s[start:p.i], 64)
+	if err != nil {
+		p.i = start
+		return nil, p.errorf("invalid number")
+	}
+	return f, nil
+}
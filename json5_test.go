@@ -0,0 +1,120 @@
+package hydra
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestJSON5CodecDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]any
+	}{
+		{
+			name: "json",
+			in:   `{"a": 1, "b": [true, false, null], "c": {"d": "e"}}`,
+			want: map[string]any{"a": 1.0, "b": []any{true, false, nil}, "c": map[string]any{"d": "e"}},
+		},
+		{
+			name: "jsonc",
+			in:   "// comment\n{\n  /* block\n comment */ \"a\": 1, // trailing\n  \"b\": [1, 2,],\n}\n",
+			want: map[string]any{"a": 1.0, "b": []any{1.0, 2.0}},
+		},
+		{
+			name: "unquoted keys and single quotes",
+			in:   "{unquoted: 'single \"quoted\"', $dollar_1: 'it\\'s', 'quoted key': 1}",
+			want: map[string]any{"unquoted": `single "quoted"`, "$dollar_1": "it's", "quoted key": 1.0},
+		},
+		{
+			name: "numbers",
+			in:   "{hex: 0xFF, neg: -0x10, lead: .5, trail: 5., plus: +1, exp: 1e3}",
+			want: map[string]any{"hex": 255.0, "neg": -16.0, "lead": 0.5, "trail": 5.0, "plus": 1.0, "exp": 1000.0},
+		},
+		{
+			name: "continued strings and escapes",
+			in:   "{s: 'line \\\nnext', e: '\\x41\\u00e9\\ud83d\\ude00\\t'}",
+			want: map[string]any{"s": "line next", "e": "Aé😀\t"},
+		},
+		{
+			name: "empty",
+			in:   "\ufeff  // nothing\n",
+			want: map[string]any{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]any{}
+			err := json5Codec{}.Decode([]byte(tt.in), got)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSON5CodecSpecialNumbers(t *testing.T) {
+	got := map[string]any{}
+	err := json5Codec{}.Decode([]byte("{inf: Infinity, negInf: -Infinity, nan: NaN}"), got)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if got["inf"] != math.Inf(1) || got["negInf"] != math.Inf(-1) {
+		t.Errorf("Decode() = %v, want infinities", got)
+	}
+	if f, ok := got["nan"].(float64); !ok || !math.IsNaN(f) {
+		t.Errorf("nan = %v, want NaN", got["nan"])
+	}
+}
+
+func TestJSON5CodecDecodeError(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		want   string
+		line   int
+		column int
+	}{
+		{name: "missing colon", in: "{\n  a 1\n}", want: `line 2, column 5: unexpected '1', expected ":" after key "a"`, line: 2, column: 5},
+		{name: "missing comma", in: "{a: 1\n b: 2}", want: `line 2, column 2: unexpected 'b', expected "," or "}"`, line: 2, column: 2},
+		{name: "unterminated string", in: "{a: 'x\n'}", want: "line 1, column 7: unterminated string, use \\ to continue strings on the next line", line: 1, column: 7},
+		{name: "unterminated comment", in: "{a: /* x", want: "line 1, column 5: unterminated comment", line: 1, column: 5},
+		{name: "trailing value", in: "{} []", want: `line 1, column 4: unexpected '[' after top-level value`, line: 1, column: 4},
+		{name: "invalid escape", in: "{a: '\\xZZ'}", want: `line 1, column 8: invalid \x escape`, line: 1, column: 8},
+		{name: "columns count characters", in: "{é: 1, ü ü}", want: `line 1, column 10: unexpected 'ü', expected ":" after key "ü"`, line: 1, column: 10},
+		{name: "not an object", in: "[1]", want: "top-level value is not an object: []interface {}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := []byte(tt.in)
+			err := json5Codec{}.Decode(in, map[string]any{})
+			if err == nil || err.Error() != tt.want {
+				t.Fatalf("Decode() error = %v, want %q", err, tt.want)
+			}
+			line, column := errorPosition(err, in)
+			if line != tt.line || column != tt.column {
+				t.Errorf("position = %d:%d, want %d:%d", line, column, tt.line, tt.column)
+			}
+		})
+	}
+}
+
+func TestJSON5CodecRoundTrip(t *testing.T) {
+	in := map[string]any{"a": 1.5, "b": []any{"x", true, nil}, "c": map[string]any{"d": "e"}}
+	b, err := json5Codec{}.Encode(in)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	got := map[string]any{}
+	err = json5Codec{}.Decode(b, got)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, in) {
+		t.Errorf("Decode(Encode()) = %v, want %v", got, in)
+	}
+}
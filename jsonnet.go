@@ -0,0 +1,112 @@
+package hydra
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/google/go-jsonnet"
+)
+
+// isJsonnet reports whether the format is the format of Jsonnet files.
+func isJsonnet(format string) bool {
+	return format == "jsonnet"
+}
+
+// evalJsonnet renders the Jsonnet file to JSON in-process and records the files it imports,
+// whose changes render it again, see importers. Imports are resolved relative to the importing
+// file and to the configured path the file was found in.
+func (h *Hydra) evalJsonnet(path string, b []byte) ([]byte, error) {
+	vm := jsonnet.MakeVM()
+	if _, ok := h.document(path); ok {
+		// documents of sources have no files to import relative to
+		vm.Importer(&jsonnet.MemoryImporter{})
+		out, err := vm.EvaluateAnonymousSnippet(path, string(b))
+		return []byte(out), err
+	}
+
+	importer := &recordingImporter{}
+	if i := h.pathIndex(path); i < len(h.options.paths) && isDir(h.options.paths[i]) {
+		importer.JPaths = []string{h.options.paths[i]}
+	}
+	vm.Importer(importer)
+	out, err := vm.EvaluateAnonymousSnippet(path, string(b))
+
+	// imports are recorded even if rendering fails, so fixing an imported file renders it again
+	h.mu.Lock()
+	h.jsonnetImports[path] = importer.imports
+	h.mu.Unlock()
+	return []byte(out), err
+}
+
+// recordingImporter imports files like jsonnet.FileImporter and records the files imported.
+type recordingImporter struct {
+	jsonnet.FileImporter
+	imports []string
+}
+
+func (i *recordingImporter) Import(importedFrom, importedPath string) (jsonnet.Contents, string, error) {
+	contents, foundAt, err := i.FileImporter.Import(importedFrom, importedPath)
+	if err == nil && !slices.Contains(i.imports, foundAt) {
+		i.imports = append(i.imports, foundAt)
+	}
+	return contents, foundAt, err
+}
+
+// jsonnetErrorPosition returns the line and column of the first position in the Jsonnet file
+// reported by the error, e.g. "app.jsonnet:2:5-17", or zeros if the error is in imported files
+// only.
+func jsonnetErrorPosition(path string, err error) (int, int) {
+	m := regexp.MustCompile(regexp.QuoteMeta(path) + `:(\d+):(\d+)`).FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0, 0
+	}
+	line, _ := strconv.Atoi(m[1])
+	column, _ := strconv.Atoi(m[2])
+	return line, column
+}
+
+// importers returns the Jsonnet files importing the file.
+func (h *Hydra) importers(path string) []string {
+	var files []string
+	h.mu.Lock()
+	for file, imports := range h.jsonnetImports {
+		if _, err := os.Stat(file); err != nil {
+			// removed
+			delete(h.jsonnetImports, file)
+			continue
+		}
+		if slices.Contains(imports, filepath.Clean(path)) {
+			files = append(files, file)
+		}
+	}
+	h.mu.Unlock()
+	slices.SortFunc(files, h.compareLoadOrder)
+	return files
+}
+
+// sum returns the checksum of the contents of the configuration file, which includes the files
+// it imports, so changes of imported files aren't mistaken for rewrites with identical contents.
+func (h *Hydra) sum(path string, b []byte) [sha256.Size]byte {
+	h.mu.Lock()
+	imports := h.jsonnetImports[path]
+	h.mu.Unlock()
+	if len(imports) == 0 {
+		return sha256.Sum256(b)
+	}
+
+	s := sha256.New()
+	s.Write(b)
+	for _, file := range imports {
+		// files removed meanwhile are rendered again anyway
+		data, _ := os.ReadFile(file)
+		s.Write([]byte(file))
+		s.Write(data)
+	}
+	var sum [sha256.Size]byte
+	s.Sum(sum[:0])
+	return sum
+}
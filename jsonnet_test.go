@@ -0,0 +1,124 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestJsonnet(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		key   string
+		want  any
+	}{
+		{
+			name:  "values",
+			files: map[string]string{"app.jsonnet": "{ server: { port: 8000 + 80 } }"},
+			key:   "server.port",
+			want:  8080.0,
+		},
+		{
+			name: "relative import",
+			files: map[string]string{
+				"app.jsonnet":          "local lib = import 'lib/common.libsonnet'; { name: lib.name }",
+				"lib/common.libsonnet": "{ name: 'app' }",
+				"lib/unused.libsonnet": "{}",
+			},
+			key:  "name",
+			want: "app",
+		},
+		{
+			name: "importstr",
+			files: map[string]string{
+				"app.jsonnet": "{ motd: importstr 'motd.txt' }",
+				"motd.txt":    "hello",
+			},
+			key:  "motd",
+			want: "hello",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, data := range tt.files {
+				writeFile(t, filepath.Join(dir, name), data)
+			}
+			h, err := New(WithPaths(dir), WithExtensions("jsonnet"))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer h.Close()
+			got, err := Get[any](h, tt.key)
+			if err != nil || got != tt.want {
+				t.Errorf("Get(%s) = %v, %v, want %v", tt.key, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestJsonnetError(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		line   int
+		column int
+	}{
+		{name: "syntax", in: "{a: 1,\n b: }", line: 2, column: 5},
+		{name: "runtime", in: "{a: 1,\n b: error 'boom'}", line: 2, column: 5},
+		{name: "missing import", in: "local x = import 'nope.libsonnet'; x", line: 1, column: 11},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "app.jsonnet")
+			writeFile(t, path, tt.in)
+			_, err := New(WithPaths(dir), WithExtensions("jsonnet"))
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("New() error = %v, want ParseError", err)
+			}
+			if parseErr.File != path || parseErr.Line != tt.line || parseErr.Column != tt.column {
+				t.Errorf("position = %s, want %s:%d:%d", parseErr.Position, path, tt.line, tt.column)
+			}
+		})
+	}
+}
+
+func TestJsonnetImportReload(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.jsonnet"), "(import 'lib.libsonnet') + { name: 'app' }")
+	lib := filepath.Join(dir, "lib.libsonnet")
+	writeFile(t, lib, "{ port: 80 }")
+	h, err := New(WithPaths(dir), WithExtensions("jsonnet"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	if got := h.importers(lib); len(got) != 1 || filepath.Base(got[0]) != "app.jsonnet" {
+		t.Fatalf("importers() = %v, want app.jsonnet", got)
+	}
+
+	steps := []struct {
+		lib     string
+		wantErr bool
+		want    float64
+	}{
+		{lib: "{ port: 8080 }", want: 8080},
+		{lib: "{ port: ", wantErr: true, want: 8080},
+		{lib: "{ port: 9090 }", want: 9090},
+	}
+	for i, step := range steps {
+		writeFile(t, lib, step.lib)
+		err := h.Reload(context.Background())
+		if (err != nil) != step.wantErr {
+			t.Fatalf("step %d: Reload() error = %v, want error %t", i, err, step.wantErr)
+		}
+		if got, _ := Get[float64](h, "port"); got != step.want {
+			t.Errorf("step %d: port = %v, want %v", i, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,850 @@
+package hydra
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// kdlCodec decodes and encodes KDL documents of version 1 or 2, e.g.
+//
+//	server host="localhost" {
+//	    port 8080
+//	    tls #true
+//	}
+//	hosts "a" "b"
+//
+// Nodes are keys, whose values are their argument, or the list of their arguments if there are
+// several, or null if there are none. The properties and children of nodes are nested keys, and
+// the arguments of such nodes are kept under the key "-". Children all named "-" are a list,
+// like repeated nodes. Type annotations are ignored, and encoding writes version 2.
+type kdlCodec struct{}
+
+// kdlNode is a node of a KDL document.
+type kdlNode struct {
+	name     string
+	args     []any
+	props    map[string]any
+	children []kdlNode
+	// block reports whether the node has a children block, which may be empty.
+	block bool
+}
+
+func (kdlCodec) Decode(b []byte, v map[string]any) error {
+	s := strings.TrimPrefix(string(b), "\ufeff")
+	p := &kdlParser{s: strings.ReplaceAll(s, "\r\n", "\n")}
+	nodes, err := p.nodes(false)
+	if err != nil {
+		return err
+	}
+	m, err := kdlMap(nodes)
+	if err != nil {
+		return err
+	}
+	for key, value := range m {
+		v[key] = value
+	}
+	return nil
+}
+
+// kdlMap returns the nodes as keys, and repeated nodes as lists.
+func kdlMap(nodes []kdlNode) (map[string]any, error) {
+	m := make(map[string]any)
+	repeated := make(map[string]bool)
+	for _, n := range nodes {
+		value, err := kdlValue(n)
+		if err != nil {
+			return nil, err
+		}
+		old, ok := m[n.name]
+		switch {
+		case !ok:
+			m[n.name] = value
+		case repeated[n.name]:
+			m[n.name] = append(old.([]any), value)
+		default:
+			m[n.name] = []any{old, value}
+			repeated[n.name] = true
+		}
+	}
+	return m, nil
+}
+
+// kdlValue returns the value of the node, see kdlCodec.
+func kdlValue(n kdlNode) (any, error) {
+	var args any
+	switch len(n.args) {
+	case 0:
+	case 1:
+		args = n.args[0]
+	default:
+		args = n.args
+	}
+	if len(n.props) == 0 && !n.block {
+		return args, nil
+	}
+
+	list := len(n.children) > 0
+	for _, child := range n.children {
+		list = list && child.name == "-"
+	}
+	if list {
+		values := make([]any, 0, len(n.children))
+		for _, child := range n.children {
+			value, err := kdlValue(child)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		if len(n.props) == 0 && len(n.args) == 0 {
+			return values, nil
+		}
+		m := make(map[string]any, len(n.props)+1)
+		for key, value := range n.props {
+			m[key] = value
+		}
+		m["-"] = append(slices.Clone(n.args), values...)
+		return m, nil
+	}
+
+	m, err := kdlMap(n.children)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range n.props {
+		if _, ok := m[key]; ok {
+			return nil, fmt.Errorf("node %s: property %s conflicts with a child", n.name, key)
+		}
+		m[key] = value
+	}
+	if args != nil {
+		if _, ok := m["-"]; ok {
+			return nil, fmt.Errorf("node %s: arguments conflict with a child named -", n.name)
+		}
+		m["-"] = args
+	}
+	return m, nil
+}
+
+// kdlParser parses KDL documents.
+type kdlParser struct {
+	s string
+	i int
+}
+
+func (p *kdlParser) errorf(format string, args ...any) error {
+	line := strings.Count(p.s[:p.i], "\n") + 1
+	column := utf8.RuneCountInString(p.s[strings.LastIndexByte(p.s[:p.i], '\n')+1:p.i]) + 1
+	return fmt.Errorf("line %d, column %d: %s", line, column, fmt.Sprintf(format, args...))
+}
+
+func (p *kdlParser) eof() bool {
+	return p.i >= len(p.s)
+}
+
+func (p *kdlParser) peekRune() rune {
+	r, _ := utf8.DecodeRuneInString(p.s[p.i:])
+	return r
+}
+
+// quote returns the next character quoted for errors, or "end of file".
+func (p *kdlParser) quote() string {
+	if p.eof() {
+		return "end of file"
+	}
+	return strconv.QuoteRune(p.peekRune())
+}
+
+// nodes parses nodes up to the end of the file or, of children blocks, up to "}".
+func (p *kdlParser) nodes(children bool) ([]kdlNode, error) {
+	var nodes []kdlNode
+	for {
+		if err := p.skipLines(); err != nil {
+			return nil, err
+		}
+		switch {
+		case p.eof():
+			if children {
+				return nil, p.errorf("unexpected end of file, expected \"}\"")
+			}
+			return nodes, nil
+		case p.s[p.i] == '}':
+			if !children {
+				return nil, p.errorf("unexpected \"}\"")
+			}
+			p.i++
+			return nodes, nil
+		}
+
+		discard := strings.HasPrefix(p.s[p.i:], "/-")
+		if discard {
+			p.i += 2
+			if err := p.skipLines(); err != nil {
+				return nil, err
+			}
+		}
+		n, err := p.node()
+		if err != nil {
+			return nil, err
+		}
+		if !discard {
+			nodes = append(nodes, n)
+		}
+	}
+}
+
+func (p *kdlParser) node() (kdlNode, error) {
+	if err := p.typeAnnotation(); err != nil {
+		return kdlNode{}, err
+	}
+	if p.eof() || !p.startsString() {
+		return kdlNode{}, p.errorf("unexpected %s, expected node name", p.quote())
+	}
+	name, err := p.string()
+	if err != nil {
+		return kdlNode{}, err
+	}
+
+	n := kdlNode{name: name}
+	for {
+		spaced, err := p.skipSpace()
+		if err != nil {
+			return kdlNode{}, err
+		}
+		if p.terminate() {
+			return n, nil
+		}
+
+		discard := strings.HasPrefix(p.s[p.i:], "/-")
+		if discard {
+			p.i += 2
+			if _, err := p.skipSpace(); err != nil {
+				return kdlNode{}, err
+			}
+		}
+		if p.s[p.i] == '{' {
+			p.i++
+			children, err := p.nodes(true)
+			if err != nil {
+				return kdlNode{}, err
+			}
+			if !discard {
+				if n.block {
+					return kdlNode{}, p.errorf("node %s has several children blocks", name)
+				}
+				n.children, n.block = children, true
+			}
+			continue
+		}
+		if n.block {
+			return kdlNode{}, p.errorf("unexpected %s after children of node %s", p.quote(), name)
+		}
+		if !spaced && !discard {
+			return kdlNode{}, p.errorf("unexpected %s, expected space", p.quote())
+		}
+
+		if err := p.typeAnnotation(); err != nil {
+			return kdlNode{}, err
+		}
+		start := p.i
+		value, err := p.value()
+		if err != nil {
+			return kdlNode{}, err
+		}
+		if !p.eof() && p.s[p.i] == '=' {
+			key, ok := value.(string)
+			if !ok || !p.startsStringAt(start) {
+				p.i = start
+				return kdlNode{}, p.errorf("property name must be a string")
+			}
+			p.i++
+			if err := p.typeAnnotation(); err != nil {
+				return kdlNode{}, err
+			}
+			value, err = p.value()
+			if err != nil {
+				return kdlNode{}, err
+			}
+			if !discard {
+				if n.props == nil {
+					n.props = make(map[string]any)
+				}
+				// later properties override earlier ones
+				n.props[key] = value
+			}
+			continue
+		}
+		if !discard {
+			n.args = append(n.args, value)
+		}
+	}
+}
+
+// terminate consumes the end of a node, a newline, ";", a line comment or the end of the file,
+// and reports whether there's one. "}" ends a node too but is left to the children block.
+func (p *kdlParser) terminate() bool {
+	switch {
+	case p.eof():
+		return true
+	case p.s[p.i] == '\n' || p.s[p.i] == '\r' || p.s[p.i] == ';':
+		p.i++
+		return true
+	case strings.HasPrefix(p.s[p.i:], "//"):
+		p.skipLine()
+		return true
+	case p.s[p.i] == '}':
+		return true
+	}
+	return false
+}
+
+func (p *kdlParser) skipLine() {
+	end := strings.IndexByte(p.s[p.i:], '\n')
+	if end < 0 {
+		p.i = len(p.s)
+		return
+	}
+	p.i += end + 1
+}
+
+// skipSpace skips the whitespace within nodes, including block comments and lines continued
+// by "\", and reports whether there was any.
+func (p *kdlParser) skipSpace() (bool, error) {
+	start := p.i
+	for !p.eof() {
+		r, n := utf8.DecodeRuneInString(p.s[p.i:])
+		switch {
+		case r == '\n' || r == '\r':
+			return p.i > start, nil
+		case unicode.IsSpace(r) || r == '\ufeff':
+			p.i += n
+		case strings.HasPrefix(p.s[p.i:], "/*"):
+			if err := p.skipComment(); err != nil {
+				return false, err
+			}
+		case r == '\\':
+			// lines continue after "\", which may be followed by a comment
+			p.i++
+			for !p.eof() && (p.s[p.i] == ' ' || p.s[p.i] == '\t') {
+				p.i++
+			}
+			switch {
+			case strings.HasPrefix(p.s[p.i:], "//"), !p.eof() && p.s[p.i] == '\n':
+				p.skipLine()
+			case !p.eof():
+				return false, p.errorf("unexpected %s after line continuation", p.quote())
+			}
+		default:
+			return p.i > start, nil
+		}
+	}
+	return p.i > start, nil
+}
+
+// skipLines skips whitespace, newlines, comments and ";" between nodes.
+func (p *kdlParser) skipLines() error {
+	for !p.eof() {
+		if _, err := p.skipSpace(); err != nil {
+			return err
+		}
+		switch {
+		case p.eof():
+		case p.s[p.i] == '\n' || p.s[p.i] == '\r' || p.s[p.i] == ';':
+			p.i++
+			continue
+		case strings.HasPrefix(p.s[p.i:], "//"):
+			p.skipLine()
+			continue
+		}
+		return nil
+	}
+	return nil
+}
+
+// skipComment skips the block comment, which may be nested.
+func (p *kdlParser) skipComment() error {
+	start := p.i
+	depth := 0
+	for !p.eof() {
+		switch {
+		case strings.HasPrefix(p.s[p.i:], "/*"):
+			depth++
+			p.i += 2
+		case strings.HasPrefix(p.s[p.i:], "*/"):
+			depth--
+			p.i += 2
+			if depth == 0 {
+				return nil
+			}
+		default:
+			p.i++
+		}
+	}
+	p.i = start
+	return p.errorf("unterminated comment")
+}
+
+// typeAnnotation skips the type annotation, e.g. "(u8)", if there's one.
+func (p *kdlParser) typeAnnotation() error {
+	if p.eof() || p.s[p.i] != '(' {
+		return nil
+	}
+	p.i++
+	if p.eof() || !p.startsString() {
+		return p.errorf("unexpected %s, expected type name", p.quote())
+	}
+	if _, err := p.string(); err != nil {
+		return err
+	}
+	if p.eof() || p.s[p.i] != ')' {
+		return p.errorf("unexpected %s, expected \")\"", p.quote())
+	}
+	p.i++
+	return nil
+}
+
+// startsString reports whether a string, quoted, raw or an identifier, starts at the current
+// position.
+func (p *kdlParser) startsString() bool {
+	return p.startsStringAt(p.i)
+}
+
+func (p *kdlParser) startsStringAt(i int) bool {
+	rest := p.s[i:]
+	if rest == "" {
+		return false
+	}
+	switch {
+	case rest[0] == '"':
+		return true
+	case rest[0] == '#' || (rest[0] == 'r' && len(rest) > 1 && (rest[1] == '"' || rest[1] == '#')):
+		return strings.HasPrefix(strings.TrimLeft(strings.TrimPrefix(rest, "r"), "#"), `"`)
+	}
+	return kdlIdentStart(rest)
+}
+
+// kdlIdentStart reports whether an identifier starts the string, which don't start like
+// numbers.
+func kdlIdentStart(s string) bool {
+	r, n := utf8.DecodeRuneInString(s)
+	if !kdlIdentRune(r) || r == '#' || unicode.IsDigit(r) {
+		return false
+	}
+	if r == '+' || r == '-' || r == '.' {
+		next, m := utf8.DecodeRuneInString(s[n:])
+		if unicode.IsDigit(next) {
+			return false
+		}
+		if r != '.' && next == '.' {
+			after, _ := utf8.DecodeRuneInString(s[n+m:])
+			return !unicode.IsDigit(after)
+		}
+	}
+	return true
+}
+
+func kdlIdentRune(r rune) bool {
+	return r > 0x20 && r != utf8.RuneError && !unicode.IsSpace(r) && !strings.ContainsRune(`\/(){};[]="`, r)
+}
+
+// string parses a quoted string, a raw string or an identifier.
+func (p *kdlParser) string() (string, error) {
+	rest := p.s[p.i:]
+	switch {
+	case strings.HasPrefix(rest, `"`):
+		return p.quoted(0)
+	case rest[0] == '#' || rest[0] == 'r' && len(rest) > 1 && (rest[1] == '"' || rest[1] == '#'):
+		if rest[0] == 'r' {
+			// raw strings of version 1
+			p.i++
+		}
+		hashes := 0
+		for !p.eof() && p.s[p.i] == '#' {
+			hashes++
+			p.i++
+		}
+		if hashes == 0 && rest[0] == '#' {
+			break
+		}
+		return p.quoted(hashes)
+	}
+	if !kdlIdentStart(rest) {
+		return "", p.errorf("unexpected %s, expected string", p.quote())
+	}
+	start := p.i
+	for !p.eof() {
+		r, n := utf8.DecodeRuneInString(p.s[p.i:])
+		if !kdlIdentRune(r) {
+			break
+		}
+		p.i += n
+	}
+	return p.s[start:p.i], nil
+}
+
+// quoted parses a string in quotes, raw if it's delimited by hashes, e.g. #"a\b"#, or
+// multi-line if the quotes are tripled.
+func (p *kdlParser) quoted(hashes int) (string, error) {
+	raw := hashes > 0 || (p.i > 0 && p.s[p.i-1] == 'r')
+	start := p.i
+	quote := `"`
+	if strings.HasPrefix(p.s[p.i:], `"""`) {
+		quote = `"""`
+	}
+	p.i += len(quote)
+	closing := quote + strings.Repeat("#", hashes)
+
+	var b strings.Builder
+	for {
+		if p.eof() {
+			p.i = start
+			return "", p.errorf("unterminated string")
+		}
+		if strings.HasPrefix(p.s[p.i:], closing) {
+			p.i += len(closing)
+			break
+		}
+		if raw || p.s[p.i] != '\\' {
+			b.WriteByte(p.s[p.i])
+			p.i++
+			continue
+		}
+		if err := p.escape(&b); err != nil {
+			return "", err
+		}
+	}
+	if quote == `"""` {
+		s, err := kdlDedent(b.String())
+		if err != nil {
+			p.i = start
+			return "", p.errorf("%v", err)
+		}
+		return s, nil
+	}
+	return b.String(), nil
+}
+
+// escape parses the escape at the current position into the builder.
+func (p *kdlParser) escape(b *strings.Builder) error {
+	start := p.i
+	p.i++
+	if p.eof() {
+		return p.errorf("unterminated string")
+	}
+	c := p.s[p.i]
+	p.i++
+	switch c {
+	case 'n':
+		b.WriteByte('\n')
+	case 'r':
+		b.WriteByte('\r')
+	case 't':
+		b.WriteByte('\t')
+	case 'b':
+		b.WriteByte('\b')
+	case 'f':
+		b.WriteByte('\f')
+	case 's':
+		b.WriteByte(' ')
+	case '\\', '"', '/':
+		b.WriteByte(c)
+	case 'u':
+		end := strings.IndexByte(p.s[p.i:], '}')
+		if !strings.HasPrefix(p.s[p.i:], "{") || end < 2 || end > 7 {
+			p.i = start
+			return p.errorf("invalid \\u escape, expected \\u{XXXX}")
+		}
+		r, err := strconv.ParseUint(p.s[p.i+1:p.i+end], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			p.i = start
+			return p.errorf("invalid \\u escape, expected \\u{XXXX}")
+		}
+		b.WriteRune(rune(r))
+		p.i += end + 1
+	default:
+		if unicode.IsSpace(rune(c)) {
+			// escaped whitespace is skipped
+			for !p.eof() && unicode.IsSpace(p.peekRune()) {
+				p.i += utf8.RuneLen(p.peekRune())
+			}
+			return nil
+		}
+		p.i = start
+		return p.errorf("invalid escape \\%c", c)
+	}
+	return nil
+}
+
+// kdlDedent returns the content of a multi-line string, whose lines are dedented by the
+// whitespace of the line of the closing quotes.
+func kdlDedent(s string) (string, error) {
+	if !strings.HasPrefix(s, "\n") {
+		return "", fmt.Errorf("multi-line strings must start with a newline")
+	}
+	lines := strings.Split(s[1:], "\n")
+	prefix := lines[len(lines)-1]
+	if strings.TrimSpace(prefix) != "" {
+		return "", fmt.Errorf("closing quotes of multi-line strings must be on their own line")
+	}
+	lines = lines[:len(lines)-1]
+	for i, line := range lines {
+		switch {
+		case strings.TrimSpace(line) == "":
+			lines[i] = ""
+		case strings.HasPrefix(line, prefix):
+			lines[i] = line[len(prefix):]
+		default:
+			return "", fmt.Errorf("line %d of multi-line string isn't indented like the closing quotes", i+1)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// value parses an argument or property value.
+func (p *kdlParser) value() (any, error) {
+	if p.eof() {
+		return nil, p.errorf("unexpected end of file, expected value")
+	}
+	for _, keyword := range []struct {
+		text  string
+		value any
+	}{
+		{"#true", true}, {"#false", false}, {"#null", nil},
+		{"#inf", math.Inf(1)}, {"#-inf", math.Inf(-1)}, {"#nan", math.NaN()},
+	} {
+		if strings.HasPrefix(p.s[p.i:], keyword.text) && !p.continuesIdent(p.i+len(keyword.text)) {
+			p.i += len(keyword.text)
+			return keyword.value, nil
+		}
+	}
+
+	switch c := p.s[p.i]; {
+	case c >= '0' && c <= '9', (c == '-' || c == '+' || c == '.') && !kdlIdentStart(p.s[p.i:]):
+		return p.number()
+	case p.startsString():
+		quoted := p.s[p.i] == '"' || p.s[p.i] == '#' || p.s[p.i] == 'r' && len(p.s) > p.i+1 && (p.s[p.i+1] == '"' || p.s[p.i+1] == '#')
+		s, err := p.string()
+		if err != nil || quoted {
+			return s, err
+		}
+		switch s {
+		// keywords of version 1
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return s, nil
+	}
+	return nil, p.errorf("unexpected %s, expected value", p.quote())
+}
+
+// continuesIdent reports whether an identifier character is at the position.
+func (p *kdlParser) continuesIdent(i int) bool {
+	if i >= len(p.s) {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(p.s[i:])
+	return kdlIdentRune(r)
+}
+
+func (p *kdlParser) number() (any, error) {
+	start := p.i
+	for p.continuesIdent(p.i) {
+		p.i++
+	}
+	raw := p.s[start:p.i]
+	text := strings.ReplaceAll(raw, "_", "")
+	sign, digits := "", text
+	if strings.HasPrefix(text, "-") || strings.HasPrefix(text, "+") {
+		sign, digits = text[:1], text[1:]
+	}
+
+	for prefix, base := range map[string]int{"0x": 16, "0o": 8, "0b": 2} {
+		if strings.HasPrefix(digits, prefix) {
+			n, err := strconv.ParseInt(sign+digits[2:], base, 64)
+			if err != nil {
+				p.i = start
+				return nil, p.errorf("invalid number %s", raw)
+			}
+			return int(n), nil
+		}
+	}
+	if !strings.ContainsAny(digits, ".eE") {
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err == nil {
+			return int(n), nil
+		}
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil || strings.ContainsAny(digits, "xXnN") || strings.HasPrefix(digits, ".") || strings.HasSuffix(digits, ".") {
+		p.i = start
+		return nil, p.errorf("invalid number %s", raw)
+	}
+	return f, nil
+}
+
+func (kdlCodec) Encode(v map[string]any) ([]byte, error) {
+	var b bytes.Buffer
+	err := encodeKDLNodes(&b, v, 0)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// encodeKDLNodes encodes the keys of the map as nodes indented by indent.
+func encodeKDLNodes(b *bytes.Buffer, m map[string]any, indent int) error {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		err := encodeKDLNode(b, key, m[key], indent)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeKDLNode(b *bytes.Buffer, name string, value any, indent int) error {
+	prefix := strings.Repeat("    ", indent)
+	b.WriteString(prefix)
+	b.WriteString(kdlQuote(name, true))
+	switch value := value.(type) {
+	case map[string]any:
+		if len(value) == 0 {
+			b.WriteString(" {}\n")
+			return nil
+		}
+		b.WriteString(" {\n")
+		err := encodeKDLNodes(b, value, indent+1)
+		if err != nil {
+			return err
+		}
+		b.WriteString(prefix + "}\n")
+		return nil
+	case []any:
+		scalars := len(value) > 1
+		for _, elem := range value {
+			switch elem.(type) {
+			case map[string]any, []any:
+				scalars = false
+			}
+		}
+		if scalars {
+			for _, elem := range value {
+				s, err := kdlScalar(elem)
+				if err != nil {
+					return err
+				}
+				b.WriteString(" " + s)
+			}
+			b.WriteString("\n")
+			return nil
+		}
+		// lists of one element or of lists and maps are children named "-"
+		b.WriteString(" {\n")
+		for _, elem := range value {
+			err := encodeKDLNode(b, "-", elem, indent+1)
+			if err != nil {
+				return err
+			}
+		}
+		b.WriteString(prefix + "}\n")
+		return nil
+	case nil:
+		// nodes without arguments are null
+		b.WriteString("\n")
+		return nil
+	}
+	s, err := kdlScalar(value)
+	if err != nil {
+		return err
+	}
+	b.WriteString(" " + s + "\n")
+	return nil
+}
+
+// kdlScalar returns the value as a KDL value of version 2.
+func kdlScalar(value any) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "#null", nil
+	case bool:
+		if value {
+			return "#true", nil
+		}
+		return "#false", nil
+	case string:
+		return kdlQuote(value, false), nil
+	case float32:
+		return kdlFloat(float64(value)), nil
+	case float64:
+		return kdlFloat(value), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(value), nil
+	}
+	return "", fmt.Errorf("encode value: unsupported type %T", value)
+}
+
+func kdlFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "#inf"
+	case math.IsInf(f, -1):
+		return "#-inf"
+	case math.IsNaN(f):
+		return "#nan"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// kdlQuote quotes the string unless it's a node name that's a valid identifier.
+func kdlQuote(s string, name bool) string {
+	if name && s != "" && kdlIdentStart(s) && !slices.Contains([]string{"true", "false", "null", "inf", "-inf", "nan"}, s) && !strings.ContainsFunc(s, func(r rune) bool { return !kdlIdentRune(r) }) {
+		return s
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u{%x}`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
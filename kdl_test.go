@@ -0,0 +1,199 @@
+package hydra
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestKDLCodecDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]any
+	}{
+		{
+			name: "version 2",
+			in:   "server host=\"localhost\" {\n    port 8080\n    tls #true\n}\nhosts \"a\" \"b\"\nempty #null\nbare\n",
+			want: map[string]any{
+				"server": map[string]any{"host": "localhost", "port": 8080, "tls": true},
+				"hosts":  []any{"a", "b"},
+				"empty":  nil,
+				"bare":   nil,
+			},
+		},
+		{
+			name: "version 1",
+			in:   "tls true\nlog false\nnone null\nraw r#\"C:\\path \"quoted\"\"#\n",
+			want: map[string]any{"tls": true, "log": false, "none": nil, "raw": `C:\path "quoted"`},
+		},
+		{
+			name: "numbers",
+			in:   "n 1_000 -5 +3\nhex 0xff\noct 0o17\nbin 0b101\nf 1.5 -2e3\nspecial #inf #-inf\n",
+			want: map[string]any{
+				"n":       []any{1000, -5, 3},
+				"hex":     255,
+				"oct":     15,
+				"bin":     5,
+				"f":       []any{1.5, -2000.0},
+				"special": []any{math.Inf(1), math.Inf(-1)},
+			},
+		},
+		{
+			name: "strings",
+			in:   "plain abc\nescaped \"tab\\tquote\\\"\\u{1F600}\"\nraw #\"no \\escapes\"#\nmulti \"\"\"\n    line one\n      line two\n    \"\"\"\n",
+			want: map[string]any{
+				"plain":   "abc",
+				"escaped": "tab\tquote\"😀",
+				"raw":     `no \escapes`,
+				"multi":   "line one\n  line two",
+			},
+		},
+		{
+			name: "repeated nodes and dash children",
+			in:   "host a\nhost b\nhost c\nusers {\n    - name=a\n    - {\n        name b\n    }\n}\n",
+			want: map[string]any{
+				"host":  []any{"a", "b", "c"},
+				"users": []any{map[string]any{"name": "a"}, map[string]any{"name": "b"}},
+			},
+		},
+		{
+			name: "arguments with properties and children",
+			in:   "server 1 2 port=80 {\n    tls #true\n}\nlist x { - 1; - 2 }\n",
+			want: map[string]any{
+				"server": map[string]any{"-": []any{1, 2}, "port": 80, "tls": true},
+				"list":   map[string]any{"-": []any{"x", 1, 2}},
+			},
+		},
+		{
+			name: "comments, slashdash and continuations",
+			in:   "// comment\n/* block /* nested */ */ a 1 /-2 3 /-{ ignored 1 }\n/-b 2\nc \\ // continued\n    4; d 5\n(type)e (u8)6\n",
+			want: map[string]any{"a": []any{1, 3}, "c": 4, "d": 5, "e": 6},
+		},
+		{
+			name: "properties",
+			in:   "node a=1 \"b c\"=2 a=3 {}\n",
+			want: map[string]any{"node": map[string]any{"a": 3, "b c": 2}},
+		},
+		{
+			name: "bom and crlf",
+			in:   "\ufeffa 1\r\nb 2\r\n",
+			want: map[string]any{"a": 1, "b": 2},
+		},
+		{
+			name: "empty",
+			in:   "// nothing\n",
+			want: map[string]any{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]any{}
+			err := kdlCodec{}.Decode([]byte(tt.in), got)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKDLCodecDecodeError(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		want   string
+		line   int
+		column int
+	}{
+		{
+			name: "unclosed children", in: "a {\n    b 1\n",
+			want: `line 3, column 1: unexpected end of file, expected "}"`, line: 3, column: 1,
+		},
+		{
+			name: "unexpected brace", in: "a 1\n}\n",
+			want: `line 2, column 1: unexpected "}"`, line: 2, column: 1,
+		},
+		{
+			name: "missing space", in: "a \"b\"\"c\"\n",
+			want: `line 1, column 6: unexpected '"', expected space`, line: 1, column: 6,
+		},
+		{
+			name: "after children", in: "a {\n} 1\n",
+			want: "line 2, column 3: unexpected '1' after children of node a", line: 2, column: 3,
+		},
+		{
+			name: "several children blocks", in: "a {} {}\n",
+			want: "line 1, column 8: node a has several children blocks", line: 1, column: 8,
+		},
+		{
+			name: "numeric property name", in: "a 1=2\n",
+			want: "line 1, column 3: property name must be a string", line: 1, column: 3,
+		},
+		{
+			name: "invalid number", in: "a 1\nb 0xz\n",
+			want: "line 2, column 3: invalid number 0xz", line: 2, column: 3,
+		},
+		{
+			name: "invalid number with underscores", in: "a 1_000_x\n",
+			want: "line 1, column 3: invalid number 1_000_x", line: 1, column: 3,
+		},
+		{
+			name: "unterminated string", in: "a \"b\n",
+			want: "line 1, column 3: unterminated string", line: 1, column: 3,
+		},
+		{
+			name: "invalid escape", in: "a \"\\q\"\n",
+			want: `line 1, column 4: invalid escape \q`, line: 1, column: 4,
+		},
+		{
+			name: "unterminated comment", in: "a 1 /* b\n",
+			want: "line 1, column 5: unterminated comment", line: 1, column: 5,
+		},
+		{
+			name: "property conflicts with child", in: "a b=1 {\n    b 2\n}\n",
+			want: "node a: property b conflicts with a child",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := kdlCodec{}.Decode([]byte(tt.in), map[string]any{})
+			if err == nil || err.Error() != tt.want {
+				t.Fatalf("Decode() error = %v, want %q", err, tt.want)
+			}
+			if line, column := errorPosition(err, []byte(tt.in)); line != tt.line || column != tt.column {
+				t.Errorf("position = %d:%d, want %d:%d", line, column, tt.line, tt.column)
+			}
+		})
+	}
+}
+
+func TestKDLCodecRoundTrip(t *testing.T) {
+	in := map[string]any{
+		"server": map[string]any{"host": "localhost", "port": 8080, "tls": true},
+		"hosts":  []any{"a", "b"},
+		"single": []any{"a"},
+		"users":  []any{map[string]any{"name": "a"}, []any{1, 2}},
+		"empty":  map[string]any{},
+		"none":   nil,
+		"ratio":  1.0,
+		"inf":    math.Inf(1),
+		"quoted": "line\n\"two\"\t\x01",
+		"true":   "keyword name",
+		"a b":    "spaced name",
+	}
+	b, err := kdlCodec{}.Encode(in)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	got := map[string]any{}
+	err = kdlCodec{}.Decode(b, got)
+	if err != nil {
+		t.Fatalf("Decode(%s) error = %v", b, err)
+	}
+	if !reflect.DeepEqual(got, in) {
+		t.Errorf("round trip = %#v, want %#v\n%s", got, in, b)
+	}
+}
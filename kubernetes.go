@@ -0,0 +1,292 @@
+package hydra
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// serviceAccountDir is the directory the service account of a pod is mounted in.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// KubernetesConfig configures a source of the data keys of ConfigMaps and Secrets read from the
+// Kubernetes API, see WithKubernetes.
+type KubernetesConfig struct {
+	// Namespace of the ConfigMaps and Secrets. Defaults to the namespace of the pod.
+	Namespace string
+	// ConfigMaps and Secrets are the names of the objects whose data keys, e.g. "app.yaml", are
+	// loaded as configuration documents.
+	ConfigMaps []string
+	Secrets    []string
+	// Host of the API server, e.g. "https://kubernetes.default.svc". Defaults to the API server
+	// of the cluster the pod runs in.
+	Host string
+	// Token authorizes requests. Defaults to the token of the service account of the pod, which
+	// is read for every request as it's rotated.
+	Token string
+	// Client sends the requests. Defaults to a client trusting the certificate authority of the
+	// service account of the pod.
+	Client *http.Client
+}
+
+// kubernetesSource provides the data keys of ConfigMaps and Secrets as configuration documents.
+type kubernetesSource struct {
+	config KubernetesConfig
+
+	once   sync.Once
+	client *http.Client
+	err    error
+}
+
+// kubernetesObject is a ConfigMap or a Secret. Values of the data of Secrets and of the binary
+// data of ConfigMaps are encoded in base64, which is decoded into byte slices.
+type kubernetesObject struct {
+	Data       map[string]json.RawMessage `json:"data"`
+	BinaryData map[string][]byte          `json:"binaryData"`
+}
+
+// kubernetesResource is a ConfigMap or Secret of the source.
+type kubernetesResource struct {
+	// kind is the resource of the API, "configmaps" or "secrets".
+	kind string
+	name string
+}
+
+func (s *kubernetesSource) load(ctx context.Context, want func(rel string) bool) ([]document, error) {
+	var docs []document
+	for _, r := range s.resources() {
+		var obj kubernetesObject
+		found, err := s.get(ctx, "/"+r.kind+"/"+url.PathEscape(r.name), nil, func(body io.Reader) error {
+			return json.NewDecoder(body).Decode(&obj)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("get %s (name: %s): %w", r.kind, r.name, err)
+		}
+		if !found {
+			// the object may be created later
+			continue
+		}
+
+		data, err := obj.values(r.kind == "secrets")
+		if err != nil {
+			return nil, fmt.Errorf("decode %s (name: %s): %w", r.kind, r.name, err)
+		}
+		// data keys are loaded in the order of their names, like the files of mounted volumes
+		keys := make([]string, 0, len(data))
+		for key := range data {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			if !want(key) {
+				continue
+			}
+
+			name := "k8s:" + strings.TrimSuffix(r.kind, "s") + "/" + s.namespace() + "/" + r.name + "/" + key
+			docs = append(docs, document{name: name, rel: key, data: data[key]})
+		}
+	}
+	return docs, nil
+}
+
+// values returns the data of the object by key.
+func (o *kubernetesObject) values(secret bool) (map[string][]byte, error) {
+	values := make(map[string][]byte, len(o.Data)+len(o.BinaryData))
+	for key, raw := range o.Data {
+		var value any = new(string)
+		if secret {
+			value = new([]byte)
+		}
+		err := json.Unmarshal(raw, value)
+		if err != nil {
+			return nil, fmt.Errorf("decode key (key: %s): %w", key, err)
+		}
+
+		switch v := value.(type) {
+		case *string:
+			values[key] = []byte(*v)
+		case *[]byte:
+			values[key] = *v
+		}
+	}
+	for key, value := range o.BinaryData {
+		values[key] = value
+	}
+	return values, nil
+}
+
+// watch watches the ConfigMaps and Secrets with the watch API, until watching one of them fails.
+func (s *kubernetesSource) watch(ctx context.Context, changed func()) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resources := s.resources()
+	if len(resources) == 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	errs := make(chan error, len(resources))
+	for _, r := range resources {
+		go func() {
+			errs <- s.watchResource(ctx, r, changed)
+		}()
+	}
+
+	err := <-errs
+	cancel()
+	for range len(resources) - 1 {
+		<-errs
+	}
+	return err
+}
+
+// watchResource watches the object, invoking changed for every event. Watches closed by the API
+// server, e.g. after a timeout, are started again.
+func (s *kubernetesSource) watchResource(ctx context.Context, r kubernetesResource, changed func()) error {
+	query := url.Values{"watch": {"true"}, "fieldSelector": {"metadata.name=" + r.name}}
+	for {
+		// watches starting without a resource version begin with the current state of the
+		// object, so changes made before are caught up
+		found, err := s.get(ctx, "/"+r.kind, query, func(body io.Reader) error {
+			d := json.NewDecoder(body)
+			for {
+				var ev struct {
+					Type   string `json:"type"`
+					Object struct {
+						Message string `json:"message"`
+					} `json:"object"`
+				}
+				err := d.Decode(&ev)
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				if err != nil {
+					return fmt.Errorf("decode event: %w", err)
+				}
+				if ev.Type == "ERROR" {
+					return errors.New(ev.Object.Message)
+				}
+
+				changed()
+			}
+		})
+		if err == nil && !found {
+			err = errors.New("namespace not found")
+		}
+		if err != nil {
+			return fmt.Errorf("watch %s (name: %s): %w", r.kind, r.name, err)
+		}
+	}
+}
+
+func (s *kubernetesSource) resources() []kubernetesResource {
+	var resources []kubernetesResource
+	for _, name := range s.config.ConfigMaps {
+		resources = append(resources, kubernetesResource{kind: "configmaps", name: name})
+	}
+	for _, name := range s.config.Secrets {
+		resources = append(resources, kubernetesResource{kind: "secrets", name: name})
+	}
+	return resources
+}
+
+// get sends a GET request for the path of the namespace and passes the response body to read.
+// It reports false if the object isn't found.
+func (s *kubernetesSource) get(ctx context.Context, path string, query url.Values, read func(body io.Reader) error) (bool, error) {
+	client, err := s.httpClient()
+	if err != nil {
+		return false, err
+	}
+
+	u := s.host() + "/api/v1/namespaces/" + url.PathEscape(s.namespace()) + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return false, fmt.Errorf("create request: %w", err)
+	}
+
+	token := s.config.Token
+	if token == "" {
+		b, err := os.ReadFile(serviceAccountDir + "/token")
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, fmt.Errorf("read service account token: %w", err)
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, read(resp.Body)
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+}
+
+func (s *kubernetesSource) host() string {
+	if s.config.Host != "" {
+		return strings.TrimSuffix(s.config.Host, "/")
+	}
+	return "https://" + net.JoinHostPort(os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT"))
+}
+
+func (s *kubernetesSource) namespace() string {
+	if s.config.Namespace != "" {
+		return s.config.Namespace
+	}
+	b, err := os.ReadFile(serviceAccountDir + "/namespace")
+	if err != nil {
+		return "default"
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// httpClient returns the client of the requests, see KubernetesConfig.Client.
+func (s *kubernetesSource) httpClient() (*http.Client, error) {
+	if s.config.Client != nil {
+		return s.config.Client, nil
+	}
+
+	s.once.Do(func() {
+		b, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+		if err != nil {
+			s.err = fmt.Errorf("read service account certificate authority: %w", err)
+			return
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			s.err = errors.New("no service account certificate authority found")
+			return
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+		s.client = &http.Client{Transport: transport}
+	})
+	return s.client, s.err
+}
@@ -0,0 +1,226 @@
+package hydra
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// kubernetesTestServer is the API server of a cluster, whose ConfigMaps and Secrets are kept by
+// namespace, resource and name, e.g. "default/configmaps/myapp".
+type kubernetesTestServer struct {
+	mu      sync.Mutex
+	objects map[string]any
+	// watches receive the events of the objects watched by key.
+	watches map[string][]chan string
+	// fail is the message of the error events of watches, if set.
+	fail string
+}
+
+func newKubernetesTestServer(objects map[string]any) *kubernetesTestServer {
+	return &kubernetesTestServer{objects: objects, watches: make(map[string][]chan string)}
+}
+
+// put sets the object and notifies its watches.
+func (s *kubernetesTestServer) put(key string, obj any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = obj
+	for _, events := range s.watches[key] {
+		select {
+		case events <- "MODIFIED":
+		default:
+		}
+	}
+}
+
+func (s *kubernetesTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer s3cret" {
+		http.Error(w, `{"kind":"Status","code":401}`, http.StatusUnauthorized)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/api/v1/namespaces/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.URL.Query().Get("watch") == "true" {
+		name, _ := strings.CutPrefix(r.URL.Query().Get("fieldSelector"), "metadata.name=")
+		s.serveWatch(w, r, key+"/"+name)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[key]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(obj)
+}
+
+// serveWatch streams the events of the object, beginning with its current state.
+func (s *kubernetesTestServer) serveWatch(w http.ResponseWriter, r *http.Request, key string) {
+	events := make(chan string, 1)
+	s.mu.Lock()
+	if s.fail != "" {
+		s.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{"type": "ERROR", "object": map[string]any{"message": s.fail}})
+		return
+	}
+	s.watches[key] = append(s.watches[key], events)
+	if _, ok := s.objects[key]; ok {
+		events <- "ADDED"
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	for {
+		select {
+		case ev := <-events:
+			json.NewEncoder(w).Encode(map[string]any{"type": ev, "object": map[string]any{}})
+			w.(http.Flusher).Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func TestKubernetesSourceLoad(t *testing.T) {
+	objects := map[string]any{
+		"default/configmaps/myapp": map[string]any{
+			"data":       map[string]string{"b.yaml": "b: 2\n", "a.yaml": "a: 1\n"},
+			"binaryData": map[string][]byte{"c.json": []byte(`{"c": 3}`)},
+		},
+		"default/secrets/myapp": map[string]any{
+			"data": map[string][]byte{"secret.yaml": []byte("password: hunter2\n")},
+		},
+		"other/configmaps/myapp": map[string]any{
+			"data": map[string]string{"other.yaml": "other: true\n"},
+		},
+		"default/secrets/broken": map[string]any{
+			"data": map[string]string{"secret.yaml": "not base64!"},
+		},
+	}
+	tests := []struct {
+		name    string
+		config  KubernetesConfig
+		docs    []document
+		wantErr string
+	}{
+		{
+			name:   "config maps and secrets",
+			config: KubernetesConfig{Namespace: "default", ConfigMaps: []string{"myapp"}, Secrets: []string{"myapp"}},
+			docs: []document{
+				{name: "k8s:configmap/default/myapp/a.yaml", rel: "a.yaml", data: []byte("a: 1\n")},
+				{name: "k8s:configmap/default/myapp/b.yaml", rel: "b.yaml", data: []byte("b: 2\n")},
+				{name: "k8s:configmap/default/myapp/c.json", rel: "c.json", data: []byte(`{"c": 3}`)},
+				{name: "k8s:secret/default/myapp/secret.yaml", rel: "secret.yaml", data: []byte("password: hunter2\n")},
+			},
+		},
+		{
+			name:   "namespace",
+			config: KubernetesConfig{Namespace: "other", ConfigMaps: []string{"myapp"}},
+			docs:   []document{{name: "k8s:configmap/other/myapp/other.yaml", rel: "other.yaml", data: []byte("other: true\n")}},
+		},
+		{
+			name:   "not found",
+			config: KubernetesConfig{Namespace: "default", ConfigMaps: []string{"missing"}, Secrets: []string{"missing"}},
+		},
+		{
+			name:    "invalid secret",
+			config:  KubernetesConfig{Namespace: "default", Secrets: []string{"broken"}},
+			wantErr: "decode secrets (name: broken): decode key (key: secret.yaml): json: cannot unmarshal string into Go value of type []uint8: illegal base64 data at input byte 3",
+		},
+		{
+			name:    "unauthorized",
+			config:  KubernetesConfig{Namespace: "default", ConfigMaps: []string{"myapp"}, Token: "wrong"},
+			wantErr: "get configmaps (name: myapp): unexpected status: 401 Unauthorized",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(newKubernetesTestServer(objects))
+			defer srv.Close()
+
+			tt.config.Host = srv.URL + "/"
+			tt.config.Client = srv.Client()
+			if tt.config.Token == "" {
+				tt.config.Token = "s3cret"
+			}
+			docs, err := (&kubernetesSource{config: tt.config}).load(context.Background(), func(string) bool { return true })
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("load() error = %v", err)
+			}
+			if !reflect.DeepEqual(docs, tt.docs) {
+				t.Errorf("load() = %s, want %s", docs, tt.docs)
+			}
+		})
+	}
+}
+
+func TestKubernetesSourceWatch(t *testing.T) {
+	server := newKubernetesTestServer(map[string]any{
+		"default/configmaps/myapp": map[string]any{"data": map[string]string{"app.yaml": "port: 8080\n"}},
+	})
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	config := KubernetesConfig{
+		Namespace:  "default",
+		ConfigMaps: []string{"myapp"},
+		Secrets:    []string{"myapp"},
+		Host:       srv.URL,
+		Token:      "s3cret",
+		Client:     srv.Client(),
+	}
+	h, err := New(WithKubernetes(config), WithAutoReload())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	start(t, h)
+
+	server.put("default/configmaps/myapp", map[string]any{"data": map[string]string{"app.yaml": "port: 9090\n"}})
+	eventually(t, "config map changed", func() bool {
+		got, _ := Get[int](h, "port")
+		return got == 9090
+	})
+	// secrets created later are watched too
+	server.put("default/secrets/myapp", map[string]any{"data": map[string][]byte{"secret.yaml": []byte("password: hunter2\n")}})
+	eventually(t, "secret created", func() bool {
+		got, _ := Get[string](h, "password")
+		return got == "hunter2"
+	})
+}
+
+func TestKubernetesSourceWatchError(t *testing.T) {
+	server := newKubernetesTestServer(map[string]any{})
+	server.fail = "too old resource version: 1 (2)"
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	src := &kubernetesSource{config: KubernetesConfig{
+		Namespace:  "default",
+		ConfigMaps: []string{"myapp"},
+		Host:       srv.URL,
+		Token:      "s3cret",
+		Client:     srv.Client(),
+	}}
+	err := src.watch(context.Background(), func() {})
+	want := "watch configmaps (name: myapp): too old resource version: 1 (2)"
+	if err == nil || err.Error() != want {
+		t.Errorf("watch() error = %v, want %q", err, want)
+	}
+}
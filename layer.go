@@ -0,0 +1,235 @@
+package hydra
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// Namespace decides under which key the configuration of a file is placed in the merged
+// configuration.
+type Namespace int
+
+const (
+	// NoNamespace merges the configuration of all files at the top level.
+	NoNamespace Namespace = iota
+	// ByFileName places the configuration of a file under its name without the extension, e.g.
+	// "database.yaml" under "database". Dots in the name nest the key further, e.g.
+	// "database.replica.yaml" is placed under "database.replica".
+	ByFileName
+	// ByRelativePath places the configuration of a file under its path relative to the
+	// configured path it was found in, without the extension, e.g. "services/auth/limits.yaml"
+	// under "services.auth.limits".
+	ByRelativePath
+)
+
+// layer is the configuration decoded from a configuration file.
+type layer struct {
+	settings map[string]any
+	// env are the entries of a .env file by their names, see DotEnvEnvironment.
+	env map[string]envEntry
+	// sum is the checksum of the file contents the settings were decoded from.
+	sum [sha256.Size]byte
+	// raw are the file contents, to locate keys in errors, see Hydra.Position.
+	raw []byte
+}
+
+// readConfigFile reads and decodes the configuration file.
+func (h *Hydra) readConfigFile(path string) (*layer, error) {
+	b, err := h.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	format := h.format(path)
+	data := b
+	if isJsonnet(format) {
+		data, err = h.evalJsonnet(path, b)
+		if err != nil {
+			perr := &ParseError{Position: Position{File: path}, Err: fmt.Errorf("render jsonnet: %w", err)}
+			perr.Line, perr.Column = jsonnetErrorPosition(path, err)
+			return nil, perr
+		}
+		format = "json"
+	}
+	decoder, err := h.options.decoderRegistry.Decoder(format)
+	if err != nil {
+		return nil, fmt.Errorf("get decoder (format: %s): %w", format, err)
+	}
+
+	settings := make(map[string]any)
+	err = decoder.Decode(data, settings)
+	if err != nil {
+		perr := &ParseError{Position: Position{File: path}, Err: err}
+		if !isJsonnet(h.format(path)) {
+			// positions in rendered jsonnet don't match the file
+			perr.Line, perr.Column = errorPosition(err, data)
+		}
+		return nil, perr
+	}
+
+	l := &layer{
+		settings: nest(h.filterKeys(path, nest(toLowerKeys(settings), h.namespace(path))), h.keyPrefix()),
+		sum:      h.sum(path, b),
+		raw:      b,
+	}
+	if h.options.dotEnv == DotEnvEnvironment && isDotEnv(format) {
+		l.env = h.envEntries(path, settings, l)
+	}
+	return l, nil
+}
+
+// namespace returns the key under which the configuration of the file is placed, split into
+// its parts, see WithKeyNamespace.
+func (h *Hydra) namespace(path string) []string {
+	doc, isDocument := h.document(path)
+	if isDocument {
+		doc.rel = h.overlayBase(doc.rel)
+	}
+	// environment overlay files are placed under the key of their base files
+	path = h.overlayBase(path)
+
+	switch h.options.namespace {
+	case ByFileName:
+		name := filepath.Base(path)
+		if isDocument {
+			name = filepath.Base(doc.rel)
+		}
+		name = h.trimConfigExt(name)
+		// files without a name, e.g. ".env" or ".env.local", are placed at the top level
+		return slices.DeleteFunc(strings.Split(strings.ToLower(name), "."), isEmpty)
+	case ByRelativePath:
+		rel := filepath.Base(path)
+		if i := h.pathIndex(path); isDocument {
+			rel = doc.rel
+		} else if i < len(h.options.paths) && isDir(h.options.paths[i]) {
+			rel, _ = filepath.Rel(h.options.paths[i], path)
+		}
+		rel = h.trimConfigExt(rel)
+
+		var key []string
+		for _, dir := range strings.Split(filepath.ToSlash(rel), "/") {
+			key = append(key, strings.Split(strings.ToLower(dir), ".")...)
+		}
+		return slices.DeleteFunc(key, isEmpty)
+	default:
+		return nil
+	}
+}
+
+func isEmpty(s string) bool {
+	return s == ""
+}
+
+// keyPrefix returns the key under which the configuration is placed in viper, split into its
+// parts, see WithKeyPrefix.
+func (h *Hydra) keyPrefix() []string {
+	prefix := strings.ToLower(strings.Trim(h.options.keyPrefix, "."))
+	if prefix == "" {
+		return nil
+	}
+	return strings.Split(prefix, ".")
+}
+
+// nest places the settings under the key made of the parts.
+func nest(settings map[string]any, key []string) map[string]any {
+	for i := len(key) - 1; i >= 0; i-- {
+		settings = map[string]any{key[i]: settings}
+	}
+	return settings
+}
+
+// rereadConfigFile reads and decodes the configuration file on a reload, retrying as set by
+// WithReadRetry. A file that doesn't exist isn't retried.
+func (h *Hydra) rereadConfigFile(path string) (*layer, error) {
+	backoff := h.options.readBackoff
+	for attempt := 1; ; attempt++ {
+		l, err := h.readConfigFile(path)
+		if err == nil || errors.Is(err, os.ErrNotExist) || attempt >= h.options.readAttempts {
+			return l, err
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// checksum returns the checksum of the contents of the configuration file or document.
+func (h *Hydra) checksum(path string) ([sha256.Size]byte, error) {
+	b, err := h.readFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return h.sum(path, b), nil
+}
+
+func copyValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, value := range v {
+			m[key] = copyValue(value)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, value := range v {
+			s[i] = copyValue(value)
+		}
+		return s
+	default:
+		return value
+	}
+}
+
+// toLowerKeys returns a copy of the configuration tree with lowercased keys, as viper treats
+// keys case-insensitively.
+//
+// Keys differing only in case are combined deterministically: they're handled in sorted order,
+// so maps are merged and other values of later keys, e.g. "key" over "Key", take precedence.
+func toLowerKeys(m map[string]any) map[string]any {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	out := make(map[string]any, len(m))
+	for _, key := range keys {
+		lower := strings.ToLower(key)
+		value := lowerKeys(m[key])
+
+		existing, ok := out[lower].(map[string]any)
+		sub, isMap := value.(map[string]any)
+		if ok && isMap {
+			newMerger(MergeStrategy{}).mergeMap(existing, sub, lower)
+			continue
+		}
+		out[lower] = value
+	}
+	return out
+}
+
+func lowerKeys(value any) any {
+	switch v := value.(type) {
+	case map[any]any:
+		return toLowerKeys(cast.ToStringMap(v))
+	case map[string]any:
+		return toLowerKeys(v)
+	case []any:
+		s := make([]any, len(v))
+		for i, value := range v {
+			s[i] = lowerKeys(value)
+		}
+		return s
+	default:
+		return value
+	}
+}
@@ -0,0 +1,174 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestByFileName(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "database.yaml"), "host: db\nport: 5432\n")
+	writeFile(t, filepath.Join(dir, "Logging.yaml"), "level: info\n")
+	writeFile(t, filepath.Join(dir, "database.replica.yaml"), "host: replica\n")
+	writeFile(t, filepath.Join(dir, "nested", "cache.json"), `{"size": 10}`)
+	src := newMemSource(Document{Path: "conf/queue.yaml", Data: []byte("name: jobs\n")})
+
+	h, err := New(WithPaths(dir), WithSource(src), WithKeyNamespace(ByFileName), WithAutoReload())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	// files and documents are placed under their names, and dots in the names nest the keys
+	want := map[string]any{
+		"database": map[string]any{"host": "db", "port": 5432, "replica": map[string]any{"host": "replica"}},
+		"logging":  map[string]any{"level": "info"},
+		"cache":    map[string]any{"size": float64(10)},
+		"queue":    map[string]any{"name": "jobs"},
+	}
+	if got := h.viper.AllSettings(); !reflect.DeepEqual(got, want) {
+		t.Errorf("settings = %v, want %v", got, want)
+	}
+
+	// keys of reloads are placed under the namespace as well
+	var changes []Change
+	h.Listen(func(c Change) { changes = append(changes, c) })
+	writeFile(t, filepath.Join(dir, "database.yaml"), "host: primary\nport: 5432\n")
+	if err := h.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(changes) != 1 || !reflect.DeepEqual(changes[0].Modified, map[string]Values{"database.host": {Old: "db", New: "primary"}}) {
+		t.Errorf("changes = %+v, want database.host modified", changes)
+	}
+}
+
+func TestByRelativePath(t *testing.T) {
+	dir, other := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(dir, "services", "auth", "limits.yaml"), "rps: 100\n")
+	writeFile(t, filepath.Join(dir, "services", "auth.v2.yaml"), "enabled: true\n")
+	writeFile(t, filepath.Join(dir, "app.yaml"), "name: app\n")
+	writeFile(t, filepath.Join(other, "deep", "cache.yaml"), "size: 10\n")
+	src := newMemSource(Document{Path: "queues/jobs.yaml", Data: []byte("workers: 2\n")})
+
+	// files of a directory are placed under their relative paths, files configured as paths
+	// under their names and documents under their names in the source
+	h, err := New(WithPaths(dir, filepath.Join(other, "deep", "cache.yaml")), WithSource(src), WithKeyNamespace(ByRelativePath))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	want := map[string]any{
+		"services": map[string]any{
+			"auth": map[string]any{"limits": map[string]any{"rps": 100}, "v2": map[string]any{"enabled": true}},
+		},
+		"app":    map[string]any{"name": "app"},
+		"cache":  map[string]any{"size": 10},
+		"queues": map[string]any{"jobs": map[string]any{"workers": 2}},
+	}
+	if got := h.viper.AllSettings(); !reflect.DeepEqual(got, want) {
+		t.Errorf("settings = %v, want %v", got, want)
+	}
+}
+
+func TestMixedCaseKeys(t *testing.T) {
+	h, _, err := loadFiles(t, []string{
+		"Server:\n  Port: 1\n  host: a\nserver:\n  TLS: true\nKey: upper\nkey: lower\n",
+		"SERVER:\n  port: 2\n",
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// keys are lowercased, maps of keys differing in case are merged and of other values, the
+	// key sorting last within a file and the file taking precedence win
+	want := map[string]any{
+		"server": map[string]any{"port": 2, "host": "a", "tls": true},
+		"key":    "lower",
+	}
+	for range 10 {
+		if got := h.viper.AllSettings(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("settings = %v, want %v", got, want)
+		}
+		if err := h.Reload(context.Background()); err != nil {
+			t.Fatalf("Reload() error = %v", err)
+		}
+	}
+}
+
+func TestReadRetry(t *testing.T) {
+	const backoff = 20 * time.Millisecond
+	tests := []struct {
+		name     string
+		attempts int
+		// fixed is how long after the read the file is valid again, if it's fixed
+		fixed   time.Duration
+		wantErr bool
+		// wantWait is how long the read waits at least for retries
+		wantWait time.Duration
+	}{
+		{name: "no retry", fixed: 10 * time.Millisecond, wantErr: true},
+		{name: "fixed while retrying", attempts: 5, fixed: 30 * time.Millisecond, wantWait: 30 * time.Millisecond},
+		{name: "all attempts failed", attempts: 3, wantErr: true, wantWait: backoff + 2*backoff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "app.yaml")
+			writeFile(t, path, "port: 8080\n")
+			h, err := New(WithPaths(dir), WithReadRetry(tt.attempts, backoff))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer h.Close()
+
+			// the file is read while being written
+			writeFile(t, path, "port: [8080\n")
+			if tt.fixed > 0 {
+				timer := time.AfterFunc(tt.fixed, func() {
+					// replaced atomically, so it isn't read half written
+					if os.WriteFile(path+".tmp", []byte("port: 9090\n"), 0o644) == nil {
+						_ = os.Rename(path+".tmp", path)
+					}
+				})
+				defer timer.Stop()
+			}
+
+			began := time.Now()
+			l, err := h.rereadConfigFile(path)
+			if took := time.Since(began); took < tt.wantWait {
+				t.Errorf("rereadConfigFile() took %s, want at least %s", took, tt.wantWait)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("rereadConfigFile() = %+v, want error", l.settings)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("rereadConfigFile() error = %v", err)
+			}
+			if got := l.settings["port"]; got != 9090 {
+				t.Errorf("port = %v, want 9090", got)
+			}
+		})
+	}
+
+	// files that don't exist aren't retried
+	dir := t.TempDir()
+	h, err := New(WithPaths(dir), WithReadRetry(5, time.Second))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+	began := time.Now()
+	_, err = h.rereadConfigFile(filepath.Join(dir, "missing.yaml"))
+	if !errors.Is(err, os.ErrNotExist) || time.Since(began) >= time.Second {
+		t.Errorf("rereadConfigFile() error = %v after %s, want ErrNotExist at once", err, time.Since(began))
+	}
+}
@@ -0,0 +1,259 @@
+package hydra
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// SliceMerge decides how a slice is merged with a slice set for the same key by a
+// configuration file loaded earlier.
+type SliceMerge int
+
+const (
+	// ReplaceSlices replaces the earlier slice.
+	ReplaceSlices SliceMerge = iota
+	// AppendSlices appends the elements to the earlier slice.
+	AppendSlices
+	// MergeSlicesByKey merges maps with the same value of MergeStrategy.Key into the maps of the
+	// earlier slice, and appends the other elements.
+	MergeSlicesByKey
+)
+
+// Precedence decides which configuration file wins if multiple files set the same key.
+type Precedence int
+
+const (
+	// LastWins makes files loaded later take precedence over files loaded earlier.
+	LastWins Precedence = iota
+	// FirstWins makes files loaded earlier take precedence over files loaded later.
+	FirstWins
+)
+
+// ConflictPolicy decides what happens when configuration files set different values for the
+// same key.
+type ConflictPolicy int
+
+const (
+	// AllowConflicts silently lets the value of the file taking precedence win.
+	AllowConflicts ConflictPolicy = iota
+	// WarnConflicts reports conflicts as ConflictError (see WithErrorHandler) and lets the value
+	// of the file taking precedence win.
+	WarnConflicts
+	// FailConflicts makes loading or reloading the configuration fail with ConflictError.
+	FailConflicts
+)
+
+// EnvPrecedence decides whether environment variables bound to viper, e.g. by AutomaticEnv
+// or BindEnv, take precedence over configuration files.
+type EnvPrecedence int
+
+const (
+	// EnvWins lets environment variables take precedence over configuration files, which is
+	// the precedence of viper.
+	EnvWins EnvPrecedence = iota
+	// FilesWin lets configuration files take precedence over environment variables. The
+	// settings are applied as overrides of viper, as by viper.Set, so they take precedence
+	// over flags and values set by viper.Set as well.
+	FilesWin
+)
+
+// MergeStrategy controls how configuration files are merged, see WithMergeStrategy. The zero
+// value merges maps recursively and replaces other values, including slices.
+type MergeStrategy struct {
+	Slices SliceMerge
+	// Key identifies maps in slices merged by MergeSlicesByKey, e.g. "name".
+	Key string
+	// Conflicts sets how different values of the same key are handled. Maps are merged
+	// regardless, and so are slices unless they're replaced.
+	Conflicts ConflictPolicy
+	// NullDeletes makes a key set to null remove the key, including keys nested under it, set
+	// by files merged before, e.g. to unset a default, instead of setting it to nil.
+	NullDeletes bool
+}
+
+// ConflictError reports configuration files setting different values for the same key.
+type ConflictError struct {
+	Key string
+	// Files are the file that set the value first and the file setting a different value.
+	Files []string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("conflicting values of key %s (files: %s)", e.Key, strings.Join(e.Files, ", "))
+}
+
+// merger merges configuration files, keeping track of the file that set each key.
+type merger struct {
+	MergeStrategy
+	// path is the configuration file being merged.
+	path string
+	// origins maps keys to the configuration file that set them. Keys nested under a key set
+	// by a file aren't recorded separately.
+	origins map[string]string
+	// conflicts are conflicts reported by WarnConflicts.
+	conflicts []error
+}
+
+func newMerger(s MergeStrategy) *merger {
+	return &merger{
+		MergeStrategy: s,
+		origins:       make(map[string]string),
+	}
+}
+
+// merge merges a copy of the settings of the configuration file into dst.
+func (m *merger) merge(dst, settings map[string]any, path string) error {
+	m.path = path
+	return m.mergeMap(dst, settings, "")
+}
+
+// mergeMap merges a copy of src into dst. key is the dotted key of dst.
+func (m *merger) mergeMap(dst, src map[string]any, key string) error {
+	// keys are merged in order, so conflicts are reported deterministically
+	names := make([]string, 0, len(src))
+	for name := range src {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		value := src[name]
+		k := name
+		if key != "" {
+			k = key + "." + name
+		}
+
+		if value == nil && m.NullDeletes {
+			delete(dst, name)
+			m.dropOrigins(k)
+			delete(m.origins, k)
+			continue
+		}
+
+		existing, ok := dst[name]
+		if !ok {
+			dst[name] = m.copyValue(value)
+			m.origins[k] = m.path
+			continue
+		}
+
+		merged, err := m.mergeValue(existing, value, k)
+		if err != nil {
+			return err
+		}
+		dst[name] = merged
+	}
+	return nil
+}
+
+func (m *merger) mergeValue(dst, src any, key string) (any, error) {
+	switch src := src.(type) {
+	case map[string]any:
+		if d, ok := dst.(map[string]any); ok {
+			return d, m.mergeMap(d, src, key)
+		}
+	case []any:
+		if d, ok := dst.([]any); ok && m.Slices != ReplaceSlices {
+			merged, err := m.mergeSlices(d, src, key)
+			m.origins[key] = m.path
+			return merged, err
+		}
+	}
+
+	if m.Conflicts != AllowConflicts && !reflect.DeepEqual(dst, src) {
+		err := &ConflictError{
+			Key:   key,
+			Files: []string{origin(m.origins, key), m.path},
+		}
+		if m.Conflicts == FailConflicts {
+			return nil, err
+		}
+		m.conflicts = append(m.conflicts, err)
+	}
+
+	switch dst.(type) {
+	case map[string]any, []any:
+		// the value replaces keys nested in it
+		m.dropOrigins(key)
+	}
+	m.origins[key] = m.path
+	return m.copyValue(src), nil
+}
+
+func (m *merger) mergeSlices(dst, src []any, key string) ([]any, error) {
+	if m.Slices == AppendSlices {
+		return append(dst, copyValue(src).([]any)...), nil
+	}
+
+	for _, elem := range src {
+		i := m.indexByKey(dst, elem)
+		if i < 0 {
+			dst = append(dst, copyValue(elem))
+			continue
+		}
+
+		err := m.mergeMap(dst[i].(map[string]any), elem.(map[string]any), fmt.Sprintf("%s[%d]", key, i))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dst, nil
+}
+
+// indexByKey returns the index of the map in elems identified by the same value of the key as
+// elem, or -1 if there is none.
+func (m *merger) indexByKey(elems []any, elem any) int {
+	key := strings.ToLower(m.Key)
+
+	e, ok := elem.(map[string]any)
+	if !ok {
+		return -1
+	}
+	id, ok := e[key]
+	if !ok {
+		return -1
+	}
+
+	return slices.IndexFunc(elems, func(other any) bool {
+		o, ok := other.(map[string]any)
+		return ok && reflect.DeepEqual(o[key], id)
+	})
+}
+
+// copyValue returns a deep copy of the value. With NullDeletes, keys set to null are omitted.
+func (m *merger) copyValue(value any) any {
+	v, ok := value.(map[string]any)
+	if !ok || !m.NullDeletes {
+		return copyValue(value)
+	}
+
+	c := make(map[string]any, len(v))
+	for key, value := range v {
+		if value != nil {
+			c[key] = m.copyValue(value)
+		}
+	}
+	return c
+}
+
+// dropOrigins forgets the origins of keys nested under the key.
+func (m *merger) dropOrigins(key string) {
+	for k := range m.origins {
+		if strings.HasPrefix(k, key+".") || strings.HasPrefix(k, key+"[") {
+			delete(m.origins, k)
+		}
+	}
+}
+
+// origin looks up the configuration file that set the key or the closest key it's nested in.
+func origin(origins map[string]string, key string) string {
+	for key != "" {
+		if path, ok := origins[key]; ok {
+			return path
+		}
+		key = key[:max(strings.LastIndexAny(key, ".["), 0)]
+	}
+	return ""
+}
@@ -0,0 +1,312 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// loadFiles writes the files into a temporary directory and returns hydra loading them in
+// their order with the options.
+func loadFiles(t *testing.T, files []string, opts ...Option) (*Hydra, []string, error) {
+	t.Helper()
+	dir := t.TempDir()
+	var paths []string
+	for i, data := range files {
+		path := filepath.Join(dir, string(rune('a'+i))+".yaml")
+		writeFile(t, path, data)
+		paths = append(paths, path)
+		opts = append(opts, WithPath(path))
+	}
+	h, err := New(append([]Option{WithPaths()}, opts...)...)
+	if err == nil {
+		t.Cleanup(func() { h.Close() })
+	}
+	return h, paths, err
+}
+
+func TestMergeStrategy(t *testing.T) {
+	base := "servers:\n  - name: a\n    port: 1\n  - name: b\n    port: 2\ntags: [x]\ndb:\n  host: db\n  pool:\n    size: 1\n    idle: 1\n"
+	override := "servers:\n  - name: b\n    port: 3\n  - name: c\n    port: 4\ntags: [y]\ndb:\n  pool:\n    size: 5\n"
+	tests := []struct {
+		name     string
+		strategy MergeStrategy
+		want     map[string]any
+	}{
+		{
+			name: "replace slices",
+			want: map[string]any{
+				"servers": []any{map[string]any{"name": "b", "port": 3}, map[string]any{"name": "c", "port": 4}},
+				"tags":    []any{"y"},
+				"db":      map[string]any{"host": "db", "pool": map[string]any{"size": 5, "idle": 1}},
+			},
+		},
+		{
+			name:     "append slices",
+			strategy: MergeStrategy{Slices: AppendSlices},
+			want: map[string]any{
+				"servers": []any{
+					map[string]any{"name": "a", "port": 1}, map[string]any{"name": "b", "port": 2},
+					map[string]any{"name": "b", "port": 3}, map[string]any{"name": "c", "port": 4},
+				},
+				"tags": []any{"x", "y"},
+				"db":   map[string]any{"host": "db", "pool": map[string]any{"size": 5, "idle": 1}},
+			},
+		},
+		{
+			name:     "merge slices by key",
+			strategy: MergeStrategy{Slices: MergeSlicesByKey, Key: "Name"},
+			want: map[string]any{
+				"servers": []any{
+					map[string]any{"name": "a", "port": 1}, map[string]any{"name": "b", "port": 3},
+					map[string]any{"name": "c", "port": 4},
+				},
+				"tags": []any{"x", "y"},
+				"db":   map[string]any{"host": "db", "pool": map[string]any{"size": 5, "idle": 1}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _, err := loadFiles(t, []string{base, override}, WithMergeStrategy(tt.strategy))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if got := h.viper.AllSettings(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("settings = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeStrategyReplacesNested(t *testing.T) {
+	// maps are merged deeply, and values of other types replace maps with the keys nested in them
+	h, _, err := loadFiles(t, []string{"db:\n  pool:\n    size: 1\n", "db:\n  pool: none\n", "db:\n  host: db\n"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	want := map[string]any{"db": map[string]any{"pool": "none", "host": "db"}}
+	if got := h.viper.AllSettings(); !reflect.DeepEqual(got, want) {
+		t.Errorf("settings = %v, want %v", got, want)
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	files := []string{"port: 1\ntags: [a]\nfirst: true\n", "port: 2\ntags: [b]\n", "port: 3\ntags: [c]\n"}
+	tests := []struct {
+		name       string
+		precedence Precedence
+		priority   bool
+		wantPort   int
+		wantTags   []any
+	}{
+		{name: "last wins", precedence: LastWins, wantPort: 3, wantTags: []any{"a", "b", "c"}},
+		{name: "first wins", precedence: FirstWins, wantPort: 1, wantTags: []any{"c", "b", "a"}},
+		// priorities take precedence over the order of the paths either way
+		{name: "last wins priority", precedence: LastWins, priority: true, wantPort: 2, wantTags: []any{"a", "c", "b"}},
+		{name: "first wins priority", precedence: FirstWins, priority: true, wantPort: 2, wantTags: []any{"c", "a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []Option{WithPrecedence(tt.precedence), WithMergeStrategy(MergeStrategy{Slices: AppendSlices})}
+			h, paths, err := loadFiles(t, files, opts...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if tt.priority {
+				// the second file is loaded again with a higher priority
+				h, _, err = loadFiles(t, nil, append(opts, WithPath(paths[0]), WithPath(paths[1], Priority(1)), WithPath(paths[2]))...)
+				if err != nil {
+					t.Fatalf("New() error = %v", err)
+				}
+			}
+
+			check := func(when string) {
+				t.Helper()
+				if got, _ := Get[int](h, "port"); got != tt.wantPort {
+					t.Errorf("%s: port = %d, want %d", when, got, tt.wantPort)
+				}
+				if got := h.viper.Get("tags"); !reflect.DeepEqual(got, tt.wantTags) {
+					t.Errorf("%s: tags = %v, want %v", when, got, tt.wantTags)
+				}
+				if !h.viper.GetBool("first") {
+					t.Errorf("%s: key set only by the first file is missing", when)
+				}
+			}
+			check("load")
+
+			// reloads merge the files with the same precedence
+			writeFile(t, paths[1], files[1])
+			if err := h.Reload(context.Background()); err != nil {
+				t.Fatalf("Reload() error = %v", err)
+			}
+			check("reload")
+		})
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	files := []string{"port: 1\nhost: db\nserver:\n  tls: true\ntags: [a]\n", "port: 2\nhost: db\nserver:\n  cert: c\ntags: [b]\n"}
+	tests := []struct {
+		name       string
+		conflicts  ConflictPolicy
+		slices     SliceMerge
+		wantKeys   []string
+		wantReport bool
+		wantErr    bool
+	}{
+		{name: "allow", conflicts: AllowConflicts},
+		{name: "warn", conflicts: WarnConflicts, wantKeys: []string{"port", "tags"}, wantReport: true},
+		{name: "fail", conflicts: FailConflicts, wantKeys: []string{"port"}, wantErr: true},
+		// appended slices don't conflict
+		{name: "warn appending", conflicts: WarnConflicts, slices: AppendSlices, wantKeys: []string{"port"}, wantReport: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reported []string
+			var conflicting []string
+			handler := WithErrorHandler(func(err error) {
+				var conflict *ConflictError
+				if errors.As(err, &conflict) {
+					reported = append(reported, conflict.Key)
+					conflicting = conflict.Files
+				}
+			})
+			strategy := MergeStrategy{Conflicts: tt.conflicts, Slices: tt.slices}
+			h, paths, err := loadFiles(t, files, WithMergeStrategy(strategy), handler)
+
+			if tt.wantErr {
+				var conflict *ConflictError
+				if !errors.As(err, &conflict) {
+					t.Fatalf("New() error = %v, want ConflictError", err)
+				}
+				if conflict.Key != "port" || !reflect.DeepEqual(conflict.Files, paths) {
+					t.Errorf("conflict = %+v, want port of %v", conflict, paths)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if !tt.wantReport {
+				if len(reported) != 0 {
+					t.Errorf("reported conflicts = %v, want none", reported)
+				}
+				return
+			}
+			if !reflect.DeepEqual(reported, tt.wantKeys) {
+				t.Errorf("reported conflicts = %v, want %v", reported, tt.wantKeys)
+			}
+			if !reflect.DeepEqual(conflicting, paths) {
+				t.Errorf("conflicting files = %v, want %v", conflicting, paths)
+			}
+			// the value of the file taking precedence wins
+			if got, _ := Get[int](h, "port"); got != 2 {
+				t.Errorf("port = %d, want 2", got)
+			}
+		})
+	}
+}
+
+func TestConflictsReload(t *testing.T) {
+	h, paths, err := loadFiles(t, []string{"port: 1\n", "host: db\n"}, WithMergeStrategy(MergeStrategy{Conflicts: FailConflicts}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// a reload introducing a conflict fails and keeps the configuration
+	writeFile(t, paths[1], "host: db\nport: 2\n")
+	err = h.Reload(context.Background())
+	var reloadErr *ReloadError
+	var conflict *ConflictError
+	if !errors.As(err, &reloadErr) || !errors.As(err, &conflict) {
+		t.Fatalf("Reload() error = %v, want ReloadError of ConflictError", err)
+	}
+	if got, _ := Get[int](h, "port"); got != 1 {
+		t.Errorf("port = %d, want 1", got)
+	}
+}
+
+func TestNullDeletes(t *testing.T) {
+	files := []string{"db:\n  host: db\n  pool:\n    size: 1\nport: 1\n", "db:\n  pool: null\nport: null\n"}
+	tests := []struct {
+		name        string
+		nullDeletes bool
+		want        []string
+	}{
+		// keys set to nil are still keys of viper, though not set
+		{name: "null sets nil", want: []string{"db.host", "db.pool", "port"}},
+		{name: "null deletes", nullDeletes: true, want: []string{"db.host"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _, err := loadFiles(t, files, WithMergeStrategy(MergeStrategy{NullDeletes: tt.nullDeletes}))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if got := sorted(h.viper.AllKeys()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("keys = %v, want %v", got, tt.want)
+			}
+			if h.viper.IsSet("db.pool.size") || h.viper.IsSet("port") {
+				t.Error("keys set to null by the second file are still set")
+			}
+		})
+	}
+}
+
+func TestNullDeletesFirstFile(t *testing.T) {
+	// keys set to null by the first file aren't set, and can't delete keys of later files
+	h, _, err := loadFiles(t, []string{"db:\n  host: null\n  port: 1\n", "db:\n  host: db\n"},
+		WithMergeStrategy(MergeStrategy{NullDeletes: true}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	want := map[string]any{"db": map[string]any{"host": "db", "port": 1}}
+	if got := h.viper.AllSettings(); !reflect.DeepEqual(got, want) {
+		t.Errorf("settings = %v, want %v", got, want)
+	}
+}
+
+func TestEnvPrecedence(t *testing.T) {
+	t.Setenv("MYAPP_PORT", "9090")
+	t.Setenv("MYAPP_LOG", "debug")
+	tests := []struct {
+		name       string
+		precedence EnvPrecedence
+		wantPort   int
+		wantReload int
+	}{
+		{name: "env wins", precedence: EnvWins, wantPort: 9090, wantReload: 9090},
+		{name: "files win", precedence: FilesWin, wantPort: 8080, wantReload: 8081},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := viper.New()
+			v.SetEnvPrefix("myapp")
+			v.AutomaticEnv()
+			h, paths, err := loadFiles(t, []string{"port: 8080\nlog: info\n"}, WithViper(v), WithEnvPrecedence(tt.precedence))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if got := v.GetInt("port"); got != tt.wantPort {
+				t.Errorf("port = %d, want %d", got, tt.wantPort)
+			}
+
+			// on reloads as well, and keys removed from the files fall back to the environment
+			writeFile(t, paths[0], "port: 8081\n")
+			if err := h.Reload(context.Background()); err != nil {
+				t.Fatalf("Reload() error = %v", err)
+			}
+			if got := v.GetInt("port"); got != tt.wantReload {
+				t.Errorf("port after reload = %d, want %d", got, tt.wantReload)
+			}
+			if got := v.GetString("log"); got != "debug" {
+				t.Errorf("log = %s, want debug of the environment", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,505 @@
+package hydra
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultNATSHandshakeTimeout is the time servers are given to accept connections.
+const defaultNATSHandshakeTimeout = 10 * time.Second
+
+// NATSConfig configures a source of configuration documents stored as keys of a NATS JetStream
+// key-value bucket, see WithNATS.
+type NATSConfig struct {
+	// Servers of the cluster, e.g. "nats://localhost:4222", which are connected to in order
+	// until one accepts the connection. Users and passwords of the URLs authenticate the
+	// connection.
+	Servers []string
+	// Bucket is the name of the key-value bucket, e.g. "config".
+	Bucket string
+	// Prefix selects the keys starting with it, e.g. "myapp/". Keys relative to the prefix are
+	// used like relative paths, see ByRelativePath, and their extensions determine their
+	// formats, e.g. "myapp/app.yaml".
+	Prefix string
+	// Token, or User and Password, authenticate the connection.
+	Token    string
+	User     string
+	Password string
+	// TLS configures TLS connections, if set.
+	TLS *tls.Config
+}
+
+// natsSource provides the configuration documents stored as keys of a bucket.
+type natsSource struct {
+	config NATSConfig
+}
+
+type natsError struct {
+	Code        int    `json:"code"`
+	ErrCode     int    `json:"err_code"`
+	Description string `json:"description"`
+}
+
+func (e *natsError) Error() string {
+	return fmt.Sprintf("jetstream error %d: %s", e.ErrCode, e.Description)
+}
+
+func (s *natsSource) load(ctx context.Context, want func(rel string) bool) ([]document, error) {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	subjects, err := s.subjects(conn)
+	if err != nil {
+		return nil, fmt.Errorf("list keys (bucket: %s): %w", s.config.Bucket, err)
+	}
+
+	var docs []document
+	for _, subject := range subjects {
+		key := strings.TrimPrefix(subject, "$KV."+s.config.Bucket+".")
+		if !strings.HasPrefix(key, s.config.Prefix) {
+			continue
+		}
+
+		rel := strings.TrimPrefix(strings.TrimPrefix(key, s.config.Prefix), "/")
+		if rel == "" {
+			// the prefix is the key of a single document
+			rel = key
+		}
+		if !want(rel) {
+			continue
+		}
+
+		var resp struct {
+			Message struct {
+				Headers []byte `json:"hdrs"`
+				Data    []byte `json:"data"`
+			} `json:"message"`
+			Error *natsError `json:"error"`
+		}
+		err := conn.request("$JS.API.STREAM.MSG.GET."+s.stream(), map[string]string{"last_by_subj": subject}, &resp)
+		if err == nil && resp.Error != nil {
+			err = resp.Error
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get key (key: %s): %w", key, err)
+		}
+
+		if op := natsHeader(resp.Message.Headers, "KV-Operation"); op == "DEL" || op == "PURGE" {
+			// deleted
+			continue
+		}
+		docs = append(docs, document{name: "nats:" + s.config.Bucket + "/" + key, rel: rel, data: resp.Message.Data})
+	}
+	return docs, nil
+}
+
+// watch creates a consumer of the bucket delivering the changes of its keys.
+func (s *natsSource) watch(ctx context.Context, changed func()) error {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	deliver := natsInbox()
+	err = conn.subscribe(deliver, "2")
+	if err != nil {
+		return fmt.Errorf("subscribe to changes: %w", err)
+	}
+
+	req := map[string]any{
+		"stream_name": s.stream(),
+		"config": map[string]any{
+			"deliver_subject": deliver,
+			"deliver_policy":  "new",
+			"ack_policy":      "none",
+			"replay_policy":   "instant",
+			"filter_subject":  "$KV." + s.config.Bucket + "." + natsFilter(s.config.Prefix),
+			"mem_storage":     true,
+		},
+	}
+	var resp struct {
+		Error *natsError `json:"error"`
+	}
+	err = conn.request("$JS.API.CONSUMER.CREATE."+s.stream(), req, &resp)
+	if err == nil && resp.Error != nil {
+		err = resp.Error
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("create consumer (bucket: %s): %w", s.config.Bucket, err)
+	}
+
+	// changes made before the consumer was created are caught up
+	changed()
+
+	for {
+		msg, err := conn.next()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("read change: %w", err)
+		}
+		if msg.subject == deliver {
+			changed()
+		}
+	}
+}
+
+// subjects returns the subjects of the keys of the bucket.
+func (s *natsSource) subjects(conn *natsConn) ([]string, error) {
+	var subjects []string
+	for {
+		var resp struct {
+			State struct {
+				Subjects map[string]uint64 `json:"subjects"`
+			} `json:"state"`
+			Total int        `json:"total"`
+			Error *natsError `json:"error"`
+		}
+		req := map[string]any{"subjects_filter": "$KV." + s.config.Bucket + "." + natsFilter(s.config.Prefix), "offset": len(subjects)}
+		err := conn.request("$JS.API.STREAM.INFO."+s.stream(), req, &resp)
+		if err == nil && resp.Error != nil {
+			err = resp.Error
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for subject := range resp.State.Subjects {
+			subjects = append(subjects, subject)
+		}
+		if len(resp.State.Subjects) == 0 || len(subjects) >= resp.Total {
+			break
+		}
+	}
+	slices.Sort(subjects)
+	return subjects, nil
+}
+
+// stream returns the name of the stream of the bucket.
+func (s *natsSource) stream() string {
+	return "KV_" + s.config.Bucket
+}
+
+// natsFilter returns the subject filter of keys starting with the prefix. The filter selects
+// the tokens of the prefix ending with a dot, and keys are matched by the prefix otherwise.
+func natsFilter(prefix string) string {
+	if i := strings.LastIndex(prefix, "."); i >= 0 {
+		return prefix[:i+1] + ">"
+	}
+	return ">"
+}
+
+// natsHeader returns the value of the header of the headers of a message, e.g.
+// "NATS/1.0\r\nKV-Operation: DEL\r\n\r\n".
+func natsHeader(headers []byte, name string) string {
+	_, hdr, ok := strings.Cut(string(headers), "\r\n")
+	if !ok {
+		return ""
+	}
+	h, _ := textproto.NewReader(bufio.NewReader(strings.NewReader(hdr))).ReadMIMEHeader()
+	return h.Get(name)
+}
+
+// dial connects to the first server of the cluster accepting the connection.
+func (s *natsSource) dial(ctx context.Context) (*natsConn, error) {
+	var errs []error
+	for _, server := range s.config.Servers {
+		c, err := s.connect(ctx, server)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("connect (server: %s): %w", server, err))
+			continue
+		}
+		return c, nil
+	}
+	if len(errs) == 0 {
+		return nil, errors.New("no servers")
+	}
+	return nil, errors.Join(errs...)
+}
+
+// connect connects to the server, authenticating the connection.
+func (s *natsSource) connect(ctx context.Context, server string) (*natsConn, error) {
+	if !strings.Contains(server, "://") {
+		server = "nats://" + server
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), "4222")
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	c := &natsConn{Conn: conn, r: bufio.NewReader(conn)}
+	err = s.handshake(ctx, c, u)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// handshake authenticates the connection to the server of the URL, upgrading it to TLS if
+// configured.
+func (s *natsSource) handshake(ctx context.Context, c *natsConn, u *url.URL) error {
+	// servers not responding are given up on
+	c.SetDeadline(time.Now().Add(defaultNATSHandshakeTimeout))
+	defer c.SetDeadline(time.Time{})
+
+	// the server sends its info before the connection is upgraded to TLS
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("read server info: %w", err)
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("unexpected greeting: %q", strings.TrimSpace(line))
+	}
+	if s.config.TLS != nil || u.Scheme == "tls" {
+		config := s.config.TLS.Clone()
+		if config == nil {
+			config = &tls.Config{}
+		}
+		if config.ServerName == "" {
+			config.ServerName = u.Hostname()
+		}
+		tlsConn := tls.Client(c.Conn, config)
+		err := tlsConn.HandshakeContext(ctx)
+		if err != nil {
+			return fmt.Errorf("handshake: %w", err)
+		}
+		c.Conn, c.r = tlsConn, bufio.NewReader(tlsConn)
+	}
+
+	opts := map[string]any{
+		"verbose":       false,
+		"pedantic":      false,
+		"headers":       true,
+		"no_responders": true,
+		"protocol":      1,
+		"lang":          "go",
+		"name":          "hydra",
+	}
+	user, password := s.config.User, s.config.Password
+	if u.User != nil {
+		user = u.User.Username()
+		password, _ = u.User.Password()
+	}
+	if user != "" {
+		opts["user"], opts["pass"] = user, password
+	}
+	if s.config.Token != "" {
+		opts["auth_token"] = s.config.Token
+	}
+	b, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+
+	err = c.write("CONNECT " + string(b) + "\r\nPING\r\n")
+	if err != nil {
+		return err
+	}
+	// the server responds to the ping once the connection is accepted
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if line == "PONG" {
+			break
+		}
+		if line == "PING" {
+			err := c.write("PONG\r\n")
+			if err != nil {
+				return err
+			}
+		}
+		if strings.HasPrefix(line, "-ERR") {
+			return errors.New(strings.Trim(strings.TrimPrefix(line, "-ERR "), "'"))
+		}
+	}
+
+	// replies to requests are delivered to subjects of an inbox
+	c.inbox = natsInbox()
+	return c.subscribe(c.inbox+".*", "1")
+}
+
+// natsConn is a connection speaking the NATS protocol.
+type natsConn struct {
+	net.Conn
+	r *bufio.Reader
+	// inbox is the prefix of subjects of replies to requests.
+	inbox string
+
+	mu sync.Mutex
+	// requests counts the requests sent, naming their reply subjects.
+	requests int
+}
+
+type natsMsg struct {
+	subject string
+	headers []byte
+	data    []byte
+}
+
+// request sends a request and decodes the JSON reply into resp.
+func (c *natsConn) request(subject string, req any, resp any) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+
+	c.mu.Lock()
+	c.requests++
+	reply := c.inbox + "." + strconv.Itoa(c.requests)
+	c.mu.Unlock()
+
+	err = c.write(fmt.Sprintf("PUB %s %s %d\r\n%s\r\n", subject, reply, len(b), b))
+	if err != nil {
+		return err
+	}
+
+	for {
+		msg, err := c.next()
+		if err != nil {
+			return err
+		}
+		if msg.subject != reply {
+			continue
+		}
+		if natsStatus(msg.headers) == "503" {
+			return errors.New("no responders, JetStream may not be enabled")
+		}
+		err = json.Unmarshal(msg.data, resp)
+		if err != nil {
+			return fmt.Errorf("decode reply: %w", err)
+		}
+		return nil
+	}
+}
+
+// subscribe subscribes to the subject with the subscription ID.
+func (c *natsConn) subscribe(subject, sid string) error {
+	return c.write("SUB " + subject + " " + sid + "\r\n")
+}
+
+// next returns the next message delivered to a subscription, responding to pings of the server.
+func (c *natsConn) next() (*natsMsg, error) {
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "PING":
+			err := c.write("PONG\r\n")
+			if err != nil {
+				return nil, err
+			}
+		case "-ERR":
+			return nil, errors.New(strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'"))
+		case "MSG":
+			// MSG <subject> <sid> [reply] <size>
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil || len(fields) < 4 {
+				return nil, fmt.Errorf("invalid message: %q", line)
+			}
+			data, err := c.payload(size)
+			if err != nil {
+				return nil, err
+			}
+			return &natsMsg{subject: fields[1], data: data}, nil
+		case "HMSG":
+			// HMSG <subject> <sid> [reply] <header size> <total size>
+			if len(fields) < 5 {
+				return nil, fmt.Errorf("invalid message: %q", line)
+			}
+			hsize, err1 := strconv.Atoi(fields[len(fields)-2])
+			size, err2 := strconv.Atoi(fields[len(fields)-1])
+			if err1 != nil || err2 != nil || hsize > size {
+				return nil, fmt.Errorf("invalid message: %q", line)
+			}
+			data, err := c.payload(size)
+			if err != nil {
+				return nil, err
+			}
+			return &natsMsg{subject: fields[1], headers: data[:hsize], data: data[hsize:]}, nil
+		}
+	}
+}
+
+// payload reads the payload of a message followed by CRLF.
+func (c *natsConn) payload(size int) ([]byte, error) {
+	b := make([]byte, size+2)
+	_, err := io.ReadFull(c.r, b)
+	if err != nil {
+		return nil, err
+	}
+	return b[:size], nil
+}
+
+func (c *natsConn) write(s string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := io.WriteString(c.Conn, s)
+	return err
+}
+
+// natsInbox returns a random subject of an inbox.
+func natsInbox() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return "_INBOX." + hex.EncodeToString(b)
+}
+
+// natsStatus returns the status of the headers of a message, e.g. "503" for
+// "NATS/1.0 503\r\n\r\n".
+func natsStatus(headers []byte) string {
+	line, _, _ := strings.Cut(string(headers), "\r\n")
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return ""
+	}
+	return fields[1]
+}
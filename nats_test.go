@@ -0,0 +1,441 @@
+package hydra
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// natsTestServer is a NATS server with JetStream speaking enough of the protocol for
+// natsSource, whose key-value bucket "config" is kept by keys.
+type natsTestServer struct {
+	ln net.Listener
+	// connect checks the options of CONNECT, returning an error to reject the connection.
+	connect func(opts map[string]any) error
+	// tls upgrades connections to TLS after the server info, if set.
+	tls *tls.Config
+	// noJetStream makes requests of the JetStream API have no responders.
+	noJetStream bool
+
+	mu        sync.Mutex
+	keys      map[string]natsTestEntry
+	consumers []natsTestConsumer
+	conns     []net.Conn
+}
+
+type natsTestEntry struct {
+	data []byte
+	// op is the KV-Operation header, e.g. "DEL".
+	op string
+}
+
+type natsTestConsumer struct {
+	conn    *natsTestConn
+	deliver string
+	filter  string
+}
+
+type natsTestConn struct {
+	net.Conn
+	mu sync.Mutex
+}
+
+func (c *natsTestConn) msg(subject, sid string, headers string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if headers == "" {
+		fmt.Fprintf(c, "MSG %s %s %d\r\n%s\r\n", subject, sid, len(data), data)
+		return
+	}
+	fmt.Fprintf(c, "HMSG %s %s %d %d\r\n%s%s\r\n", subject, sid, len(headers), len(headers)+len(data), headers, data)
+}
+
+// newNATSTestServer returns a server listening for connections, which are accepted once it's
+// started, so its options can be set before.
+func newNATSTestServer(t *testing.T, keys map[string]string) *natsTestServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &natsTestServer{ln: ln, keys: make(map[string]natsTestEntry)}
+	for key, data := range keys {
+		s.keys[key] = natsTestEntry{data: []byte(data)}
+	}
+	t.Cleanup(func() {
+		ln.Close()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, c := range s.conns {
+			c.Close()
+		}
+	})
+	return s
+}
+
+// start accepts connections.
+func (s *natsTestServer) start() {
+	go func() {
+		for {
+			conn, err := s.ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+}
+
+func (s *natsTestServer) address() string {
+	return s.ln.Addr().String()
+}
+
+// put sets the key, or deletes it if data is nil, and delivers the change to the consumers
+// filtering it.
+func (s *natsTestServer) put(key string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := natsTestEntry{data: data}
+	headers := ""
+	if data == nil {
+		e.op = "DEL"
+		headers = "NATS/1.0\r\nKV-Operation: DEL\r\n\r\n"
+	}
+	s.keys[key] = e
+	for _, c := range s.consumers {
+		if natsTestMatch(c.filter, "$KV.config."+key) {
+			c.conn.msg(c.deliver, "2", headers, data)
+		}
+	}
+}
+
+// natsTestMatch reports whether the subject matches the filter, which may end with ">".
+func natsTestMatch(filter, subject string) bool {
+	if prefix, ok := strings.CutSuffix(filter, ">"); ok {
+		return strings.HasPrefix(subject, prefix)
+	}
+	return filter == subject
+}
+
+func (s *natsTestServer) serve(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprint(conn, "INFO {\"server_id\":\"test\",\"headers\":true}\r\n")
+	if s.tls != nil {
+		tlsConn := tls.Server(conn, s.tls)
+		if tlsConn.Handshake() != nil {
+			return
+		}
+		conn = tlsConn
+	}
+	c := &natsTestConn{Conn: conn}
+	r := bufio.NewReader(conn)
+	var inbox string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		op, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch op {
+		case "CONNECT":
+			var opts map[string]any
+			err := json.Unmarshal([]byte(args), &opts)
+			if err == nil && s.connect != nil {
+				err = s.connect(opts)
+			}
+			if err != nil {
+				c.mu.Lock()
+				fmt.Fprintf(c, "-ERR '%s'\r\n", err)
+				c.mu.Unlock()
+				return
+			}
+		case "PING":
+			c.mu.Lock()
+			fmt.Fprint(c, "PONG\r\n")
+			c.mu.Unlock()
+		case "SUB":
+			if subject, sid, _ := strings.Cut(args, " "); sid == "1" {
+				inbox = strings.TrimSuffix(subject, "*")
+			}
+		case "PUB":
+			fields := strings.Fields(args)
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			reply := fields[1]
+			if !strings.HasPrefix(reply, inbox) {
+				return
+			}
+			if s.noJetStream {
+				c.msg(reply, "1", "NATS/1.0 503\r\n\r\n", nil)
+				continue
+			}
+			resp := s.handle(c, fields[0], payload[:size])
+			b, _ := json.Marshal(resp)
+			c.msg(reply, "1", "", b)
+		}
+	}
+}
+
+// handle returns the response of a request of the JetStream API.
+func (s *natsTestServer) handle(c *natsTestConn, subject string, payload []byte) any {
+	var req map[string]any
+	_ = json.Unmarshal(payload, &req)
+	api, stream, _ := strings.Cut(strings.TrimPrefix(subject, "$JS.API."), ".KV_")
+	if stream != "config" {
+		return map[string]any{"error": natsError{Code: 404, ErrCode: 10059, Description: "stream not found"}}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch api {
+	case "STREAM.INFO":
+		var subjects []string
+		for key := range s.keys {
+			if subject := "$KV.config." + key; natsTestMatch(req["subjects_filter"].(string), subject) {
+				subjects = append(subjects, subject)
+			}
+		}
+		slices.Sort(subjects)
+		// subjects are paged by two
+		offset := int(req["offset"].(float64))
+		page := make(map[string]uint64)
+		for _, subject := range subjects[min(offset, len(subjects)):min(offset+2, len(subjects))] {
+			page[subject] = 1
+		}
+		return map[string]any{"state": map[string]any{"subjects": page}, "total": len(subjects)}
+	case "STREAM.MSG.GET":
+		e, ok := s.keys[strings.TrimPrefix(req["last_by_subj"].(string), "$KV.config.")]
+		if !ok {
+			return map[string]any{"error": natsError{Code: 404, ErrCode: 10037, Description: "no message found"}}
+		}
+		msg := map[string]any{"data": e.data}
+		if e.op != "" {
+			msg["hdrs"] = []byte("NATS/1.0\r\nKV-Operation: " + e.op + "\r\n\r\n")
+		}
+		return map[string]any{"message": msg}
+	case "CONSUMER.CREATE":
+		config := req["config"].(map[string]any)
+		s.consumers = append(s.consumers, natsTestConsumer{
+			conn:    c,
+			deliver: config["deliver_subject"].(string),
+			filter:  config["filter_subject"].(string),
+		})
+		return map[string]any{}
+	}
+	return map[string]any{"error": natsError{Code: 400, ErrCode: 10003, Description: "bad request"}}
+}
+
+func TestNATSSourceLoad(t *testing.T) {
+	keys := map[string]string{
+		"myapp/app.yaml":       "port: 8080\n",
+		"myapp/db/db.json":     `{"host": "localhost"}`,
+		"myapp/extra.yaml":     "extra: true\n",
+		"myapp/deleted.yaml":   "",
+		"other/app.yaml":       "port: 1\n",
+		"myapp.dotted.env.yml": "a: 1\n",
+	}
+	docs := []document{
+		{name: "nats:config/myapp/app.yaml", rel: "app.yaml", data: []byte("port: 8080\n")},
+		{name: "nats:config/myapp/db/db.json", rel: "db/db.json", data: []byte(`{"host": "localhost"}`)},
+		{name: "nats:config/myapp/extra.yaml", rel: "extra.yaml", data: []byte("extra: true\n")},
+	}
+	tests := []struct {
+		name   string
+		config NATSConfig
+		// userinfo are the user and password of the URL of the server, e.g. "user:pass@".
+		userinfo    string
+		connect     func(opts map[string]any) error
+		tls         bool
+		noJetStream bool
+		want        func(rel string) bool
+		docs        []document
+		wantErr     string
+	}{
+		{name: "prefix", config: NATSConfig{Bucket: "config", Prefix: "myapp/"}, docs: docs},
+		{
+			name:   "filtered",
+			config: NATSConfig{Bucket: "config", Prefix: "myapp/"},
+			want:   func(rel string) bool { return strings.HasSuffix(rel, ".json") },
+			docs:   docs[1:2],
+		},
+		{
+			name:   "single key",
+			config: NATSConfig{Bucket: "config", Prefix: "other/app.yaml"},
+			docs:   []document{{name: "nats:config/other/app.yaml", rel: "other/app.yaml", data: []byte("port: 1\n")}},
+		},
+		{
+			name:   "dotted prefix",
+			config: NATSConfig{Bucket: "config", Prefix: "myapp.dotted."},
+			docs:   []document{{name: "nats:config/myapp.dotted.env.yml", rel: "env.yml", data: []byte("a: 1\n")}},
+		},
+		{
+			name:   "token",
+			config: NATSConfig{Bucket: "config", Prefix: "other/", Token: "s3cret"},
+			connect: func(opts map[string]any) error {
+				if opts["auth_token"] != "s3cret" {
+					return errors.New("Authorization Violation")
+				}
+				return nil
+			},
+			docs: []document{{name: "nats:config/other/app.yaml", rel: "app.yaml", data: []byte("port: 1\n")}},
+		},
+		{
+			name:     "user of the url",
+			config:   NATSConfig{Bucket: "config", Prefix: "other/", User: "ignored", Password: "ignored"},
+			userinfo: "user:pass@",
+			connect: func(opts map[string]any) error {
+				if opts["user"] != "user" || opts["pass"] != "pass" {
+					return errors.New("Authorization Violation")
+				}
+				return nil
+			},
+			docs: []document{{name: "nats:config/other/app.yaml", rel: "app.yaml", data: []byte("port: 1\n")}},
+		},
+		{
+			name:   "tls",
+			config: NATSConfig{Bucket: "config", Prefix: "other/"},
+			tls:    true,
+			docs:   []document{{name: "nats:config/other/app.yaml", rel: "app.yaml", data: []byte("port: 1\n")}},
+		},
+		{
+			name:    "authorization violation",
+			config:  NATSConfig{Bucket: "config", Prefix: "other/", Token: "wrong"},
+			connect: func(map[string]any) error { return errors.New("Authorization Violation") },
+			wantErr: "connect (server: SERVER): Authorization Violation",
+		},
+		{
+			name:    "unknown bucket",
+			config:  NATSConfig{Bucket: "missing"},
+			wantErr: "list keys (bucket: missing): jetstream error 10059: stream not found",
+		},
+		{
+			name:        "no jetstream",
+			config:      NATSConfig{Bucket: "config"},
+			noJetStream: true,
+			wantErr:     "list keys (bucket: config): no responders, JetStream may not be enabled",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newNATSTestServer(t, keys)
+			s.put("myapp/deleted.yaml", nil)
+			s.connect, s.noJetStream = tt.connect, tt.noJetStream
+			server := "nats://" + tt.userinfo + s.address()
+			if tt.tls {
+				ts := httptest.NewTLSServer(http.NotFoundHandler())
+				defer ts.Close()
+				s.tls = ts.TLS
+				tt.config.TLS = ts.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+				tt.config.TLS.ServerName = "example.com"
+			}
+			s.start()
+
+			// servers refusing connections are skipped
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			refused := ln.Addr().String()
+			ln.Close()
+			tt.config.Servers = []string{refused, server}
+
+			want := tt.want
+			if want == nil {
+				want = func(string) bool { return true }
+			}
+			src := &natsSource{config: tt.config}
+			docs, err := src.load(context.Background(), want)
+			if tt.wantErr != "" {
+				wantErr := strings.ReplaceAll(tt.wantErr, "SERVER", server)
+				if err == nil || !strings.HasSuffix(err.Error(), wantErr) {
+					t.Fatalf("load() error = %v, want suffix %q", err, wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("load() error = %v", err)
+			}
+			if !reflect.DeepEqual(docs, tt.docs) {
+				t.Errorf("load() = %+v, want %+v", docs, tt.docs)
+			}
+		})
+	}
+}
+
+func TestNATSFilter(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{prefix: "", want: ">"},
+		{prefix: "myapp/", want: ">"},
+		{prefix: "myapp.", want: "myapp.>"},
+		{prefix: "myapp.config.app", want: "myapp.config.>"},
+	}
+	for _, tt := range tests {
+		if got := natsFilter(tt.prefix); got != tt.want {
+			t.Errorf("natsFilter(%q) = %q, want %q", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestNATSSourceWatch(t *testing.T) {
+	s := newNATSTestServer(t, map[string]string{"myapp/app.yaml": "port: 8080\n"})
+	s.start()
+	h, err := New(WithNATS(NATSConfig{Servers: []string{s.address()}, Bucket: "config", Prefix: "myapp/"}), WithAutoReload())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got, _ := Get[int](h, "port"); got != 8080 {
+		t.Fatalf("port = %d, want 8080", got)
+	}
+	start(t, h)
+	eventually(t, "consumer created", func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.consumers) > 0
+	})
+
+	steps := []struct {
+		key  string
+		data []byte
+		get  string
+		want any
+	}{
+		{key: "myapp/app.yaml", data: []byte("port: 9090\n"), get: "port", want: 9090},
+		{key: "myapp/db.yaml", data: []byte("db: postgres\n"), get: "db", want: "postgres"},
+		{key: "myapp/app.yaml", data: nil, get: "port", want: nil},
+	}
+	for _, step := range steps {
+		s.put(step.key, step.data)
+		eventually(t, step.get+" changed", func() bool {
+			got, err := Get[any](h, step.get)
+			if step.want == nil {
+				return errors.Is(err, ErrKeyNotSet)
+			}
+			return got == step.want
+		})
+	}
+	if got, _ := Get[string](h, "db"); got != "postgres" {
+		t.Errorf("db = %q after deleting app.yaml, want postgres", got)
+	}
+}
@@ -0,0 +1,380 @@
+package hydra
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// nestedTextCodec decodes and encodes NestedText files. Values are strings, lists and
+// dictionaries, nested by indentation, and are never quoted or escaped, e.g.
+//
+//	server:
+//	    host: localhost
+//	    ports:
+//	        - 8080
+//	        - 8443
+//	motd:
+//	    > Welcome,
+//	    > have fun
+type nestedTextCodec struct{}
+
+// ntLine is a line of a NestedText file.
+type ntLine struct {
+	n      int
+	indent int
+	// kind is "-" of list items, ":" of dictionary items, ">" of string lines, ": " of key lines
+	// or "[" and "{" of inline lists and dictionaries.
+	kind  string
+	key   string
+	value string
+	// nested reports whether the item has no value on its line, so the value is nested below.
+	nested bool
+}
+
+func (nestedTextCodec) Decode(b []byte, v map[string]any) error {
+	lines, err := ntLines(string(b))
+	if err != nil {
+		return err
+	}
+	if len(lines) == 0 {
+		// empty files have no configuration
+		return nil
+	}
+
+	p := &ntParser{lines: lines}
+	value, err := p.value(lines[0].indent)
+	if err != nil {
+		return err
+	}
+	if p.i < len(lines) {
+		return fmt.Errorf("line %d: invalid indentation", lines[p.i].n)
+	}
+	m, ok := value.(map[string]any)
+	if !ok {
+		return fmt.Errorf("top-level value is not a dictionary: %T", value)
+	}
+	for key, value := range m {
+		v[key] = value
+	}
+	return nil
+}
+
+// ntLines classifies the lines of the file, skipping blank lines and comments.
+func ntLines(s string) ([]ntLine, error) {
+	s = strings.TrimPrefix(s, "\ufeff")
+	var lines []ntLine
+	for i, text := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n") {
+		n := i + 1
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.TrimSpace(trimmed) == "" || trimmed[0] == '#' {
+			continue
+		}
+		if trimmed[0] == '\t' || (len(text) > len(trimmed) && strings.Contains(text[:len(text)-len(trimmed)], "\t")) {
+			return nil, fmt.Errorf("line %d: invalid indentation, tabs are not allowed", n)
+		}
+
+		l := ntLine{n: n, indent: len(text) - len(trimmed)}
+		switch {
+		case trimmed == "-" || strings.HasPrefix(trimmed, "- "):
+			l.kind, l.value = "-", strings.TrimPrefix(trimmed[1:], " ")
+			l.nested = trimmed == "-"
+		case trimmed == ">" || strings.HasPrefix(trimmed, "> "):
+			l.kind, l.value = ">", strings.TrimPrefix(trimmed[1:], " ")
+		case trimmed == ":" || strings.HasPrefix(trimmed, ": "):
+			l.kind, l.key = ": ", strings.TrimPrefix(trimmed[1:], " ")
+		case trimmed[0] == '[' || trimmed[0] == '{':
+			l.kind, l.value = trimmed[:1], strings.TrimRight(trimmed, " ")
+		default:
+			i := strings.Index(trimmed, ": ")
+			if i < 0 && strings.HasSuffix(trimmed, ":") {
+				i = len(trimmed) - 1
+			}
+			if i < 0 {
+				return nil, fmt.Errorf("line %d: unrecognized line: %s", n, trimmed)
+			}
+			l.kind, l.key = ":", strings.TrimRight(trimmed[:i], " ")
+			l.value = strings.TrimPrefix(trimmed[i+1:], " ")
+			l.nested = i == len(trimmed)-1
+		}
+		lines = append(lines, l)
+	}
+	return lines, nil
+}
+
+// ntParser parses the classified lines of a NestedText file.
+type ntParser struct {
+	lines []ntLine
+	i     int
+}
+
+// value parses the value starting at the current line, which is indented by indent.
+func (p *ntParser) value(indent int) (any, error) {
+	first := p.lines[p.i]
+	if first.indent != indent {
+		return nil, fmt.Errorf("line %d: invalid indentation", first.n)
+	}
+
+	switch first.kind {
+	case "-":
+		var list []any
+		for p.i < len(p.lines) && p.lines[p.i].indent == indent {
+			l := p.lines[p.i]
+			if l.kind != "-" {
+				return nil, fmt.Errorf("line %d: expected list item", l.n)
+			}
+			p.i++
+			value, err := p.item(l, indent)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	case ">":
+		var text []string
+		for p.i < len(p.lines) && p.lines[p.i].indent == indent {
+			l := p.lines[p.i]
+			if l.kind != ">" {
+				return nil, fmt.Errorf("line %d: expected string line", l.n)
+			}
+			text = append(text, l.value)
+			p.i++
+		}
+		return strings.Join(text, "\n"), nil
+	case "[", "{":
+		p.i++
+		r := &ntInline{s: first.value, n: first.n, indent: first.indent}
+		value, err := r.value()
+		if err == nil && r.i < len(r.s) {
+			err = r.errorf("unexpected %q after inline value", r.s[r.i])
+		}
+		if err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+
+	m := make(map[string]any)
+	for p.i < len(p.lines) && p.lines[p.i].indent == indent {
+		l := p.lines[p.i]
+		if l.kind != ":" && l.kind != ": " {
+			return nil, fmt.Errorf("line %d: expected dictionary item", l.n)
+		}
+		p.i++
+
+		var value any = l.value
+		key := l.key
+		if l.kind == ": " {
+			// multiline keys continue on the following key lines, and their values are nested
+			keys := []string{key}
+			for p.i < len(p.lines) && p.lines[p.i].indent == indent && p.lines[p.i].kind == ": " {
+				keys = append(keys, p.lines[p.i].key)
+				p.i++
+			}
+			key = strings.Join(keys, "\n")
+			l.nested = true
+		}
+		if l.nested {
+			var err error
+			value, err = p.item(l, indent)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if _, ok := m[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key: %s", l.n, key)
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+// item returns the value of the list or dictionary item, which may be nested below it.
+func (p *ntParser) item(l ntLine, indent int) (any, error) {
+	if !l.nested {
+		return l.value, nil
+	}
+	if p.i == len(p.lines) || p.lines[p.i].indent <= indent {
+		// items without nested values are empty strings
+		if l.kind == ": " {
+			return nil, fmt.Errorf("line %d: key has no value", l.n)
+		}
+		return "", nil
+	}
+	return p.value(p.lines[p.i].indent)
+}
+
+// ntInline parses inline lists and dictionaries, e.g. "[a, b]" or "{a: 1, b: 2}".
+type ntInline struct {
+	s string
+	i int
+	// n and indent are the number and indentation of the line.
+	n, indent int
+}
+
+func (r *ntInline) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d, column %d: %s", r.n, r.indent+r.i+1, fmt.Sprintf(format, args...))
+}
+
+func (r *ntInline) value() (any, error) {
+	if r.i == len(r.s) {
+		return nil, r.errorf("unexpected end of line")
+	}
+
+	switch r.s[r.i] {
+	case '[':
+		list := []any{}
+		r.i++
+		if strings.HasPrefix(r.s[r.i:], "]") {
+			r.i++
+			return list, nil
+		}
+		for {
+			value, err := r.element(']')
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+			if r.i == len(r.s) {
+				return nil, r.errorf("unexpected end of line, expected \",\" or \"]\"")
+			}
+			r.i++
+			if r.s[r.i-1] == ']' {
+				return list, nil
+			}
+		}
+	case '{':
+		m := make(map[string]any)
+		r.i++
+		if strings.HasPrefix(r.s[r.i:], "}") {
+			r.i++
+			return m, nil
+		}
+		for {
+			key := r.text("[]{},:")
+			if r.i == len(r.s) || r.s[r.i] != ':' {
+				return nil, r.errorf("expected \":\" after key %q", key)
+			}
+			r.i++
+			value, err := r.element('}')
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+			if r.i == len(r.s) {
+				return nil, r.errorf("unexpected end of line, expected \",\" or \"}\"")
+			}
+			r.i++
+			if r.s[r.i-1] == '}' {
+				return m, nil
+			}
+		}
+	}
+	return nil, r.errorf("unexpected %q", r.s[r.i])
+}
+
+// element parses an element of an inline list or a value of an inline dictionary, which is
+// followed by "," or the closing bracket.
+func (r *ntInline) element(closing byte) (any, error) {
+	var value any
+	if text := r.text("[]{},"); text != "" || r.i == len(r.s) || (r.s[r.i] != '[' && r.s[r.i] != '{') {
+		value = text
+	} else {
+		var err error
+		value, err = r.value()
+		if err != nil {
+			return nil, err
+		}
+		for r.i < len(r.s) && r.s[r.i] == ' ' {
+			r.i++
+		}
+	}
+	if r.i < len(r.s) && r.s[r.i] != ',' && r.s[r.i] != closing {
+		return nil, r.errorf("unexpected %q", r.s[r.i])
+	}
+	return value, nil
+}
+
+// text parses text up to one of the special characters, without surrounding spaces.
+func (r *ntInline) text(special string) string {
+	start := r.i
+	for r.i < len(r.s) && !strings.ContainsRune(special, rune(r.s[r.i])) {
+		r.i++
+	}
+	return strings.TrimSpace(r.s[start:r.i])
+}
+
+func (nestedTextCodec) Encode(v map[string]any) ([]byte, error) {
+	var b bytes.Buffer
+	err := encodeNestedText(&b, v, 0)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// encodeNestedText encodes the value indented by indent.
+func encodeNestedText(b *bytes.Buffer, value any, indent int) error {
+	prefix := strings.Repeat(" ", indent)
+	switch value := value.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			s, ok := ntScalar(value[key])
+			switch {
+			case strings.Contains(key, "\n") || strings.Contains(key, ": ") || strings.TrimSpace(key) != key || key == "" || strings.ContainsAny(key[:1], "#-[{>:"):
+				for _, line := range strings.Split(key, "\n") {
+					fmt.Fprintf(b, "%s: %s\n", prefix, line)
+				}
+			case ok && !strings.Contains(s, "\n"):
+				fmt.Fprintf(b, "%s%s: %s\n", prefix, key, s)
+				continue
+			default:
+				fmt.Fprintf(b, "%s%s:\n", prefix, key)
+			}
+			err := encodeNestedText(b, value[key], indent+4)
+			if err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, elem := range value {
+			if s, ok := ntScalar(elem); ok && !strings.Contains(s, "\n") {
+				fmt.Fprintf(b, "%s- %s\n", prefix, s)
+				continue
+			}
+			fmt.Fprintf(b, "%s-\n", prefix)
+			err := encodeNestedText(b, elem, indent+4)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		s, err := cast.ToStringE(value)
+		if err != nil {
+			return fmt.Errorf("encode value: %w", err)
+		}
+		for _, line := range strings.Split(s, "\n") {
+			fmt.Fprintf(b, "%s> %s\n", prefix, line)
+		}
+	}
+	return nil
+}
+
+// ntScalar returns the value as a string if it's not a list or dictionary.
+func ntScalar(value any) (string, bool) {
+	switch value.(type) {
+	case map[string]any, []any:
+		return "", false
+	}
+	s, err := cast.ToStringE(value)
+	return s, err == nil
+}
@@ -0,0 +1,150 @@
+package hydra
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNestedTextCodecDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]any
+	}{
+		{
+			name: "dictionaries and lists",
+			in:   "# comment\nserver:\n    host: localhost\n    ports:\n        - 8080\n        - 8443\n\nname: app\n",
+			want: map[string]any{
+				"server": map[string]any{"host": "localhost", "ports": []any{"8080", "8443"}},
+				"name":   "app",
+			},
+		},
+		{
+			name: "multiline strings",
+			in:   "motd:\n    > Welcome,\n    >\n    > have fun\n",
+			want: map[string]any{"motd": "Welcome,\n\nhave fun"},
+		},
+		{
+			name: "values are not quoted",
+			in:   "quoted: \"a\": 'b'\nhash: a # b\nspaces:   padded  \n",
+			want: map[string]any{"quoted": `"a": 'b'`, "hash": "a # b", "spaces": "  padded  "},
+		},
+		{
+			name: "empty values",
+			in:   "empty:\nitems:\n    -\n    - \n",
+			want: map[string]any{"empty": "", "items": []any{"", ""}},
+		},
+		{
+			name: "multiline keys",
+			in:   ": first\n: second\n    > value\n",
+			want: map[string]any{"first\nsecond": "value"},
+		},
+		{
+			name: "inline values",
+			in:   "list: [a, b]\nnested:\n    [a, [b, c], {d: e}, []]\ndict:\n    {a: 1, b: [x], c: {}}\n",
+			want: map[string]any{
+				"list":   "[a, b]",
+				"nested": []any{"a", []any{"b", "c"}, map[string]any{"d": "e"}, []any{}},
+				"dict":   map[string]any{"a": "1", "b": []any{"x"}, "c": map[string]any{}},
+			},
+		},
+		{
+			name: "list of dictionaries",
+			in:   "users:\n    -\n        name: a\n    -\n        name: b\n",
+			want: map[string]any{"users": []any{map[string]any{"name": "a"}, map[string]any{"name": "b"}}},
+		},
+		{
+			name: "bom and crlf",
+			in:   "\ufeffa: 1\r\nb:\r\n    - 2\r\n",
+			want: map[string]any{"a": "1", "b": []any{"2"}},
+		},
+		{
+			name: "empty",
+			in:   "# nothing\n\n",
+			want: map[string]any{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]any{}
+			err := nestedTextCodec{}.Decode([]byte(tt.in), got)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNestedTextCodecDecodeError(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		want   string
+		line   int
+		column int
+	}{
+		{name: "tabs", in: "a:\n\t- b\n", want: "line 2: invalid indentation, tabs are not allowed", line: 2},
+		{name: "unrecognized", in: "a: 1\nb\n", want: "line 2: unrecognized line: b", line: 2},
+		{name: "indentation", in: "a:\n    b: 1\n  c: 2\n", want: "line 3: invalid indentation", line: 3},
+		{name: "mixed items", in: "a:\n    - 1\n    b: 2\n", want: "line 3: expected list item", line: 3},
+		{name: "duplicate key", in: "a: 1\nb: 2\na: 3\n", want: "line 3: duplicate key: a", line: 3},
+		{name: "key without value", in: "a: 1\n: key\n", want: "line 2: key has no value", line: 2},
+		{name: "top-level list", in: "- a\n", want: "top-level value is not a dictionary: []interface {}"},
+		{
+			name:   "inline",
+			in:     "a:\n    [b, c\n",
+			want:   `line 2, column 10: unexpected end of line, expected "," or "]"`,
+			line:   2,
+			column: 10,
+		},
+		{
+			name:   "inline key",
+			in:     "a:\n    {b, c}\n",
+			want:   `line 2, column 7: expected ":" after key "b"`,
+			line:   2,
+			column: 7,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := nestedTextCodec{}.Decode([]byte(tt.in), map[string]any{})
+			if err == nil || err.Error() != tt.want {
+				t.Fatalf("Decode() error = %v, want %q", err, tt.want)
+			}
+			if line, column := errorPosition(err, []byte(tt.in)); line != tt.line || column != tt.column {
+				t.Errorf("position = %d:%d, want %d:%d", line, column, tt.line, tt.column)
+			}
+		})
+	}
+}
+
+func TestNestedTextCodecRoundTrip(t *testing.T) {
+	in := map[string]any{
+		"server": map[string]any{"host": "localhost", "ports": []any{"8080", "8443"}},
+		"motd":   "Welcome,\nhave fun",
+		"users": []any{
+			map[string]any{"name": "a", "roles": []any{"admin"}},
+			"multi\nline",
+			[]any{"nested"},
+		},
+		"key: with colon": "value",
+		"# hash":          "value",
+		"multi\nline key": "value",
+		"port":            "8080",
+	}
+	b, err := nestedTextCodec{}.Encode(in)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	got := map[string]any{}
+	err = nestedTextCodec{}.Decode(b, got)
+	if err != nil {
+		t.Fatalf("Decode(%s) error = %v", b, err)
+	}
+	if !reflect.DeepEqual(got, in) {
+		t.Errorf("round trip = %#v, want %#v\n%s", got, in, b)
+	}
+}
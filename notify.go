@@ -1,5 +1,160 @@
 package hydra
 
-import "github.com/fsnotify/fsnotify"
+import (
+	"fmt"
+	"slices"
+	"strings"
 
-type NotifyFunc func(path string, op fsnotify.Op)
+	"github.com/fsnotify/fsnotify"
+)
+
+// NotifyFunc is invoked after a change of a configuration file has been processed.
+type NotifyFunc func(change Change)
+
+// Change describes a change of a configuration file and its effect on the configuration.
+//
+// Keys are flattened and delimited by dots, e.g. "server.tls.cert". Added, Removed and
+// Modified are only populated when hydra reloads the configuration (see WithAutoReload).
+type Change struct {
+	// Path is the path of the changed configuration file or directory. It's empty if the
+	// change results from rescanning all paths.
+	Path string
+	// Op is the file operation that caused the change.
+	Op fsnotify.Op
+	// Added contains keys that were not set before the change, with their new values.
+	Added map[string]any
+	// Removed contains keys that are no longer set, with their previous values.
+	Removed map[string]any
+	// Modified contains keys whose values have changed.
+	Modified map[string]Values
+}
+
+// Values holds the value of a key before and after a change.
+type Values struct {
+	Old any
+	New any
+}
+
+// Empty reports whether the change did not affect any key.
+func (c Change) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Modified) == 0
+}
+
+// under returns the part of the change affecting keys under the prefix.
+func (c Change) under(prefix string) Change {
+	if prefix == "" {
+		return c
+	}
+
+	sub := Change{
+		Path:     c.Path,
+		Op:       c.Op,
+		Added:    make(map[string]any),
+		Removed:  make(map[string]any),
+		Modified: make(map[string]Values),
+	}
+	for key, value := range c.Added {
+		if hasKeyPrefix(key, prefix) {
+			sub.Added[key] = value
+		}
+	}
+	for key, value := range c.Removed {
+		if hasKeyPrefix(key, prefix) {
+			sub.Removed[key] = value
+		}
+	}
+	for key, values := range c.Modified {
+		if hasKeyPrefix(key, prefix) {
+			sub.Modified[key] = values
+		}
+	}
+	return sub
+}
+
+// hasKeyPrefix reports whether the key equals the prefix or is nested under it.
+func hasKeyPrefix(key, prefix string) bool {
+	return key == prefix || strings.HasPrefix(key, prefix+".")
+}
+
+type subscriber struct {
+	prefix string
+	fn     func(Change)
+	// all makes the subscriber receive every change, even one not affecting any key.
+	all bool
+}
+
+// Listen registers fn to be invoked for every change, like the NotifyFunc passed to Start.
+// Any number of listeners can be registered. The returned function removes the listener.
+func (h *Hydra) Listen(fn NotifyFunc) (stop func()) {
+	return h.subscribe(&subscriber{
+		fn:  fn,
+		all: true,
+	})
+}
+
+// Subscribe registers fn to be invoked for changes of keys under the prefix, e.g. "server.tls".
+// fn receives only the part of the change concerning the prefix and isn't invoked if no key
+// under the prefix has changed. An empty prefix subscribes to all keys.
+//
+// Subscribers are notified of reloads only, which requires auto reload (see WithAutoReload).
+// The returned function removes the subscription.
+func (h *Hydra) Subscribe(prefix string, fn func(Change)) (unsubscribe func()) {
+	return h.subscribe(&subscriber{
+		prefix: strings.ToLower(strings.Trim(prefix, ".")),
+		fn:     fn,
+	})
+}
+
+func (h *Hydra) subscribe(s *subscriber) func() {
+	h.mu.Lock()
+	h.subscribers = append(h.subscribers, s)
+	h.mu.Unlock()
+
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.subscribers = slices.DeleteFunc(h.subscribers, func(other *subscriber) bool {
+			return other == s
+		})
+	}
+}
+
+// dispatch delivers the change to the NotifyFunc passed to Start, listeners, subscribers and
+// channels returned by Events. Listeners are isolated from each other: a panicking listener
+// is reported as an error (see WithErrorHandler) and doesn't prevent others from being notified.
+func (h *Hydra) dispatch(change Change) {
+	h.mu.Lock()
+	notify := h.notify
+	subscribers := slices.Clone(h.subscribers)
+	h.mu.Unlock()
+
+	if notify != nil {
+		h.deliver(notify, change)
+	}
+
+	for _, s := range subscribers {
+		if s.all {
+			h.deliver(s.fn, change)
+			continue
+		}
+
+		sub := change.under(s.prefix)
+		if sub.Empty() {
+			continue
+		}
+		h.deliver(s.fn, sub)
+	}
+
+	h.broadcast(Event{Change: change})
+}
+
+// deliver invokes the listener with the change, recovering from its panic.
+func (h *Hydra) deliver(fn func(Change), change Change) {
+	defer func() {
+		if r := recover(); r != nil {
+			h.reportError(fmt.Errorf("listener panicked (path: %s): %v", change.Path, r))
+		}
+	}()
+
+	fn(change)
+}
@@ -0,0 +1,88 @@
+package hydra
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSubscribe(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yaml")
+	writeFile(t, path, "server:\n  port: 8080\ndb:\n  host: db\n")
+	h, err := New(WithPaths(dir), WithAutoReload())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	var server, db, all []Change
+	unsubscribe := h.Subscribe("server.", func(c Change) { server = append(server, c) })
+	h.Subscribe("DB", func(c Change) { db = append(db, c) })
+	h.Subscribe("", func(c Change) { all = append(all, c) })
+
+	writeFile(t, path, "server:\n  port: 9090\n  tls: true\ndb:\n  host: db\n")
+	if err := h.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(server) != 1 {
+		t.Fatalf("server changes = %+v, want 1", server)
+	}
+	want := Change{
+		Added:    map[string]any{"server.tls": true},
+		Removed:  map[string]any{},
+		Modified: map[string]Values{"server.port": {Old: 8080, New: 9090}},
+	}
+	if !reflect.DeepEqual(server[0], want) {
+		t.Errorf("server change = %+v, want %+v", server[0], want)
+	}
+	if len(db) != 0 {
+		t.Errorf("db changes = %+v, want none", db)
+	}
+	if len(all) != 1 {
+		t.Errorf("changes of all keys = %+v, want 1", all)
+	}
+
+	// unchanged configuration isn't notified to subscribers, removed subscribers aren't notified
+	unsubscribe()
+	if err := h.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	writeFile(t, path, "server:\n  port: 1\ndb:\n  host: db\n")
+	if err := h.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(server) != 1 || len(all) != 2 {
+		t.Errorf("server changes = %d, changes of all keys = %d, want 1 and 2", len(server), len(all))
+	}
+}
+
+func TestListen(t *testing.T) {
+	var reported []error
+	h, set := newCounter(t, WithErrorHandler(func(err error) { reported = append(reported, err) }))
+
+	var first, second []Change
+	stop := h.Listen(func(c Change) { first = append(first, c) })
+	h.Listen(func(Change) { panic("listener failed") })
+	h.Listen(func(c Change) { second = append(second, c) })
+
+	set(1)
+	// listeners are notified of every change, even one not affecting any key
+	if err := h.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(first) != 2 || len(second) != 2 || !first[1].Empty() {
+		t.Fatalf("changes = %+v and %+v, want 2 each", first, second)
+	}
+	// a panicking listener is reported and doesn't keep others from being notified
+	if len(reported) != 2 {
+		t.Errorf("reported errors = %v, want 2 panics", reported)
+	}
+
+	stop()
+	set(2)
+	if len(first) != 2 || len(second) != 3 {
+		t.Errorf("changes after stop = %d and %d, want 2 and 3", len(first), len(second))
+	}
+}
@@ -0,0 +1,329 @@
+package hydra
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+)
+
+const (
+	// ociTitleAnnotation names the file of a layer, see
+	// https://github.com/opencontainers/image-spec/blob/main/annotations.md.
+	ociTitleAnnotation = "org.opencontainers.image.title"
+	// ociUnpackAnnotation marks layers of directories packed as gzipped tar archives by ORAS.
+	ociUnpackAnnotation = "io.deis.oras.content.unpack"
+)
+
+// ociManifestTypes are the media types of manifests accepted.
+var ociManifestTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// OCIConfig configures a source of the configuration files of an artifact stored in an OCI
+// registry, e.g. pushed by ORAS, see WithOCI.
+type OCIConfig struct {
+	// Reference of the artifact by tag or digest, e.g. "ghcr.io/org/config:v1" or
+	// "registry.internal/config@sha256:...". The tag defaults to "latest".
+	Reference string
+	// Username and Password authenticate to the registry, if set. Anonymous access is
+	// requested otherwise.
+	Username string
+	Password string
+	// PlainHTTP connects to the registry over HTTP instead of HTTPS, e.g. to a local registry.
+	PlainHTTP bool
+	// Client sends the requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// ociSource provides the files of the layers of an artifact, named by their title annotations.
+type ociSource struct {
+	config OCIConfig
+
+	mu sync.Mutex
+	// token authorizes requests to the repository.
+	token string
+	// digest is the digest of the manifest whose documents are extracted, which are extracted
+	// again only once the tag resolves to another manifest.
+	digest string
+	docs   []document
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+func (s *ociSource) load(ctx context.Context, want func(rel string) bool) ([]document, error) {
+	registry, repository, reference, err := parseOCIReference(s.config.Reference)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.docs != nil && reference == s.digest {
+		// artifacts referenced by digest don't change
+		return s.docs, nil
+	}
+
+	b, err := s.get(ctx, registry, repository, "manifests/"+reference, strings.Join(ociManifestTypes, ", "))
+	if err != nil {
+		return nil, fmt.Errorf("get manifest (reference: %s): %w", s.config.Reference, err)
+	}
+	// tags are resolved again, while their files are extracted again only once they resolve
+	// to another manifest
+	sum := sha256.Sum256(b)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	if s.docs != nil && digest == s.digest {
+		return s.docs, nil
+	}
+
+	var manifest struct {
+		MediaType string          `json:"mediaType"`
+		Layers    []ociDescriptor `json:"layers"`
+	}
+	err = json.Unmarshal(b, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("decode manifest (reference: %s): %w", s.config.Reference, err)
+	}
+	if manifest.MediaType != "" && !strings.HasSuffix(manifest.MediaType, "manifest.v1+json") && !strings.HasSuffix(manifest.MediaType, "manifest.v2+json") {
+		return nil, fmt.Errorf("unsupported manifest (reference: %s, media type: %s)", s.config.Reference, manifest.MediaType)
+	}
+
+	docs := []document{}
+	add := func(name string, r io.Reader) error {
+		rel := strings.TrimPrefix(path.Clean("/"+name), "/")
+		if !want(rel) {
+			return nil
+		}
+
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("read file (path: %s): %w", name, err)
+		}
+		docs = append(docs, document{name: "oci:" + registry + "/" + repository + "/" + rel, rel: rel, data: data})
+		return nil
+	}
+	for _, layer := range manifest.Layers {
+		title := layer.Annotations[ociTitleAnnotation]
+		unpack := layer.Annotations[ociUnpackAnnotation] == "true"
+		if title == "" || !unpack && !want(title) {
+			// layers without titles aren't files
+			continue
+		}
+
+		b, err := s.get(ctx, registry, repository, "blobs/"+layer.Digest, "")
+		if err != nil {
+			return nil, fmt.Errorf("get layer (digest: %s): %w", layer.Digest, err)
+		}
+		err = verifyOCIDigest(layer.Digest, b)
+		if err != nil {
+			return nil, fmt.Errorf("verify layer (digest: %s): %w", layer.Digest, err)
+		}
+
+		if !unpack {
+			err = add(title, bytes.NewReader(b))
+		} else {
+			// directories are packed with their names, e.g. "config/app.yaml"
+			var zr *gzip.Reader
+			zr, err = gzip.NewReader(bytes.NewReader(b))
+			if err == nil {
+				err = extractTar(zr, add)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("extract layer (title: %s): %w", title, err)
+		}
+	}
+
+	s.digest, s.docs = digest, docs
+	return docs, nil
+}
+
+// get returns the body of the resource of the repository, authorizing the request with a
+// token requested from the authorization server the registry challenges to.
+func (s *ociSource) get(ctx context.Context, registry, repository, resource, accept string) ([]byte, error) {
+	scheme := "https"
+	if s.config.PlainHTTP {
+		scheme = "http"
+	}
+	u := scheme + "://" + registry + "/v2/" + repository + "/" + resource
+
+	authorized := false
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, fmt.Errorf("create request: %w", err)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if s.token != "" {
+			req.Header.Set("Authorization", "Bearer "+s.token)
+		} else if s.config.Username != "" {
+			req.SetBasicAuth(s.config.Username, s.config.Password)
+		}
+
+		resp, err := s.client().Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("send request: %w", err)
+		}
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read response: %w", err)
+		}
+
+		challenge := resp.Header.Get("WWW-Authenticate")
+		if resp.StatusCode == http.StatusUnauthorized && !authorized && strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+			// tokens expire, so they're requested again once rejected
+			s.token, err = s.authorize(ctx, challenge)
+			if err != nil {
+				return nil, fmt.Errorf("authorize: %w", err)
+			}
+			authorized = true
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+		}
+		return b, nil
+	}
+}
+
+// authorize requests a token from the authorization server of the bearer challenge, e.g.
+// `Bearer realm="https://ghcr.io/token",service="ghcr.io",scope="repository:org/config:pull"`.
+func (s *ociSource) authorize(ctx context.Context, challenge string) (string, error) {
+	params := parseOCIChallenge(challenge[len("bearer "):])
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return "", fmt.Errorf("invalid realm: %q", params["realm"])
+	}
+	q := realm.Query()
+	for _, name := range []string{"service", "scope"} {
+		if params[name] != "" {
+			q.Set(name, params[name])
+		}
+	}
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	if s.config.Username != "" {
+		req.SetBasicAuth(s.config.Username, s.config.Password)
+	}
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return "", fmt.Errorf("decode token: %w", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return "", errors.New("no token issued")
+	}
+	return token.Token, nil
+}
+
+func (s *ociSource) client() *http.Client {
+	if s.config.Client != nil {
+		return s.config.Client
+	}
+	return http.DefaultClient
+}
+
+// parseOCIReference splits the reference into the registry, the repository and the tag or
+// digest. Registries default to Docker Hub like for docker, e.g. "alpine" is
+// "registry-1.docker.io/library/alpine:latest".
+func parseOCIReference(ref string) (registry, repository, reference string, err error) {
+	name := ref
+	reference = "latest"
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, reference = name[:i], name[i+1:]
+	} else if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, reference = name[:i], name[i+1:]
+	}
+
+	registry, repository, ok := strings.Cut(name, "/")
+	if !ok || !strings.ContainsAny(registry, ".:") && registry != "localhost" {
+		registry, repository = "docker.io", name
+	}
+	if registry == "docker.io" {
+		registry = "registry-1.docker.io"
+		if !strings.Contains(repository, "/") {
+			repository = "library/" + repository
+		}
+	}
+	if repository == "" || reference == "" {
+		return "", "", "", fmt.Errorf("invalid reference: %q", ref)
+	}
+	return registry, repository, reference, nil
+}
+
+// parseOCIChallenge returns the parameters of a challenge, e.g. `realm="...",service="..."`.
+func parseOCIChallenge(s string) map[string]string {
+	params := make(map[string]string)
+	for s != "" {
+		name, rest, ok := strings.Cut(strings.TrimLeft(s, " ,"), "=")
+		if !ok {
+			break
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			// quoted values may contain commas, e.g. of multiple scopes
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			value, s = rest[1:end+1], rest[min(end+2, len(rest)):]
+		} else {
+			value, s, _ = strings.Cut(rest, ",")
+		}
+		params[strings.ToLower(strings.TrimSpace(name))] = value
+	}
+	return params
+}
+
+// verifyOCIDigest checks the sha256 digest of the content, e.g. "sha256:...".
+func verifyOCIDigest(digest string, b []byte) error {
+	algorithm, want, _ := strings.Cut(digest, ":")
+	if algorithm != "sha256" {
+		// other algorithms aren't verified
+		return nil
+	}
+	sum := sha256.Sum256(b)
+	if hex.EncodeToString(sum[:]) != want {
+		return errors.New("digest mismatch")
+	}
+	return nil
+}
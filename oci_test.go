@@ -0,0 +1,329 @@
+package hydra
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// ociTestServer is a registry of the repository "org/config", authorizing pulls with tokens
+// issued to the user "bob".
+type ociTestServer struct {
+	mu        sync.Mutex
+	manifests map[string][]byte
+	blobs     map[string][]byte
+	// gets counts the blobs downloaded by digest.
+	gets   map[string]int
+	tokens int
+}
+
+func newOCITestServer() *ociTestServer {
+	return &ociTestServer{manifests: make(map[string][]byte), blobs: make(map[string][]byte), gets: make(map[string]int)}
+}
+
+// push adds the layers, annotated with their titles, and tags their manifest.
+func (s *ociTestServer) push(tag string, layers map[string][]byte, unpack ...string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var descriptors []ociDescriptor
+	titles := make([]string, 0, len(layers))
+	for title := range layers {
+		titles = append(titles, title)
+	}
+	slices.Sort(titles)
+	for _, title := range titles {
+		digest := ociDigest(layers[title])
+		s.blobs[digest] = layers[title]
+		annotations := map[string]string{ociTitleAnnotation: title}
+		for _, name := range unpack {
+			if name == title {
+				annotations[ociUnpackAnnotation] = "true"
+			}
+		}
+		descriptors = append(descriptors, ociDescriptor{MediaType: "application/vnd.oci.image.layer.v1.tar", Digest: digest, Annotations: annotations})
+	}
+	// layers without titles aren't files
+	descriptors = append(descriptors, ociDescriptor{MediaType: "application/vnd.oci.empty.v1+json", Digest: ociDigest([]byte("{}"))})
+	b, _ := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"layers":        descriptors,
+	})
+	digest := ociDigest(b)
+	s.manifests[tag], s.manifests[digest] = b, b
+	return digest
+}
+
+func (s *ociTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.URL.Path == "/token" {
+		user, password, _ := r.BasicAuth()
+		if user != "bob" || password != "s3cret" || r.URL.Query().Get("scope") != "repository:org/config:pull" || r.URL.Query().Get("service") != "registry" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		s.tokens++
+		fmt.Fprintf(w, `{"access_token":"token-%d"}`, s.tokens)
+		return
+	}
+	if r.Header.Get("Authorization") != fmt.Sprintf("Bearer token-%d", s.tokens) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%s/token",service="registry",scope="repository:org/config:pull"`, r.Host))
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	resource, ok := strings.CutPrefix(r.URL.Path, "/v2/org/config/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if reference, ok := strings.CutPrefix(resource, "manifests/"); ok {
+		b, ok := s.manifests[reference]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w.Write(b)
+		return
+	}
+	digest, _ := strings.CutPrefix(resource, "blobs/")
+	b, ok := s.blobs[digest]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	s.gets[digest]++
+	w.Write(b)
+}
+
+func ociDigest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// targz packs the files as a gzipped tar archive.
+func targz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, name := range []string{"config/", "config/db.json", "config/nested/cache.yaml"} {
+		data, ok := files[name]
+		if !ok {
+			continue
+		}
+		hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(name, "/") {
+			hdr.Typeflag, hdr.Mode, hdr.Size = tar.TypeDir, 0o755, 0
+		}
+		err := tw.WriteHeader(hdr)
+		if err == nil {
+			_, err = tw.Write([]byte(data))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseOCIReference(t *testing.T) {
+	tests := []struct {
+		ref                             string
+		registry, repository, reference string
+		wantErr                         bool
+	}{
+		{ref: "alpine", registry: "registry-1.docker.io", repository: "library/alpine", reference: "latest"},
+		{ref: "org/config:v1", registry: "registry-1.docker.io", repository: "org/config", reference: "v1"},
+		{ref: "ghcr.io/org/config:v1", registry: "ghcr.io", repository: "org/config", reference: "v1"},
+		{ref: "localhost:5000/config", registry: "localhost:5000", repository: "config", reference: "latest"},
+		{ref: "localhost/config", registry: "localhost", repository: "config", reference: "latest"},
+		{ref: "registry.internal/config@sha256:abc", registry: "registry.internal", repository: "config", reference: "sha256:abc"},
+		{ref: "ghcr.io/", wantErr: true},
+		{ref: "ghcr.io/org/config:", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			registry, repository, reference, err := parseOCIReference(tt.ref)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseOCIReference() = %s, %s, %s, want error", registry, repository, reference)
+				}
+				return
+			}
+			if err != nil || registry != tt.registry || repository != tt.repository || reference != tt.reference {
+				t.Errorf("parseOCIReference() = %s, %s, %s, %v, want %s, %s, %s", registry, repository, reference, err, tt.registry, tt.repository, tt.reference)
+			}
+		})
+	}
+}
+
+func TestParseOCIChallenge(t *testing.T) {
+	got := parseOCIChallenge(`realm="https://auth.docker.io/token", Service=registry.docker.io,scope="repository:org/a:pull,push"`)
+	want := map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:org/a:pull,push",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseOCIChallenge() = %v, want %v", got, want)
+	}
+}
+
+func TestOCISourceLoad(t *testing.T) {
+	server := newOCITestServer()
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	dir := targz(t, map[string]string{
+		"config/":                  "",
+		"config/db.json":           `{"db": {"host": "localhost"}}`,
+		"config/nested/cache.yaml": "cache: true\n",
+	})
+	v1 := server.push("v1", map[string][]byte{"app.yaml": []byte("port: 8080\n"), "config": dir}, "config")
+	host := strings.TrimPrefix(srv.URL, "http://")
+	src := &ociSource{config: OCIConfig{
+		Reference: host + "/org/config:v1",
+		Username:  "bob",
+		Password:  "s3cret",
+		PlainHTTP: true,
+		Client:    srv.Client(),
+	}}
+	name := func(rel string) string { return "oci:" + host + "/org/config/" + rel }
+
+	docs, err := src.load(context.Background(), func(rel string) bool { return rel != "config/nested/cache.yaml" })
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	want := []document{
+		{name: name("app.yaml"), rel: "app.yaml", data: []byte("port: 8080\n")},
+		{name: name("config/db.json"), rel: "config/db.json", data: []byte(`{"db": {"host": "localhost"}}`)},
+	}
+	if !reflect.DeepEqual(docs, want) {
+		t.Errorf("load() = %s, want %s", docs, want)
+	}
+
+	// tags resolving to the same manifest aren't extracted again
+	_, err = src.load(context.Background(), func(string) bool { return true })
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	if got := server.gets[ociDigest(dir)]; got != 1 {
+		t.Errorf("downloaded layer %d times, want 1", got)
+	}
+
+	// tags pushed again are
+	server.push("v1", map[string][]byte{"app.yaml": []byte("port: 9090\n")})
+	server.tokens++ // tokens expire
+	docs, err = src.load(context.Background(), func(string) bool { return true })
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	want = []document{{name: name("app.yaml"), rel: "app.yaml", data: []byte("port: 9090\n")}}
+	if !reflect.DeepEqual(docs, want) {
+		t.Errorf("load() after push = %s, want %s", docs, want)
+	}
+
+	// digests are resolved once
+	src = &ociSource{config: src.config}
+	src.config.Reference = host + "/org/config@" + v1
+	for range 2 {
+		docs, err = src.load(context.Background(), func(rel string) bool { return rel == "config/nested/cache.yaml" })
+		if err != nil {
+			t.Fatalf("load() error = %v", err)
+		}
+	}
+	want = []document{{name: name("config/nested/cache.yaml"), rel: "config/nested/cache.yaml", data: []byte("cache: true\n")}}
+	if !reflect.DeepEqual(docs, want) {
+		t.Errorf("load() by digest = %s, want %s", docs, want)
+	}
+	if got := server.gets[ociDigest(dir)]; got != 2 {
+		t.Errorf("downloaded layer %d times, want 2", got)
+	}
+}
+
+func TestOCISourceLoadError(t *testing.T) {
+	server := newOCITestServer()
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	server.push("v1", map[string][]byte{"app.yaml": []byte("port: 8080\n")})
+	server.push("corrupted", map[string][]byte{"app.yaml": []byte("port: 9090\n")})
+	appDigest := ociDigest([]byte("port: 9090\n"))
+	server.blobs[appDigest] = []byte("port: 6666\n")
+	server.push("invalid", map[string][]byte{"config": []byte("not a gzipped tar archive")}, "config")
+	server.manifests["index"] = []byte(`{"mediaType": "application/vnd.oci.image.index.v1+json", "manifests": []}`)
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	tests := []struct {
+		name     string
+		ref      string
+		password string
+		wantErr  string
+	}{
+		{
+			name:    "unknown tag",
+			ref:     "org/config:v2",
+			wantErr: "get manifest (reference: " + host + "/org/config:v2): unexpected status: 404 Not Found",
+		},
+		{
+			name:     "wrong password",
+			ref:      "org/config:v1",
+			password: "wrong",
+			wantErr:  "get manifest (reference: " + host + "/org/config:v1): authorize: unexpected status: 401 Unauthorized",
+		},
+		{
+			name:    "corrupted layer",
+			ref:     "org/config:corrupted",
+			wantErr: "verify layer (digest: " + appDigest + "): digest mismatch",
+		},
+		{
+			name:    "invalid archive",
+			ref:     "org/config:invalid",
+			wantErr: "extract layer (title: config): gzip: invalid header",
+		},
+		{
+			name:    "index",
+			ref:     "org/config:index",
+			wantErr: "unsupported manifest (reference: " + host + "/org/config:index, media type: application/vnd.oci.image.index.v1+json)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.password == "" {
+				tt.password = "s3cret"
+			}
+			src := &ociSource{config: OCIConfig{
+				Reference: host + "/" + tt.ref,
+				Username:  "bob",
+				Password:  tt.password,
+				PlainHTTP: true,
+				Client:    srv.Client(),
+			}}
+			_, err := src.load(context.Background(), func(string) bool { return true })
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("load() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package hydra
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/spf13/viper"
+)
+
+// ChangePolicy decides what happens when a handler registered by OnChange returns an error.
+type ChangePolicy int
+
+const (
+	// Veto aborts the reload and keeps the current configuration.
+	Veto ChangePolicy = iota
+	// Report reports the error (see WithErrorHandler) and applies the reload anyway.
+	Report
+)
+
+type changeHandler struct {
+	prefix string
+	fn     func(prev, next any) error
+}
+
+// OnChange registers fn to be invoked on reloads changing the configuration under the prefix,
+// e.g. "database", with the previous and the reloaded configuration under the prefix decoded
+// into T, the same way viper.UnmarshalKey does. fn isn't invoked if nothing under the prefix
+// has changed.
+//
+// Handlers are invoked before the reload is applied. An error returned by fn, or failing to
+// decode the reloaded configuration into T, is handled according to the policy set by
+// WithChangePolicy. The returned function removes the handler.
+func OnChange[T any](h *Hydra, prefix string, fn func(prev, next T) error) (unregister func()) {
+	c := &changeHandler{
+		prefix: strings.ToLower(strings.Trim(prefix, ".")),
+		fn: func(prev, next any) error {
+			var p, n T
+			err := decode(prev, &p)
+			if err != nil {
+				return fmt.Errorf("decode previous config: %w", err)
+			}
+			err = decode(next, &n)
+			if err != nil {
+				return fmt.Errorf("decode reloaded config: %w", err)
+			}
+			return fn(p, n)
+		},
+	}
+
+	h.mu.Lock()
+	h.changeHandlers = append(h.changeHandlers, c)
+	h.mu.Unlock()
+
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.changeHandlers = slices.DeleteFunc(h.changeHandlers, func(other *changeHandler) bool {
+			return other == c
+		})
+	}
+}
+
+// runChangeHandlers invokes the handlers registered by OnChange whose part of the configuration
+// differs between the current and the reloaded settings. Errors are returned according to the
+// policy set by WithChangePolicy: with Veto, the first error is returned, with Report, all
+// errors are returned to be reported once the reload is applied.
+func (h *Hydra) runChangeHandlers(settings map[string]any) []error {
+	h.mu.Lock()
+	current := h.settings
+	handlers := slices.Clone(h.changeHandlers)
+	h.mu.Unlock()
+
+	var errs []error
+	for _, c := range handlers {
+		prev, next := lookup(current, c.prefix), lookup(settings, c.prefix)
+		if reflect.DeepEqual(prev, next) {
+			continue
+		}
+
+		err := c.fn(copyValue(prev), copyValue(next))
+		if err == nil {
+			continue
+		}
+
+		errs = append(errs, fmt.Errorf("change handler (prefix: %s): %w", c.prefix, err))
+		if h.options.changePolicy == Veto {
+			break
+		}
+	}
+	return errs
+}
+
+// lookup returns the value of the dotted key in the settings, or all settings for an empty key.
+func lookup(settings map[string]any, key string) any {
+	if key == "" {
+		return settings
+	}
+
+	var value any = settings
+	for _, part := range strings.Split(key, ".") {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = m[part]
+	}
+	return value
+}
+
+// decode decodes the value into the output with the decode hooks of viper.Unmarshal.
+func decode(value, output any, opts ...viper.DecoderConfigOption) error {
+	c := &mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+		WeaklyTypedInput: true,
+		Result:           output,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	d, err := mapstructure.NewDecoder(c)
+	if err != nil {
+		return err
+	}
+	return d.Decode(value)
+}
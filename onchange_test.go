@@ -0,0 +1,148 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type databaseConfig struct {
+	Host string
+	Port int
+}
+
+func TestOnChange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yaml")
+	writeFile(t, path, "database:\n  host: db\n  port: 5432\nlog: info\n")
+
+	h, err := New(WithPaths(dir))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	type call struct{ prev, next databaseConfig }
+	var calls []call
+	unregister := OnChange(h, "Database", func(prev, next databaseConfig) error {
+		calls = append(calls, call{prev, next})
+		return nil
+	})
+
+	// changes of other keys don't invoke the handler
+	writeFile(t, path, "database:\n  host: db\n  port: 5432\nlog: debug\n")
+	if err := h.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(calls) != 0 {
+		t.Fatalf("handler invoked %d times, want 0", len(calls))
+	}
+
+	writeFile(t, path, "database:\n  host: db\n  port: 6432\nlog: debug\n")
+	if err := h.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	want := call{prev: databaseConfig{Host: "db", Port: 5432}, next: databaseConfig{Host: "db", Port: 6432}}
+	if len(calls) != 1 || calls[0] != want {
+		t.Fatalf("calls = %+v, want %+v", calls, want)
+	}
+
+	// the removed section is decoded as the zero value
+	writeFile(t, path, "log: debug\n")
+	if err := h.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(calls) != 2 || calls[1] != (call{prev: want.next}) {
+		t.Fatalf("calls = %+v, want the removal", calls)
+	}
+
+	unregister()
+	writeFile(t, path, "database:\n  host: other\n")
+	if err := h.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(calls) != 2 {
+		t.Errorf("handler invoked %d times after unregistering, want 2", len(calls))
+	}
+}
+
+func TestChangePolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   ChangePolicy
+		want     int
+		wantErrs int
+	}{
+		{name: "veto", policy: Veto, want: 5432},
+		{name: "report", policy: Report, want: 6432, wantErrs: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "app.yaml")
+			writeFile(t, path, "database:\n  port: 5432\n")
+
+			var errs []error
+			h, err := New(WithPaths(dir), WithChangePolicy(tt.policy), WithErrorHandler(func(err error) { errs = append(errs, err) }))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer h.Close()
+
+			OnChange(h, "database", func(_, next databaseConfig) error {
+				if next.Port != 5432 {
+					return errors.New("port can't change")
+				}
+				return nil
+			})
+			var invoked bool
+			OnChange(h, "database", func(_, _ databaseConfig) error {
+				invoked = true
+				return nil
+			})
+
+			writeFile(t, path, "database:\n  port: 6432\n")
+			err = h.Reload(context.Background())
+			if tt.policy == Veto {
+				var rerr *ReloadError
+				if !errors.As(err, &rerr) || !strings.Contains(err.Error(), "change handler (prefix: database): port can't change") {
+					t.Fatalf("Reload() error = %v, want the veto", err)
+				}
+				if invoked {
+					t.Error("handler after the veto invoked")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Reload() error = %v", err)
+				}
+				if !invoked {
+					t.Error("handler after the error not invoked")
+				}
+			}
+			if got, _ := Get[int](h, "database.port"); got != tt.want {
+				t.Errorf("database.port = %d, want %d", got, tt.want)
+			}
+			if len(errs) != tt.wantErrs {
+				t.Errorf("reported %d errors, want %d: %v", len(errs), tt.wantErrs, errs)
+			}
+		})
+	}
+
+	// configurations that can't be decoded are handled like errors of the handler
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yaml")
+	writeFile(t, path, "database:\n  port: 5432\n")
+	h, err := New(WithPaths(dir))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+	OnChange(h, "database", func(_, _ databaseConfig) error { return nil })
+	writeFile(t, path, "database:\n  port: [5432]\n")
+	err = h.Reload(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "decode reloaded config") {
+		t.Errorf("Reload() error = %v, want decode error", err)
+	}
+}
@@ -1,16 +1,87 @@
 package hydra
 
-import "github.com/spf13/viper"
+import (
+	"fmt"
+	"io/fs"
+	"math"
+	"net/http"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
 
 type options struct {
-	supportedExtensions []string
-	paths               []string
-	viper               *viper.Viper
+	supportedExtensions  []string
+	paths                []string
+	priorities           map[string]int
+	keyFilters           map[string]*keyFilter
+	viper                *viper.Viper
+	viperOptions         []viper.Option
+	debounce             time.Duration
+	autoReload           bool
+	decoderRegistry      viper.DecoderRegistry
+	kubernetesVolumes    bool
+	pollInterval         time.Duration
+	pollPaths            []string
+	pollFallback         bool
+	pollFallbackInterval time.Duration
+	watcherRecovery      bool
+	onRecover            func(cause error)
+	errorHandler         func(err error)
+	preReloadHooks       []ReloadHook
+	postReloadHooks      []ReloadHook
+	maxReloads           int
+	reloadWindow         time.Duration
+	ops                  fsnotify.Op
+	changeDetection      ChangeDetection
+	rescanInterval       time.Duration
+	readAttempts         int
+	readBackoff          time.Duration
+	changePolicy         ChangePolicy
+	fileOrder            FileOrder
+	mergeStrategy        MergeStrategy
+	precedence           Precedence
+	namespace            Namespace
+	environment          string
+	environments         []string
+	defaultsFiles        []string
+	overrideFiles        []string
+	keyPrefix            string
+	envPrecedence        EnvPrecedence
+	sources              []*sourceConfig
+	pollIntervals        map[string]time.Duration
+	dotEnv               DotEnvMode
+	xml                  *XMLConfig
+	yamlDocuments        YAMLDocumentMode
+	textProto            *TextProtoConfig
+	extensionAliases     map[string]string
+	jsonSchema           []byte
+	schema               *jsonSchema
+	structValidator      StructValidator
+	cueSchema            []byte
+	requiredKeys         []string
+	strictKeys           []reflect.Type
+	structs              []checkedStruct
+	validators           []func(snapshot Snapshot) error
+	dryRun               bool
+	references           []reference
+	// formats are the extensions of the formats enabled in addition to the extensions set by
+	// WithExtensions, e.g. by WithCUE.
+	formats []string
 }
 
 type Option func(*options)
 
-// WithExtensions sets the config file extensions hydra should support.
+// WithExtensions sets the config file extensions hydra should support. Defaults to the
+// extensions of viper's formats and of the codecs registered by RegisterCodec. Files of the
+// formats hydra supports in addition are found if enabled, e.g. by WithCUE or WithKDL, or if
+// their extensions are set, e.g. "kdl".
 func WithExtensions(exts ...string) Option {
 	return func(o *options) {
 		o.supportedExtensions = exts
@@ -18,15 +89,998 @@ func WithExtensions(exts ...string) Option {
 }
 
 // WithPaths specifies list of files or directories hydra should look for configs in.
+//
+// Configuration files are merged in the order of the paths, so files found in a later path
+// take precedence over files found in an earlier one, unless priorities are set by WithPath or
+// the precedence is reversed by WithPrecedence. Files found in the same path are merged in the
+// order set by WithFileOrder. Defaults to the working directory, unless sources are added, e.g.
+// by WithFS or WithS3.
 func WithPaths(paths ...string) Option {
 	return func(o *options) {
 		o.paths = paths
+		o.priorities = nil
+		o.keyFilters = nil
+	}
+}
+
+// PathOption configures a path added by WithPath.
+type PathOption func(o *options, path string)
+
+// WithPath adds a file or directory hydra should look for configs in, after the paths added
+// before. Unlike WithPaths, it doesn't replace the paths and accepts options like Priority or
+// OnlyKeys.
+func WithPath(path string, opts ...PathOption) Option {
+	return func(o *options) {
+		o.paths = append(o.paths, path)
+		for _, opt := range opts {
+			opt(o, path)
+		}
 	}
 }
 
-// WithViper makes hydra use existing viper instance instead of creating a new one.
+// Priority sets the priority of the path. Configuration files found in paths with higher
+// priorities take precedence over files found in paths with lower priorities, regardless of
+// the order of the paths. Paths with the same priority are merged in their order. Defaults to
+// 0.
+//
+// For example, files in "/etc/myapp" as baseline can be overridden by files in the user's
+// config directory and both by files in the working directory:
+//
+//	hydra.New(
+//		hydra.WithPath(".", hydra.Priority(30)),
+//		hydra.WithPath("/etc/myapp", hydra.Priority(10)),
+//		hydra.WithPath(filepath.Join(home, ".config/myapp"), hydra.Priority(20)),
+//	)
+func Priority(n int) PathOption {
+	return func(o *options, path string) {
+		if o.priorities == nil {
+			o.priorities = make(map[string]int)
+		}
+		o.priorities[path] = n
+	}
+}
+
+// WithViper makes hydra use existing viper instance instead of creating a new one. viper isn't
+// safe for concurrent use, so reads concurrent with reloads must go through hydra, e.g. Get or
+// UnmarshalValidated, which don't overlap with the replacement of its configuration.
 func WithViper(v *viper.Viper) Option {
 	return func(o *options) {
 		o.viper = v
 	}
 }
+
+// WithViperOptions sets options of the viper instance hydra creates, e.g. viper.EnvKeyReplacer.
+// They are ignored if an existing viper instance is set by WithViper.
+//
+// Keys are always lowercased, since viper lowercases the keys of configurations it's given and
+// has no option preserving their case, so keys of configuration files are lowercased before
+// they are merged. Keys differing only in case, within a file or across files, are merged
+// deterministically: maps are merged, and of other values, the value of the key sorting last
+// within a file, e.g. "key" over "Key", and of the file taking precedence across files wins.
+func WithViperOptions(opts ...viper.Option) Option {
+	return func(o *options) {
+		o.viperOptions = append(o.viperOptions, opts...)
+	}
+}
+
+// WithDebounce makes hydra coalesce bursts of events for the same file. The notification is
+// sent once no new event for the file has been received for the given duration.
+func WithDebounce(d time.Duration) Option {
+	return func(o *options) {
+		o.debounce = d
+	}
+}
+
+// WithAutoReload makes hydra re-read and merge changed configuration files into viper before
+// the change is notified, so viper always reflects the content of the files on disk.
+//
+// Every reload rebuilds the configuration from all configuration files in their load order,
+// so a changed file keeps its precedence and can't override files that take precedence over
+// it.
+func WithAutoReload() Option {
+	return func(o *options) {
+		o.autoReload = true
+	}
+}
+
+// WithDecoderRegistry sets the registry of decoders used to decode configuration files. The
+// format of a file is determined by its extension. Defaults to viper's codec registry with
+// codecs of the formats hydra supports in addition registered, e.g. INI, HCL2, CUE, Dhall, XML
+// and Java properties, and the codecs registered by RegisterCodec.
+func WithDecoderRegistry(r viper.DecoderRegistry) Option {
+	return func(o *options) {
+		o.decoderRegistry = r
+	}
+}
+
+// WithKubernetesVolumes makes hydra understand how kubelet updates mounted ConfigMap and
+// Secret volumes. Internal entries of the volumes are ignored and configuration files in
+// the volume directory are reloaded at once whenever its "..data" symlink is swapped.
+func WithKubernetesVolumes() Option {
+	return func(o *options) {
+		o.kubernetesVolumes = true
+	}
+}
+
+// WithPolling makes hydra detect changes by checking the size and modification time of
+// configuration files in the given interval, instead of relying on filesystem events which
+// aren't delivered for network filesystems like NFS, SMB or FUSE mounts.
+//
+// Only the given paths, which have to be located in the paths set by WithPaths, are polled
+// while the rest is watched. If no paths are given, all paths are polled.
+func WithPolling(interval time.Duration, paths ...string) Option {
+	return func(o *options) {
+		o.pollInterval = interval
+		o.pollPaths = paths
+	}
+}
+
+// WithPollingFallback makes hydra poll paths that can't be watched because the limit of
+// watches is reached, e.g. fs.inotify.max_user_watches on Linux, in the given interval. If
+// polling is enabled by WithPolling, its interval is used instead.
+//
+// Paths that can't be watched are reported as WatchError (see WithErrorHandler), with or
+// without the fallback.
+func WithPollingFallback(interval time.Duration) Option {
+	return func(o *options) {
+		o.pollFallback = true
+		o.pollFallbackInterval = interval
+	}
+}
+
+// WithWatcherRecovery makes hydra recover from the watcher closing unexpectedly, instead of
+// returning an error from Start. The watcher is replaced by a new one watching all paths and
+// the paths are rescanned to reload changes missed in the meantime. onRecover, if not nil, is
+// invoked with the cause after each recovery.
+func WithWatcherRecovery(onRecover func(cause error)) Option {
+	return func(o *options) {
+		o.watcherRecovery = true
+		o.onRecover = onRecover
+	}
+}
+
+// WithErrorHandler sets the function invoked with errors reported while watching, e.g. by
+// the watcher when its event queue overflows, or as ReloadError when a changed configuration
+// can't be reloaded. Errors are also delivered as events by channels
+// returned by Events.
+func WithErrorHandler(fn func(err error)) Option {
+	return func(o *options) {
+		o.errorHandler = fn
+	}
+}
+
+// WithPreReloadHook adds a hook invoked before a reload is applied, with the settings about to
+// be applied. Returning an error aborts the reload and keeps the current configuration.
+func WithPreReloadHook(hook ReloadHook) Option {
+	return func(o *options) {
+		o.preReloadHooks = append(o.preReloadHooks, hook)
+	}
+}
+
+// WithPostReloadHook adds a hook invoked after a reload has been applied, with the applied
+// settings. Errors returned by the hook are reported (see WithErrorHandler).
+func WithPostReloadHook(hook ReloadHook) Option {
+	return func(o *options) {
+		o.postReloadHooks = append(o.postReloadHooks, hook)
+	}
+}
+
+// WithMaxReloadRate limits reloads, and notifications of changes, to n per the given duration.
+// Changes exceeding the limit are held back and collapsed into a single reload once the limit
+// allows it, so a file rewritten in a tight loop can't cause a storm of reloads.
+func WithMaxReloadRate(n int, per time.Duration) Option {
+	return func(o *options) {
+		o.maxReloads = n
+		o.reloadWindow = per
+	}
+}
+
+// WithOps sets the file operations which trigger changes of the configuration. Defaults to
+// Create, Write, Remove and Rename. Include Chmod to handle permission changes, e.g. of secret
+// files becoming readable, which makes hydra reload the file.
+func WithOps(ops fsnotify.Op) Option {
+	return func(o *options) {
+		o.ops = ops
+	}
+}
+
+// WithChangeDetection sets how changes of configuration files are detected. Defaults to
+// ModTime, i.e. every event is handled as a change. Hash skips events of files whose contents
+// are the same as when they were last read, e.g. when rewritten by configuration management.
+// Events of files read empty are skipped too, since files rewritten in place are truncated
+// first; files emptied on purpose are reloaded by Reload or WithRescanInterval.
+func WithChangeDetection(d ChangeDetection) Option {
+	return func(o *options) {
+		o.changeDetection = d
+	}
+}
+
+// WithRescanInterval makes hydra walk all paths again in the given interval and compare the
+// configuration files found with the last known state. If any file was created, changed or
+// removed, the configuration is reloaded from all paths, as by Reload. This catches up with
+// changes missed by the watcher, e.g. on bind mounts or overlay filesystems.
+func WithRescanInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.rescanInterval = d
+	}
+}
+
+// WithReadRetry makes reloads retry reading and decoding a configuration file that fails, e.g.
+// because it's read while being written, up to the given number of attempts in total. The wait
+// before a retry starts at backoff and doubles after every attempt. The reload fails once all
+// attempts failed.
+func WithReadRetry(attempts int, backoff time.Duration) Option {
+	return func(o *options) {
+		o.readAttempts = attempts
+		o.readBackoff = backoff
+	}
+}
+
+// WithChangePolicy sets how errors returned by handlers registered by OnChange are handled.
+// Defaults to Veto, which aborts the reload. Report reports the error as ReloadError (see
+// WithErrorHandler) and applies the reload anyway.
+func WithChangePolicy(p ChangePolicy) Option {
+	return func(o *options) {
+		o.changePolicy = p
+	}
+}
+
+// WithFileOrder sets the order in which configuration files found in the same path are merged,
+// with files merged later taking precedence. Defaults to ByName. Use ByModTime to let the most
+// recently modified file win, ByNumericPrefix for conf.d style names like "50-overrides.yaml",
+// or a custom FileOrder. The resulting order is reported by ConfigFiles.
+func WithFileOrder(order FileOrder) Option {
+	return func(o *options) {
+		o.fileOrder = order
+	}
+}
+
+// WithMergeStrategy sets how configuration files are merged. By default maps are merged
+// recursively and other values, including slices, set by a later file replace the ones set by
+// an earlier file. Conflicting values set by different files can be reported or make loading
+// and reloading the configuration fail, see ConflictPolicy.
+func WithMergeStrategy(s MergeStrategy) Option {
+	return func(o *options) {
+		o.mergeStrategy = s
+	}
+}
+
+// WithPrecedence sets which configuration file wins if multiple files set the same key, on the
+// initial load as well as on reloads. Defaults to LastWins. With FirstWins, files of paths with
+// the same priority are merged in reverse load order, e.g. the files of the first path are
+// authoritative and slices appended by AppendSlices start with the elements of the last file.
+// Priorities set by WithPath take precedence either way.
+func WithPrecedence(p Precedence) Option {
+	return func(o *options) {
+		o.precedence = p
+	}
+}
+
+// WithKeyNamespace sets under which key the configuration of each file is placed, e.g. with
+// ByFileName, the keys of "database.yaml" and "logging.yaml" are placed under "database" and
+// "logging", so unrelated files don't collide. With ByRelativePath, a hierarchy of
+// directories is mapped to nested keys. Defaults to NoNamespace.
+func WithKeyNamespace(n Namespace) Option {
+	return func(o *options) {
+		o.namespace = n
+	}
+}
+
+// WithEnvironment enables environment overlay files: a file named like "config.prod.yaml" is
+// merged right after, i.e. on top of, "config.yaml" in the same directory if the environment is
+// "prod". Overlays of the other environments, e.g. "config.staging.yaml" for "staging" among
+// others, aren't loaded.
+//
+// A file or document is an overlay only if the part of its name before the extension after the
+// last dot names one of the environments, whether or not its base file exists. Other files with
+// dots in their names are loaded as usual, e.g. "database.replica.yaml" is placed under
+// "database.replica" by ByFileName. Overlays are placed under the keys of their base files.
+func WithEnvironment(env string, others ...string) Option {
+	return func(o *options) {
+		o.environment = env
+		o.environments = others
+	}
+}
+
+// WithDefaultsFile adds a configuration file with defaults shipped with the application, whose
+// values are merged with the lowest precedence, like viper.SetDefault. It never overrides
+// values set by other configuration files, regardless of their paths, priorities and the
+// precedence. If the file is located in one of the paths set by WithPaths, it's merged only as
+// defaults.
+func WithDefaultsFile(path string) Option {
+	return func(o *options) {
+		o.defaultsFiles = append(o.defaultsFiles, path)
+	}
+}
+
+// WithOverrideFile adds a configuration file, e.g. "local.override.yaml", whose values are
+// merged with the highest precedence, for developer-local tweaks or emergency overrides. It
+// always overrides values set by other configuration files, also when they are reloaded. The
+// file is optional, it's loaded once it's created.
+func WithOverrideFile(path string) Option {
+	return func(o *options) {
+		o.overrideFiles = append(o.overrideFiles, path)
+	}
+}
+
+// WithKeyPrefix places the configuration merged from the configuration files under the prefix,
+// e.g. "fileconfig", instead of at the root of viper, so it doesn't collide with keys of a
+// viper instance shared by WithViper. Keys of changes, hooks and provenance include the prefix,
+// while key filters set by OnlyKeys and ExcludeKeys don't. Reloads replace only the keys under
+// the prefix, which must not be set in the configuration of the viper instance already.
+func WithKeyPrefix(prefix string) Option {
+	return func(o *options) {
+		o.keyPrefix = prefix
+	}
+}
+
+// WithEnvPrecedence sets whether environment variables bound to viper take precedence over the
+// configuration files, on the initial load as well as on reloads. Defaults to EnvWins.
+func WithEnvPrecedence(p EnvPrecedence) Option {
+	return func(o *options) {
+		o.envPrecedence = p
+	}
+}
+
+// WithDotEnv sets how the entries of .env files found in the paths, e.g. ".env" or "app.env",
+// are exposed. Defaults to DotEnvKeys.
+func WithDotEnv(m DotEnvMode) Option {
+	return func(o *options) {
+		o.dotEnv = m
+	}
+}
+
+// WithFS adds the configuration files found in the root of the filesystem, e.g. an embed.FS, a
+// zip.Reader or a fstest.MapFS for tests, which are merged with the configuration files found in
+// the paths. The root is searched recursively like a directory added by WithPath, and the files
+// are merged after the files found in the paths unless a priority is set by Priority.
+//
+// Files of the filesystem are named like "fs/config/app.yaml" in ConfigFiles and changes, or
+// "fs#2/config/app.yaml" for the second filesystem added. The filesystem isn't watched, which is
+// fine for filesystems that don't change like embed.FS; other filesystems can be polled with
+// PollEvery.
+func WithFS(fsys fs.FS, root string, opts ...PathOption) Option {
+	return WithSource(NewFSSource(fsys, root), opts...)
+}
+
+// WithSource adds the configuration documents the source provides, which are merged with the
+// configuration files like a source added by WithFS, e.g. to load documents of a proprietary
+// configuration store. Sources implementing fmt.Stringer are identified by String in errors,
+// see SourceError, and their documents are named by it, see Document. Sources with the same
+// String are told apart by a suffix, e.g. "store#2".
+//
+// The source is watched once hydra is started, and sources that can't be watched are polled if
+// set by PollEvery. A watch that fails is reported as SourceError and started again.
+func WithSource(src Source, opts ...PathOption) Option {
+	return func(o *options) {
+		id := fmt.Sprintf("source:%d", len(o.sources))
+		if s, ok := src.(fmt.Stringer); ok {
+			id = s.String()
+		}
+		taken := func(s *sourceConfig) bool { return s.id == id }
+		for n, base := 2, id; slices.ContainsFunc(o.sources, taken); n++ {
+			id = base + "#" + strconv.Itoa(n)
+		}
+
+		s := &sourceConfig{source: customSource{Source: src, id: id}, id: id}
+		o.sources = append(o.sources, s)
+		for _, opt := range opts {
+			opt(o, s.id)
+		}
+	}
+}
+
+// PollEvery makes hydra reload a source, e.g. added by WithFS or WithURL, in the given interval
+// and notify the changes of its documents. It has no effect on paths, see WithPolling.
+func PollEvery(interval time.Duration) PathOption {
+	return func(o *options, path string) {
+		if o.pollIntervals == nil {
+			o.pollIntervals = make(map[string]time.Duration)
+		}
+		o.pollIntervals[path] = interval
+	}
+}
+
+// WithURL adds the configuration document served at the URL, e.g.
+// "https://config.internal/app.yaml", which is merged with the configuration files like a
+// source added by WithFS and named by its URL in ConfigFiles and changes. The format of the
+// document is determined by the extension of the URL path or, without one, by the content type
+// of the response.
+//
+// Credentials in the URL aren't included in its name, i.e. the userinfo and the values of query
+// parameters like "token" or "X-Amz-Signature". The same URL added again is named like
+// "https://config.internal/app.yaml#2".
+//
+// The document is requested again if polled by PollEvery. Requests are conditional, using the
+// ETag and Last-Modified headers of the previous response, so documents the server reports as
+// not modified aren't downloaded and don't cause reloads.
+func WithURL(url string, opts ...PathOption) Option {
+	return func(o *options) {
+		id := redactURL(url)
+		taken := func(s *sourceConfig) bool { return s.id == id }
+		for n, base := 2, id; slices.ContainsFunc(o.sources, taken); n++ {
+			id = base + "#" + strconv.Itoa(n)
+		}
+
+		s := &sourceConfig{source: &urlSource{url: url, id: id, client: http.DefaultClient}, id: id}
+		o.sources = append(o.sources, s)
+		for _, opt := range opts {
+			opt(o, s.id)
+		}
+	}
+}
+
+// WithS3 adds the configuration files stored as objects under the prefix of an Amazon S3
+// bucket, filtered by their extensions like files found in a path, which are merged with the
+// configuration files like a source added by WithFS. Objects are named like
+// "s3://bucket/myapp/app.yaml" in ConfigFiles and changes.
+//
+// The objects are listed again if polled by PollEvery, and only objects whose ETag changed are
+// downloaded again.
+func WithS3(c S3Config, opts ...PathOption) Option {
+	return func(o *options) {
+		s := &sourceConfig{source: &s3Source{config: c}, id: "s3://" + c.Bucket + "/" + c.Prefix}
+		o.sources = append(o.sources, s)
+		for _, opt := range opts {
+			opt(o, s.id)
+		}
+	}
+}
+
+// WithGCS adds the configuration files stored as objects under the prefix of a Google Cloud
+// Storage bucket, filtered by their extensions like files found in a path, which are merged
+// with the configuration files like a source added by WithFS. Objects are named like
+// "gs://bucket/myapp/app.yaml" in ConfigFiles and changes.
+//
+// The objects are listed again if polled by PollEvery, and only objects whose generation
+// changed are downloaded again.
+func WithGCS(c GCSConfig, opts ...PathOption) Option {
+	return func(o *options) {
+		s := &sourceConfig{source: &gcsSource{config: c}, id: "gs://" + c.Bucket + "/" + c.Prefix}
+		o.sources = append(o.sources, s)
+		for _, opt := range opts {
+			opt(o, s.id)
+		}
+	}
+}
+
+// WithEtcd adds the configuration documents stored as keys under a prefix of etcd v3, filtered
+// by their extensions like files found in a path, which are merged with the configuration files
+// like a source added by WithFS. Keys are named like "etcd:/myapp/config/app.yaml" in
+// ConfigFiles and changes.
+//
+// The keys are watched with the watch API of etcd, so changes are reloaded as soon as they are
+// made. A watch that fails is reported as SourceError and started again.
+func WithEtcd(c EtcdConfig, opts ...PathOption) Option {
+	return func(o *options) {
+		s := &sourceConfig{source: &etcdSource{config: c}, id: "etcd:" + c.Prefix}
+		o.sources = append(o.sources, s)
+		for _, opt := range opts {
+			opt(o, s.id)
+		}
+	}
+}
+
+// WithConsul adds the configuration documents stored as keys under a prefix of the Consul KV
+// store, filtered by their extensions like files found in a path, which are merged with the
+// configuration files like a source added by WithFS. Keys are named like
+// "consul:myapp/config/app.yaml" in ConfigFiles and changes.
+//
+// The keys are watched with blocking queries, so changes are reloaded as soon as they are made.
+// A watch that fails is reported as SourceError and started again.
+func WithConsul(c ConsulConfig, opts ...PathOption) Option {
+	return func(o *options) {
+		s := &sourceConfig{source: &consulSource{config: c}, id: "consul:" + c.Prefix}
+		o.sources = append(o.sources, s)
+		for _, opt := range opts {
+			opt(o, s.id)
+		}
+	}
+}
+
+// WithVault adds secrets stored in the KV version 2 secrets engine of HashiCorp Vault, placed
+// under the keys set by VaultConfig.Secrets, which are merged with the configuration files like
+// a source added by WithFS. Secrets are named like "vault:secret/myapp/database" in ConfigFiles
+// and changes.
+//
+// Secrets are read again in the refresh interval and before their leases expire, so rotated
+// secrets are reloaded and notified like changed configuration files.
+func WithVault(c VaultConfig, opts ...PathOption) Option {
+	return func(o *options) {
+		s := &sourceConfig{source: &vaultSource{config: c}, id: "vault:" + c.Address}
+		o.sources = append(o.sources, s)
+		for _, opt := range opts {
+			opt(o, s.id)
+		}
+	}
+}
+
+// WithKubernetes adds the data keys of ConfigMaps and Secrets read from the Kubernetes API,
+// filtered by their extensions like files found in a path, which are merged with the
+// configuration files like a source added by WithFS. Keys are named like
+// "k8s:configmap/namespace/name/app.yaml" in ConfigFiles and changes. ConfigMaps and Secrets
+// which don't exist are loaded once they are created.
+//
+// The objects are watched with the watch API, so changes are reloaded right away instead of
+// once kubelet syncs mounted volumes, see WithKubernetesVolumes. The service account of the pod
+// needs to be allowed to get, list and watch them.
+func WithKubernetes(c KubernetesConfig, opts ...PathOption) Option {
+	return func(o *options) {
+		s := &sourceConfig{source: &kubernetesSource{config: c}, id: "k8s:" + c.Namespace}
+		o.sources = append(o.sources, s)
+		for _, opt := range opts {
+			opt(o, s.id)
+		}
+	}
+}
+
+// WithGit adds the configuration files found in a directory of a Git repository, which are
+// merged with the configuration files like a source added by WithFS. Files are named like
+// "git:https://github.com/org/config.git/services/myapp/app.yaml" in ConfigFiles and changes.
+//
+// The repository is cloned on creation and pulled again if polled by PollEvery. The files are
+// loaded again only if the checked out commit changes.
+func WithGit(c GitConfig, opts ...PathOption) Option {
+	return func(o *options) {
+		s := &sourceConfig{source: &gitSource{config: c}, id: gitSourceID(c)}
+		o.sources = append(o.sources, s)
+		for _, opt := range opts {
+			opt(o, s.id)
+		}
+	}
+}
+
+// WithStdin adds the configuration document piped into the process, in the format, e.g.
+// "yaml", which is merged with the configuration files like a source added by WithFS and named
+// "stdin" in ConfigFiles and changes. Nothing is added if the standard input is a terminal.
+//
+// The document is merged with a lower precedence than all paths and sources, except defaults
+// files set by WithDefaultsFile, unless a priority is set by Priority. It's read once, so it
+// doesn't change on reloads.
+func WithStdin(format string, opts ...PathOption) Option {
+	return func(o *options) {
+		s := &sourceConfig{source: &stdinSource{file: os.Stdin, format: format}, id: "stdin"}
+		o.sources = append(o.sources, s)
+		// right above the defaults files
+		Priority(math.MinInt+1)(o, s.id)
+		for _, opt := range opts {
+			opt(o, s.id)
+		}
+	}
+}
+
+// WithArchive adds the configuration files of a zip or tar archive, optionally compressed with
+// gzip, at the path or HTTP(S) URL, e.g. "/opt/myapp/config-bundle.tar.gz". Files are filtered
+// by their extensions like files found in a path and merged with the configuration files like
+// a source added by WithFS. They are named like "/opt/myapp/config-bundle.tar.gz/app.yaml" in
+// ConfigFiles and changes.
+//
+// The archive is extracted in memory. Archives at paths are watched and read again once they
+// change, archives served at URLs are requested again like by WithURL if polled by PollEvery.
+// Files are extracted again only if the archive changed, and only files of at most 16 MiB and
+// 64 MiB in total are extracted.
+func WithArchive(location string, opts ...PathOption) Option {
+	return func(o *options) {
+		src := newArchiveSource(location)
+		s := &sourceConfig{source: src, id: src.id}
+		o.sources = append(o.sources, s)
+		for _, opt := range opts {
+			opt(o, s.id)
+		}
+	}
+}
+
+// WithSQL adds the configuration documents stored as rows of a database table, filtered by
+// their formats like files found in a path by their extensions, which are merged with the
+// configuration files like a source added by WithFS. Documents are named like "sql:config/app"
+// in ConfigFiles and changes.
+//
+// The documents are queried again if polled by PollEvery, or whenever a change is notified if
+// SQLConfig.Notify is set.
+func WithSQL(c SQLConfig, opts ...PathOption) Option {
+	return func(o *options) {
+		var src source = &sqlSource{config: c}
+		if c.Notify != nil {
+			src = notifiedSQLSource{sqlSource: &sqlSource{config: c}}
+		}
+
+		s := &sourceConfig{source: src, id: sqlSourceID(c)}
+		o.sources = append(o.sources, s)
+		for _, opt := range opts {
+			opt(o, s.id)
+		}
+	}
+}
+
+// WithRedis adds the configuration documents stored as strings and hashes of Redis, filtered by
+// their extensions like files found in a path, which are merged with the configuration files
+// like a source added by WithFS. Keys are named like "redis:myapp:config.yaml" in ConfigFiles
+// and changes.
+//
+// The keys are watched by subscribing to their keyspace notifications, so changes are reloaded
+// as soon as they are made. Notifications need to be enabled by the notify-keyspace-events
+// setting of Redis, e.g. "KA"; if they aren't, the keys aren't watched but polled if set by
+// PollEvery. A subscription that fails is reported as SourceError and started again.
+func WithRedis(c RedisConfig, opts ...PathOption) Option {
+	return func(o *options) {
+		s := &sourceConfig{source: &redisSource{config: c}, id: "redis:" + strings.Join(c.Keys, ",")}
+		o.sources = append(o.sources, s)
+		for _, opt := range opts {
+			opt(o, s.id)
+		}
+	}
+}
+
+// WithSSM adds the parameters stored under a path of AWS Systems Manager Parameter Store, placed
+// under keys by their names relative to the path and with SecureString parameters decrypted,
+// which are merged with the configuration files like a source added by WithFS. Parameters are
+// named like "ssm:/myapp/prod" in ConfigFiles and changes.
+//
+// Parameters are read again in the refresh interval, so changed parameters are reloaded and
+// notified like changed configuration files.
+func WithSSM(c SSMConfig, opts ...PathOption) Option {
+	return func(o *options) {
+		s := &sourceConfig{source: &ssmSource{config: c}, id: "ssm:" + c.Path}
+		o.sources = append(o.sources, s)
+		for _, opt := range opts {
+			opt(o, s.id)
+		}
+	}
+}
+
+// WithAppConfig adds the configuration profile deployed to an environment by AWS AppConfig,
+// which is merged with the configuration files like a source added by WithFS. Profiles are
+// named like "appconfig:myapp/prod/settings" in ConfigFiles and changes.
+//
+// The profile is polled in a configuration session of AppConfig, which only sends it again once
+// a new deployment changes it, so deployments are reloaded and notified like changed
+// configuration files.
+func WithAppConfig(c AppConfigConfig, opts ...PathOption) Option {
+	return func(o *options) {
+		id := "appconfig:" + c.Application + "/" + c.Environment + "/" + c.Profile
+		s := &sourceConfig{source: &appConfigSource{config: c}, id: id}
+		o.sources = append(o.sources, s)
+		for _, opt := range opts {
+			opt(o, s.id)
+		}
+	}
+}
+
+// WithAzureAppConfig adds the key-values stored in Azure App Configuration, placed under keys by
+// the hierarchy of their keys and with references of secrets of Key Vault resolved, which are
+// merged with the configuration files like a source added by WithFS. Stores are named like
+// "azappconfig:myapp.azconfig.io" in ConfigFiles and changes.
+//
+// The key-values, or only the sentinel set by AzureConfig.Sentinel, are checked for changes in
+// the refresh interval, so changed key-values are reloaded and notified like changed
+// configuration files.
+func WithAzureAppConfig(c AzureConfig, opts ...PathOption) Option {
+	return func(o *options) {
+		s := &sourceConfig{source: &azureSource{config: c}, id: azureSourceID(c)}
+		o.sources = append(o.sources, s)
+		for _, opt := range opts {
+			opt(o, s.id)
+		}
+	}
+}
+
+// WithGRPC adds the configuration document served by a gRPC service defined by config.proto,
+// which is merged with the configuration files like a source added by WithFS. Documents are
+// named like "grpc:config.internal:8443/myapp" in ConfigFiles and changes. The service is called
+// with grpc-go and the stubs of package configpb, and the connection is closed by Close.
+//
+// Updates of the document are streamed from the service, so documents pushed by the service are
+// reloaded and notified like changed configuration files. A stream that fails is reported as
+// SourceError and started again.
+func WithGRPC(c GRPCConfig, opts ...PathOption) Option {
+	return func(o *options) {
+		s := &sourceConfig{source: &grpcSource{config: c}, id: "grpc:" + c.Address + "/" + c.Name}
+		o.sources = append(o.sources, s)
+		for _, opt := range opts {
+			opt(o, s.id)
+		}
+	}
+}
+
+// WithSFTP adds the configuration files found in a directory of a remote host, downloaded over
+// SFTP, filtered by their extensions like files found in a path, which are merged with the
+// configuration files like a source added by WithFS. Files are named like
+// "sftp://bastion.internal/etc/myapp/app.yaml" in ConfigFiles and changes.
+//
+// The files are downloaded again if polled by PollEvery.
+func WithSFTP(c SFTPConfig, opts ...PathOption) Option {
+	return func(o *options) {
+		s := &sourceConfig{source: &sftpSource{config: c}, id: "sftp://" + c.Host + "/" + strings.TrimPrefix(c.Path, "/")}
+		o.sources = append(o.sources, s)
+		for _, opt := range opts {
+			opt(o, s.id)
+		}
+	}
+}
+
+// WithRegistry adds the values of a key of the Windows registry and its subkeys, placed under
+// their lowercased names, which are merged with the configuration files like a source added by
+// WithFS. Keys are named like `registry:HKLM\SOFTWARE\MyApp` in ConfigFiles and changes. Loading
+// the key fails on other platforms.
+//
+// The key is watched with RegNotifyChangeKeyValue, so changed values are reloaded as soon as
+// they are made. A watch that fails is reported as SourceError and started again.
+func WithRegistry(c RegistryConfig, opts ...PathOption) Option {
+	return func(o *options) {
+		s := &sourceConfig{source: &registrySource{config: c}, id: "registry:" + c.Key}
+		o.sources = append(o.sources, s)
+		for _, opt := range opts {
+			opt(o, s.id)
+		}
+	}
+}
+
+// WithZooKeeper adds the configuration documents stored as znodes of a ZooKeeper subtree,
+// filtered by their extensions like files found in a path, which are merged with the
+// configuration files like a source added by WithFS. Znodes are named like
+// "zk:/config/myapp/app.yaml" in ConfigFiles and changes.
+//
+// The znodes are watched, so changes are reloaded as soon as they are made. A watch that fails,
+// e.g. because the session expired, is reported as SourceError and started again.
+func WithZooKeeper(c ZooKeeperConfig, opts ...PathOption) Option {
+	return func(o *options) {
+		s := &sourceConfig{source: &zooKeeperSource{config: c}, id: "zk:" + c.Path}
+		o.sources = append(o.sources, s)
+		for _, opt := range opts {
+			opt(o, s.id)
+		}
+	}
+}
+
+// WithNATS adds the configuration documents stored as keys of a NATS JetStream key-value bucket,
+// filtered by their extensions like files found in a path, which are merged with the
+// configuration files like a source added by WithFS. Keys are named like
+// "nats:config/myapp/app.yaml" in ConfigFiles and changes, and deleted keys are removed.
+//
+// The bucket is watched by a consumer, so changes are reloaded as soon as they are made. A watch
+// that fails, e.g. because the connection was lost, is reported as SourceError and started
+// again.
+func WithNATS(c NATSConfig, opts ...PathOption) Option {
+	return func(o *options) {
+		s := &sourceConfig{source: &natsSource{config: c}, id: "nats:" + c.Bucket + "/" + c.Prefix}
+		o.sources = append(o.sources, s)
+		for _, opt := range opts {
+			opt(o, s.id)
+		}
+	}
+}
+
+// WithOCI adds the configuration files of an artifact stored in an OCI registry by tag or
+// digest, e.g. pushed by "oras push ghcr.io/org/config:v1 app.yaml", which are filtered by their
+// extensions like files found in a path and merged with the configuration files like a source
+// added by WithFS. Files are the layers of the artifact named by their title annotations, and
+// directories pushed by ORAS are unpacked. They are named like "oci:ghcr.io/org/config/app.yaml"
+// in ConfigFiles and changes.
+//
+// Tags are resolved again if polled by PollEvery, and the layers are downloaded again only if
+// the tag resolves to another manifest, so tags can be moved to roll out new versions. Artifacts
+// referenced by digest aren't requested again.
+func WithOCI(c OCIConfig, opts ...PathOption) Option {
+	return func(o *options) {
+		s := &sourceConfig{source: &ociSource{config: c}, id: "oci:" + c.Reference}
+		o.sources = append(o.sources, s)
+		for _, opt := range opts {
+			opt(o, s.id)
+		}
+	}
+}
+
+// WithXML finds XML files (.xml) in addition to the extensions set by WithExtensions, and sets
+// how their elements and attributes are mapped to keys, see XMLConfig. It configures the XML
+// codec of the default decoder registry, not of a registry set by WithDecoderRegistry, and New
+// fails if a codec is registered for the extension by RegisterCodec.
+func WithXML(c XMLConfig) Option {
+	return func(o *options) {
+		o.xml = &c
+		o.formats = append(o.formats, "xml")
+	}
+}
+
+// WithYAMLDocuments sets how YAML files with multiple documents are decoded. Defaults to
+// YAMLFirstDocument. Like WithXML, it configures the YAML codec of the default decoder
+// registry only, and New fails if a codec is registered for "yaml" or "yml" by RegisterCodec.
+func WithYAMLDocuments(m YAMLDocumentMode) Option {
+	return func(o *options) {
+		o.yamlDocuments = m
+	}
+}
+
+// WithTextProto finds protobuf text format files (.textproto and .txtpb) in addition to the
+// extensions set by WithExtensions, and decodes them as the message of the schema, so they're
+// checked against it. Like WithXML, it configures the codec of the default decoder registry
+// only, and New fails if a codec is registered for the extensions by RegisterCodec.
+func WithTextProto(c TextProtoConfig) Option {
+	return func(o *options) {
+		o.textProto = &c
+		o.formats = append(o.formats, "textproto", "txtpb")
+	}
+}
+
+// WithExtensionAlias decodes configuration files with the extension, e.g. "conf", "cfg" or
+// "yml.tpl", as files of the format, e.g. "toml", so they're found instead of skipped as files
+// of unsupported extensions. Extensions may have several parts and are matched
+// case-insensitively, preferring longer ones, so "app.yml.tpl" is decoded by an alias of
+// "yml.tpl" rather than of "tpl".
+func WithExtensionAlias(ext, format string) Option {
+	return func(o *options) {
+		if o.extensionAliases == nil {
+			o.extensionAliases = make(map[string]string)
+		}
+		ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+		o.extensionAliases[ext] = strings.ToLower(strings.TrimPrefix(format, "."))
+	}
+}
+
+// WithJSONSchema validates the merged configuration against the JSON schema on the initial load
+// and on every reload. Invalid configurations fail New with a SchemaError listing the paths of
+// the violations, and invalid reloads are reported as ReloadError, keeping the previous
+// configuration. Since keys are lowercased, property names of the schema are matched
+// case-insensitively.
+func WithJSONSchema(schema []byte) Option {
+	return func(o *options) {
+		o.jsonSchema = schema
+	}
+}
+
+// WithStructValidator sets the validator of structs unmarshaled by UnmarshalValidated, e.g. a
+// *validator.Validate of github.com/go-playground/validator. By default, structs are validated by
+// their "validate" tags with a subset of the tags of github.com/go-playground/validator.
+func WithStructValidator(v StructValidator) Option {
+	return func(o *options) {
+		o.structValidator = v
+	}
+}
+
+// WithCUESchema unifies the merged configuration with the CUE schema on the initial load and on
+// every reload, whatever the formats of the configuration files, by evaluating them in-process.
+// Constraints of the schema are checked and its defaults are filled in. Invalid schemas and
+// configurations not unifying with the schema fail New, and such reloads are reported as
+// ReloadError, keeping the previous configuration. Since keys are lowercased, fields of the
+// schema should be lowercase.
+func WithCUESchema(schema []byte) Option {
+	return func(o *options) {
+		o.cueSchema = schema
+	}
+}
+
+// WithRequiredKeys requires the dotted keys, e.g. "db.host", to be set by the merged
+// configuration files. If any of them is missing or null, New fails with a MissingKeysError
+// listing them, and reloads are reported as ReloadError, keeping the previous configuration.
+func WithRequiredKeys(keys ...string) Option {
+	return func(o *options) {
+		for _, key := range keys {
+			o.requiredKeys = append(o.requiredKeys, strings.ToLower(key))
+		}
+	}
+}
+
+// WithStrictKeys rejects configurations with keys that none of the structs consumes when
+// unmarshaled, e.g. a misspelled "server.tiemout". The structs may be passed as values or
+// pointers. Such configurations fail New with an UnknownKeysError naming the keys and the files
+// setting them, and such reloads are reported as ReloadError, keeping the previous
+// configuration. Keys of map fields and of fields of type any are all consumed. With a JSON
+// schema set by WithJSONSchema, additionalProperties set to false rejects unknown keys instead.
+func WithStrictKeys(structs ...any) Option {
+	return func(o *options) {
+		for _, s := range structs {
+			t := reflect.TypeOf(s)
+			for t != nil && t.Kind() == reflect.Pointer {
+				t = t.Elem()
+			}
+			o.strictKeys = append(o.strictKeys, t)
+		}
+	}
+}
+
+// WithStruct registers the struct the configuration is unmarshaled into, passed as a value or a
+// pointer, with the decoder options passed to viper.Unmarshal. On the initial load and on every
+// reload, the merged configuration files are decoded into a throwaway struct, and
+// configurations failing to decode, e.g. with values of the wrong type or unparsable durations,
+// fail New or are rejected like invalid configuration files, keeping the last good
+// configuration. To reject invalid values of enums implementing encoding.TextUnmarshaler, pass
+// viper.DecodeHook composing mapstructure.TextUnmarshallerHookFunc with the default hooks, as
+// for viper.Unmarshal.
+func WithStruct(s any, opts ...viper.DecoderConfigOption) Option {
+	return func(o *options) {
+		t := reflect.TypeOf(s)
+		for t != nil && t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		o.structs = append(o.structs, checkedStruct{typ: t, opts: opts})
+	}
+}
+
+// WithValidator adds a validator of the merged configuration, e.g. checking business rules like
+// a pool size not exceeding the maximum number of connections. Validators run in order on the
+// initial load and on every reload, after the configuration files are merged and before the
+// configuration is committed. If a validator returns an error, New fails with a
+// ValidationError, and reloads are reported as ReloadError wrapping the ValidationError, to the
+// error handler and as events, keeping the previous configuration.
+func WithValidator(fn func(snapshot Snapshot) error) Option {
+	return func(o *options) {
+		o.validators = append(o.validators, fn)
+	}
+}
+
+// WithReference requires the values of the key to reference entries of the target across all
+// configuration files, e.g. WithReference("routes.*.upstream", "upstreams.*") requires every
+// upstream of a route to be a key of upstreams. In both patterns, a "*" matches any key of a
+// map or index of a list. A target ending in "*" references the keys it matches,
+// case-insensitively, otherwise its values; lists of values reference each element.
+// Configurations with dangling references fail New with a ReferenceError naming the files
+// setting them and the target, and such reloads are reported as ReloadError, keeping the
+// previous configuration.
+func WithReference(key, target string) Option {
+	return func(o *options) {
+		o.references = append(o.references, reference{key: strings.ToLower(key), target: strings.ToLower(target)})
+	}
+}
+
+// WithCUE finds CUE files (.cue) in addition to the extensions set by WithExtensions, and
+// evaluates them as configuration files. They aren't found by default, since .cue files next to
+// configuration files are often schemas rather than configuration.
+func WithCUE() Option {
+	return func(o *options) {
+		o.formats = append(o.formats, "cue")
+	}
+}
+
+// WithStarlark finds Starlark files (.star) in addition to the extensions set by WithExtensions,
+// and evaluates them as configuration files. They aren't found by default, since evaluating a
+// file may allocate memory without limit.
+func WithStarlark() Option {
+	return func(o *options) {
+		o.formats = append(o.formats, "star")
+	}
+}
+
+// WithJsonnet finds Jsonnet files (.jsonnet) in addition to the extensions set by
+// WithExtensions, and renders them as configuration files.
+func WithJsonnet() Option {
+	return func(o *options) {
+		o.formats = append(o.formats, "jsonnet")
+	}
+}
+
+// WithDhall finds Dhall files (.dhall) in addition to the extensions set by WithExtensions, and
+// normalizes them as configuration files.
+func WithDhall() Option {
+	return func(o *options) {
+		o.formats = append(o.formats, "dhall")
+	}
+}
+
+// WithJSON5 finds JSON5 and JSONC files (.json5 and .jsonc) in addition to the extensions set
+// by WithExtensions.
+func WithJSON5() Option {
+	return func(o *options) {
+		o.formats = append(o.formats, "json5", "jsonc")
+	}
+}
+
+// WithNestedText finds NestedText files (.nt) in addition to the extensions set by
+// WithExtensions.
+func WithNestedText() Option {
+	return func(o *options) {
+		o.formats = append(o.formats, "nt")
+	}
+}
+
+// WithKDL finds KDL documents (.kdl) in addition to the extensions set by WithExtensions.
+func WithKDL() Option {
+	return func(o *options) {
+		o.formats = append(o.formats, "kdl")
+	}
+}
+
+// WithPlist finds property lists (.plist) in addition to the extensions set by WithExtensions.
+func WithPlist() Option {
+	return func(o *options) {
+		o.formats = append(o.formats, "plist")
+	}
+}
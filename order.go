@@ -0,0 +1,191 @@
+package hydra
+
+import (
+	"cmp"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileOrder compares two configuration files found in the same path, returning a negative
+// number if a is loaded before b, a positive number if a is loaded after b and zero if their
+// order doesn't matter. Files loaded later take precedence over files loaded earlier.
+type FileOrder func(a, b string) int
+
+// ByName orders configuration files lexicographically by their path, component by component,
+// which is the order filepath.Walk visits them in. Files in a directory are loaded before
+// files in a directory next to them with a greater name.
+func ByName(a, b string) int {
+	return slices.Compare(
+		strings.Split(filepath.Clean(a), string(filepath.Separator)),
+		strings.Split(filepath.Clean(b), string(filepath.Separator)),
+	)
+}
+
+// ByModTime orders configuration files by their modification time, so the most recently
+// modified file takes precedence. Files modified at the same time are ordered ByName.
+func ByModTime(a, b string) int {
+	if c := modTime(a).Compare(modTime(b)); c != 0 {
+		return c
+	}
+	return ByName(a, b)
+}
+
+// ByNumericPrefix orders configuration files by the number their name starts with, following
+// the conf.d convention of names like "00-base.yaml", "50-overrides.yaml" and "99-local.yaml",
+// so files with greater numbers take precedence. Numbers are compared by value, so "9-a.yaml"
+// is loaded before "10-b.yaml". Files without a numeric prefix are loaded first, and files
+// with the same number are ordered ByName.
+func ByNumericPrefix(a, b string) int {
+	pa, oka := numericPrefix(a)
+	pb, okb := numericPrefix(b)
+	switch {
+	case oka != okb:
+		if oka {
+			return 1
+		}
+		return -1
+	case pa != pb:
+		return cmp.Compare(pa, pb)
+	}
+	return ByName(a, b)
+}
+
+// numericPrefix returns the number the name of the file starts with.
+func numericPrefix(path string) (uint64, bool) {
+	name := filepath.Base(path)
+	end := strings.IndexFunc(name, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	if end < 0 {
+		end = len(name)
+	}
+
+	n, err := strconv.ParseUint(name[:end], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// compareLoadOrder compares configuration files by the order in which they are loaded, i.e.
+// by the priority and order of paths they were found in and then by the file order set by
+// WithFileOrder. Environment overlay files are loaded right after their base files.
+func (h *Hydra) compareLoadOrder(a, b string) int {
+	ra, rb := h.pathIndex(a), h.pathIndex(b)
+	if c := cmp.Compare(h.pathPriority(ra), h.pathPriority(rb)); c != 0 {
+		return c
+	}
+	if ra != rb {
+		return ra - rb
+	}
+
+	if h.options.environment != "" {
+		// environment overlay files are merged right after their base files
+		ba, bb := h.overlayBase(a), h.overlayBase(b)
+		if ba == bb && a != b {
+			if a == ba {
+				return -1
+			}
+			return 1
+		}
+		a, b = ba, bb
+	}
+
+	if h.options.fileOrder != nil {
+		return h.options.fileOrder(a, b)
+	}
+	return ByName(a, b)
+}
+
+// sortLoadOrder sorts the configuration files in their load order.
+func (h *Hydra) sortLoadOrder(files []string) {
+	slices.SortStableFunc(files, h.compareLoadOrder)
+}
+
+// mergeOrder returns the configuration files sorted in load order in the order they are merged
+// according to the precedence set by WithPrecedence. With FirstWins, files of the same
+// priority are merged in reverse, so priorities are respected regardless of the precedence.
+func (h *Hydra) mergeOrder(files []string) []string {
+	if h.options.precedence != FirstWins {
+		return files
+	}
+
+	ordered := slices.Clone(files)
+	for start := 0; start < len(ordered); {
+		priority := h.pathPriority(h.pathIndex(ordered[start]))
+		end := start + 1
+		for end < len(ordered) && h.pathPriority(h.pathIndex(ordered[end])) == priority {
+			end++
+		}
+		slices.Reverse(ordered[start:end])
+		start = end
+	}
+	return ordered
+}
+
+// pathIndex returns the index of the configured path the file is loaded through: the path
+// itself or, if the file isn't configured explicitly, the first configured path containing it.
+// Documents of sources are indexed after the paths, by the order of their sources.
+func (h *Hydra) pathIndex(file string) int {
+	if doc, ok := h.document(file); ok {
+		return len(h.options.paths) + doc.source
+	}
+	if i := h.explicitPathIndex(file); i >= 0 {
+		return i
+	}
+	for i, path := range h.options.paths {
+		if isUnder(file, path) {
+			return i
+		}
+	}
+	return len(h.options.paths) + len(h.options.sources)
+}
+
+// explicitPathIndex returns the index of the configured path equal to the file, or -1.
+func (h *Hydra) explicitPathIndex(file string) int {
+	return slices.IndexFunc(h.options.paths, func(path string) bool {
+		return filepath.Clean(path) == filepath.Clean(file)
+	})
+}
+
+// pathPriority returns the priority of the configured path at the index, see Priority.
+func (h *Hydra) pathPriority(i int) int {
+	id, ok := h.pathID(i)
+	if !ok {
+		return 0
+	}
+	return h.options.priorities[id]
+}
+
+// pathID returns the configured path, or the id of the source, at the index, see pathIndex.
+func (h *Hydra) pathID(i int) (string, bool) {
+	switch {
+	case i < len(h.options.paths):
+		return h.options.paths[i], true
+	case i < len(h.options.paths)+len(h.options.sources):
+		return h.options.sources[i-len(h.options.paths)].id, true
+	default:
+		return "", false
+	}
+}
+
+// isUnder reports whether the path equals the root or is located under it.
+func isUnder(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
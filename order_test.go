@@ -0,0 +1,194 @@
+package hydra
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// relFiles returns the configuration files of hydra relative to the directory.
+func relFiles(t *testing.T, h *Hydra, dir string) []string {
+	t.Helper()
+	var files []string
+	for _, file := range h.ConfigFiles() {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, filepath.ToSlash(rel))
+	}
+	return files
+}
+
+func TestFileOrder(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{"b.yaml", "a/z.yaml", "a.yaml", "a/b/c.yaml"}
+	now := time.Now()
+	for i, name := range files {
+		path := filepath.Join(dir, name)
+		writeFile(t, path, "name: "+name+"\n")
+		// files are modified in the order above
+		mtime := now.Add(time.Duration(i-len(files)) * time.Minute)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		order FileOrder
+		want  []string
+	}{
+		{name: "default", want: []string{"a/b/c.yaml", "a/z.yaml", "a.yaml", "b.yaml"}},
+		{name: "by name", order: ByName, want: []string{"a/b/c.yaml", "a/z.yaml", "a.yaml", "b.yaml"}},
+		{name: "by mod time", order: ByModTime, want: files},
+		{
+			name:  "custom",
+			order: func(a, b string) int { return ByName(b, a) },
+			want:  []string{"b.yaml", "a.yaml", "a/z.yaml", "a/b/c.yaml"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []Option{WithPaths(dir)}
+			if tt.order != nil {
+				opts = append(opts, WithFileOrder(tt.order))
+			}
+			h, err := New(opts...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer h.Close()
+
+			if got := relFiles(t, h, dir); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ConfigFiles() = %v, want %v", got, tt.want)
+			}
+			// the file loaded last takes precedence
+			if got := h.viper.GetString("name"); got != tt.want[len(tt.want)-1] {
+				t.Errorf("name = %s, want %s", got, tt.want[len(tt.want)-1])
+			}
+		})
+	}
+}
+
+func TestByNumericPrefix(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"99-local.yaml", "10-b.yaml", "9-a.yaml", "base.yaml", "00-defaults.yaml", "10-a.yaml"} {
+		writeFile(t, filepath.Join(dir, "conf.d", name), "name: "+name+"\n")
+	}
+	h, err := New(WithPaths(dir), WithFileOrder(ByNumericPrefix))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	// files without a number are loaded first, numbers are compared by value, and files with
+	// the same number by name
+	want := []string{
+		"conf.d/base.yaml", "conf.d/00-defaults.yaml", "conf.d/9-a.yaml", "conf.d/10-a.yaml",
+		"conf.d/10-b.yaml", "conf.d/99-local.yaml",
+	}
+	if got := relFiles(t, h, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("ConfigFiles() = %v, want %v", got, want)
+	}
+	if got := h.viper.GetString("name"); got != "99-local.yaml" {
+		t.Errorf("name = %s, want 99-local.yaml", got)
+	}
+}
+
+func TestNumericPrefix(t *testing.T) {
+	tests := []struct {
+		path string
+		want uint64
+		ok   bool
+	}{
+		{path: "conf.d/50-overrides.yaml", want: 50, ok: true},
+		{path: "007.yaml", want: 7, ok: true},
+		{path: "base.yaml"},
+		{path: "99999999999999999999-big.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, ok := numericPrefix(tt.path)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("numericPrefix() = %d, %t, want %d, %t", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestPriority(t *testing.T) {
+	dir := t.TempDir()
+	etc, home, work := filepath.Join(dir, "etc"), filepath.Join(dir, "home"), filepath.Join(dir, "work")
+	writeFile(t, filepath.Join(etc, "app.yaml"), "name: etc\netc: true\n")
+	writeFile(t, filepath.Join(home, "app.yaml"), "name: home\n")
+	writeFile(t, filepath.Join(work, "app.yaml"), "name: work\n")
+	src := newMemSource(Document{Path: "app.yaml", Data: []byte("name: source\n")})
+
+	tests := []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{
+			name: "order of paths",
+			opts: []Option{WithPath(work), WithPath(etc), WithPath(home), WithSource(src)},
+			want: []string{"work", "etc", "home", "source"},
+		},
+		{
+			name: "priorities",
+			opts: []Option{
+				WithPath(work, Priority(30)), WithPath(etc, Priority(10)), WithPath(home, Priority(20)),
+				WithSource(src),
+			},
+			want: []string{"source", "etc", "home", "work"},
+		},
+		{
+			// paths of the same priority keep their order, and negative priorities come first
+			name: "same and negative priorities",
+			opts: []Option{
+				WithPath(work, Priority(1)), WithPath(etc, Priority(-1)), WithPath(home, Priority(1)),
+				WithSource(src, Priority(1)),
+			},
+			want: []string{"etc", "work", "home", "source"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := New(append([]Option{WithPaths()}, tt.opts...)...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer h.Close()
+
+			check := func(when string) {
+				t.Helper()
+				var got []string
+				for _, file := range h.ConfigFiles() {
+					switch filepath.Dir(file) {
+					case etc, home, work:
+						got = append(got, filepath.Base(filepath.Dir(file)))
+					default:
+						got = append(got, "source")
+					}
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%s: ConfigFiles() = %v, want %v", when, h.ConfigFiles(), tt.want)
+				}
+				if name := h.viper.GetString("name"); name != tt.want[len(tt.want)-1] || !h.viper.GetBool("etc") {
+					t.Errorf("%s: name = %s, want %s", when, name, tt.want[len(tt.want)-1])
+				}
+			}
+			check("load")
+
+			// reloads keep the priorities
+			if err := h.Reload(context.Background()); err != nil {
+				t.Fatalf("Reload() error = %v", err)
+			}
+			check("reload")
+		})
+	}
+}
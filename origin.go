@@ -0,0 +1,36 @@
+package hydra
+
+import "strings"
+
+// Setting is the value of a key and the configuration file that set it.
+type Setting struct {
+	Value any
+	// Source is the path of the configuration file.
+	Source string
+}
+
+// Origin returns the path of the configuration file that set the effective value of the key,
+// e.g. "server.port", or an empty string if no configuration file set it. For a map merged
+// from multiple files, the file that set it first is returned, while its nested keys report
+// the files that set them. See Position for the line and column of the key.
+func (h *Hydra) Origin(key string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return origin(h.origins, strings.ToLower(key))
+}
+
+// AllSettingsWithSources returns the settings merged from the configuration files by their
+// dotted keys, with the configuration file that set each of them.
+func (h *Hydra) AllSettingsWithSources() map[string]Setting {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	settings := make(map[string]Setting)
+	for key, value := range flatten(h.settings) {
+		settings[key] = Setting{
+			Value:  copyValue(value),
+			Source: origin(h.origins, key),
+		}
+	}
+	return settings
+}
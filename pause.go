@@ -0,0 +1,34 @@
+package hydra
+
+import (
+	"context"
+	"fmt"
+)
+
+// Pause suspends processing of configuration changes until Resume is called. Changes made in
+// the meantime are neither loaded nor notified.
+func (h *Hydra) Pause() {
+	h.paused.Store(true)
+}
+
+// Resume resumes processing of configuration changes suspended by Pause. It rescans all paths,
+// reloads the configuration and notifies a single change consolidating everything that has
+// changed while paused.
+func (h *Hydra) Resume() error {
+	if !h.paused.Load() {
+		return nil
+	}
+
+	h.reloadMu.Lock()
+	defer h.reloadMu.Unlock()
+
+	h.paused.Store(false)
+
+	change, err := h.rescan(context.Background())
+	if err != nil {
+		return fmt.Errorf("rescan paths: %w", err)
+	}
+
+	h.dispatch(change)
+	return nil
+}
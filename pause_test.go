@@ -0,0 +1,76 @@
+package hydra
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPause(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml")
+	writeFile(t, a, "a: 1\n")
+	writeFile(t, b, "b: 1\n")
+	h, err := New(WithPaths(dir), WithAutoReload())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	changes := startNotify(t, h)
+
+	// changes while paused are neither applied nor notified
+	h.Pause()
+	writeFile(t, a, "a: 2\n")
+	writeFile(t, b, "b: 2\n")
+	quiet(t, changes, 200*time.Millisecond)
+	if got, _ := Get[int](h, "a"); got != 1 {
+		t.Errorf("a = %d while paused, want 1", got)
+	}
+
+	// resuming catches up with a single notification
+	if err := h.Resume(); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	c := receive(t, changes)
+	want := map[string]Values{"a": {Old: 1, New: 2}, "b": {Old: 1, New: 2}}
+	if !reflect.DeepEqual(c.Modified, want) {
+		t.Errorf("modified = %v, want %v", c.Modified, want)
+	}
+	if got, _ := Get[int](h, "b"); got != 2 {
+		t.Errorf("b = %d, want 2", got)
+	}
+	quiet(t, changes, 200*time.Millisecond)
+
+	// resuming without pausing notifies nothing
+	if err := h.Resume(); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	quiet(t, changes, 50*time.Millisecond)
+}
+
+func TestPauseSource(t *testing.T) {
+	src := newMemSource(Document{Path: "app.yaml", Data: []byte("x: 1\n")})
+	h, err := New(WithSource(src, PollEvery(10*time.Millisecond)), WithAutoReload())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	changes := startNotify(t, h)
+
+	// polls of the source are dropped while paused
+	h.Pause()
+	src.set(Document{Path: "app.yaml", Data: []byte("x: 2\n")})
+	quiet(t, changes, 200*time.Millisecond)
+	if got, _ := Get[int](h, "x"); got != 1 {
+		t.Errorf("x = %d while paused, want 1", got)
+	}
+
+	if err := h.Resume(); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	c := receive(t, changes)
+	if want := map[string]Values{"x": {Old: 1, New: 2}}; !reflect.DeepEqual(c.Modified, want) {
+		t.Errorf("modified = %v, want %v", c.Modified, want)
+	}
+	// the source was caught up by Resume, so its next polls don't notify the change again
+	quiet(t, changes, 200*time.Millisecond)
+}
@@ -0,0 +1,512 @@
+package hydra
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/spf13/cast"
+)
+
+// plistCodec decodes property lists of macOS, XML and binary ones, and encodes them as XML.
+// Dates are decoded as time.Time, data as []byte and UIDs of binary property lists as
+// integers. The top-level value must be a dictionary.
+type plistCodec struct{}
+
+// plistEpoch is the reference date of dates of binary property lists.
+var plistEpoch = time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func (plistCodec) Decode(b []byte, v map[string]any) error {
+	var value any
+	var err error
+	if bytes.HasPrefix(b, []byte("bplist")) {
+		value, err = decodeBinaryPlist(b)
+	} else {
+		value, err = decodeXMLPlist(b)
+	}
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		// empty property lists have no configuration
+		return nil
+	}
+
+	m, ok := value.(map[string]any)
+	if !ok {
+		return fmt.Errorf("top-level value is not a dictionary: %T", value)
+	}
+	for key, value := range m {
+		v[key] = value
+	}
+	return nil
+}
+
+func decodeXMLPlist(b []byte) (any, error) {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	d.Strict = true
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("no plist element")
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local != "plist" {
+			return nil, fmt.Errorf("root element is %s, not plist", start.Name.Local)
+		}
+
+		var value any
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch tok := tok.(type) {
+			case xml.StartElement:
+				if value != nil {
+					return nil, errors.New("plist element has several values")
+				}
+				value, err = decodeXMLPlistValue(d, tok)
+				if err != nil {
+					return nil, err
+				}
+			case xml.EndElement:
+				return value, nil
+			}
+		}
+	}
+}
+
+// decodeXMLPlistValue decodes the value of the element, which started.
+func decodeXMLPlistValue(d *xml.Decoder, start xml.StartElement) (any, error) {
+	switch start.Name.Local {
+	case "dict":
+		m := make(map[string]any)
+		var key *string
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch tok := tok.(type) {
+			case xml.StartElement:
+				if tok.Name.Local == "key" {
+					if key != nil {
+						return nil, fmt.Errorf("key %s has no value", *key)
+					}
+					text, err := plistText(d)
+					if err != nil {
+						return nil, err
+					}
+					key = &text
+					continue
+				}
+				if key == nil {
+					return nil, fmt.Errorf("%s element has no key", tok.Name.Local)
+				}
+				value, err := decodeXMLPlistValue(d, tok)
+				if err != nil {
+					return nil, fmt.Errorf("decode value (key: %s): %w", *key, err)
+				}
+				m[*key] = value
+				key = nil
+			case xml.EndElement:
+				if key != nil {
+					return nil, fmt.Errorf("key %s has no value", *key)
+				}
+				return m, nil
+			}
+		}
+	case "array":
+		list := []any{}
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch tok := tok.(type) {
+			case xml.StartElement:
+				value, err := decodeXMLPlistValue(d, tok)
+				if err != nil {
+					return nil, fmt.Errorf("decode element (index: %d): %w", len(list), err)
+				}
+				list = append(list, value)
+			case xml.EndElement:
+				return list, nil
+			}
+		}
+	case "true", "false":
+		if err := d.Skip(); err != nil {
+			return nil, err
+		}
+		return start.Name.Local == "true", nil
+	}
+
+	text, err := plistText(d)
+	if err != nil {
+		return nil, err
+	}
+	switch start.Name.Local {
+	case "string":
+		return text, nil
+	case "integer":
+		text = strings.TrimSpace(text)
+		if n, err := strconv.ParseInt(text, 0, 64); err == nil {
+			return int(n), nil
+		}
+		n, err := strconv.ParseUint(text, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer: %s", text)
+		}
+		return n, nil
+	case "real":
+		f, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid real: %s", text)
+		}
+		return f, nil
+	case "date":
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(text))
+		if err != nil {
+			return nil, fmt.Errorf("invalid date: %s", text)
+		}
+		return t, nil
+	case "data":
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+		if err != nil {
+			return nil, fmt.Errorf("invalid data: %w", err)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("unknown element: %s", start.Name.Local)
+}
+
+// plistText returns the text of the element, which started, up to its end.
+func plistText(d *xml.Decoder) (string, error) {
+	var b strings.Builder
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return "", err
+		}
+		switch tok := tok.(type) {
+		case xml.CharData:
+			b.Write(tok)
+		case xml.StartElement:
+			return "", fmt.Errorf("unexpected %s element in text", tok.Name.Local)
+		case xml.EndElement:
+			return b.String(), nil
+		}
+	}
+}
+
+// binaryPlist decodes the objects of a binary property list.
+type binaryPlist struct {
+	b       []byte
+	offsets []uint64
+	refSize int
+	// decoding are the objects being decoded, which can't be referenced by themselves.
+	decoding []uint64
+}
+
+func decodeBinaryPlist(b []byte) (any, error) {
+	if !bytes.HasPrefix(b, []byte("bplist00")) {
+		return nil, fmt.Errorf("unsupported binary plist version: %q", b[:min(len(b), 8)])
+	}
+	if len(b) < 8+32 {
+		return nil, errors.New("binary plist is truncated")
+	}
+	trailer := b[len(b)-32:]
+	offsetSize := int(trailer[6])
+	refSize := int(trailer[7])
+	numObjects := binary.BigEndian.Uint64(trailer[8:])
+	top := binary.BigEndian.Uint64(trailer[16:])
+	tableOffset := binary.BigEndian.Uint64(trailer[24:])
+	if offsetSize < 1 || offsetSize > 8 || refSize < 1 || refSize > 8 {
+		return nil, errors.New("invalid binary plist trailer")
+	}
+	if numObjects == 0 || top >= numObjects || tableOffset >= uint64(len(b)-32) || numObjects > (uint64(len(b)-32)-tableOffset)/uint64(offsetSize) {
+		return nil, errors.New("invalid binary plist trailer")
+	}
+
+	p := &binaryPlist{b: b[:len(b)-32], refSize: refSize}
+	for i := uint64(0); i < numObjects; i++ {
+		start := tableOffset + i*uint64(offsetSize)
+		offset := plistUint(b[start : start+uint64(offsetSize)])
+		if offset < 8 || offset >= tableOffset {
+			return nil, fmt.Errorf("invalid offset of object %d", i)
+		}
+		p.offsets = append(p.offsets, offset)
+	}
+	return p.object(top)
+}
+
+// plistUint returns the big-endian unsigned integer of up to 8 bytes.
+func plistUint(b []byte) uint64 {
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n
+}
+
+// bytes returns the n bytes at the offset.
+func (p *binaryPlist) bytes(offset, n uint64) ([]byte, error) {
+	if offset > uint64(len(p.b)) || n > uint64(len(p.b))-offset {
+		return nil, fmt.Errorf("object at offset %d is truncated", offset)
+	}
+	return p.b[offset : offset+n], nil
+}
+
+func (p *binaryPlist) object(ref uint64) (any, error) {
+	if ref >= uint64(len(p.offsets)) {
+		return nil, fmt.Errorf("invalid object reference %d", ref)
+	}
+	if slices.Contains(p.decoding, ref) {
+		return nil, fmt.Errorf("object %d references itself", ref)
+	}
+	p.decoding = append(p.decoding, ref)
+	defer func() { p.decoding = p.decoding[:len(p.decoding)-1] }()
+
+	offset := p.offsets[ref]
+	marker := p.b[offset]
+	kind, info := marker>>4, uint64(marker&0x0f)
+	offset++
+	switch kind {
+	case 0x0:
+		switch info {
+		case 0x0:
+			return nil, nil
+		case 0x8:
+			return false, nil
+		case 0x9:
+			return true, nil
+		}
+	case 0x1:
+		// integers of 16 bytes are 128-bit, whose low 8 bytes are kept
+		n := uint64(1) << info
+		b, err := p.bytes(offset, n)
+		if err != nil || n > 16 {
+			return nil, fmt.Errorf("invalid integer at offset %d", offset-1)
+		}
+		b = b[max(0, len(b)-8):]
+		if n >= 8 {
+			return int(int64(plistUint(b))), nil
+		}
+		return int(plistUint(b)), nil
+	case 0x2:
+		b, err := p.bytes(offset, uint64(1)<<info)
+		if err != nil {
+			return nil, err
+		}
+		switch info {
+		case 2:
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+		case 3:
+			return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+		}
+	case 0x3:
+		b, err := p.bytes(offset, 8)
+		if err != nil || info != 3 {
+			return nil, fmt.Errorf("invalid date at offset %d", offset-1)
+		}
+		seconds := math.Float64frombits(binary.BigEndian.Uint64(b))
+		return plistEpoch.Add(time.Duration(seconds * float64(time.Second))), nil
+	case 0x4, 0x5, 0x6:
+		n, offset, err := p.count(info, offset)
+		if err != nil {
+			return nil, err
+		}
+		size := n
+		if kind == 0x6 {
+			size *= 2
+		}
+		b, err := p.bytes(offset, size)
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case 0x4:
+			return slices.Clone(b), nil
+		case 0x5:
+			return string(b), nil
+		}
+		units := make([]uint16, n)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(b[2*i:])
+		}
+		return string(utf16.Decode(units)), nil
+	case 0x8:
+		b, err := p.bytes(offset, info+1)
+		if err != nil {
+			return nil, err
+		}
+		return int(plistUint(b)), nil
+	case 0xa, 0xc:
+		n, offset, err := p.count(info, offset)
+		if err != nil {
+			return nil, err
+		}
+		refs, err := p.refs(offset, n)
+		if err != nil {
+			return nil, err
+		}
+		list := make([]any, 0, n)
+		for i, ref := range refs {
+			value, err := p.object(ref)
+			if err != nil {
+				return nil, fmt.Errorf("decode element (index: %d): %w", i, err)
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	case 0xd:
+		n, offset, err := p.count(info, offset)
+		if err != nil {
+			return nil, err
+		}
+		refs, err := p.refs(offset, 2*n)
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[string]any, n)
+		for i := uint64(0); i < n; i++ {
+			key, err := p.object(refs[i])
+			if err != nil {
+				return nil, err
+			}
+			s, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("dictionary key is not a string: %T", key)
+			}
+			value, err := p.object(refs[n+i])
+			if err != nil {
+				return nil, fmt.Errorf("decode value (key: %s): %w", s, err)
+			}
+			m[s] = value
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("invalid object marker 0x%02x at offset %d", marker, offset-1)
+}
+
+// count returns the count of elements of the info of a marker, which is followed by an
+// integer object if it's 0xf, and the offset after it.
+func (p *binaryPlist) count(info, offset uint64) (uint64, uint64, error) {
+	if info != 0xf {
+		return info, offset, nil
+	}
+	b, err := p.bytes(offset, 1)
+	if err != nil || b[0]>>4 != 0x1 || b[0]&0x0f > 3 {
+		return 0, 0, fmt.Errorf("invalid count at offset %d", offset)
+	}
+	n := uint64(1) << (b[0] & 0x0f)
+	b, err = p.bytes(offset+1, n)
+	if err != nil {
+		return 0, 0, err
+	}
+	return plistUint(b), offset + 1 + n, nil
+}
+
+// refs returns the n object references at the offset.
+func (p *binaryPlist) refs(offset, n uint64) ([]uint64, error) {
+	if n > uint64(len(p.b)) {
+		return nil, fmt.Errorf("object at offset %d is truncated", offset)
+	}
+	b, err := p.bytes(offset, n*uint64(p.refSize))
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]uint64, n)
+	for i := range refs {
+		refs[i] = plistUint(b[i*p.refSize : (i+1)*p.refSize])
+	}
+	return refs, nil
+}
+
+func (plistCodec) Encode(v map[string]any) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString(`<plist version="1.0">` + "\n")
+	err := encodePlist(&b, v, 0)
+	if err != nil {
+		return nil, err
+	}
+	b.WriteString("</plist>\n")
+	return b.Bytes(), nil
+}
+
+// encodePlist encodes the value as an element indented by indent.
+func encodePlist(b *bytes.Buffer, value any, indent int) error {
+	prefix := strings.Repeat("\t", indent)
+	switch value := value.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		b.WriteString(prefix + "<dict>\n")
+		for _, key := range keys {
+			b.WriteString(prefix + "\t<key>")
+			_ = xml.EscapeText(b, []byte(key))
+			b.WriteString("</key>\n")
+			err := encodePlist(b, value[key], indent+1)
+			if err != nil {
+				return fmt.Errorf("encode value (key: %s): %w", key, err)
+			}
+		}
+		b.WriteString(prefix + "</dict>\n")
+		return nil
+	case []any:
+		b.WriteString(prefix + "<array>\n")
+		for _, elem := range value {
+			err := encodePlist(b, elem, indent+1)
+			if err != nil {
+				return err
+			}
+		}
+		b.WriteString(prefix + "</array>\n")
+		return nil
+	case bool:
+		fmt.Fprintf(b, "%s<%t/>\n", prefix, value)
+		return nil
+	case string:
+		b.WriteString(prefix + "<string>")
+		_ = xml.EscapeText(b, []byte(value))
+		b.WriteString("</string>\n")
+		return nil
+	case float32, float64:
+		fmt.Fprintf(b, "%s<real>%s</real>\n", prefix, strconv.FormatFloat(cast.ToFloat64(value), 'g', -1, 64))
+		return nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		fmt.Fprintf(b, "%s<integer>%v</integer>\n", prefix, value)
+		return nil
+	case time.Time:
+		fmt.Fprintf(b, "%s<date>%s</date>\n", prefix, value.UTC().Format(time.RFC3339))
+		return nil
+	case []byte:
+		fmt.Fprintf(b, "%s<data>%s</data>\n", prefix, base64.StdEncoding.EncodeToString(value))
+		return nil
+	case nil:
+		return errors.New("property lists have no null values")
+	}
+	return fmt.Errorf("unsupported type %T", value)
+}
@@ -0,0 +1,250 @@
+package hydra
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// binaryPlistOf returns a binary property list of the encoded objects, whose references are
+// of one byte, with the first object as the top-level object.
+func binaryPlistOf(objects ...[]byte) []byte {
+	b := []byte("bplist00")
+	var offsets []byte
+	for _, object := range objects {
+		offsets = append(offsets, byte(len(b)))
+		b = append(b, object...)
+	}
+	tableOffset := len(b)
+	b = append(b, offsets...)
+
+	trailer := make([]byte, 32)
+	trailer[6], trailer[7] = 1, 1
+	binary.BigEndian.PutUint64(trailer[8:], uint64(len(objects)))
+	binary.BigEndian.PutUint64(trailer[24:], uint64(tableOffset))
+	return append(b, trailer...)
+}
+
+func TestPlistCodecDecode(t *testing.T) {
+	date := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	seconds := make([]byte, 8)
+	binary.BigEndian.PutUint64(seconds, math.Float64bits(date.Sub(plistEpoch).Seconds()))
+	ratio := make([]byte, 8)
+	binary.BigEndian.PutUint64(ratio, math.Float64bits(0.5))
+
+	tests := []struct {
+		name string
+		in   string
+		want map[string]any
+	}{
+		{
+			name: "xml",
+			in: `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>name</key>
+	<string>app &amp; co</string>
+	<key>server</key>
+	<dict>
+		<key>port</key>
+		<integer>8080</integer>
+		<key>hosts</key>
+		<array>
+			<string>a</string>
+			<string>b</string>
+		</array>
+	</dict>
+	<key>debug</key>
+	<true/>
+	<key>verbose</key>
+	<false/>
+	<key>ratio</key>
+	<real>0.5</real>
+	<key>hex</key>
+	<integer>0x10</integer>
+	<key>big</key>
+	<integer>18446744073709551615</integer>
+	<key>date</key>
+	<date>2024-03-01T12:00:00Z</date>
+	<key>data</key>
+	<data>
+		aGVs
+		bG8=
+	</data>
+	<key>empty</key>
+	<array/>
+</dict>
+</plist>
+`,
+			want: map[string]any{
+				"name":    "app & co",
+				"server":  map[string]any{"port": 8080, "hosts": []any{"a", "b"}},
+				"debug":   true,
+				"verbose": false,
+				"ratio":   0.5,
+				"hex":     16,
+				"big":     uint64(math.MaxUint64),
+				"date":    date,
+				"data":    []byte("hello"),
+				"empty":   []any{},
+			},
+		},
+		{
+			name: "binary",
+			in: string(binaryPlistOf(
+				[]byte{0xd7, 1, 2, 3, 4, 5, 6, 7, 8, 9, 13, 14, 15, 16, 17},
+				append([]byte{0x54}, "name"...),
+				append([]byte{0x55}, "hosts"...),
+				append([]byte{0x55}, "debug"...),
+				append([]byte{0x55}, "ratio"...),
+				append([]byte{0x54}, "date"...),
+				append([]byte{0x54}, "data"...),
+				append([]byte{0x53}, "uid"...),
+				append([]byte{0x53}, "app"...),
+				[]byte{0xa3, 10, 11, 12},
+				append([]byte{0x51}, "a"...),
+				[]byte{0x61, 0x00, 0xe9},
+				[]byte{0x11, 0x1f, 0x90},
+				[]byte{0x09},
+				append([]byte{0x23}, ratio...),
+				append([]byte{0x33}, seconds...),
+				append([]byte{0x42}, "hi"...),
+				[]byte{0x80, 0x05},
+			)),
+			want: map[string]any{
+				"name":  "app",
+				"hosts": []any{"a", "é", 8080},
+				"debug": true,
+				"ratio": 0.5,
+				"date":  date,
+				"data":  []byte("hi"),
+				"uid":   5,
+			},
+		},
+		{
+			name: "binary count of many elements",
+			in: string(binaryPlistOf(
+				[]byte{0xd1, 1, 2},
+				append([]byte{0x51}, "s"...),
+				append([]byte{0x5f, 0x10, 20}, strings.Repeat("x", 20)...),
+			)),
+			want: map[string]any{"s": strings.Repeat("x", 20)},
+		},
+		{
+			name: "empty",
+			in:   `<plist version="1.0"></plist>`,
+			want: map[string]any{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]any{}
+			err := plistCodec{}.Decode([]byte(tt.in), got)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlistCodecDecodeError(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+		line int
+	}{
+		{
+			name: "syntax",
+			in:   "<plist>\n<dict>\n<key>a</key>\n<string>b</dict>\n</plist>",
+			want: "decode value (key: a): XML syntax error on line 4: element <string> closed by </dict>",
+			line: 4,
+		},
+		{name: "no plist", in: "<?xml version=\"1.0\"?>\n", want: "no plist element"},
+		{name: "root", in: "<dict></dict>", want: "root element is dict, not plist"},
+		{name: "several values", in: "<plist><dict/><dict/></plist>", want: "plist element has several values"},
+		{name: "top-level array", in: "<plist><array/></plist>", want: "top-level value is not a dictionary: []interface {}"},
+		{name: "missing value", in: "<plist><dict><key>a</key></dict></plist>", want: "key a has no value"},
+		{name: "missing key", in: "<plist><dict><string>a</string></dict></plist>", want: "string element has no key"},
+		{
+			name: "nested",
+			in:   "<plist><dict><key>a</key><array><integer>1</integer><integer>x</integer></array></dict></plist>",
+			want: "decode value (key: a): decode element (index: 1): invalid integer: x",
+		},
+		{name: "unknown element", in: "<plist><dict><key>a</key><set/></dict></plist>", want: "decode value (key: a): unknown element: set"},
+		{name: "binary version", in: "bplist01" + strings.Repeat("\x00", 32), want: `unsupported binary plist version: "bplist01"`},
+		{name: "binary truncated", in: "bplist00\x08", want: "binary plist is truncated"},
+		{
+			name: "binary trailer",
+			in:   "bplist00" + strings.Repeat("\x00", 32),
+			want: "invalid binary plist trailer",
+		},
+		{
+			name: "binary self reference",
+			in:   string(binaryPlistOf([]byte{0xd1, 1, 2}, append([]byte{0x51}, "a"...), []byte{0xa1, 2})),
+			want: "decode value (key: a): decode element (index: 0): object 2 references itself",
+		},
+		{
+			name: "binary invalid reference",
+			in:   string(binaryPlistOf([]byte{0xd1, 1, 9}, append([]byte{0x51}, "a"...))),
+			want: "decode value (key: a): invalid object reference 9",
+		},
+		{
+			name: "binary key",
+			in:   string(binaryPlistOf([]byte{0xd1, 1, 1}, []byte{0x10, 1})),
+			want: "dictionary key is not a string: int",
+		},
+		{
+			name: "binary marker",
+			in:   string(binaryPlistOf([]byte{0xd1, 1, 2}, append([]byte{0x51}, "a"...), []byte{0x07})),
+			want: "decode value (key: a): invalid object marker 0x07 at offset 13",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := plistCodec{}.Decode([]byte(tt.in), map[string]any{})
+			if err == nil || err.Error() != tt.want {
+				t.Fatalf("Decode() error = %v, want %q", err, tt.want)
+			}
+			if line, _ := errorPosition(err, []byte(tt.in)); line != tt.line {
+				t.Errorf("line = %d, want %d", line, tt.line)
+			}
+		})
+	}
+}
+
+func TestPlistCodecRoundTrip(t *testing.T) {
+	in := map[string]any{
+		"name":   "<app> & \"co\"",
+		"server": map[string]any{"port": 8080, "hosts": []any{"a", "b"}, "empty": map[string]any{}},
+		"debug":  true,
+		"ratio":  0.5,
+		"date":   time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC),
+		"data":   []byte{0, 1, 2},
+		"list":   []any{},
+	}
+	b, err := plistCodec{}.Encode(in)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	got := map[string]any{}
+	err = plistCodec{}.Decode(b, got)
+	if err != nil {
+		t.Fatalf("Decode(%s) error = %v", b, err)
+	}
+	if !reflect.DeepEqual(got, in) {
+		t.Errorf("round trip = %#v, want %#v\n%s", got, in, b)
+	}
+
+	_, err = plistCodec{}.Encode(map[string]any{"a": map[string]any{"b": nil}})
+	if want := "encode value (key: a): encode value (key: b): property lists have no null values"; err == nil || err.Error() != want {
+		t.Errorf("Encode() error = %v, want %q", err, want)
+	}
+}
@@ -0,0 +1,125 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// fileState is the state of a polled file used to detect its changes.
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// isPolled reports whether changes of the path are detected by polling instead of the watcher.
+func (h *Hydra) isPolled(path string) bool {
+	h.mu.Lock()
+	unwatchable := slices.ContainsFunc(h.unwatchable, func(root string) bool {
+		return isUnder(path, root)
+	})
+	h.mu.Unlock()
+	if unwatchable {
+		return true
+	}
+
+	if h.options.pollInterval <= 0 {
+		return false
+	}
+	if len(h.options.pollPaths) == 0 {
+		return true
+	}
+
+	for _, root := range h.options.pollPaths {
+		if isUnder(path, root) {
+			return true
+		}
+	}
+	return false
+}
+
+// pollInterval returns the interval in which paths are polled, or 0 if nothing is polled.
+func (h *Hydra) pollInterval() time.Duration {
+	if h.options.pollInterval > 0 {
+		return h.options.pollInterval
+	}
+	if h.options.pollFallback {
+		return h.options.pollFallbackInterval
+	}
+	return 0
+}
+
+// pollRoots returns the paths whose changes are detected by polling.
+func (h *Hydra) pollRoots() []string {
+	h.mu.Lock()
+	unwatchable := slices.Clone(h.unwatchable)
+	h.mu.Unlock()
+
+	if h.options.pollInterval <= 0 {
+		return unwatchable
+	}
+	if len(h.options.pollPaths) == 0 {
+		return h.options.paths
+	}
+	return append(slices.Clone(h.options.pollPaths), unwatchable...)
+}
+
+// poll scans the polled paths and returns events for files that have been created, written
+// or removed since the last poll.
+func (h *Hydra) poll(ctx context.Context) ([]fsnotify.Event, error) {
+	current := make(map[string]fileState)
+	for _, root := range h.pollRoots() {
+		files, err := h.walkPath(ctx, root, nil)
+		if errors.Is(err, os.ErrNotExist) {
+			// path was removed, so are the files in it
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, path := range files {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				// file was removed while polling
+				continue
+			}
+			current[path] = fileState{size: info.Size(), modTime: info.ModTime()}
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var events []fsnotify.Event
+	for path, state := range current {
+		prev, ok := h.polled[path]
+		switch {
+		case !ok:
+			events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Create})
+		case prev != state:
+			events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Write})
+		}
+	}
+	for path := range h.polled {
+		if _, ok := current[path]; !ok {
+			events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Remove})
+		}
+	}
+
+	slices.SortFunc(events, func(a, b fsnotify.Event) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	h.polled = current
+	return events, nil
+}
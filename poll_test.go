@@ -0,0 +1,168 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestPolling(t *testing.T) {
+	dir := t.TempDir()
+	polled, watched := filepath.Join(dir, "polled"), filepath.Join(dir, "watched")
+	writeFile(t, filepath.Join(polled, "a.yaml"), "a: 1\n")
+	writeFile(t, filepath.Join(watched, "b.yaml"), "b: 1\n")
+
+	tests := []struct {
+		name    string
+		paths   []string
+		watched []string
+	}{
+		{name: "all paths"},
+		{name: "some paths", paths: []string{polled}, watched: []string{watched}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := New(WithPaths(polled, watched), WithPolling(20*time.Millisecond, tt.paths...), WithAutoReload())
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			changes := startNotify(t, h)
+
+			// polled paths aren't added to the watcher
+			if got := h.watcher.WatchList(); !slices.Equal(sorted(got), tt.watched) {
+				t.Errorf("WatchList() = %v, want %v", got, tt.watched)
+			}
+
+			steps := []struct {
+				name   string
+				change func(path string)
+				op     fsnotify.Op
+			}{
+				{name: "created", change: func(path string) { replaceFile(t, path, "c: 1\n") }, op: fsnotify.Create},
+				{name: "written", change: func(path string) { replaceFile(t, path, "c: 2\nd: 1\n") }, op: fsnotify.Write},
+				{
+					name: "removed",
+					change: func(path string) {
+						if err := os.Remove(path); err != nil {
+							t.Fatal(err)
+						}
+					},
+					op: fsnotify.Remove,
+				},
+			}
+			path := filepath.Join(polled, "c.yaml")
+			for _, step := range steps {
+				step.change(path)
+				c := receive(t, changes)
+				if c.Path != path || c.Op != step.op {
+					t.Fatalf("%s: change = %s %s, want %s %s", step.name, c.Op, c.Path, step.op, path)
+				}
+			}
+			if _, err := Get[int](h, "c"); !errors.Is(err, ErrKeyNotSet) {
+				t.Error("c is set after its file was removed")
+			}
+
+			// the watched path is still watched
+			replaceFile(t, filepath.Join(watched, "b.yaml"), "b: 2\n")
+			if c := receive(t, changes); c.Path != filepath.Join(watched, "b.yaml") {
+				t.Errorf("change = %s, want b.yaml", c.Path)
+			}
+			if got, _ := Get[int](h, "b"); got != 2 {
+				t.Errorf("b = %d, want 2", got)
+			}
+		})
+	}
+}
+
+func TestPollingUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.yaml"), "port: 8080\n")
+
+	h, err := New(WithPaths(dir), WithPolling(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	changes := startNotify(t, h)
+
+	// files are compared with their state on creation, so unchanged files aren't reported
+	quiet(t, changes, 100*time.Millisecond)
+}
+
+func TestPollingFallback(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "conf.d")
+	writeFile(t, filepath.Join(dir, "app.yaml"), "port: 8080\n")
+	writeFile(t, filepath.Join(sub, "db.yaml"), "db: local\n")
+
+	h, err := New(WithPaths(dir), WithPollingFallback(20*time.Millisecond), WithAutoReload())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// the limit of watches can't be reached in tests, so the directory is made unwatchable like
+	// by watch once adding it fails
+	if err := h.watcher.Remove(sub); err != nil {
+		t.Fatal(err)
+	}
+	h.mu.Lock()
+	h.unwatchable = append(h.unwatchable, sub)
+	h.mu.Unlock()
+	if _, err := h.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	changes := startNotify(t, h)
+
+	// only the unwatchable directory is polled, the rest is still watched
+	path := filepath.Join(sub, "db.yaml")
+	replaceFile(t, path, "db: remote\n")
+	if c := receive(t, changes); c.Path != path || c.Op != fsnotify.Write {
+		t.Fatalf("change = %s %s, want WRITE %s", c.Op, c.Path, path)
+	}
+	if got, _ := Get[string](h, "db"); got != "remote" {
+		t.Errorf("db = %s, want remote", got)
+	}
+	if got := h.watcher.WatchList(); !slices.Equal(got, []string{dir}) {
+		t.Errorf("WatchList() = %v, want %v", got, []string{dir})
+	}
+	if got := h.pollRoots(); !slices.Equal(got, []string{sub}) {
+		t.Errorf("pollRoots() = %v, want %v", got, []string{sub})
+	}
+
+	replaceFile(t, filepath.Join(dir, "app.yaml"), "port: 9090\n")
+	if c := receive(t, changes); c.Path != filepath.Join(dir, "app.yaml") {
+		t.Errorf("change = %s, want app.yaml", c.Path)
+	}
+}
+
+func TestWatchLimit(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: syscall.ENOSPC, want: true},
+		{err: fmt.Errorf("add watch: %w", syscall.EMFILE), want: true},
+		{err: syscall.EACCES, want: false},
+		{err: errors.New("no space left on device"), want: false},
+	}
+	for _, tt := range tests {
+		if got := isWatchLimit(tt.err); got != tt.want {
+			t.Errorf("isWatchLimit(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+
+	err := &WatchError{Path: "/etc/myapp", Polled: true, Err: syscall.ENOSPC}
+	if want := "watch path (path: /etc/myapp, polled instead): no space left on device"; err.Error() != want {
+		t.Errorf("Error() = %s, want %s", err, want)
+	}
+	if !errors.Is(err, syscall.ENOSPC) {
+		t.Error("WatchError doesn't wrap its cause")
+	}
+}
@@ -0,0 +1,206 @@
+package hydra
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Position is a position in a configuration file.
+type Position struct {
+	File string
+	// Line and Column start at 1, or are 0 if unknown.
+	Line   int
+	Column int
+}
+
+// String returns the position as "file:line:column", omitting an unknown line or column.
+func (p Position) String() string {
+	s := p.File
+	if p.Line > 0 {
+		s += ":" + strconv.Itoa(p.Line)
+		if p.Column > 0 {
+			s += ":" + strconv.Itoa(p.Column)
+		}
+	}
+	return s
+}
+
+// ParseError is returned when a configuration file fails to decode, with the position of the
+// error if the decoder reports it. On reloads, it's reported as the Err of a ReloadError and
+// the previous configuration is kept.
+type ParseError struct {
+	Position
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	var attrs []string
+	if e.File != "" {
+		attrs = append(attrs, "file: "+e.File)
+	}
+	if e.Line > 0 && !e.reportsLine() {
+		attrs = append(attrs, "line: "+strconv.Itoa(e.Line))
+		if e.Column > 0 {
+			attrs = append(attrs, "column: "+strconv.Itoa(e.Column))
+		}
+	}
+	if len(attrs) == 0 {
+		return fmt.Sprintf("decode config: %s", e.Err)
+	}
+	return fmt.Sprintf("decode config (%s): %s", strings.Join(attrs, ", "), e.Err)
+}
+
+// reportsLine reports whether the error of the decoder already reports the line, e.g.
+// "line 2, column 6: ..." of CUE or "app.jsonnet:2:5-6 ..." of Jsonnet, which isn't repeated.
+func (e *ParseError) reportsLine() bool {
+	msg := e.Err.Error()
+	if m := linePattern.FindStringSubmatch(msg); m != nil && m[1] == strconv.Itoa(e.Line) {
+		return true
+	}
+	return e.File != "" && strings.Contains(msg, fmt.Sprintf("%s:%d:", e.File, e.Line))
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// linePattern matches positions in errors of decoders, e.g. "yaml: line 3: ..." or
+// "line 3, column 5: ...".
+var linePattern = regexp.MustCompile(`\bline:? (\d+)(?:(?:, column:? |:)(\d+))?`)
+
+// errorPosition returns the line and column of the decoding error of the data, or zeros if the
+// decoder doesn't report them.
+func errorPosition(err error, data []byte) (int, int) {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return offsetPosition(data, syntaxErr.Offset)
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return offsetPosition(data, typeErr.Offset)
+	}
+	// e.g. errors of github.com/pelletier/go-toml/v2
+	var positioned interface{ Position() (int, int) }
+	if errors.As(err, &positioned) {
+		return positioned.Position()
+	}
+
+	m := linePattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0, 0
+	}
+	line, _ := strconv.Atoi(m[1])
+	column, _ := strconv.Atoi(m[2])
+	return line, column
+}
+
+// offsetPosition returns the line and column of the byte offset in the data.
+func offsetPosition(data []byte, offset int64) (int, int) {
+	offset = min(max(offset, 0), int64(len(data)))
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+// Position returns the position of the key, e.g. "server.port", in the configuration file that
+// set it, like Origin. Lines and columns are located in YAML and JSON files only.
+func (h *Hydra) Position(key string) Position {
+	h.mu.Lock()
+	origins, layers := maps.Clone(h.origins), maps.Clone(h.layers)
+	h.mu.Unlock()
+	// the namespace of a file is looked up under the lock
+	return h.locate(origins, layers, strings.ToLower(key))
+}
+
+// locate returns the position of the key in the configuration file that set it.
+func (h *Hydra) locate(origins map[string]string, layers map[string]*layer, key string) Position {
+	path := origin(origins, key)
+	p := Position{File: path}
+	l := layers[path]
+	if l == nil || l.raw == nil {
+		return p
+	}
+	switch h.format(path) {
+	case "yaml", "yml", "json":
+	default:
+		return p
+	}
+
+	// keys are placed under the key prefix and the namespace of the file
+	parts := keyParts(key)
+	for _, prefix := range append(h.keyPrefix(), h.namespace(path)...) {
+		if len(parts) == 0 || parts[0] != prefix {
+			return p
+		}
+		parts = parts[1:]
+	}
+
+	var doc yaml.Node
+	if yaml.Unmarshal(l.raw, &doc) != nil || len(doc.Content) == 0 {
+		return p
+	}
+	node := doc.Content[0]
+	for _, part := range parts {
+		node = childNode(node, part)
+		if node == nil {
+			return p
+		}
+	}
+	p.Line, p.Column = node.Line, node.Column
+	return p
+}
+
+// keyParts splits the key into its parts, e.g. "hosts[1].name" into "hosts", "[1]", "name".
+func keyParts(key string) []string {
+	var parts []string
+	for _, part := range strings.Split(key, ".") {
+		for part != "" {
+			i := strings.IndexByte(part[1:], '[') + 1
+			if i <= 0 {
+				break
+			}
+			parts = append(parts, part[:i])
+			part = part[i:]
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// childNode returns the key node of the mapping node by the key, matched case-insensitively,
+// or the element of the sequence node by the index part, e.g. "[1]".
+func childNode(node *yaml.Node, part string) *yaml.Node {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if strings.EqualFold(node.Content[i].Value, part) {
+				// the key is located, but nested keys are looked up in the value
+				key, value := *node.Content[i], node.Content[i+1]
+				key.Kind, key.Content, key.Alias = value.Kind, value.Content, value.Alias
+				return &key
+			}
+		}
+	case yaml.SequenceNode:
+		index, ok := strings.CutPrefix(part, "[")
+		if !ok {
+			return nil
+		}
+		i, err := strconv.Atoi(strings.TrimSuffix(index, "]"))
+		if err == nil && i >= 0 && i < len(node.Content) {
+			return node.Content[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package hydra
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseErrorError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *ParseError
+		want string
+	}{
+		{
+			name: "position",
+			err:  &ParseError{Position{File: "app.json", Line: 2, Column: 6}, errors.New("invalid character")},
+			want: "decode config (file: app.json, line: 2, column: 6): invalid character",
+		},
+		{
+			name: "line",
+			err:  &ParseError{Position{File: "app.ini", Line: 3}, errors.New("invalid key")},
+			want: "decode config (file: app.ini, line: 3): invalid key",
+		},
+		{
+			name: "no position",
+			err:  &ParseError{Position{File: "app.plist"}, errors.New("invalid plist")},
+			want: "decode config (file: app.plist): invalid plist",
+		},
+		{
+			name: "no file",
+			err:  &ParseError{Err: errors.New("invalid")},
+			want: "decode config: invalid",
+		},
+		{
+			name: "line in error",
+			err:  &ParseError{Position{File: "app.cue", Line: 2, Column: 6}, errors.New("evaluate: line 2, column 6: expected '}'")},
+			want: "decode config (file: app.cue): evaluate: line 2, column 6: expected '}'",
+		},
+		{
+			name: "other line in error",
+			err:  &ParseError{Position{File: "app.yaml", Line: 4}, errors.New("yaml: line 3: did not find expected key")},
+			want: "decode config (file: app.yaml, line: 4): yaml: line 3: did not find expected key",
+		},
+		{
+			name: "file position in error",
+			err:  &ParseError{Position{File: "app.jsonnet", Line: 2, Column: 5}, errors.New("render jsonnet: app.jsonnet:2:5-6 unexpected: \"}\"")},
+			want: "decode config (file: app.jsonnet): render jsonnet: app.jsonnet:2:5-6 unexpected: \"}\"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.want {
+				t.Errorf("Error() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		data   string
+		line   int
+		column int
+	}{
+		{name: "json syntax", file: "app.json", data: "{\n  \"a\": ,\n}", line: 2, column: 9},
+		{name: "yaml", file: "app.yaml", data: "a: 1\nb: [\n", line: 2},
+		{name: "toml", file: "app.toml", data: "a = 1\nb = \n", line: 2, column: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, tt.file)
+			writeFile(t, path, tt.data)
+			_, err := New(WithPaths(dir))
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("New() error = %v, want ParseError", err)
+			}
+			if parseErr.File != path || parseErr.Line != tt.line || parseErr.Column != tt.column {
+				t.Errorf("position = %s, want %s:%d:%d", parseErr.Position, path, tt.line, tt.column)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package hydra
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/spf13/cast"
+)
+
+// propertiesCodec decodes and encodes Java properties files. Keys are nested at their dots,
+// e.g. "server.port" is "port" of "server". Lines starting with "#" or "!" are comments, keys are
+// separated from values by "=", ":" or whitespace, lines ending with a backslash continue on the
+// next line, and escapes, e.g. `\u00e9`, are unescaped. Files are read as UTF-8.
+type propertiesCodec struct{}
+
+func (propertiesCodec) Decode(b []byte, v map[string]any) error {
+	b = bytes.TrimPrefix(b, []byte("\ufeff"))
+	lines := strings.Split(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		n := i + 1
+		line := strings.TrimLeft(lines[i], " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+
+		// an odd number of trailing backslashes continues the line
+		for continued(line) && i+1 < len(lines) {
+			i++
+			line = line[:len(line)-1] + strings.TrimLeft(lines[i], " \t\f")
+		}
+		if continued(line) {
+			// the last line doesn't continue
+			line = line[:len(line)-1]
+		}
+
+		key, value := splitProperty(line)
+		key, err := unescapeProperty(key)
+		if err != nil {
+			return fmt.Errorf("invalid key (line: %d): %w", n, err)
+		}
+		value, err = unescapeProperty(value)
+		if err != nil {
+			return fmt.Errorf("invalid value (line: %d, key: %s): %w", n, key, err)
+		}
+
+		// later keys replace values of earlier keys they're nested under, e.g. "log.level" of "log"
+		path := strings.Split(key, ".")
+		m := v
+		for _, part := range path[:len(path)-1] {
+			next, ok := m[part].(map[string]any)
+			if !ok {
+				next = make(map[string]any)
+				m[part] = next
+			}
+			m = next
+		}
+		m[path[len(path)-1]] = value
+	}
+	return nil
+}
+
+// continued reports whether the line ends with an unescaped backslash.
+func continued(line string) bool {
+	n := len(line) - len(strings.TrimRight(line, `\`))
+	return n%2 == 1
+}
+
+// splitProperty splits the line at the first unescaped "=", ":" or whitespace into its key and
+// value, e.g. "a" and "b" of "a = b".
+func splitProperty(line string) (string, string) {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '=', ':', ' ', '\t', '\f':
+			// separators may be surrounded by whitespace
+			key, value := line[:i], strings.TrimLeft(line[i:], " \t\f")
+			if value != "" && (value[0] == '=' || value[0] == ':') {
+				value = value[1:]
+			}
+			return key, strings.TrimLeft(value, " \t\f")
+		}
+	}
+	return line, ""
+}
+
+// unescapeProperty returns the key or value without its escapes, e.g. a tab for `\t`.
+func unescapeProperty(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			r, ok := hexRune(s, i+1)
+			if !ok {
+				return "", fmt.Errorf("malformed \\uxxxx escape: %s", s[i-1:min(i+5, len(s))])
+			}
+			i += 4
+			if utf16.IsSurrogate(r) && strings.HasPrefix(s[i+1:], `\u`) {
+				// characters outside the basic multilingual plane are escaped as surrogate pairs
+				if low, ok := hexRune(s, i+3); ok {
+					if pair := utf16.DecodeRune(r, low); pair != utf8.RuneError {
+						r = pair
+						i += 6
+					}
+				}
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// hexRune returns the character of the 4 hexadecimal digits at the index of the string.
+func hexRune(s string, i int) (rune, bool) {
+	if i+4 > len(s) {
+		return 0, false
+	}
+	r, err := strconv.ParseUint(s[i:i+4], 16, 16)
+	return rune(r), err == nil
+}
+
+func (propertiesCodec) Encode(v map[string]any) ([]byte, error) {
+	flat := make(map[string]any)
+	var visit func(prefix string, m map[string]any)
+	visit = func(prefix string, m map[string]any) {
+		for key, value := range m {
+			if sub, ok := value.(map[string]any); ok {
+				visit(prefix+key+".", sub)
+				continue
+			}
+			flat[prefix+key] = value
+		}
+	}
+	visit("", v)
+
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var b bytes.Buffer
+	for _, key := range keys {
+		value, err := cast.ToStringE(flat[key])
+		if err != nil {
+			return nil, fmt.Errorf("encode key (key: %s): %w", key, err)
+		}
+		fmt.Fprintf(&b, "%s = %s\n", escapeProperty(key, true), escapeProperty(value, false))
+	}
+	return b.Bytes(), nil
+}
+
+// escapeProperty returns the key or value with the characters escaped that would otherwise be
+// read differently, e.g. separators of keys and leading whitespace of values.
+func escapeProperty(s string, key bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case key && (r == '=' || r == ':' || r == ' '),
+			(key || i == 0) && (r == '#' || r == '!'),
+			!key && i == 0 && r == ' ':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,108 @@
+package hydra
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPropertiesCodecDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]any
+	}{
+		{
+			name: "separators",
+			in:   "a=1\nb: 2\nc 3\nd  =  4\ne\n",
+			want: map[string]any{"a": "1", "b": "2", "c": "3", "d": "4", "e": ""},
+		},
+		{
+			name: "nested keys",
+			in:   "server.host = localhost\nserver.port = 8080\n",
+			want: map[string]any{"server": map[string]any{"host": "localhost", "port": "8080"}},
+		},
+		{
+			name: "comments and blank lines",
+			in:   "\ufeff# comment\n! comment\n\n  a = 1\r\n",
+			want: map[string]any{"a": "1"},
+		},
+		{
+			name: "continued lines",
+			in:   "list = a, \\\n       b, \\\n       c\nlast = x\\",
+			want: map[string]any{"list": "a, b, c", "last": "x"},
+		},
+		{
+			name: "escaped backslash",
+			in:   "path = C:\\\\dir\\\\\nnext = 1\n",
+			want: map[string]any{"path": `C:\dir\`, "next": "1"},
+		},
+		{
+			name: "escapes",
+			in:   "a\\=b = c\\:d\nmsg = caf\\u00e9\\tok\nemoji = \\ud83d\\ude00\n",
+			want: map[string]any{"a=b": "c:d", "msg": "café\tok", "emoji": "😀"},
+		},
+		{
+			name: "later nested keys",
+			in:   "log = debug\nlog.level = info\n",
+			want: map[string]any{"log": map[string]any{"level": "info"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]any{}
+			err := propertiesCodec{}.Decode([]byte(tt.in), got)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPropertiesCodecDecodeError(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+		line int
+	}{
+		{name: "key", in: "a = 1\nb\\u12 = 2\n", want: "invalid key (line: 2)", line: 2},
+		{name: "value", in: "a = 1\n\nb = \\uzzzz\n", want: "invalid value (line: 3, key: b)", line: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := propertiesCodec{}.Decode([]byte(tt.in), map[string]any{})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Decode() error = %v, want %q", err, tt.want)
+			}
+			if line, _ := errorPosition(err, []byte(tt.in)); line != tt.line {
+				t.Errorf("line of %q = %d, want %d", err, line, tt.line)
+			}
+		})
+	}
+}
+
+func TestPropertiesCodecRoundTrip(t *testing.T) {
+	in := map[string]any{
+		"server": map[string]any{"host": "localhost", "port": "8080"},
+		"a=b":    " leading space",
+		"#key":   "#value",
+		"multi":  "line\nbreak\ttab",
+		"path":   `C:\dir`,
+	}
+	b, err := propertiesCodec{}.Encode(in)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	got := map[string]any{}
+	err = propertiesCodec{}.Decode(b, got)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, in) {
+		t.Errorf("Decode(Encode()) = %v, want %v\n%s", got, in, b)
+	}
+}
@@ -0,0 +1,98 @@
+package hydra
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// rateLimiter limits the number of reloads per time window. Changes exceeding the limit are
+// held back and released at once when the window allows another reload.
+type rateLimiter struct {
+	limit   int
+	window  time.Duration
+	reloads []time.Time
+	timer   *time.Timer
+	held    map[string]fsnotify.Op
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	t := time.NewTimer(window)
+	t.Stop()
+
+	return &rateLimiter{
+		limit:  limit,
+		window: window,
+		timer:  t,
+		held:   make(map[string]fsnotify.Op),
+	}
+}
+
+// C returns the channel that is signaled when held back changes may be reloaded.
+func (l *rateLimiter) C() <-chan time.Time {
+	return l.timer.C
+}
+
+// allow reports whether a reload may happen now and records it if so. Reloads aren't allowed
+// while there are held back changes, so they aren't overtaken.
+func (l *rateLimiter) allow() bool {
+	if len(l.held) > 0 {
+		return false
+	}
+
+	l.prune()
+	if len(l.reloads) >= l.limit {
+		return false
+	}
+
+	l.reloads = append(l.reloads, time.Now())
+	return true
+}
+
+// hold holds back the change until the window allows another reload.
+func (l *rateLimiter) hold(ev fsnotify.Event) {
+	if len(l.held) == 0 {
+		l.timer.Reset(time.Until(l.reloads[0].Add(l.window)))
+	}
+	l.held[ev.Name] |= ev.Op
+}
+
+// release returns the held back changes and records their reload. The timer may fire before
+// the window allows a reload, in which case it's rearmed and nothing is returned.
+func (l *rateLimiter) release() []fsnotify.Event {
+	if len(l.held) == 0 {
+		return nil
+	}
+
+	l.prune()
+	if len(l.reloads) >= l.limit {
+		l.timer.Reset(time.Until(l.reloads[0].Add(l.window)))
+		return nil
+	}
+	l.reloads = append(l.reloads, time.Now())
+
+	events := make([]fsnotify.Event, 0, len(l.held))
+	for name, op := range l.held {
+		events = append(events, fsnotify.Event{Name: name, Op: op})
+	}
+	clear(l.held)
+
+	slices.SortFunc(events, func(a, b fsnotify.Event) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return events
+}
+
+// prune forgets reloads which happened before the current window.
+func (l *rateLimiter) prune() {
+	start := time.Now().Add(-l.window)
+	l.reloads = slices.DeleteFunc(l.reloads, func(t time.Time) bool {
+		return !t.After(start)
+	})
+}
+
+func (l *rateLimiter) stop() {
+	l.timer.Stop()
+}
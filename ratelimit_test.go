@@ -0,0 +1,65 @@
+package hydra
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMaxReloadRate(t *testing.T) {
+	const window = 300 * time.Millisecond
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml")
+	writeFile(t, a, "a: 0\n")
+	writeFile(t, b, "b: 0\n")
+	h, err := New(WithPaths(dir), WithAutoReload(), WithMaxReloadRate(1, window))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	changes := startNotify(t, h)
+
+	// the first change is reloaded at once
+	replaceFile(t, a, "a: 1\n")
+	if c := receive(t, changes); c.Path != a {
+		t.Fatalf("path = %s, want %s", c.Path, a)
+	}
+
+	// changes beyond the limit are held back until the window allows a reload
+	started := time.Now()
+	for i := 2; i <= 4; i++ {
+		replaceFile(t, a, "a: "+strconv.Itoa(i)+"\n")
+		time.Sleep(10 * time.Millisecond)
+	}
+	c := receive(t, changes)
+	if elapsed := time.Since(started); elapsed < window/2 {
+		t.Errorf("held back change notified after %v, want about %v", elapsed, window)
+	}
+	if c.Path != a || c.Modified["a"].New != 4 {
+		t.Errorf("change = %+v, want a changed to 4", c)
+	}
+	quiet(t, changes, window+100*time.Millisecond)
+
+	// held back changes of multiple files are collapsed into a single reload, and none is lost
+	replaceFile(t, a, "a: 5\n")
+	receive(t, changes)
+	replaceFile(t, a, "a: 6\n")
+	replaceFile(t, b, "b: 1\n")
+	c = receive(t, changes)
+	if c.Modified["a"].New != 6 || c.Modified["b"].New != 1 {
+		t.Errorf("modified = %v, want a changed to 6 and b to 1", c.Modified)
+	}
+	quiet(t, changes, window+100*time.Millisecond)
+}
+
+// replaceFile atomically replaces the file by renaming a new one over it, so it's never read
+// half written.
+func replaceFile(t *testing.T, path, data string) {
+	t.Helper()
+	tmp := path + ".tmp"
+	writeFile(t, tmp, data)
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,284 @@
+package hydra
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// RedisConfig configures a source of configuration documents stored as keys of Redis, see
+// WithRedis.
+type RedisConfig struct {
+	// Address of Redis, e.g. "localhost:6379". Defaults to "localhost:6379".
+	Address string
+	// Username and Password authenticate the connections, if set.
+	Username string
+	Password string
+	// DB is the number of the database the keys are stored in.
+	DB int
+	// TLS configures TLS connections, if set.
+	TLS *tls.Config
+	// Keys are the keys of the documents. A string holds a document whose format is determined
+	// by the extension of the key, e.g. "myapp:config.yaml", and the fields of a hash are placed
+	// as keys of a document, e.g. "myapp:settings".
+	Keys []string
+}
+
+// redisSource provides the configuration documents stored as keys of Redis.
+type redisSource struct {
+	config RedisConfig
+}
+
+func (s *redisSource) load(ctx context.Context, want func(rel string) bool) ([]document, error) {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var docs []document
+	for _, key := range s.config.Keys {
+		typ, err := conn.do("TYPE", key)
+		if err != nil {
+			return nil, fmt.Errorf("get type (key: %s): %w", key, err)
+		}
+
+		var doc document
+		switch typ {
+		case "none":
+			// the key doesn't exist
+			continue
+		case "string":
+			v, err := conn.do("GET", key)
+			if err != nil {
+				return nil, fmt.Errorf("get key (key: %s): %w", key, err)
+			}
+			b, _ := v.(string)
+			doc = document{name: "redis:" + key, rel: key, data: []byte(b)}
+		case "hash":
+			v, err := conn.do("HGETALL", key)
+			if err != nil {
+				return nil, fmt.Errorf("get hash (key: %s): %w", key, err)
+			}
+			fields, _ := v.([]any)
+			m := make(map[string]string, len(fields)/2)
+			for i := 0; i+1 < len(fields); i += 2 {
+				field, _ := fields[i].(string)
+				m[field], _ = fields[i+1].(string)
+			}
+			b, err := json.Marshal(m)
+			if err != nil {
+				return nil, fmt.Errorf("encode hash (key: %s): %w", key, err)
+			}
+			doc = document{name: "redis:" + key, rel: key + ".json", data: b}
+		default:
+			return nil, fmt.Errorf("unsupported type (key: %s): %s", key, typ)
+		}
+
+		if !want(doc.rel) {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// watch subscribes to the keyspace notifications of the keys, which are published if enabled by
+// the notify-keyspace-events setting of Redis, e.g. "KA" or "K$hgx". ErrWatchUnsupported is
+// returned if the setting doesn't enable them.
+func (s *redisSource) watch(ctx context.Context, changed func()) error {
+	if len(s.config.Keys) == 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	// CONFIG may be disabled, e.g. by managed services, in which case notifications are
+	// assumed to be enabled
+	if v, err := conn.do("CONFIG", "GET", "notify-keyspace-events"); err == nil {
+		if reply, _ := v.([]any); len(reply) == 2 {
+			flags, _ := reply[1].(string)
+			if !redisKeyspaceEvents(flags) {
+				return fmt.Errorf("%w: keyspace notifications disabled (notify-keyspace-events: %q)", ErrWatchUnsupported, flags)
+			}
+		}
+	} else if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	args := []string{"SUBSCRIBE"}
+	for _, key := range s.config.Keys {
+		args = append(args, fmt.Sprintf("__keyspace@%d__:%s", s.config.DB, key))
+	}
+	err = conn.send(args...)
+	if err != nil {
+		return fmt.Errorf("subscribe to notifications: %w", err)
+	}
+
+	subscribed := 0
+	for {
+		v, err := conn.read()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("read notification: %w", err)
+		}
+
+		msg, _ := v.([]any)
+		if len(msg) == 0 {
+			continue
+		}
+		switch kind, _ := msg[0].(string); kind {
+		case "subscribe":
+			subscribed++
+			if subscribed == len(s.config.Keys) {
+				// changes made before the subscription are caught up
+				changed()
+			}
+		case "message":
+			changed()
+		}
+	}
+}
+
+// redisKeyspaceEvents returns whether the flags of notify-keyspace-events enable the keyspace
+// notifications of changes to strings and hashes and of deleted and expired keys.
+func redisKeyspaceEvents(flags string) bool {
+	if !strings.Contains(flags, "K") {
+		return false
+	}
+	return strings.Contains(flags, "A") ||
+		(strings.Contains(flags, "$") && strings.Contains(flags, "h") && strings.Contains(flags, "g") && strings.Contains(flags, "x"))
+}
+
+// dial connects to Redis, authenticates and selects the database.
+func (s *redisSource) dial(ctx context.Context) (*redisConn, error) {
+	address := s.config.Address
+	if address == "" {
+		address = "localhost:6379"
+	}
+
+	var conn net.Conn
+	var err error
+	if s.config.TLS != nil {
+		d := &tls.Dialer{Config: s.config.TLS}
+		conn, err = d.DialContext(ctx, "tcp", address)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connect (address: %s): %w", address, err)
+	}
+
+	c := &redisConn{Conn: conn, r: bufio.NewReader(conn)}
+	if s.config.Password != "" {
+		args := []string{"AUTH", s.config.Password}
+		if s.config.Username != "" {
+			args = []string{"AUTH", s.config.Username, s.config.Password}
+		}
+		_, err := c.do(args...)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("authenticate: %w", err)
+		}
+	}
+	if s.config.DB != 0 {
+		_, err := c.do("SELECT", strconv.Itoa(s.config.DB))
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("select database (db: %d): %w", s.config.DB, err)
+		}
+	}
+	return c, nil
+}
+
+// redisConn is a connection speaking the RESP protocol of Redis.
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// do sends the command and returns its reply.
+func (c *redisConn) do(args ...string) (any, error) {
+	err := c.send(args...)
+	if err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+// send sends the command as an array of bulk strings.
+func (c *redisConn) send(args ...string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := io.WriteString(c.Conn, b.String())
+	return err
+}
+
+// read reads a reply, which is a string, an int64, nil or a slice of replies. Error replies are
+// returned as errors.
+func (c *redisConn) read() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, errors.New(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		b := make([]byte, n+2)
+		_, err = io.ReadFull(c.r, b)
+		if err != nil {
+			return nil, err
+		}
+		return string(b[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		replies := make([]any, n)
+		for i := range replies {
+			replies[i], err = c.read()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return replies, nil
+	default:
+		return nil, fmt.Errorf("unexpected reply: %q", line)
+	}
+}
@@ -0,0 +1,255 @@
+package hydra
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// redisTestServer serves the commands of Redis used by redisSource from its keys, which are
+// strings or hashes, publishing keyspace notifications as the keys are set.
+type redisTestServer struct {
+	password string
+	// events is the notify-keyspace-events setting, the CONFIG command is disabled if nil
+	events *string
+
+	mu          sync.Mutex
+	keys        map[string]any
+	subscribers []chan string
+}
+
+// newRedisTestServer starts the server and returns the config of a source reading the keys.
+func newRedisTestServer(t *testing.T, s *redisTestServer, keys ...string) RedisConfig {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return RedisConfig{Address: lis.Addr().String(), Password: s.password, Keys: keys}
+}
+
+// set sets the key to a string or a hash and notifies the subscribers.
+func (s *redisTestServer) set(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys == nil {
+		s.keys = make(map[string]any)
+	}
+	s.keys[key] = value
+	for _, ch := range s.subscribers {
+		ch <- "__keyspace@0__:" + key
+	}
+}
+
+func (s *redisTestServer) serve(c net.Conn) {
+	conn := &redisConn{Conn: c, r: bufio.NewReader(c)}
+	defer conn.Close()
+	authenticated := s.password == ""
+	for {
+		v, err := conn.read()
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range v.([]any) {
+			args = append(args, arg.(string))
+		}
+
+		cmd := strings.ToUpper(args[0])
+		if !authenticated && cmd != "AUTH" {
+			fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+		switch cmd {
+		case "AUTH":
+			if args[len(args)-1] != s.password {
+				fmt.Fprint(conn, "-WRONGPASS invalid password\r\n")
+				continue
+			}
+			authenticated = true
+			fmt.Fprint(conn, "+OK\r\n")
+		case "TYPE":
+			s.mu.Lock()
+			value := s.keys[args[1]]
+			s.mu.Unlock()
+			switch value.(type) {
+			case string:
+				fmt.Fprint(conn, "+string\r\n")
+			case map[string]string:
+				fmt.Fprint(conn, "+hash\r\n")
+			default:
+				fmt.Fprint(conn, "+none\r\n")
+			}
+		case "GET":
+			s.mu.Lock()
+			value, _ := s.keys[args[1]].(string)
+			s.mu.Unlock()
+			fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(value), value)
+		case "HGETALL":
+			s.mu.Lock()
+			var fields []string
+			for field, value := range s.keys[args[1]].(map[string]string) {
+				fields = append(fields, field, value)
+			}
+			s.mu.Unlock()
+			_ = conn.send(fields...)
+		case "CONFIG":
+			if s.events == nil {
+				fmt.Fprint(conn, "-ERR unknown command 'CONFIG'\r\n")
+				continue
+			}
+			_ = conn.send(args[2], *s.events)
+		case "SUBSCRIBE":
+			ch := make(chan string, 16)
+			s.mu.Lock()
+			s.subscribers = append(s.subscribers, ch)
+			s.mu.Unlock()
+			for i, channel := range args[1:] {
+				fmt.Fprintf(conn, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:%d\r\n", len(channel), channel, i+1)
+			}
+			for channel := range ch {
+				if conn.send("message", channel, "set") != nil {
+					return
+				}
+			}
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+	}
+}
+
+func TestRedisSourceLoad(t *testing.T) {
+	server := &redisTestServer{password: "secret"}
+	server.set("myapp:config.yaml", "port: 8080\n")
+	server.set("myapp:settings", map[string]string{"debug": "true"})
+	c := newRedisTestServer(t, server, "myapp:config.yaml", "myapp:settings", "myapp:missing.yaml")
+
+	s := &redisSource{config: c}
+	docs, err := s.load(context.Background(), func(string) bool { return true })
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	if len(docs) != 2 {
+		t.Fatalf("load() = %+v, want 2 documents", docs)
+	}
+	if docs[0].name != "redis:myapp:config.yaml" || docs[0].rel != "myapp:config.yaml" || string(docs[0].data) != "port: 8080\n" {
+		t.Errorf("string = %+v", docs[0])
+	}
+	if docs[1].name != "redis:myapp:settings" || docs[1].rel != "myapp:settings.json" || string(docs[1].data) != `{"debug":"true"}` {
+		t.Errorf("hash = %+v", docs[1])
+	}
+
+	docs, err = s.load(context.Background(), func(rel string) bool { return strings.HasSuffix(rel, ".yaml") })
+	if err != nil || len(docs) != 1 {
+		t.Errorf("load() filtered = %+v, %v, want the string", docs, err)
+	}
+
+	c.Password = "wrong"
+	s = &redisSource{config: c}
+	_, err = s.load(context.Background(), func(string) bool { return true })
+	if err == nil || !strings.Contains(err.Error(), "authenticate: WRONGPASS") {
+		t.Errorf("load() error = %v, want WRONGPASS", err)
+	}
+}
+
+func TestRedisSourceWatch(t *testing.T) {
+	enabled, disabled := "xKhg$", ""
+	tests := []struct {
+		name   string
+		events *string
+	}{
+		{name: "enabled", events: &enabled},
+		// the setting can't be read, so notifications are subscribed to
+		{name: "config disabled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &redisTestServer{events: tt.events}
+			server.set("config.yaml", "port: 8080\n")
+			c := newRedisTestServer(t, server, "config.yaml")
+
+			h, err := New(WithRedis(c), WithAutoReload())
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			start(t, h)
+
+			// the subscription catches up changes made before it
+			eventually(t, "subscribed", func() bool {
+				server.mu.Lock()
+				defer server.mu.Unlock()
+				return len(server.subscribers) == 1
+			})
+			server.set("config.yaml", "port: 9090\n")
+			eventually(t, "port 9090", func() bool {
+				got, _ := Get[int](h, "port")
+				return got == 9090
+			})
+		})
+	}
+
+	t.Run("notifications disabled", func(t *testing.T) {
+		server := &redisTestServer{events: &disabled}
+		c := newRedisTestServer(t, server, "config.yaml")
+		s := &redisSource{config: c}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err := s.watch(ctx, func() {})
+		if !errors.Is(err, ErrWatchUnsupported) || !strings.Contains(err.Error(), "keyspace notifications disabled") {
+			t.Fatalf("watch() error = %v, want ErrWatchUnsupported", err)
+		}
+	})
+
+	t.Run("polled", func(t *testing.T) {
+		server := &redisTestServer{events: &disabled}
+		server.set("config.yaml", "port: 8080\n")
+		c := newRedisTestServer(t, server, "config.yaml")
+
+		h, err := New(WithRedis(c, PollEvery(10*time.Millisecond)), WithAutoReload())
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		start(t, h)
+
+		server.set("config.yaml", "port: 9090\n")
+		eventually(t, "port 9090", func() bool {
+			got, _ := Get[int](h, "port")
+			return got == 9090
+		})
+	})
+}
+
+func TestRedisKeyspaceEvents(t *testing.T) {
+	tests := []struct {
+		flags string
+		want  bool
+	}{
+		{flags: "", want: false},
+		{flags: "KA", want: true},
+		{flags: "AKE", want: true},
+		{flags: "xKhg$", want: true},
+		{flags: "K$", want: false},
+		{flags: "EA", want: false},
+	}
+	for _, tt := range tests {
+		if got := redisKeyspaceEvents(tt.flags); got != tt.want {
+			t.Errorf("redisKeyspaceEvents(%q) = %v, want %v", tt.flags, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package hydra
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// reference is an invariant set by WithReference.
+type reference struct {
+	key    string
+	target string
+}
+
+// ReferenceViolation is a value of a key that doesn't reference any entry of the target set by
+// WithReference.
+type ReferenceViolation struct {
+	// Key is the dotted key of the value, e.g. "routes.api.upstream".
+	Key    string
+	Value  any
+	Target string
+	// Source is the position in the configuration file that set the key, e.g.
+	// "routes.yaml:3:15", and TargetSources are the positions of the entries of the target.
+	Source        string
+	TargetSources []string
+}
+
+func (v ReferenceViolation) String() string {
+	msg := fmt.Sprintf("%s (file: %s): %v isn't in %s", v.Key, v.Source, v.Value, v.Target)
+	if len(v.TargetSources) > 0 {
+		msg += fmt.Sprintf(" (files: %s)", strings.Join(v.TargetSources, ", "))
+	}
+	return msg
+}
+
+// ReferenceError reports the values violating the references set by WithReference.
+type ReferenceError struct {
+	Violations []ReferenceViolation
+}
+
+func (e *ReferenceError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.String()
+	}
+	return "config has dangling references: " + strings.Join(msgs, "; ")
+}
+
+// checkReferences returns a ReferenceError if values of the keys of the references aren't
+// entries of their targets.
+func checkReferences(refs []reference, settings map[string]any, locate func(key string) string) error {
+	var violations []ReferenceViolation
+	for _, ref := range refs {
+		targets := make(map[string]bool)
+		var sources []string
+		name, keys := strings.CutSuffix(ref.target, ".*")
+		if keys {
+			// the keys of the target are referenced
+			for _, m := range matchKeys(settings, name, "") {
+				entries, ok := m.value.(map[string]any)
+				if !ok {
+					continue
+				}
+				// entries are sorted, so the sources are reported in a stable order
+				names := make([]string, 0, len(entries))
+				for key := range entries {
+					names = append(names, key)
+				}
+				slices.Sort(names)
+				for _, key := range names {
+					targets[key] = true
+					sources = appendSource(sources, locate(m.key+"."+key))
+				}
+			}
+		} else {
+			for _, m := range matchKeys(settings, ref.target, "") {
+				for _, value := range referenceValues(m.value) {
+					targets[value] = true
+				}
+				sources = appendSource(sources, locate(m.key))
+			}
+		}
+
+		for _, m := range matchKeys(settings, ref.key, "") {
+			for _, value := range referenceValues(m.value) {
+				// keys are lowercased, so values referencing them are matched case-insensitively
+				if targets[value] || keys && targets[strings.ToLower(value)] {
+					continue
+				}
+				violations = append(violations, ReferenceViolation{
+					Key:           m.key,
+					Value:         value,
+					Target:        ref.target,
+					Source:        locate(m.key),
+					TargetSources: sources,
+				})
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		slices.SortStableFunc(violations, func(a, b ReferenceViolation) int {
+			return strings.Compare(a.Key, b.Key)
+		})
+		return &ReferenceError{Violations: violations}
+	}
+	return nil
+}
+
+func appendSource(sources []string, source string) []string {
+	if source == "" || slices.Contains(sources, source) {
+		return sources
+	}
+	return append(sources, source)
+}
+
+// referenceValues returns the value as strings, or its elements if it's a list.
+func referenceValues(value any) []string {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []any:
+		var values []string
+		for _, elem := range v {
+			values = append(values, referenceValues(elem)...)
+		}
+		return values
+	case map[string]any:
+		return nil
+	}
+	return []string{fmt.Sprint(value)}
+}
+
+// matchedKey is a value of the settings matched by a key pattern.
+type matchedKey struct {
+	key   string
+	value any
+}
+
+// matchKeys returns the values of the settings matched by the dotted key pattern, where a "*"
+// matches any key of a map or index of a list, with their keys below the prefix.
+func matchKeys(value any, pattern, prefix string) []matchedKey {
+	if pattern == "" {
+		return []matchedKey{{key: prefix, value: value}}
+	}
+	part, rest, _ := strings.Cut(pattern, ".")
+
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+	var matched []matchedKey
+	switch v := value.(type) {
+	case map[string]any:
+		if part != "*" {
+			if elem, ok := v[part]; ok {
+				matched = matchKeys(elem, rest, join(part))
+			}
+			break
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			matched = append(matched, matchKeys(v[key], rest, join(key))...)
+		}
+	case []any:
+		if part != "*" {
+			break
+		}
+		for i, elem := range v {
+			matched = append(matched, matchKeys(elem, rest, fmt.Sprintf("%s[%d]", prefix, i))...)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,105 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheckReferences(t *testing.T) {
+	settings := map[string]any{
+		"upstreams": map[string]any{"api": map[string]any{"url": "http://api"}, "web": map[string]any{"url": "http://web"}},
+		"routes": map[string]any{
+			"a": map[string]any{"upstream": "api"},
+			"b": map[string]any{"upstream": "API"},
+			"c": map[string]any{"upstream": "db"},
+		},
+		"pools":    []any{map[string]any{"members": []any{"api", "cache"}}, map[string]any{"members": "web"}},
+		"default":  "api",
+		"regions":  []any{"eu", "us"},
+		"failover": map[string]any{"eu": "us", "us": "ap", "ap": 1},
+	}
+	tests := []struct {
+		name string
+		refs []reference
+		// want are the violations as "key=value".
+		want []string
+	}{
+		{
+			name: "keys of the target",
+			refs: []reference{{key: "routes.*.upstream", target: "upstreams.*"}},
+			want: []string{"routes.c.upstream=db"},
+		},
+		{
+			name: "lists",
+			refs: []reference{{key: "pools.*.members", target: "upstreams.*"}, {key: "default", target: "upstreams.*"}},
+			want: []string{"pools[0].members=cache"},
+		},
+		{
+			name: "values of the target",
+			refs: []reference{{key: "failover.*", target: "regions"}},
+			want: []string{"failover.ap=1", "failover.us=ap"},
+		},
+		{
+			name: "missing target",
+			refs: []reference{{key: "default", target: "backends.*"}},
+			want: []string{"default=api"},
+		},
+		{
+			name: "missing key",
+			refs: []reference{{key: "listeners.*.upstream", target: "upstreams.*"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkReferences(tt.refs, settings, func(key string) string { return "" })
+			var got []string
+			var refErr *ReferenceError
+			if errors.As(err, &refErr) {
+				for _, v := range refErr.Violations {
+					got = append(got, fmt.Sprintf("%s=%v", v.Key, v.Value))
+				}
+			} else if err != nil {
+				t.Fatalf("checkReferences() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("violations = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithReference(t *testing.T) {
+	dir := t.TempDir()
+	routes := filepath.Join(dir, "routes.yaml")
+	upstreams := filepath.Join(dir, "upstreams.yaml")
+	writeFile(t, routes, "routes:\n  api:\n    upstream: db\n")
+	writeFile(t, upstreams, "upstreams:\n  web: {}\n  api: {}\n  cache: {}\n")
+	_, err := New(WithPaths(dir), WithReference("Routes.*.Upstream", "Upstreams.*"))
+	var refErr *ReferenceError
+	want := fmt.Sprintf("config has dangling references: routes.api.upstream (file: %s:3:5): db isn't in upstreams.* (files: %s:3:3, %s:4:3, %s:2:3)", routes, upstreams, upstreams, upstreams)
+	if !errors.As(err, &refErr) || err.Error() != want {
+		t.Fatalf("New() error = %v, want %q", err, want)
+	}
+
+	writeFile(t, routes, "routes:\n  api:\n    upstream: api\n")
+	h, err := New(WithPaths(dir), WithReference("routes.*.upstream", "upstreams.*"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	// removing an entry still referenced is rejected
+	writeFile(t, upstreams, "upstreams:\n  web: {}\n")
+	err = h.Reload(context.Background())
+	var reloadErr *ReloadError
+	if !errors.As(err, &reloadErr) || !errors.As(err, &refErr) || len(refErr.Violations) != 1 || refErr.Violations[0].Key != "routes.api.upstream" {
+		t.Fatalf("Reload() error = %v, want ReloadError of the dangling routes.api.upstream", err)
+	}
+	if _, ok := Lookup[any](h, "upstreams.api"); !ok {
+		t.Error("upstreams.api removed by a rejected reload")
+	}
+}
@@ -0,0 +1,16 @@
+package hydra
+
+// RegistryConfig configures a source of a key of the Windows registry, see WithRegistry.
+type RegistryConfig struct {
+	// Key is the path of the key, starting with its root key, e.g. `HKLM\SOFTWARE\MyApp` or
+	// `HKEY_CURRENT_USER\Software\MyApp`. Values of the key are placed under their lowercased
+	// names, and values of subkeys under the names of the subkeys, e.g. the value "Host" of the
+	// subkey "Database" under "database.host".
+	Key string
+}
+
+// registrySource provides the values of a key of the Windows registry and its subkeys as a
+// configuration document. It's only supported on Windows.
+type registrySource struct {
+	config RegistryConfig
+}
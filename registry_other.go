@@ -0,0 +1,18 @@
+//go:build !windows
+
+package hydra
+
+import (
+	"context"
+	"errors"
+)
+
+var errRegistryUnsupported = errors.New("the registry is only supported on Windows")
+
+func (s *registrySource) load(context.Context, func(rel string) bool) ([]document, error) {
+	return nil, errRegistryUnsupported
+}
+
+func (s *registrySource) watch(context.Context, func()) error {
+	return errRegistryUnsupported
+}
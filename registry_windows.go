@@ -0,0 +1,197 @@
+package hydra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// registryRoots are the root keys by their names and abbreviations.
+var registryRoots = map[string]registry.Key{
+	"HKLM":                  registry.LOCAL_MACHINE,
+	"HKEY_LOCAL_MACHINE":    registry.LOCAL_MACHINE,
+	"HKCU":                  registry.CURRENT_USER,
+	"HKEY_CURRENT_USER":     registry.CURRENT_USER,
+	"HKCR":                  registry.CLASSES_ROOT,
+	"HKEY_CLASSES_ROOT":     registry.CLASSES_ROOT,
+	"HKU":                   registry.USERS,
+	"HKEY_USERS":            registry.USERS,
+	"HKCC":                  registry.CURRENT_CONFIG,
+	"HKEY_CURRENT_CONFIG":   registry.CURRENT_CONFIG,
+	"HKEY_PERFORMANCE_DATA": registry.PERFORMANCE_DATA,
+}
+
+func (s *registrySource) load(ctx context.Context, want func(rel string) bool) ([]document, error) {
+	name, path, _ := strings.Cut(strings.Trim(s.config.Key, `\`), `\`)
+	rel := strings.ToLower(name) + ".json"
+	if i := strings.LastIndex(path, `\`); path != "" {
+		rel = strings.ToLower(path[i+1:]) + ".json"
+	}
+	if !want(rel) {
+		// values are decoded as JSON
+		return nil, nil
+	}
+
+	k, err := s.open()
+	if errors.Is(err, registry.ErrNotExist) {
+		// a key that doesn't exist has no values
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
+
+	settings, err := readRegistryKey(ctx, k)
+	if err != nil {
+		return nil, fmt.Errorf("read key (key: %s): %w", s.config.Key, err)
+	}
+
+	b, err := json.Marshal(settings)
+	if err != nil {
+		return nil, fmt.Errorf("encode key (key: %s): %w", s.config.Key, err)
+	}
+	return []document{{name: "registry:" + s.config.Key, rel: rel, data: b}}, nil
+}
+
+// watch waits for changes of the values of the key and its subkeys notified by
+// RegNotifyChangeKeyValue.
+func (s *registrySource) watch(ctx context.Context, changed func()) error {
+	k, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+
+	event, err := windows.CreateEvent(nil, 0, 0, nil)
+	if err != nil {
+		return fmt.Errorf("create event: %w", err)
+	}
+	defer windows.CloseHandle(event)
+
+	notified := false
+	for {
+		// notifications are requested once, so they're requested again after each
+		err := windows.RegNotifyChangeKeyValue(windows.Handle(k), true, windows.REG_NOTIFY_CHANGE_NAME|windows.REG_NOTIFY_CHANGE_LAST_SET, event, true)
+		if err != nil {
+			return fmt.Errorf("notify changes (key: %s): %w", s.config.Key, err)
+		}
+		if !notified {
+			// changes made before watching are caught up
+			changed()
+			notified = true
+		}
+
+		for {
+			// the context is checked while waiting
+			ev, err := windows.WaitForSingleObject(event, 250)
+			if err != nil {
+				return fmt.Errorf("wait for changes (key: %s): %w", s.config.Key, err)
+			}
+			if ev == windows.WAIT_OBJECT_0 {
+				break
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+		}
+		changed()
+	}
+}
+
+// open opens the key for reading its values and notifying its changes.
+func (s *registrySource) open() (registry.Key, error) {
+	name, path, _ := strings.Cut(strings.Trim(s.config.Key, `\`), `\`)
+	root, ok := registryRoots[strings.ToUpper(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown root key (key: %s)", s.config.Key)
+	}
+
+	k, err := registry.OpenKey(root, path, registry.READ)
+	if err != nil {
+		return 0, fmt.Errorf("open key (key: %s): %w", s.config.Key, err)
+	}
+	return k, nil
+}
+
+// readRegistryKey returns the values of the key and its subkeys by their lowercased names.
+func readRegistryKey(ctx context.Context, k registry.Key) (map[string]any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	settings := make(map[string]any)
+	names, err := k.ReadValueNames(-1)
+	if err != nil {
+		return nil, fmt.Errorf("read value names: %w", err)
+	}
+	for _, name := range names {
+		if name == "" {
+			// the default value of the key has no name
+			continue
+		}
+
+		value, err := readRegistryValue(k, name)
+		if err != nil {
+			return nil, fmt.Errorf("read value (name: %s): %w", name, err)
+		}
+		settings[strings.ToLower(name)] = value
+	}
+
+	subkeys, err := k.ReadSubKeyNames(-1)
+	if err != nil {
+		return nil, fmt.Errorf("read subkey names: %w", err)
+	}
+	for _, name := range subkeys {
+		sub, err := registry.OpenKey(k, name, registry.READ)
+		if err != nil {
+			return nil, fmt.Errorf("open subkey (name: %s): %w", name, err)
+		}
+		subSettings, err := readRegistryKey(ctx, sub)
+		sub.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read subkey (name: %s): %w", name, err)
+		}
+		settings[strings.ToLower(name)] = subSettings
+	}
+	return settings, nil
+}
+
+// readRegistryValue returns the value by its type: strings, with environment variables of
+// expandable strings expanded, integers, lists of strings or bytes.
+func readRegistryValue(k registry.Key, name string) (any, error) {
+	n, valtype, err := k.GetValue(name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch valtype {
+	case registry.SZ:
+		v, _, err := k.GetStringValue(name)
+		return v, err
+	case registry.EXPAND_SZ:
+		v, _, err := k.GetStringValue(name)
+		if err != nil {
+			return nil, err
+		}
+		return registry.ExpandString(v)
+	case registry.DWORD, registry.QWORD:
+		v, _, err := k.GetIntegerValue(name)
+		return v, err
+	case registry.MULTI_SZ:
+		v, _, err := k.GetStringsValue(name)
+		return v, err
+	default:
+		b := make([]byte, n)
+		n, _, err := k.GetValue(name, b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
@@ -0,0 +1,641 @@
+package hydra
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ReloadHook is invoked on reloads of the configuration with the path of the changed
+// configuration file, or an empty path for rescans of all paths, and the settings merged from
+// the configuration files.
+type ReloadHook func(path string, settings map[string]any) error
+
+// ReloadError is reported when the configuration can't be reloaded, e.g. because a changed
+// configuration file can't be parsed. Reloads are transactional: all affected files must be
+// read and merged successfully, otherwise the last good configuration is kept.
+type ReloadError struct {
+	// Path is the path of the changed configuration file or directory, or empty for a rescan.
+	Path string
+	Err  error
+}
+
+func (e *ReloadError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("reload config: %s", e.Err)
+	}
+	return fmt.Sprintf("reload config (path: %s): %s", e.Path, e.Err)
+}
+
+func (e *ReloadError) Unwrap() error {
+	return e.Err
+}
+
+// ChangeDetection decides whether an event for a configuration file is handled as a change.
+type ChangeDetection int
+
+const (
+	// ModTime handles every event reported for a configuration file as a change.
+	ModTime ChangeDetection = iota
+	// Hash handles an event as a change only if the checksum of the file contents differs
+	// from the one when the file was last read.
+	Hash
+)
+
+// staged is a configuration prepared by a reload which hasn't been applied yet.
+type staged struct {
+	files    []string
+	layers   map[string]*layer
+	settings map[string]any
+	// origins map keys to the configuration file that set them.
+	origins map[string]string
+	// conflicts are reported once the configuration is applied, see WarnConflicts.
+	conflicts []error
+	// documents replace the loaded documents of sources once the configuration is committed,
+	// unless nil, see stageScan.
+	documents map[string]sourcedDocument
+	// watches are the paths found in configured paths which are added to the watcher once the
+	// configuration is committed.
+	watches []watchedPath
+}
+
+// watchedPath is a path found in the root, a configured path, to be watched, see Hydra.watch.
+type watchedPath struct {
+	root, path string
+}
+
+// Reload rescans all paths and reloads the configuration from the configuration files found,
+// independently of filesystem events, e.g. on SIGHUP. The resulting change is notified.
+// If the reload fails, the current configuration is kept.
+func (h *Hydra) Reload(ctx context.Context) error {
+	h.reloadMu.Lock()
+	defer h.reloadMu.Unlock()
+
+	change, err := h.rescan(ctx)
+	if err != nil {
+		return &ReloadError{Err: err}
+	}
+
+	h.dispatch(change)
+	return nil
+}
+
+// handle processes a single change of a configuration file. A failed reload is reported as
+// ReloadError (see WithErrorHandler) and the change isn't notified.
+func (h *Hydra) handle(ev fsnotify.Event) {
+	if h.paused.Load() {
+		// changes are caught up by Resume
+		return
+	}
+
+	h.reloadMu.Lock()
+	defer h.reloadMu.Unlock()
+
+	if h.options.changeDetection == Hash && !h.options.autoReload && h.unchanged(ev) {
+		return
+	}
+
+	change := Change{
+		Path: ev.Name,
+		Op:   ev.Op,
+	}
+
+	if h.options.autoReload {
+		before := h.viper.AllSettings()
+
+		var st *staged
+		var err error
+		switch {
+		case isDir(ev.Name):
+			st, err = h.stageDir(ev.Name)
+		case ev.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Chmod) != 0:
+			// a permission change may make a file readable
+			st, err = h.stageFile(ev.Name)
+			if err == nil && st != nil && h.options.changeDetection == Hash &&
+				h.unchangedContents(ev.Name, st.layers[ev.Name].sum) {
+				return
+			}
+		case ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+			st, err = h.stageRemoval(ev.Name)
+		}
+		if err == nil && st != nil {
+			err = h.apply(ev.Name, st)
+		}
+		if err != nil {
+			h.reportError(&ReloadError{Path: ev.Name, Err: err})
+			return
+		}
+
+		change.Added, change.Removed, change.Modified = diff(before, h.viper.AllSettings())
+	}
+
+	h.dispatch(change)
+}
+
+// unchanged reports whether the event is about a tracked configuration file whose contents are
+// unchanged, see unchangedContents. Without auto reload, the file isn't read again, so its
+// checksum is recorded to detect the next change.
+func (h *Hydra) unchanged(ev fsnotify.Event) bool {
+	if ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0 || isDir(ev.Name) {
+		return false
+	}
+
+	b, err := h.readFile(ev.Name)
+	if err != nil {
+		// the error is reported by the reload
+		return false
+	}
+	sum := h.sum(ev.Name, b)
+	if h.unchangedContents(ev.Name, sum) {
+		return true
+	}
+
+	h.mu.Lock()
+	if l, ok := h.layers[ev.Name]; ok {
+		h.layers[ev.Name] = &layer{settings: l.settings, env: l.env, sum: sum, raw: l.raw}
+	}
+	h.mu.Unlock()
+	return false
+}
+
+// unchangedContents reports whether the contents of the tracked configuration file are the same
+// as when it was last committed.
+func (h *Hydra) unchangedContents(path string, sum [sha256.Size]byte) bool {
+	h.mu.Lock()
+	l, ok := h.layers[path]
+	h.mu.Unlock()
+	return ok && sum == l.sum
+}
+
+// truncated reports whether the event is about a tracked configuration file that is empty while
+// change detection compares contents. Files are truncated before being rewritten in place, so
+// the file is read again once the write that may follow had the time to happen.
+func (h *Hydra) truncated(ev fsnotify.Event) bool {
+	if h.options.changeDetection != Hash || ev.Op&fsnotify.Write == 0 || !h.isConfigFile(ev.Name) {
+		return false
+	}
+	info, err := os.Stat(ev.Name)
+	return err == nil && info.Mode().IsRegular() && info.Size() == 0
+}
+
+// handleRescan reloads the configuration from all paths and notifies the consolidated change.
+func (h *Hydra) handleRescan() {
+	if h.paused.Load() {
+		// changes are caught up by Resume
+		return
+	}
+
+	h.reloadMu.Lock()
+	defer h.reloadMu.Unlock()
+
+	change, err := h.rescan(context.Background())
+	if err != nil {
+		h.reportError(&ReloadError{Err: err})
+		return
+	}
+
+	h.dispatch(change)
+}
+
+// stageFile re-reads the configuration file and merges it with the other configuration files
+// in their load order. A file that isn't tracked yet is added to the configuration files at
+// its load order position. It returns nil if the file doesn't exist.
+func (h *Hydra) stageFile(path string) (*staged, error) {
+	l, err := h.rereadConfigFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// file was removed before the event got processed
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	files, layers := h.state()
+	layers[path] = l
+
+	if !slices.Contains(files, path) {
+		files = append(files, path)
+	}
+	// the order may depend on the change, e.g. by modification time
+	h.sortLoadOrder(files)
+
+	// only the changed file is read, the rest is merged from layers cached by previous reads
+	return h.stage(files, layers)
+}
+
+// stageDir re-reads configuration files located directly in the directory.
+func (h *Hydra) stageDir(dir string) (*staged, error) {
+	files, layers := h.state()
+
+	for _, path := range slices.Clone(files) {
+		if filepath.Dir(path) != filepath.Clean(dir) {
+			continue
+		}
+
+		l, err := h.rereadConfigFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			files = slices.DeleteFunc(files, func(other string) bool {
+				return other == path
+			})
+			delete(layers, path)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read config file (path: %s): %w", path, err)
+		}
+		layers[path] = l
+	}
+	h.sortLoadOrder(files)
+
+	return h.stage(files, layers)
+}
+
+// stageRemoval drops the configuration file. It returns nil if the file isn't tracked or
+// exists again.
+func (h *Hydra) stageRemoval(path string) (*staged, error) {
+	if h.exists(path) {
+		// file was recreated before the event got processed
+		return nil, nil
+	}
+
+	files, layers := h.state()
+
+	i := slices.Index(files, path)
+	if i < 0 {
+		return nil, nil
+	}
+	files = slices.Delete(files, i, i+1)
+	delete(layers, path)
+
+	return h.stage(files, layers)
+}
+
+// stageScan walks all paths again, loads all sources again and reads all configuration files
+// found in them. The loaded documents and the paths to watch are staged too, so nothing changes
+// unless the configuration is committed, e.g. by Validate. Callers unstage the documents once
+// the configuration is committed or discarded.
+func (h *Hydra) stageScan(ctx context.Context) (*staged, error) {
+	var files []string
+	var watches []watchedPath
+	layers := make(map[string]*layer)
+	for _, root := range h.options.paths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		found, err := h.walkPath(ctx, root, func(path string) {
+			watches = append(watches, watchedPath{root: root, path: path})
+		})
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("walk path (path: %s): %w", root, err)
+		}
+
+		for _, path := range found {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			l, err := h.rereadConfigFile(path)
+			if errors.Is(err, os.ErrNotExist) {
+				// file was removed while rescanning
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("read config file (path: %s): %w", path, err)
+			}
+
+			files = append(files, path)
+			layers[path] = l
+		}
+	}
+	documents := make(map[string]sourcedDocument)
+	for i, s := range h.options.sources {
+		docs, err := h.loadSource(ctx, i)
+		if err != nil {
+			return nil, fmt.Errorf("load source (source: %s): %w", s.id, err)
+		}
+		for _, doc := range docs {
+			documents[doc.name] = sourcedDocument{document: doc, source: i}
+			files = append(files, doc.name)
+		}
+	}
+
+	// documents are looked up in the staged ones rather than the loaded ones, until unstage
+	h.mu.Lock()
+	h.stagedDocuments = documents
+	h.mu.Unlock()
+	for _, path := range files {
+		if _, ok := documents[path]; !ok {
+			continue
+		}
+		l, err := h.readConfigFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read config file (path: %s): %w", path, err)
+		}
+		layers[path] = l
+	}
+	h.sortLoadOrder(files)
+
+	st, err := h.stage(files, layers)
+	if err != nil {
+		return nil, err
+	}
+	st.documents, st.watches = documents, watches
+	return st, nil
+}
+
+// unstage drops the documents staged by stageScan.
+func (h *Hydra) unstage() {
+	h.mu.Lock()
+	h.stagedDocuments = nil
+	h.mu.Unlock()
+}
+
+// rescan walks all paths again, reads all configuration files found in them and rebuilds the
+// configuration. Configuration files no longer found are dropped.
+func (h *Hydra) rescan(ctx context.Context) (Change, error) {
+	before := h.viper.AllSettings()
+
+	st, err := h.stageScan(ctx)
+	defer h.unstage()
+	if err != nil {
+		return Change{}, err
+	}
+
+	err = h.apply("", st)
+	if err != nil {
+		return Change{}, err
+	}
+
+	_, err = h.poll(ctx)
+	if err != nil {
+		return Change{}, fmt.Errorf("poll paths: %w", err)
+	}
+
+	change := Change{}
+	change.Added, change.Removed, change.Modified = diff(before, h.viper.AllSettings())
+	return change, nil
+}
+
+// state returns copies of the tracked configuration files and their layers.
+func (h *Hydra) state() ([]string, map[string]*layer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return slices.Clone(h.configFiles), maps.Clone(h.layers)
+}
+
+// stage merges the layers of the configuration files in their load order, according to the
+// precedence set by WithPrecedence and the strategy set by WithMergeStrategy.
+func (h *Hydra) stage(files []string, layers map[string]*layer) (*staged, error) {
+	settings := make(map[string]any)
+	m := newMerger(h.options.mergeStrategy)
+	for _, path := range h.mergeOrder(files) {
+		err := m.merge(settings, layers[path].settings, path)
+		if err != nil {
+			return nil, fmt.Errorf("merge config file (path: %s): %w", path, err)
+		}
+	}
+
+	return &staged{
+		files:     files,
+		layers:    layers,
+		settings:  settings,
+		origins:   m.origins,
+		conflicts: m.conflicts,
+	}, nil
+}
+
+// apply validates the staged configuration, runs the pre-reload hooks and change handlers,
+// commits it and runs the post-reload hooks. An invalid configuration, or an error returned by
+// a pre-reload hook or by a change handler with the Veto policy, aborts the reload.
+func (h *Hydra) apply(path string, st *staged) error {
+	err := h.validate(st)
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range h.options.preReloadHooks {
+		err := hook(path, copyValue(st.settings).(map[string]any))
+		if err != nil {
+			return fmt.Errorf("pre-reload hook: %w", err)
+		}
+	}
+
+	errs := h.runChangeHandlers(st.settings)
+	if len(errs) > 0 && h.options.changePolicy == Veto {
+		return errs[0]
+	}
+
+	err = h.commit(st)
+	if err != nil {
+		return err
+	}
+
+	for _, err := range st.conflicts {
+		h.reportError(err)
+	}
+	for _, err := range errs {
+		h.reportError(&ReloadError{Path: path, Err: err})
+	}
+
+	for _, hook := range h.options.postReloadHooks {
+		err := hook(path, copyValue(st.settings).(map[string]any))
+		if err != nil {
+			h.reportError(fmt.Errorf("post-reload hook (path: %s): %w", path, err))
+		}
+	}
+
+	return nil
+}
+
+// validate unifies the staged settings with the CUE schema set by WithCUESchema, and checks them
+// for the keys required by WithRequiredKeys, for keys unknown to the structs set by
+// WithStrictKeys, for dangling references set by WithReference, by decoding them into the
+// structs set by WithStruct, against the JSON schema set by WithJSONSchema and the structs
+// registered by UnmarshalValidated, and runs the validators set by WithValidator. It returns
+// the first error.
+func (h *Hydra) validate(st *staged) error {
+	errs := h.check(st, false)
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// check runs the checks of validate, returning their errors. Unless all is set, it stops at the
+// first error.
+func (h *Hydra) check(st *staged, all bool) []error {
+	var errs []error
+	failed := func(err error) bool {
+		if err != nil {
+			errs = append(errs, err)
+		}
+		return len(errs) > 0 && !all
+	}
+
+	if h.options.cueSchema != nil {
+		settings, err := unifyCUESchema(h.options.cueSchema, st.settings)
+		if failed(err) {
+			return errs
+		}
+		if err == nil {
+			st.settings = settings
+		}
+	}
+	settings := st.settings
+	if failed(checkRequiredKeys(h.options.requiredKeys, settings)) {
+		return errs
+	}
+	locate := func(key string) string {
+		return h.locate(st.origins, st.layers, key).String()
+	}
+	if len(h.options.strictKeys) > 0 && failed(checkUnknownKeys(h.options.strictKeys, settings, locate)) {
+		return errs
+	}
+	if len(h.options.references) > 0 && failed(checkReferences(h.options.references, settings, locate)) {
+		return errs
+	}
+	if failed(checkStructs(h.options.structs, settings)) {
+		return errs
+	}
+	if h.options.schema != nil {
+		var violations []SchemaViolation
+		h.options.schema.validate(settings, "", &violations)
+		for i, v := range violations {
+			violations[i].Source = locate(v.Path)
+		}
+		if len(violations) > 0 && failed(&SchemaError{Violations: violations}) {
+			return errs
+		}
+	}
+	if failed(h.validateStructs(settings)) {
+		return errs
+	}
+
+	snapshot := newSnapshot(st)
+	for _, validator := range h.options.validators {
+		err := validator(snapshot)
+		if err != nil && failed(&ValidationError{Err: err}) {
+			return errs
+		}
+	}
+	return errs
+}
+
+// commit makes the staged configuration the current one and replaces the configuration of
+// viper with its settings. The settings are copied before viper is locked, so the
+// configuration is replaced in one step.
+func (h *Hydra) commit(st *staged) error {
+	settings := copyValue(st.settings).(map[string]any)
+
+	h.viperMu.Lock()
+	err := h.install(st, settings)
+	h.viperMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	h.configFiles = st.files
+	h.layers = st.layers
+	h.settings = st.settings
+	h.origins = st.origins
+	if st.documents != nil {
+		h.documents = st.documents
+	}
+	h.mu.Unlock()
+
+	for _, w := range st.watches {
+		h.watch(w.root, w.path)
+	}
+	return nil
+}
+
+// install replaces the configuration of viper with the settings. It must be called with viperMu
+// held.
+func (h *Hydra) install(st *staged, settings map[string]any) error {
+	if prefix := h.keyPrefix(); prefix != nil {
+		err := h.installPrefixed(prefix, settings)
+		if err != nil {
+			return err
+		}
+	} else {
+		// viper can't replace its configuration directly, so it's reset by reading an empty
+		// document before the merged configuration is applied.
+		h.viper.SetConfigType("json")
+		err := h.viper.ReadConfig(strings.NewReader("{}"))
+		if err != nil {
+			return fmt.Errorf("reset config: %w", err)
+		}
+
+		err = h.viper.MergeConfigMap(settings)
+		if err != nil {
+			return fmt.Errorf("merge config: %w", err)
+		}
+	}
+
+	if h.options.envPrecedence == FilesWin {
+		h.override(st.settings)
+	}
+	if h.options.dotEnv == DotEnvEnvironment {
+		return h.applyDotEnv(st)
+	}
+	return nil
+}
+
+// installPrefixed replaces the subtree under the key prefix, leaving the rest of the
+// configuration of viper, which may be shared by WithViper, untouched. viper keeps the maps
+// merged into its configuration at keys it doesn't hold yet, so the subtree merged on the first
+// install is replaced in place afterwards.
+func (h *Hydra) installPrefixed(prefix []string, settings map[string]any) error {
+	subtree := settings
+	for _, key := range prefix {
+		subtree, _ = subtree[key].(map[string]any)
+	}
+
+	if h.prefixed != nil {
+		clear(h.prefixed)
+		maps.Copy(h.prefixed, subtree)
+		return nil
+	}
+
+	if key := strings.Join(prefix, "."); h.viper.InConfig(key) {
+		return fmt.Errorf("key prefix %s is already set in the configuration of viper", key)
+	}
+
+	h.prefixed = maps.Clone(subtree)
+	if h.prefixed == nil {
+		h.prefixed = make(map[string]any)
+	}
+	err := h.viper.MergeConfigMap(nest(h.prefixed, prefix))
+	if err != nil {
+		return fmt.Errorf("merge config: %w", err)
+	}
+	return nil
+}
+
+// override sets the settings as overrides of viper, which take precedence over environment
+// variables, see FilesWin. Keys of the previous settings which are gone are unset.
+func (h *Hydra) override(settings map[string]any) {
+	current := flatten(settings)
+	for key := range flatten(h.settings) {
+		if _, ok := current[key]; !ok {
+			// viper ignores overrides set to nil
+			h.viper.Set(key, nil)
+		}
+	}
+	for key, value := range current {
+		h.viper.Set(key, copyValue(value))
+	}
+}
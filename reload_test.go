@@ -0,0 +1,496 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+func TestCommitConcurrentReads(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yaml")
+	writeFile(t, path, "port: 8000\n")
+	h, err := New(WithPaths(dir))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			var c struct{ Port int }
+			err := h.UnmarshalValidated(&c)
+			if err != nil || c.Port < 8000 || c.Port >= 8050 {
+				// the configuration was read while it was replaced
+				t.Errorf("UnmarshalValidated() = %+v, %v during reload", c, err)
+				return
+			}
+		}
+	}()
+
+	for i := range 50 {
+		writeFile(t, path, fmt.Sprintf("port: %d\n", 8000+i))
+		err := h.Reload(context.Background())
+		if err != nil {
+			t.Fatalf("Reload() error = %v", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestGetDuringReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yaml")
+	writeFile(t, path, "server:\n  port: 8000\n  hosts: [a]\n")
+	h, err := New(WithPaths(dir))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, key := range []string{"server.port", "server", "server.hosts"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if _, ok := Lookup[any](h, key); !ok {
+					t.Errorf("Lookup(%s) not set during reload", key)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := range 50 {
+		writeFile(t, path, fmt.Sprintf("server:\n  port: %d\n  hosts: [a, b]\n", 8001+i))
+		err := h.Reload(context.Background())
+		if err != nil {
+			t.Fatalf("Reload() error = %v", err)
+		}
+		if got, err := Get[int](h, "server.port"); err != nil || got != 8001+i {
+			t.Fatalf("Get(server.port) = %d, %v, want %d", got, err, 8001+i)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestHashChangeDetection(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "auto reload", opts: []Option{WithAutoReload()}},
+		{name: "notify only"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "app.yaml")
+			writeFile(t, path, "port: 8080\n")
+			h, err := New(append([]Option{WithPaths(dir), WithChangeDetection(Hash)}, tt.opts...)...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer h.Close()
+
+			var mu sync.Mutex
+			var changes []Change
+			h.Listen(func(change Change) {
+				mu.Lock()
+				defer mu.Unlock()
+				changes = append(changes, change)
+			})
+			count := func() int {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(changes)
+			}
+			start(t, h)
+
+			for range 5 {
+				rewrite(t, path, "port: 8080\n")
+			}
+			rewrite(t, path, "port: 9090\n")
+			eventually(t, "change notified", func() bool { return count() > 0 })
+			for range 5 {
+				rewrite(t, path, "port: 9090\n")
+			}
+			time.Sleep(100 * time.Millisecond)
+
+			if got := count(); got != 1 {
+				t.Errorf("notified %d changes, want 1: %+v", got, changes)
+			}
+			if tt.opts != nil {
+				if got, _ := Get[int](h, "port"); got != 9090 {
+					t.Errorf("port = %d, want 9090", got)
+				}
+			}
+		})
+	}
+}
+
+func TestHashChangeDetectionEmptied(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "auto reload", opts: []Option{WithAutoReload()}},
+		{name: "notify only"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "app.yaml")
+			writeFile(t, path, "port: 8080\n")
+			h, err := New(append([]Option{WithPaths(dir), WithChangeDetection(Hash)}, tt.opts...)...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer h.Close()
+
+			var mu sync.Mutex
+			var changes []Change
+			h.Listen(func(change Change) {
+				mu.Lock()
+				defer mu.Unlock()
+				changes = append(changes, change)
+			})
+			count := func() int {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(changes)
+			}
+			start(t, h)
+
+			writeFile(t, path, "")
+			eventually(t, "change notified", func() bool { return count() > 0 })
+			time.Sleep(2 * replaceWindow)
+
+			if got := count(); got != 1 {
+				t.Errorf("notified %d changes, want 1: %+v", got, changes)
+			}
+			if tt.opts != nil && h.viper.IsSet("port") {
+				t.Errorf("port is set after the file is emptied")
+			}
+		})
+	}
+}
+
+func TestReloadRollback(t *testing.T) {
+	dir := t.TempDir()
+	app := filepath.Join(dir, "app.yaml")
+	db := filepath.Join(dir, "db.yaml")
+	writeFile(t, app, "port: 8080\n")
+	writeFile(t, db, "db:\n  host: localhost\n")
+	h, err := New(WithPaths(dir), WithPreReloadHook(func(_ string, settings map[string]any) error {
+		if settings["port"] == 6666 {
+			return errors.New("port 6666 is reserved")
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	steps := []struct {
+		name    string
+		change  func()
+		wantErr string
+		port    int
+		dbHost  string
+		files   int
+	}{
+		{
+			name:   "valid",
+			change: func() { writeFile(t, app, "port: 9090\n") },
+			port:   9090,
+			dbHost: "localhost",
+			files:  2,
+		},
+		{
+			name:    "parse error",
+			change:  func() { writeFile(t, app, "port: [\n") },
+			wantErr: "reload config: read config file (path: " + app + "):",
+			port:    9090,
+			dbHost:  "localhost",
+			files:   2,
+		},
+		{
+			// the removal isn't applied either while another file is invalid
+			name: "removal with parse error",
+			change: func() {
+				if err := os.Remove(db); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "reload config: read config file (path: " + app + "):",
+			port:    9090,
+			dbHost:  "localhost",
+			files:   2,
+		},
+		{
+			name:   "fixed",
+			change: func() { writeFile(t, app, "port: 9091\n") },
+			port:   9091,
+			files:  1,
+		},
+		{
+			name:    "rejected by hook",
+			change:  func() { writeFile(t, app, "port: 6666\n") },
+			wantErr: "reload config: pre-reload hook: port 6666 is reserved",
+			port:    9091,
+			files:   1,
+		},
+	}
+	for _, step := range steps {
+		step.change()
+		err := h.Reload(context.Background())
+		var reloadErr *ReloadError
+		switch {
+		case step.wantErr == "" && err != nil:
+			t.Fatalf("%s: Reload() error = %v", step.name, err)
+		case step.wantErr != "" && (!errors.As(err, &reloadErr) || !strings.HasPrefix(err.Error(), step.wantErr)):
+			t.Fatalf("%s: Reload() error = %v, want ReloadError %q", step.name, err, step.wantErr)
+		}
+		if got, _ := Get[int](h, "port"); got != step.port {
+			t.Errorf("%s: port = %d, want %d", step.name, got, step.port)
+		}
+		if got, _ := Lookup[string](h, "db.host"); got != step.dbHost {
+			t.Errorf("%s: db.host = %q, want %q", step.name, got, step.dbHost)
+		}
+		if got := h.ConfigFiles(); len(got) != step.files {
+			t.Errorf("%s: ConfigFiles() = %v, want %d files", step.name, got, step.files)
+		}
+	}
+}
+
+func TestAutoReloadRollback(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yaml")
+	writeFile(t, path, "port: 8080\nhost: a\n")
+	errs := make(chan error, 10)
+	h, err := New(WithPaths(dir), WithAutoReload(), WithDebounce(50*time.Millisecond), WithErrorHandler(func(err error) {
+		errs <- err
+	}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+	var mu sync.Mutex
+	var changes []Change
+	h.Listen(func(change Change) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, change)
+	})
+	start(t, h)
+
+	writeFile(t, path, "port: 9090\nhost: [\n")
+	select {
+	case err := <-errs:
+		var reloadErr *ReloadError
+		if !errors.As(err, &reloadErr) || reloadErr.Path != path {
+			t.Fatalf("error = %v, want ReloadError of %s", err, path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reload error")
+	}
+	// the last good configuration is kept and no change is notified
+	if got, _ := Get[int](h, "port"); got != 8080 {
+		t.Errorf("port after failed reload = %d, want 8080", got)
+	}
+	mu.Lock()
+	if len(changes) != 0 {
+		t.Errorf("notified changes %+v of failed reload", changes)
+	}
+	mu.Unlock()
+
+	writeFile(t, path, "port: 9090\nhost: b\n")
+	eventually(t, "port 9090", func() bool {
+		got, _ := Get[int](h, "port")
+		return got == 9090
+	})
+}
+
+// rewrite rewrites the file in place, truncating it and writing the data once the truncation
+// is seen.
+func rewrite(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	time.Sleep(30 * time.Millisecond)
+	_, err = f.WriteString(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyPrefixSharedViper(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(strings.NewReader("name: shared\nnested:\n  x: 2\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	app := filepath.Join(dir, "app.yaml")
+	writeFile(t, app, "port: 8080\ndb:\n  host: localhost\n")
+	h, err := New(WithPaths(dir), WithViper(v), WithKeyPrefix("fileconfig"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	writeFile(t, app, "db: sqlite\n")
+	if err := h.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	if v.IsSet("fileconfig.port") {
+		t.Errorf("fileconfig.port is set after its removal")
+	}
+	if got := v.GetString("fileconfig.db"); got != "sqlite" {
+		t.Errorf("fileconfig.db = %q, want sqlite", got)
+	}
+	if got := v.GetString("name"); got != "shared" {
+		t.Errorf("name = %q, want shared", got)
+	}
+	if got := v.GetInt("nested.x"); got != 2 {
+		t.Errorf("nested.x = %d, want 2", got)
+	}
+
+	// the config type of the shared viper is kept
+	if err := v.MergeConfig(strings.NewReader("late: true\n")); err != nil {
+		t.Fatalf("MergeConfig() error = %v", err)
+	}
+	writeFile(t, app, "port: 9090\n")
+	if err := h.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if !v.GetBool("late") {
+		t.Errorf("late is unset by the reload")
+	}
+	if got := v.GetInt("fileconfig.port"); got != 9090 {
+		t.Errorf("fileconfig.port = %d, want 9090", got)
+	}
+}
+
+func TestKeyPrefixSetInViper(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(strings.NewReader("fileconfig:\n  port: 1\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.yaml"), "port: 8080\n")
+	_, err := New(WithPaths(dir), WithViper(v), WithKeyPrefix("fileconfig"))
+	if err == nil || !strings.Contains(err.Error(), "key prefix fileconfig is already set") {
+		t.Fatalf("New() error = %v, want key prefix conflict", err)
+	}
+}
+
+func TestAutoReloadPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	a, b, c := filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml"), filepath.Join(dir, "c.yaml")
+	writeFile(t, a, "x: a\n")
+	writeFile(t, b, "x: b\ny: b\n")
+	writeFile(t, c, "x: c\n")
+	h, err := New(WithPaths(dir), WithAutoReload())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	changes := startNotify(t, h)
+
+	// every reload merges all files in their load order, so a changed file keeps its place
+	steps := []struct {
+		path, data string
+		want       map[string]any
+	}{
+		{path: a, data: "x: a2\ny: a2\nz: a2\n", want: map[string]any{"x": "c", "y": "b", "z": "a2"}},
+		{path: b, data: "x: b2\ny: b2\nz: b2\n", want: map[string]any{"x": "c", "y": "b2", "z": "b2"}},
+		{path: c, data: "y: c\n", want: map[string]any{"x": "b2", "y": "c", "z": "b2"}},
+		{path: a, data: "x: a3\n", want: map[string]any{"x": "b2", "y": "c", "z": "b2"}},
+	}
+	for i, step := range steps {
+		replaceFile(t, step.path, step.data)
+		receive(t, changes)
+		if got := h.viper.AllSettings(); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("step %d: settings = %v, want %v", i, got, step.want)
+		}
+	}
+}
+
+func TestRescanInterval(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.yaml"), "a: 1\n")
+	writeFile(t, filepath.Join(dir, "b.yaml"), "b: 1\n")
+
+	// events of the changes are ignored, like events lost on bind mounts
+	h, err := New(WithPaths(dir), WithRescanInterval(20*time.Millisecond), WithOps(fsnotify.Chmod))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	changes := startNotify(t, h)
+	quiet(t, changes, 100*time.Millisecond)
+
+	// the changes are reloaded at once, even without auto reload
+	replaceFile(t, filepath.Join(dir, "a.yaml"), "a: 2\n")
+	if err := os.Remove(filepath.Join(dir, "b.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	replaceFile(t, filepath.Join(dir, "c.yaml"), "c: 1\n")
+	c := receive(t, changes)
+	if c.Path != "" || c.Empty() {
+		t.Errorf("change = %+v, want a consolidated change", c)
+	}
+	eventually(t, "rescan", func() bool {
+		_, errC := Get[int](h, "c")
+		_, errB := Get[int](h, "b")
+		return errC == nil && errors.Is(errB, ErrKeyNotSet)
+	})
+	for len(changes) > 0 {
+		<-changes
+	}
+	if got := h.ConfigFiles(); !reflect.DeepEqual(got, []string{filepath.Join(dir, "a.yaml"), filepath.Join(dir, "c.yaml")}) {
+		t.Errorf("ConfigFiles() = %v, want a.yaml and c.yaml", got)
+	}
+	if got, _ := Get[int](h, "a"); got != 2 {
+		t.Errorf("a = %d, want 2", got)
+	}
+
+	// unchanged files aren't reloaded
+	quiet(t, changes, 100*time.Millisecond)
+}
@@ -0,0 +1,28 @@
+package hydra
+
+import "strings"
+
+// MissingKeysError reports the keys required by WithRequiredKeys that are missing from the
+// merged configuration.
+type MissingKeysError struct {
+	Keys []string
+}
+
+func (e *MissingKeysError) Error() string {
+	return "config misses required keys: " + strings.Join(e.Keys, ", ")
+}
+
+// checkRequiredKeys returns a MissingKeysError if any of the keys is missing from the
+// settings or set to null.
+func checkRequiredKeys(keys []string, settings map[string]any) error {
+	var missing []string
+	for _, key := range keys {
+		if lookup(settings, key) == nil {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return &MissingKeysError{Keys: missing}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheckRequiredKeys(t *testing.T) {
+	settings := map[string]any{
+		"name":   "app",
+		"db":     map[string]any{"host": "localhost", "password": nil},
+		"hosts":  []any{},
+		"debug":  false,
+		"ports":  map[string]any{},
+		"listen": ":8080",
+	}
+	tests := []struct {
+		name string
+		keys []string
+		want []string
+	}{
+		{name: "set", keys: []string{"name", "db.host", "db", "hosts", "debug", "ports"}},
+		{name: "missing", keys: []string{"version", "db.user"}, want: []string{"version", "db.user"}},
+		{name: "null", keys: []string{"db.password"}, want: []string{"db.password"}},
+		{name: "below a value", keys: []string{"listen.port", "name.first"}, want: []string{"listen.port", "name.first"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkRequiredKeys(tt.keys, settings)
+			var missing *MissingKeysError
+			switch {
+			case tt.want == nil && err != nil:
+				t.Errorf("checkRequiredKeys() error = %v", err)
+			case tt.want != nil && (!errors.As(err, &missing) || !reflect.DeepEqual(missing.Keys, tt.want)):
+				t.Errorf("checkRequiredKeys() error = %v, want missing %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithRequiredKeys(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yaml")
+	writeFile(t, path, "db:\n  port: 5432\n")
+	_, err := New(WithPaths(dir), WithRequiredKeys("DB.Host", "db.port", "name"))
+	if err == nil || err.Error() != "config misses required keys: db.host, name" {
+		t.Fatalf("New() error = %v, want missing db.host and name", err)
+	}
+
+	writeFile(t, path, "name: app\ndb:\n  host: localhost\n")
+	h, err := New(WithPaths(dir), WithRequiredKeys("DB.Host", "name"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	// keys set to null are missing too
+	writeFile(t, path, "name: app\ndb:\n  host: null\n")
+	err = h.Reload(context.Background())
+	var reloadErr *ReloadError
+	if !errors.As(err, &reloadErr) || err.Error() != "reload config: config misses required keys: db.host" {
+		t.Fatalf("Reload() error = %v, want ReloadError of missing db.host", err)
+	}
+	if got, _ := Get[string](h, "db.host"); got != "localhost" {
+		t.Errorf("db.host = %q, want localhost", got)
+	}
+}
@@ -0,0 +1,148 @@
+package hydra
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// S3Config configures a source of the configuration files stored as objects in an Amazon S3
+// bucket, see WithS3.
+type S3Config struct {
+	Bucket string
+	// Prefix selects the objects whose keys start with it, e.g. "myapp/". Names of the objects
+	// relative to the prefix are used like relative paths, see ByRelativePath.
+	Prefix string
+	// Region of the bucket. Defaults to the AWS_REGION and AWS_DEFAULT_REGION environment
+	// variables.
+	Region string
+	// Endpoint of S3-compatible storage, e.g. MinIO, which is requested with path-style URLs.
+	// Defaults to the AWS_ENDPOINT_URL_S3 and AWS_ENDPOINT_URL environment variables, or S3.
+	Endpoint    string
+	Credentials AWSCredentials
+	// Client sends the requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// s3Source provides the configuration files stored as objects under a prefix of a bucket.
+type s3Source struct {
+	config S3Config
+
+	mu sync.Mutex
+	// objects are the documents of the objects last downloaded, by key, which are downloaded
+	// again only if their ETag changes.
+	objects map[string]s3Object
+}
+
+type s3Object struct {
+	etag string
+	doc  document
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key  string
+		ETag string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (s *s3Source) load(ctx context.Context, want func(rel string) bool) ([]document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	objects := make(map[string]s3Object)
+	var docs []document
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.config.Prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		var list s3ListResult
+		err := s.get(ctx, "", query, func(body io.Reader) error {
+			return xml.NewDecoder(body).Decode(&list)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list objects (bucket: %s): %w", s.config.Bucket, err)
+		}
+
+		for _, c := range list.Contents {
+			rel := strings.TrimPrefix(strings.TrimPrefix(c.Key, s.config.Prefix), "/")
+			if strings.HasSuffix(c.Key, "/") || !want(rel) {
+				continue
+			}
+
+			o, ok := s.objects[c.Key]
+			if !ok || o.etag != c.ETag {
+				var b []byte
+				err := s.get(ctx, c.Key, nil, func(body io.Reader) error {
+					b, err = io.ReadAll(body)
+					return err
+				})
+				if err != nil {
+					return nil, fmt.Errorf("get object (key: %s): %w", c.Key, err)
+				}
+
+				name := "s3://" + s.config.Bucket + "/" + c.Key
+				o = s3Object{etag: c.ETag, doc: document{name: name, rel: rel, data: b}}
+			}
+			objects[c.Key] = o
+			docs = append(docs, o.doc)
+		}
+
+		if !list.IsTruncated {
+			break
+		}
+		token = list.NextContinuationToken
+	}
+
+	s.objects = objects
+	return docs, nil
+}
+
+// get sends a signed GET request for the object with the key, or for the bucket if the key is
+// empty, and passes the response body to read.
+func (s *s3Source) get(ctx context.Context, key string, query url.Values, read func(body io.Reader) error) error {
+	region := awsRegion(s.config.Region)
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	u := "https://" + s.config.Bucket + ".s3." + region + ".amazonaws.com/" + awsEscape(key, false)
+	if endpoint := awsEndpoint(s.config.Endpoint, "s3"); endpoint != "" {
+		u = strings.TrimSuffix(endpoint, "/") + "/" + s.config.Bucket + "/" + awsEscape(key, false)
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	signAWS(req, nil, "s3", region, s.config.Credentials.orEnv(), time.Now())
+
+	client := s.config.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return read(resp.Body)
+}
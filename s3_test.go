@@ -0,0 +1,195 @@
+package hydra
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// s3TestServer is an S3 endpoint of path-style requests of the bucket "config", listing
+// objects by pages of two.
+type s3TestServer struct {
+	mu      sync.Mutex
+	objects map[string]string
+	etags   map[string]string
+	// gets counts the objects downloaded by key.
+	gets map[string]int
+}
+
+func (s *s3TestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/s3/aws4_request") {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/config/")
+	if !ok {
+		http.Error(w, "<Error><Code>NoSuchBucket</Code></Error>", http.StatusNotFound)
+		return
+	}
+	if key != "" {
+		data, ok := s.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		s.gets[key]++
+		fmt.Fprint(w, data)
+		return
+	}
+
+	q := r.URL.Query()
+	var keys []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, q.Get("prefix")) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	start := 0
+	if token := q.Get("continuation-token"); token != "" {
+		fmt.Sscanf(token, "page-%d", &start)
+	}
+	end := min(start+2, len(keys))
+	fmt.Fprint(w, "<ListBucketResult>")
+	for _, key := range keys[start:end] {
+		fmt.Fprintf(w, "<Contents><Key>%s</Key><ETag>%s</ETag></Contents>", key, s.etags[key])
+	}
+	if end < len(keys) {
+		fmt.Fprintf(w, "<IsTruncated>true</IsTruncated><NextContinuationToken>page-%d</NextContinuationToken>", end)
+	}
+	fmt.Fprint(w, "</ListBucketResult>")
+}
+
+func (s *s3TestServer) put(key, data string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = data
+	s.etags[key] = fmt.Sprintf(`"%x"`, len(s.etags)+len(data))
+}
+
+func TestS3SourceLoad(t *testing.T) {
+	server := &s3TestServer{objects: map[string]string{}, etags: map[string]string{}, gets: map[string]int{}}
+	for key, data := range map[string]string{
+		"myapp/app.yaml":    "port: 8080\n",
+		"myapp/db/db.json":  `{"host": "localhost"}`,
+		"myapp/dir/":        "",
+		"myapp/extra.toml":  "extra = true\n",
+		"other/app.yaml":    "port: 1\n",
+		"myapp/readme.text": "ignored",
+	} {
+		server.put(key, data)
+	}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	src := &s3Source{config: S3Config{
+		Bucket:      "config",
+		Prefix:      "myapp/",
+		Region:      "eu-west-1",
+		Endpoint:    srv.URL,
+		Credentials: AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret"},
+		Client:      srv.Client(),
+	}}
+	want := func(rel string) bool { return !strings.HasSuffix(rel, ".text") }
+
+	steps := []struct {
+		put  map[string]string
+		docs []document
+		gets map[string]int
+	}{
+		{
+			docs: []document{
+				{name: "s3://config/myapp/app.yaml", rel: "app.yaml", data: []byte("port: 8080\n")},
+				{name: "s3://config/myapp/db/db.json", rel: "db/db.json", data: []byte(`{"host": "localhost"}`)},
+				{name: "s3://config/myapp/extra.toml", rel: "extra.toml", data: []byte("extra = true\n")},
+			},
+			gets: map[string]int{"myapp/app.yaml": 1, "myapp/db/db.json": 1, "myapp/extra.toml": 1},
+		},
+		{
+			// objects whose ETags are unchanged aren't downloaded again
+			put: map[string]string{"myapp/app.yaml": "port: 9090\n"},
+			docs: []document{
+				{name: "s3://config/myapp/app.yaml", rel: "app.yaml", data: []byte("port: 9090\n")},
+				{name: "s3://config/myapp/db/db.json", rel: "db/db.json", data: []byte(`{"host": "localhost"}`)},
+				{name: "s3://config/myapp/extra.toml", rel: "extra.toml", data: []byte("extra = true\n")},
+			},
+			gets: map[string]int{"myapp/app.yaml": 2, "myapp/db/db.json": 1, "myapp/extra.toml": 1},
+		},
+	}
+	for i, step := range steps {
+		for key, data := range step.put {
+			server.put(key, data)
+		}
+		docs, err := src.load(context.Background(), want)
+		if err != nil {
+			t.Fatalf("step %d: load() error = %v", i, err)
+		}
+		if !reflect.DeepEqual(docs, step.docs) {
+			t.Errorf("step %d: load() = %+v, want %+v", i, docs, step.docs)
+		}
+		server.mu.Lock()
+		if !reflect.DeepEqual(server.gets, step.gets) {
+			t.Errorf("step %d: downloaded %v, want %v", i, server.gets, step.gets)
+		}
+		server.mu.Unlock()
+	}
+}
+
+func TestS3SourceLoadError(t *testing.T) {
+	srv := httptest.NewServer(&s3TestServer{objects: map[string]string{}, etags: map[string]string{}, gets: map[string]int{}})
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		config S3Config
+		want   string
+	}{
+		{
+			name:   "access denied",
+			config: S3Config{Bucket: "config", Region: "eu-west-1", Credentials: AWSCredentials{AccessKeyID: "other"}},
+			want:   "list objects (bucket: config): unexpected status: 403 Forbidden",
+		},
+		{
+			name:   "no such bucket",
+			config: S3Config{Bucket: "missing", Region: "eu-west-1", Credentials: AWSCredentials{AccessKeyID: "AKID"}},
+			want:   "list objects (bucket: missing): unexpected status: 404 Not Found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Endpoint, tt.config.Client = srv.URL, srv.Client()
+			_, err := (&s3Source{config: tt.config}).load(context.Background(), func(string) bool { return true })
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("load() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestS3Endpoint(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.URL.Path)
+		fmt.Fprint(w, "<ListBucketResult></ListBucketResult>")
+	}))
+	defer srv.Close()
+
+	// endpoints set by the environment are requested with path-style URLs
+	t.Setenv("AWS_ENDPOINT_URL_S3", srv.URL+"/")
+	src := &s3Source{config: S3Config{Bucket: "config", Client: srv.Client()}}
+	_, err := src.load(context.Background(), func(string) bool { return true })
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	if len(got) != 1 || got[0] != "/config/" {
+		t.Errorf("requested %q, want /config/", got)
+	}
+}
@@ -0,0 +1,708 @@
+package hydra
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// SchemaViolation is a violation of the JSON schema set by WithJSONSchema.
+type SchemaViolation struct {
+	// Path is the key of the violating value, e.g. "server.port" or "hosts[1]", or empty for
+	// the whole configuration.
+	Path string
+	// Keyword is the keyword of the schema that's violated, e.g. "minimum" or "required".
+	Keyword string
+	Message string
+	// Source is the position in the configuration file that set the value, e.g.
+	// "config.yaml:3:5", or empty for the whole configuration.
+	Source string
+}
+
+func (v SchemaViolation) String() string {
+	path := v.Path
+	if path == "" {
+		path = "(root)"
+	}
+	if v.Source != "" {
+		path += " (file: " + v.Source + ")"
+	}
+	return path + ": " + v.Message
+}
+
+// SchemaError is returned when the merged configuration violates the JSON schema set by
+// WithJSONSchema. On reloads, it's reported as the Err of a ReloadError and the previous
+// configuration is kept.
+type SchemaError struct {
+	Violations []SchemaViolation
+}
+
+func (e *SchemaError) Error() string {
+	msgs := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		msgs = append(msgs, v.String())
+	}
+	return "config violates json schema: " + strings.Join(msgs, "; ")
+}
+
+// jsonSchema is a compiled JSON schema using the keywords of jsonSchemaKeywords, which drafts 4
+// to 2020-12 share or spell differently. Other keywords, e.g. unevaluatedProperties,
+// dependentSchemas or $dynamicRef, fail to compile. Formats are annotations and aren't checked,
+// and references must be local, e.g. "#/$defs/port".
+type jsonSchema struct {
+	// always is the result of boolean schemas.
+	always *bool
+	ref    *jsonSchema
+
+	types    []string
+	enum     []any
+	constant *any
+
+	// properties are by their lowercased names, since keys of the configuration are lowercased.
+	properties        map[string]*jsonSchema
+	required          []string
+	additional        *jsonSchema
+	patternProperties []jsonPatternSchema
+	propertyNames     *jsonSchema
+	minProperties     *int
+	maxProperties     *int
+	dependentRequired map[string][]string
+
+	prefixItems []*jsonSchema
+	items       *jsonSchema
+	contains    *jsonSchema
+	minContains *int
+	maxContains *int
+	minItems    *int
+	maxItems    *int
+	uniqueItems bool
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	multipleOf       *float64
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	allOf, anyOf, oneOf []*jsonSchema
+	not                 *jsonSchema
+	ifSchema            *jsonSchema
+	thenSchema          *jsonSchema
+	elseSchema          *jsonSchema
+}
+
+// jsonSchemaKeywords are the keywords of schema objects that are checked, and
+// jsonSchemaAnnotations the ones that are accepted without being checked.
+var (
+	jsonSchemaKeywords = []string{
+		"$ref", "type", "enum", "const",
+		"properties", "required", "additionalProperties", "patternProperties", "propertyNames",
+		"minProperties", "maxProperties", "dependentRequired", "dependencies",
+		"items", "additionalItems", "prefixItems", "contains", "minContains", "maxContains",
+		"minItems", "maxItems", "uniqueItems",
+		"minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum", "multipleOf",
+		"minLength", "maxLength", "pattern",
+		"allOf", "anyOf", "oneOf", "not", "if", "then", "else",
+	}
+	jsonSchemaAnnotations = []string{
+		"$schema", "$id", "id", "$comment", "title", "description", "default", "examples",
+		"format", "deprecated", "readOnly", "writeOnly", "$defs", "definitions",
+		"contentEncoding", "contentMediaType", "contentSchema",
+	}
+)
+
+type jsonPatternSchema struct {
+	pattern *regexp.Regexp
+	schema  *jsonSchema
+}
+
+// jsonSchemaCompiler compiles the subschemas of a JSON schema document.
+type jsonSchemaCompiler struct {
+	root any
+	// refs are the compiled subschemas by their JSON pointers, so recursive references are
+	// compiled once.
+	refs map[string]*jsonSchema
+}
+
+func compileJSONSchema(b []byte) (*jsonSchema, error) {
+	var root any
+	err := json.Unmarshal(b, &root)
+	if err != nil {
+		return nil, fmt.Errorf("parse schema: %w", err)
+	}
+	c := &jsonSchemaCompiler{root: root, refs: make(map[string]*jsonSchema)}
+	return c.compile(root, "#")
+}
+
+func (c *jsonSchemaCompiler) compile(raw any, ptr string) (*jsonSchema, error) {
+	if s, ok := c.refs[ptr]; ok {
+		return s, nil
+	}
+	s := &jsonSchema{}
+	c.refs[ptr] = s
+
+	switch raw := raw.(type) {
+	case bool:
+		s.always = &raw
+		return s, nil
+	case map[string]any:
+		return s, c.fill(s, raw, ptr)
+	}
+	return nil, fmt.Errorf("schema at %s is a %T, not an object or boolean", ptr, raw)
+}
+
+// fill compiles the keywords of the schema object at the JSON pointer into the schema.
+func (c *jsonSchemaCompiler) fill(s *jsonSchema, m map[string]any, ptr string) error {
+	var err error
+	sub := func(key string) *jsonSchema {
+		raw, ok := m[key]
+		if !ok || err != nil {
+			return nil
+		}
+		var compiled *jsonSchema
+		compiled, err = c.compile(raw, ptr+"/"+key)
+		return compiled
+	}
+	subs := func(key string) []*jsonSchema {
+		raw, ok := m[key].([]any)
+		if !ok {
+			return nil
+		}
+		var schemas []*jsonSchema
+		for i, elem := range raw {
+			if err != nil {
+				return nil
+			}
+			var compiled *jsonSchema
+			compiled, err = c.compile(elem, ptr+"/"+key+"/"+strconv.Itoa(i))
+			schemas = append(schemas, compiled)
+		}
+		return schemas
+	}
+	number := func(key string) *float64 {
+		f, ok := m[key].(float64)
+		if !ok {
+			return nil
+		}
+		return &f
+	}
+	count := func(key string) *int {
+		f, ok := m[key].(float64)
+		if !ok {
+			return nil
+		}
+		n := int(f)
+		return &n
+	}
+
+	keywords := make([]string, 0, len(m))
+	for keyword := range m {
+		keywords = append(keywords, keyword)
+	}
+	slices.Sort(keywords)
+	for _, keyword := range keywords {
+		if !slices.Contains(jsonSchemaKeywords, keyword) && !slices.Contains(jsonSchemaAnnotations, keyword) {
+			return fmt.Errorf("unsupported keyword %s of %s", keyword, ptr)
+		}
+	}
+
+	if ref, ok := m["$ref"].(string); ok {
+		s.ref, err = c.resolve(ref)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch t := m["type"].(type) {
+	case string:
+		s.types = []string{t}
+	case []any:
+		for _, elem := range t {
+			if name, ok := elem.(string); ok {
+				s.types = append(s.types, name)
+			}
+		}
+	}
+	s.enum, _ = m["enum"].([]any)
+	if constant, ok := m["const"]; ok {
+		s.constant = &constant
+	}
+
+	if props, ok := m["properties"].(map[string]any); ok {
+		s.properties = make(map[string]*jsonSchema, len(props))
+		for name, raw := range props {
+			compiled, err := c.compile(raw, ptr+"/properties/"+jsonPointerEscape(name))
+			if err != nil {
+				return err
+			}
+			s.properties[strings.ToLower(name)] = compiled
+		}
+	}
+	if required, ok := m["required"].([]any); ok {
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				s.required = append(s.required, strings.ToLower(name))
+			}
+		}
+	}
+	s.additional = sub("additionalProperties")
+	if patterns, ok := m["patternProperties"].(map[string]any); ok {
+		for pattern, raw := range patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("compile pattern of %s: %w", ptr, err)
+			}
+			compiled, err := c.compile(raw, ptr+"/patternProperties/"+jsonPointerEscape(pattern))
+			if err != nil {
+				return err
+			}
+			s.patternProperties = append(s.patternProperties, jsonPatternSchema{pattern: re, schema: compiled})
+		}
+	}
+	s.propertyNames = sub("propertyNames")
+	s.minProperties = count("minProperties")
+	s.maxProperties = count("maxProperties")
+	dependent, _ := m["dependentRequired"].(map[string]any)
+	if dependent == nil {
+		// dependencies of draft 7 and before, whose arrays are dependentRequired
+		dependent, _ = m["dependencies"].(map[string]any)
+	}
+	for name, raw := range dependent {
+		names, ok := raw.([]any)
+		if !ok {
+			// schema dependencies are dependentSchemas of 2019-09, which aren't supported
+			return fmt.Errorf("unsupported schema dependency %s of %s", name, ptr)
+		}
+		if s.dependentRequired == nil {
+			s.dependentRequired = make(map[string][]string)
+		}
+		for _, dep := range names {
+			if dep, ok := dep.(string); ok {
+				s.dependentRequired[strings.ToLower(name)] = append(s.dependentRequired[strings.ToLower(name)], strings.ToLower(dep))
+			}
+		}
+	}
+
+	if _, ok := m["items"].([]any); ok {
+		// tuples of draft 2019-09 and before
+		s.prefixItems = subs("items")
+		s.items = sub("additionalItems")
+	} else {
+		s.prefixItems = subs("prefixItems")
+		s.items = sub("items")
+	}
+	s.contains = sub("contains")
+	s.minContains = count("minContains")
+	s.maxContains = count("maxContains")
+	s.minItems = count("minItems")
+	s.maxItems = count("maxItems")
+	s.uniqueItems, _ = m["uniqueItems"].(bool)
+
+	s.minimum = number("minimum")
+	s.maximum = number("maximum")
+	s.exclusiveMinimum = number("exclusiveMinimum")
+	s.exclusiveMaximum = number("exclusiveMaximum")
+	if exclusive, _ := m["exclusiveMinimum"].(bool); exclusive {
+		// exclusive bounds of draft 4
+		s.exclusiveMinimum, s.minimum = s.minimum, nil
+	}
+	if exclusive, _ := m["exclusiveMaximum"].(bool); exclusive {
+		s.exclusiveMaximum, s.maximum = s.maximum, nil
+	}
+	s.multipleOf = number("multipleOf")
+
+	s.minLength = count("minLength")
+	s.maxLength = count("maxLength")
+	if pattern, ok := m["pattern"].(string); ok {
+		s.pattern, err = regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("compile pattern of %s: %w", ptr, err)
+		}
+	}
+
+	s.allOf = subs("allOf")
+	s.anyOf = subs("anyOf")
+	s.oneOf = subs("oneOf")
+	s.not = sub("not")
+	s.ifSchema = sub("if")
+	s.thenSchema = sub("then")
+	s.elseSchema = sub("else")
+	return err
+}
+
+// resolve returns the schema referenced by the local reference, e.g. "#/$defs/port".
+func (c *jsonSchemaCompiler) resolve(ref string) (*jsonSchema, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported reference %s, references must be local", ref)
+	}
+	ptr, err := url.PathUnescape(ref[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid reference %s: %w", ref, err)
+	}
+
+	raw := c.root
+	if ptr != "" {
+		for _, token := range strings.Split(strings.TrimPrefix(ptr, "/"), "/") {
+			token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+			switch node := raw.(type) {
+			case map[string]any:
+				raw = node[token]
+			case []any:
+				i, err := strconv.Atoi(token)
+				if err != nil || i < 0 || i >= len(node) {
+					return nil, fmt.Errorf("unresolvable reference %s", ref)
+				}
+				raw = node[i]
+			default:
+				raw = nil
+			}
+			if raw == nil {
+				return nil, fmt.Errorf("unresolvable reference %s", ref)
+			}
+		}
+	}
+	return c.compile(raw, "#"+ptr)
+}
+
+func jsonPointerEscape(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
+
+// validate appends the violations of the value at the path to the violations.
+func (s *jsonSchema) validate(v any, path string, violations *[]SchemaViolation) {
+	report := func(keyword, format string, args ...any) {
+		*violations = append(*violations, SchemaViolation{Path: path, Keyword: keyword, Message: fmt.Sprintf(format, args...)})
+	}
+	if s.always != nil {
+		if !*s.always {
+			report("false", "no value is allowed")
+		}
+		return
+	}
+	if s.ref != nil {
+		s.ref.validate(v, path, violations)
+	}
+
+	v = jsonNormalize(v)
+	kind := jsonType(v)
+	if len(s.types) > 0 && !slices.ContainsFunc(s.types, func(t string) bool { return t == kind || (t == "number" && kind == "integer") }) {
+		report("type", "got %s, want %s", kind, strings.Join(s.types, " or "))
+		return
+	}
+	if s.enum != nil && !slices.ContainsFunc(s.enum, func(e any) bool { return jsonEqual(e, v) }) {
+		report("enum", "must be one of %s, got %s", jsonString(s.enum), jsonString(v))
+	}
+	if s.constant != nil && !jsonEqual(*s.constant, v) {
+		report("const", "must be %s, got %s", jsonString(*s.constant), jsonString(v))
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		s.validateObject(v, path, violations)
+	case []any:
+		s.validateArray(v, path, violations)
+	case float64:
+		if s.minimum != nil && v < *s.minimum {
+			report("minimum", "must be >= %v, got %v", *s.minimum, v)
+		}
+		if s.maximum != nil && v > *s.maximum {
+			report("maximum", "must be <= %v, got %v", *s.maximum, v)
+		}
+		if s.exclusiveMinimum != nil && v <= *s.exclusiveMinimum {
+			report("exclusiveMinimum", "must be > %v, got %v", *s.exclusiveMinimum, v)
+		}
+		if s.exclusiveMaximum != nil && v >= *s.exclusiveMaximum {
+			report("exclusiveMaximum", "must be < %v, got %v", *s.exclusiveMaximum, v)
+		}
+		if s.multipleOf != nil && *s.multipleOf > 0 {
+			if q := v / *s.multipleOf; math.Abs(q-math.Round(q)) > 1e-9 {
+				report("multipleOf", "must be a multiple of %v, got %v", *s.multipleOf, v)
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.minLength != nil && n < *s.minLength {
+			report("minLength", "must be at least %d characters long, got %d", *s.minLength, n)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			report("maxLength", "must be at most %d characters long, got %d", *s.maxLength, n)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			report("pattern", "must match %s, got %q", s.pattern, v)
+		}
+	}
+
+	for _, sub := range s.allOf {
+		sub.validate(v, path, violations)
+	}
+	if len(s.anyOf) > 0 && !slices.ContainsFunc(s.anyOf, func(sub *jsonSchema) bool { return sub.valid(v, path) }) {
+		report("anyOf", "must match at least one schema of anyOf")
+	}
+	if len(s.oneOf) > 0 {
+		matched := 0
+		for _, sub := range s.oneOf {
+			if sub.valid(v, path) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			report("oneOf", "must match exactly one schema of oneOf, matched %d", matched)
+		}
+	}
+	if s.not != nil && s.not.valid(v, path) {
+		report("not", "must not match the schema of not")
+	}
+	if s.ifSchema != nil {
+		if s.ifSchema.valid(v, path) {
+			if s.thenSchema != nil {
+				s.thenSchema.validate(v, path, violations)
+			}
+		} else if s.elseSchema != nil {
+			s.elseSchema.validate(v, path, violations)
+		}
+	}
+}
+
+// valid reports whether the value at the path is valid.
+func (s *jsonSchema) valid(v any, path string) bool {
+	var violations []SchemaViolation
+	s.validate(v, path, &violations)
+	return len(violations) == 0
+}
+
+func (s *jsonSchema) validateObject(m map[string]any, path string, violations *[]SchemaViolation) {
+	report := func(path, keyword, format string, args ...any) {
+		*violations = append(*violations, SchemaViolation{Path: path, Keyword: keyword, Message: fmt.Sprintf(format, args...)})
+	}
+	if s.minProperties != nil && len(m) < *s.minProperties {
+		report(path, "minProperties", "must have at least %d keys, got %d", *s.minProperties, len(m))
+	}
+	if s.maxProperties != nil && len(m) > *s.maxProperties {
+		report(path, "maxProperties", "must have at most %d keys, got %d", *s.maxProperties, len(m))
+	}
+	for _, name := range s.required {
+		if _, ok := m[name]; !ok {
+			report(jsonPath(path, name), "required", "is required")
+		}
+	}
+	for name, deps := range s.dependentRequired {
+		if _, ok := m[name]; !ok {
+			continue
+		}
+		for _, dep := range deps {
+			if _, ok := m[dep]; !ok {
+				report(jsonPath(path, dep), "dependentRequired", "is required by %s", jsonPath(path, name))
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		keyPath := jsonPath(path, key)
+		if s.propertyNames != nil && !s.propertyNames.valid(key, keyPath) {
+			report(keyPath, "propertyNames", "key doesn't match the schema of propertyNames")
+		}
+
+		matched := false
+		if sub, ok := s.properties[key]; ok {
+			sub.validate(m[key], keyPath, violations)
+			matched = true
+		}
+		for _, pattern := range s.patternProperties {
+			if pattern.pattern.MatchString(key) {
+				pattern.schema.validate(m[key], keyPath, violations)
+				matched = true
+			}
+		}
+		if !matched && s.additional != nil {
+			if s.additional.always != nil && !*s.additional.always {
+				report(keyPath, "additionalProperties", "key is not allowed")
+				continue
+			}
+			s.additional.validate(m[key], keyPath, violations)
+		}
+	}
+}
+
+func (s *jsonSchema) validateArray(list []any, path string, violations *[]SchemaViolation) {
+	report := func(keyword, format string, args ...any) {
+		*violations = append(*violations, SchemaViolation{Path: path, Keyword: keyword, Message: fmt.Sprintf(format, args...)})
+	}
+	if s.minItems != nil && len(list) < *s.minItems {
+		report("minItems", "must have at least %d elements, got %d", *s.minItems, len(list))
+	}
+	if s.maxItems != nil && len(list) > *s.maxItems {
+		report("maxItems", "must have at most %d elements, got %d", *s.maxItems, len(list))
+	}
+	if s.uniqueItems {
+	unique:
+		for i := range list {
+			for j := 0; j < i; j++ {
+				if jsonEqual(list[i], list[j]) {
+					report("uniqueItems", "elements %d and %d are equal", j, i)
+					break unique
+				}
+			}
+		}
+	}
+
+	for i, elem := range list {
+		elemPath := path + "[" + strconv.Itoa(i) + "]"
+		switch {
+		case i < len(s.prefixItems):
+			s.prefixItems[i].validate(elem, elemPath, violations)
+		case s.items != nil:
+			s.items.validate(elem, elemPath, violations)
+		}
+	}
+
+	if s.contains != nil {
+		n := 0
+		for i, elem := range list {
+			if s.contains.valid(elem, path+"["+strconv.Itoa(i)+"]") {
+				n++
+			}
+		}
+		minContains := 1
+		if s.minContains != nil {
+			minContains = *s.minContains
+		}
+		if n < minContains {
+			report("contains", "must contain at least %d matching elements, got %d", minContains, n)
+		}
+		if s.maxContains != nil && n > *s.maxContains {
+			report("maxContains", "must contain at most %d matching elements, got %d", *s.maxContains, n)
+		}
+	}
+}
+
+// jsonPath returns the path of the key of the object at the path.
+func jsonPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// jsonNormalize returns the configuration value as a JSON value, e.g. integers as float64 and
+// times as strings.
+func jsonNormalize(v any) any {
+	switch v := v.(type) {
+	case nil, bool, string, float64, map[string]any, []any:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case time.Duration:
+		return v.String()
+	case []byte:
+		return string(v)
+	case fmt.Stringer:
+		if reflect.ValueOf(v).Kind() == reflect.Struct {
+			return v.String()
+		}
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Slice, reflect.Array:
+		list := make([]any, rv.Len())
+		for i := range list {
+			list[i] = rv.Index(i).Interface()
+		}
+		return list
+	case reflect.Map:
+		m := make(map[string]any, rv.Len())
+		for it := rv.MapRange(); it.Next(); {
+			m[fmt.Sprint(it.Key().Interface())] = it.Value().Interface()
+		}
+		return m
+	}
+	return fmt.Sprint(v)
+}
+
+// jsonType returns the JSON schema type of the normalized value.
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// jsonEqual reports whether the values are equal as JSON values.
+func jsonEqual(a, b any) bool {
+	a, b = jsonNormalize(a), jsonNormalize(b)
+	switch a := a.(type) {
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, ok := b[key]
+			if !ok || !jsonEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// jsonString returns the value as JSON for violations.
+func jsonString(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
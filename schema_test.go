@@ -0,0 +1,262 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		value  any
+		// want are the violations as "path keyword".
+		want []string
+	}{
+		{
+			name:   "valid",
+			schema: `{"type": "object", "properties": {"port": {"type": "integer", "minimum": 1}}, "required": ["port"]}`,
+			value:  map[string]any{"port": 8080},
+		},
+		{
+			name:   "type",
+			schema: `{"properties": {"port": {"type": "integer"}, "ratio": {"type": ["number", "null"]}, "name": {"type": "string"}}}`,
+			value:  map[string]any{"port": 1.5, "ratio": nil, "name": 1},
+			want:   []string{"name type", "port type"},
+		},
+		{
+			name:   "required names are lowercased",
+			schema: `{"required": ["Port", "Host"]}`,
+			value:  map[string]any{"port": 8080},
+			want:   []string{"host required"},
+		},
+		{
+			name:   "enum and const",
+			schema: `{"properties": {"level": {"enum": ["debug", "info"]}, "version": {"const": 2}, "tags": {"const": ["a", 1]}}}`,
+			value:  map[string]any{"level": "trace", "version": int64(2), "tags": []any{"a", uint8(1)}},
+			want:   []string{"level enum"},
+		},
+		{
+			name: "numbers",
+			schema: `{"properties": {
+				"a": {"minimum": 1, "maximum": 10},
+				"b": {"exclusiveMinimum": 1, "exclusiveMaximum": 10},
+				"c": {"minimum": 1, "exclusiveMinimum": true},
+				"d": {"multipleOf": 0.01},
+				"e": {"multipleOf": 0.01}
+			}}`,
+			value: map[string]any{"a": 11, "b": 10, "c": 1, "d": 0.3, "e": 0.305},
+			want:  []string{"a maximum", "b exclusiveMaximum", "c exclusiveMinimum", "e multipleOf"},
+		},
+		{
+			name:   "strings",
+			schema: `{"properties": {"a": {"minLength": 3}, "b": {"maxLength": 2}, "c": {"pattern": "^[a-z]+$"}, "d": {"type": "string", "pattern": "^\\d+s$"}}}`,
+			value:  map[string]any{"a": "äö", "b": "äö", "c": "ABC", "d": 30 * time.Second},
+			want:   []string{"a minLength", "c pattern"},
+		},
+		{
+			name: "objects",
+			schema: `{
+				"properties": {"port": {}},
+				"patternProperties": {"^x-": {"type": "string"}},
+				"additionalProperties": false,
+				"propertyNames": {"maxLength": 5},
+				"maxProperties": 3
+			}`,
+			value: map[string]any{"port": 1, "x-id": 2, "x-name": "a", "extra": true},
+			want:  []string{"(root) maxProperties", "extra additionalProperties", "x-id type", "x-name propertyNames"},
+		},
+		{
+			name:   "additional properties schema",
+			schema: `{"properties": {"port": {}}, "additionalProperties": {"type": "string"}, "minProperties": 3}`,
+			value:  map[string]any{"port": 1, "host": 2},
+			want:   []string{"(root) minProperties", "host type"},
+		},
+		{
+			name:   "dependencies",
+			schema: `{"dependentRequired": {"tls": ["cert", "Key"]}, "properties": {"db": {"dependencies": {"user": ["password"]}}}}`,
+			value:  map[string]any{"tls": true, "cert": "c.pem", "db": map[string]any{"user": "app"}},
+			want:   []string{"db.password dependentRequired", "key dependentRequired"},
+		},
+		{
+			name:   "arrays",
+			schema: `{"properties": {"a": {"prefixItems": [{"type": "string"}], "items": {"type": "integer"}, "minItems": 4}, "b": {"uniqueItems": true, "maxItems": 2}}}`,
+			value:  map[string]any{"a": []any{1, 2, "c"}, "b": []any{map[string]any{"x": 1}, map[string]any{"x": 1}, 3}},
+			want:   []string{"a minItems", "a[0] type", "a[2] type", "b maxItems", "b uniqueItems"},
+		},
+		{
+			name:   "tuples of draft 2019-09",
+			schema: `{"items": [{"type": "string"}, {"type": "integer"}], "additionalItems": false}`,
+			value:  []string{"a", "b", "c"},
+			want:   []string{"[1] type", "[2] false"},
+		},
+		{
+			name:   "contains",
+			schema: `{"properties": {"a": {"contains": {"const": "x"}, "minContains": 2}, "b": {"contains": {"const": "x"}, "maxContains": 1}, "c": {"contains": {"const": "x"}}}}`,
+			value:  map[string]any{"a": []any{"x", "y"}, "b": []any{"x", "x"}, "c": []any{}},
+			want:   []string{"a contains", "b maxContains", "c contains"},
+		},
+		{
+			name: "combinators",
+			schema: `{"properties": {
+				"a": {"allOf": [{"type": "integer"}, {"minimum": 5}]},
+				"b": {"anyOf": [{"type": "string"}, {"type": "boolean"}]},
+				"c": {"oneOf": [{"type": "integer"}, {"minimum": 0}]},
+				"d": {"not": {"type": "null"}}
+			}}`,
+			value: map[string]any{"a": 3, "b": 1, "c": 1, "d": nil},
+			want:  []string{"a minimum", "b anyOf", "c oneOf", "d not"},
+		},
+		{
+			name: "conditionals",
+			schema: `{"properties": {"db": {"items": {
+				"if": {"properties": {"driver": {"const": "postgres"}}},
+				"then": {"required": ["sslmode"]},
+				"else": {"required": ["path"]}
+			}}}}`,
+			value: map[string]any{"db": []any{
+				map[string]any{"driver": "postgres"},
+				map[string]any{"driver": "postgres", "sslmode": "require"},
+				map[string]any{"driver": "sqlite"},
+			}},
+			want: []string{"db[0].sslmode required", "db[2].path required"},
+		},
+		{
+			name: "references",
+			schema: `{
+				"$defs": {"port": {"type": "integer", "maximum": 65535}, "a/b": {"type": "string"}},
+				"properties": {
+					"port": {"$ref": "#/$defs/port"},
+					"name": {"$ref": "#/$defs/a~1b"},
+					"children": {"items": {"$ref": "#"}}
+				}
+			}`,
+			value: map[string]any{"port": 70000, "name": 1, "children": []any{map[string]any{"port": "x"}}},
+			want:  []string{"children[0].port type", "name type", "port maximum"},
+		},
+		{
+			name:   "false schema",
+			schema: `false`,
+			value:  map[string]any{},
+			want:   []string{"(root) false"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := compileJSONSchema([]byte(tt.schema))
+			if err != nil {
+				t.Fatalf("compileJSONSchema() error = %v", err)
+			}
+			var violations []SchemaViolation
+			schema.validate(tt.value, "", &violations)
+			var got []string
+			for _, v := range violations {
+				path := v.Path
+				if path == "" {
+					path = "(root)"
+				}
+				got = append(got, path+" "+v.Keyword)
+			}
+			slices.Sort(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("violations = %q, want %q: %v", got, tt.want, violations)
+			}
+		})
+	}
+}
+
+func TestCompileJSONSchemaError(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		wantErr string
+	}{
+		{name: "syntax", schema: `{"type": }`, wantErr: "parse schema: invalid character '}' looking for beginning of value"},
+		{name: "not a schema", schema: `{"properties": {"port": 1}}`, wantErr: "schema at #/properties/port is a float64, not an object or boolean"},
+		{name: "remote reference", schema: `{"$ref": "https://example.com/schema.json"}`, wantErr: "unsupported reference https://example.com/schema.json, references must be local"},
+		{name: "unresolvable reference", schema: `{"items": {"$ref": "#/$defs/missing"}}`, wantErr: "unresolvable reference #/$defs/missing"},
+		{name: "pattern", schema: `{"properties": {"a": {"pattern": "("}}}`, wantErr: "compile pattern of #/properties/a: error parsing regexp: missing closing ): `(`"},
+		{name: "unsupported keyword", schema: `{"properties": {"a": {"unevaluatedProperties": false}}}`, wantErr: "unsupported keyword unevaluatedProperties of #/properties/a"},
+		{name: "misspelled keyword", schema: `{"type": "object", "propertys": {}}`, wantErr: "unsupported keyword propertys of #"},
+		{name: "schema dependency", schema: `{"dependencies": {"a": {"required": ["b"]}}}`, wantErr: "unsupported schema dependency a of #"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileJSONSchema([]byte(tt.schema))
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("compileJSONSchema() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCompileJSONSchemaAnnotations(t *testing.T) {
+	schema := `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id": "https://example.com/app.json",
+		"$comment": "configuration of app",
+		"title": "app",
+		"description": "configuration",
+		"properties": {
+			"port": {"$ref": "#/$defs/port", "default": 8080, "examples": [80], "deprecated": true},
+			"cert": {"type": "string", "contentEncoding": "base64", "contentMediaType": "application/x-pem-file", "readOnly": true},
+			"since": {"type": "string", "format": "date-time", "writeOnly": true}
+		},
+		"$defs": {"port": {"type": "integer"}},
+		"definitions": {"unused": {"unevaluatedProperties": false}}
+	}`
+	if _, err := compileJSONSchema([]byte(schema)); err != nil {
+		t.Errorf("compileJSONSchema() error = %v", err)
+	}
+}
+
+func TestWithJSONSchema(t *testing.T) {
+	schema := []byte(`{
+		"type": "object",
+		"properties": {
+			"Server": {"type": "object", "properties": {"Port": {"type": "integer", "maximum": 65535}}, "required": ["port"]}
+		}
+	}`)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yaml")
+	writeFile(t, path, "server:\n  port: 70000\n")
+	_, err := New(WithPaths(dir), WithJSONSchema(schema))
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("New() error = %v, want SchemaError", err)
+	}
+	want := fmt.Sprintf("config violates json schema: server.port (file: %s:2:3): must be <= 65535, got 70000", path)
+	if !strings.HasSuffix(err.Error(), want) {
+		t.Errorf("New() error = %v, want %q", err, want)
+	}
+
+	writeFile(t, path, "server:\n  port: 8080\n")
+	h, err := New(WithPaths(dir), WithJSONSchema(schema))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	// invalid reloads keep the previous configuration
+	writeFile(t, path, "server:\n  host: a\n")
+	err = h.Reload(context.Background())
+	var reloadErr *ReloadError
+	if !errors.As(err, &reloadErr) || !errors.As(err, &schemaErr) || len(schemaErr.Violations) != 1 || schemaErr.Violations[0].Path != "server.port" || schemaErr.Violations[0].Keyword != "required" {
+		t.Fatalf("Reload() error = %v, want ReloadError of the required server.port", err)
+	}
+	if got, _ := Get[int](h, "server.port"); got != 8080 {
+		t.Errorf("server.port = %d, want 8080", got)
+	}
+
+	_, err = New(WithPaths(dir), WithJSONSchema([]byte(`{"$ref": "other.json"}`)))
+	if err == nil || err.Error() != "compile json schema: unsupported reference other.json, references must be local" {
+		t.Errorf("New() error = %v, want error compiling the schema", err)
+	}
+}
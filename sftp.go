@@ -0,0 +1,92 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// SFTPConfig configures a source of the configuration files of a remote host downloaded over
+// SFTP, see WithSFTP. Files are downloaded with the sftp command, so authentication and host
+// keys are configured like for ssh, e.g. by ~/.ssh/config, SSH keys or an agent.
+type SFTPConfig struct {
+	// Host is the remote host, e.g. "bastion.internal".
+	Host string
+	// Port of the SSH server. Defaults to the port configured for ssh, or 22.
+	Port int
+	// User logged in as. Defaults to the user configured for ssh.
+	User string
+	// Path of the remote directory searched for configuration files, or of a single
+	// configuration file, e.g. "/etc/myapp".
+	Path string
+	// IdentityFile is the private key authenticating the user, e.g. "~/.ssh/id_ed25519".
+	IdentityFile string
+	// Options are options of ssh, e.g. "StrictHostKeyChecking=accept-new".
+	Options []string
+}
+
+// sftpSource provides the configuration files of a directory of a remote host.
+type sftpSource struct {
+	config SFTPConfig
+}
+
+func (s *sftpSource) load(ctx context.Context, want func(rel string) bool) ([]document, error) {
+	dir, err := os.MkdirTemp("", "hydra-sftp-")
+	if err != nil {
+		return nil, fmt.Errorf("create download directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	remote := path.Clean(s.config.Path)
+	err = s.sftp(ctx, "lcd "+sftpQuote(dir), "get -r "+sftpQuote(remote))
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := "sftp://" + s.config.Host + "/"
+	if parent := strings.Trim(path.Dir(remote), "/"); parent != "." && parent != "" {
+		prefix += parent + "/"
+	}
+	fsys := &fsSource{fsys: os.DirFS(dir), root: path.Base(remote), prefix: prefix}
+	return fsys.load(ctx, want)
+}
+
+// sftp runs the commands with the sftp command in batch mode, in which it fails once a
+// command fails.
+func (s *sftpSource) sftp(ctx context.Context, commands ...string) error {
+	// credentials can't be prompted for
+	args := []string{"-q", "-b", "-", "-o", "BatchMode=yes"}
+	if s.config.Port != 0 {
+		args = append(args, "-P", strconv.Itoa(s.config.Port))
+	}
+	if s.config.IdentityFile != "" {
+		args = append(args, "-i", s.config.IdentityFile)
+	}
+	for _, o := range s.config.Options {
+		args = append(args, "-o", o)
+	}
+	destination := s.config.Host
+	if s.config.User != "" {
+		destination = s.config.User + "@" + destination
+	}
+
+	cmd := exec.CommandContext(ctx, "sftp", append(args, "--", destination)...)
+	cmd.Stdin = strings.NewReader(strings.Join(commands, "\n") + "\n")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("run sftp (host: %s): %w: %s", s.config.Host, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
+
+// sftpQuote quotes the path as an argument of a command of sftp.
+func sftpQuote(p string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(p) + `"`
+}
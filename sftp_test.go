@@ -0,0 +1,137 @@
+package hydra
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// sftpTestScript fakes the sftp command, downloading files of the directory $SFTP_ROOT as the
+// remote host. It records its arguments in $SFTP_ROOT/args.
+const sftpTestScript = `#!/bin/sh
+printf '%s\n' "$@" > "$SFTP_ROOT/args"
+while read -r line; do
+	eval "set -- $line"
+	case "$1" in
+	lcd) cd "$2" || exit 1 ;;
+	get) cp -R "$SFTP_ROOT$3" . 2>/dev/null || { echo "File \"$3\" not found." >&2; exit 1; } ;;
+	esac
+done
+`
+
+// fakeSFTP installs the fake sftp command and returns the directory of the remote host.
+func fakeSFTP(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("sftp is faked by a shell script")
+	}
+	bin, root := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(bin, "sftp"), sftpTestScript)
+	if err := os.Chmod(filepath.Join(bin, "sftp"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("SFTP_ROOT", root)
+	return root
+}
+
+func TestSFTPSourceLoad(t *testing.T) {
+	root := fakeSFTP(t)
+	writeFile(t, filepath.Join(root, "etc/myapp/app.yaml"), "port: 8080\n")
+	writeFile(t, filepath.Join(root, "etc/myapp/conf.d/db.yaml"), "db: local\n")
+	writeFile(t, filepath.Join(root, "etc/myapp/notes.txt"), "notes\n")
+	writeFile(t, filepath.Join(root, "etc/my app.yaml"), "name: spaced\n")
+
+	tests := []struct {
+		name    string
+		path    string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "directory",
+			path: "/etc/myapp",
+			want: []string{"sftp://bastion.internal/etc/myapp/app.yaml", "sftp://bastion.internal/etc/myapp/conf.d/db.yaml"},
+		},
+		{
+			name: "file",
+			path: "/etc/myapp/app.yaml",
+			want: []string{"sftp://bastion.internal/etc/myapp/app.yaml"},
+		},
+		{
+			name: "quoted",
+			path: "/etc/my app.yaml",
+			want: []string{"sftp://bastion.internal/etc/my app.yaml"},
+		},
+		{
+			name:    "missing",
+			path:    "/etc/other",
+			wantErr: `run sftp (host: bastion.internal): exit status 1: File "/etc/other" not found.`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &sftpSource{config: SFTPConfig{Host: "bastion.internal", Path: tt.path}}
+			docs, err := s.load(context.Background(), func(rel string) bool { return strings.HasSuffix(rel, ".yaml") })
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("load() error = %v", err)
+			}
+			var names []string
+			for _, doc := range docs {
+				names = append(names, doc.name)
+			}
+			if !slices.Equal(sorted(names), tt.want) {
+				t.Errorf("names = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestSFTPSourceArgs(t *testing.T) {
+	root := fakeSFTP(t)
+	writeFile(t, filepath.Join(root, "etc/myapp/app.yaml"), "port: 8080\n")
+
+	h, err := New(WithSFTP(SFTPConfig{
+		Host:         "bastion.internal",
+		Port:         2222,
+		User:         "deploy",
+		Path:         "/etc/myapp",
+		IdentityFile: "~/.ssh/id_ed25519",
+		Options:      []string{"StrictHostKeyChecking=accept-new"},
+	}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+	if got, _ := Get[int](h, "port"); got != 8080 {
+		t.Errorf("port = %d, want 8080", got)
+	}
+
+	b, err := os.ReadFile(filepath.Join(root, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"-q", "-b", "-", "-o", "BatchMode=yes", "-P", "2222", "-i", "~/.ssh/id_ed25519",
+		"-o", "StrictHostKeyChecking=accept-new", "--", "deploy@bastion.internal",
+	}
+	if got := strings.Fields(string(b)); !slices.Equal(got, want) {
+		t.Errorf("args = %v, want %v", got, want)
+	}
+}
+
+func TestSFTPQuote(t *testing.T) {
+	if got, want := sftpQuote(`/etc/my "app"\conf`), `"/etc/my \"app\"\\conf"`; got != want {
+		t.Errorf("sftpQuote() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,70 @@
+package hydra
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Snapshot is a read-only view of a merged configuration that isn't committed yet, passed to
+// validators set by WithValidator.
+type Snapshot struct {
+	settings map[string]any
+	origins  map[string]string
+	files    []string
+}
+
+func newSnapshot(st *staged) Snapshot {
+	return Snapshot{
+		settings: st.settings,
+		origins:  st.origins,
+		files:    st.files,
+	}
+}
+
+// Get returns the value of the dotted key, e.g. "db.pool.size", or nil if it isn't set.
+func (s Snapshot) Get(key string) any {
+	return copyValue(lookup(s.settings, strings.ToLower(key)))
+}
+
+// IsSet reports whether the dotted key is set.
+func (s Snapshot) IsSet(key string) bool {
+	return lookup(s.settings, strings.ToLower(key)) != nil
+}
+
+// AllSettings returns a copy of the merged settings.
+func (s Snapshot) AllSettings() map[string]any {
+	return copyValue(s.settings).(map[string]any)
+}
+
+// Unmarshal decodes the merged settings into the struct pointed to by rawVal, like
+// viper.Unmarshal.
+func (s Snapshot) Unmarshal(rawVal any, opts ...viper.DecoderConfigOption) error {
+	return decode(copyValue(s.settings), rawVal, opts...)
+}
+
+// Origin returns the path of the configuration file that set the key, like Hydra.Origin.
+func (s Snapshot) Origin(key string) string {
+	return origin(s.origins, strings.ToLower(key))
+}
+
+// Files returns the paths of the merged configuration files in load order.
+func (s Snapshot) Files() []string {
+	return slices.Clone(s.files)
+}
+
+// ValidationError is returned by New, and reported as ReloadError, if a validator set by
+// WithValidator rejects a configuration.
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("config rejected by validator: %s", e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
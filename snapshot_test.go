@@ -0,0 +1,122 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "a.yaml")
+	override := filepath.Join(dir, "b.yaml")
+	writeFile(t, base, "db:\n  pool: 4\n  host: localhost\nname: app\n")
+	writeFile(t, override, "db:\n  Pool: 8\n")
+
+	var snapshot Snapshot
+	h, err := New(WithPaths(dir), WithValidator(func(s Snapshot) error {
+		snapshot = s
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	if got := snapshot.Get("DB.Pool"); got != 8 {
+		t.Errorf("Get(DB.Pool) = %v, want 8", got)
+	}
+	if !snapshot.IsSet("db.host") || snapshot.IsSet("db.user") {
+		t.Errorf("IsSet(db.host), IsSet(db.user) = %t, %t, want true, false", snapshot.IsSet("db.host"), snapshot.IsSet("db.user"))
+	}
+	if got := snapshot.Origin("db.pool"); got != override {
+		t.Errorf("Origin(db.pool) = %s, want %s", got, override)
+	}
+	if got := snapshot.Origin("db.host"); got != base {
+		t.Errorf("Origin(db.host) = %s, want %s", got, base)
+	}
+	if got := snapshot.Files(); !reflect.DeepEqual(got, []string{base, override}) {
+		t.Errorf("Files() = %v, want %v", got, []string{base, override})
+	}
+	var c struct {
+		DB struct {
+			Pool int
+			Host string
+		}
+	}
+	if err := snapshot.Unmarshal(&c); err != nil || c.DB.Pool != 8 || c.DB.Host != "localhost" {
+		t.Errorf("Unmarshal() = %+v, %v", c, err)
+	}
+
+	// snapshots are read-only
+	snapshot.Get("db").(map[string]any)["pool"] = 0
+	snapshot.AllSettings()["name"] = "other"
+	snapshot.Files()[0] = "other.yaml"
+	if got, _ := Get[int](h, "db.pool"); got != 8 || snapshot.Get("db.pool") != 8 || snapshot.Get("name") != "app" || snapshot.Files()[0] != base {
+		t.Errorf("snapshot changed by its copies")
+	}
+}
+
+func TestWithValidator(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yaml")
+	writeFile(t, path, "db:\n  pool: 10\n  max: 5\n")
+	var calls []string
+	poolSize := func(s Snapshot) error {
+		calls = append(calls, "pool")
+		if pool, max := s.Get("db.pool").(int), s.Get("db.max").(int); pool > max {
+			return fmt.Errorf("pool size %d exceeds %d connections", pool, max)
+		}
+		return nil
+	}
+	named := func(s Snapshot) error {
+		calls = append(calls, "named")
+		if !s.IsSet("name") {
+			return errors.New("name is missing")
+		}
+		return nil
+	}
+	_, err := New(WithPaths(dir), WithValidator(poolSize), WithValidator(named))
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || err.Error() != "config rejected by validator: pool size 10 exceeds 5 connections" {
+		t.Fatalf("New() error = %v, want ValidationError", err)
+	}
+	// validators after a failed one don't run
+	if !reflect.DeepEqual(calls, []string{"pool"}) {
+		t.Errorf("validators run = %v, want [pool]", calls)
+	}
+
+	writeFile(t, path, "name: app\ndb:\n  pool: 5\n  max: 5\n")
+	h, err := New(WithPaths(dir), WithValidator(poolSize), WithValidator(named))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	steps := []struct {
+		data    string
+		wantErr string
+		pool    int
+	}{
+		{data: "name: app\ndb:\n  pool: 4\n  max: 5\n", pool: 4},
+		{data: "db:\n  pool: 4\n  max: 5\n", wantErr: "reload config: config rejected by validator: name is missing", pool: 4},
+		{data: "name: app\ndb:\n  pool: 6\n  max: 5\n", wantErr: "reload config: config rejected by validator: pool size 6 exceeds 5 connections", pool: 4},
+		{data: "name: app\ndb:\n  pool: 6\n  max: 8\n", pool: 6},
+	}
+	for i, step := range steps {
+		writeFile(t, path, step.data)
+		err := h.Reload(context.Background())
+		switch {
+		case step.wantErr == "" && err != nil:
+			t.Fatalf("step %d: Reload() error = %v", i, err)
+		case step.wantErr != "" && (!errors.As(err, &validationErr) || err.Error() != step.wantErr):
+			t.Fatalf("step %d: Reload() error = %v, want %q", i, err, step.wantErr)
+		}
+		if got, _ := Get[int](h, "db.pool"); got != step.pool {
+			t.Errorf("step %d: db.pool = %d, want %d", i, got, step.pool)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// sourceRetryBackoff is how long a failed watch of a source waits until it's started
+	// again, doubled for subsequent failures up to maxSourceRetryBackoff.
+	sourceRetryBackoff    = time.Second
+	maxSourceRetryBackoff = time.Minute
+)
+
+// Source provides configuration documents which aren't files found in the paths, e.g. documents
+// of a proprietary configuration store, see WithSource. Documents of a source are merged like
+// configuration files found in a path added after all paths, and their changes are notified like
+// changes of configuration files.
+type Source interface {
+	// Load returns the configuration documents the source provides. Documents whose formats
+	// aren't supported are ignored.
+	Load(ctx context.Context) ([]Document, error)
+	// Watch blocks until the context is done or watching fails, invoking changed whenever
+	// documents of the source may have changed, including once watching has started. Sources
+	// that can't be watched return ErrWatchUnsupported, and are polled if set by PollEvery.
+	Watch(ctx context.Context, changed func()) error
+}
+
+// ErrWatchUnsupported is returned by Source.Watch if the source can't be watched.
+var ErrWatchUnsupported = errors.New("watch unsupported")
+
+// Document is a configuration document provided by a Source.
+type Document struct {
+	// Name identifies the document among the documents of the source, e.g. "myapp/app.yaml",
+	// and defaults to Path. Among all configuration files, e.g. in ConfigFiles and changes,
+	// the document is named by the source followed by its name, e.g. "store/myapp/app.yaml"
+	// for a source whose String returns "store", so documents of different sources don't
+	// collide.
+	Name string
+	// Path of the document relative to the source, e.g. "myapp/app.yaml". Its extension
+	// determines the format of the document, and it's used to place the configuration, see
+	// WithKeyNamespace.
+	Path string
+	Data []byte
+}
+
+// source provides configuration documents which aren't files found in the paths, e.g. files of
+// an fs.FS. Documents of a source are merged like configuration files found in a path added
+// after all paths.
+type source interface {
+	// load returns the configuration documents the source provides. Only documents whose name
+	// relative to the source is accepted by want need to be returned.
+	load(ctx context.Context, want func(rel string) bool) ([]document, error)
+}
+
+// document is a configuration document provided by a source.
+type document struct {
+	// name identifies the document among all configuration files, e.g. in ConfigFiles and
+	// changes.
+	name string
+	// rel is the name of the document relative to the source. Its extension determines the
+	// format of the document, and it's used to place the configuration, see WithKeyNamespace.
+	rel  string
+	data []byte
+}
+
+// customSource is a Source added by WithSource.
+type customSource struct {
+	Source
+	// id identifies the source, see sourceConfig, and prefixes the names of its documents.
+	id string
+}
+
+func (s customSource) load(ctx context.Context, want func(rel string) bool) ([]document, error) {
+	docs, err := s.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var loaded []document
+	for _, doc := range docs {
+		if !want(doc.Path) {
+			continue
+		}
+		name := doc.Name
+		if name == "" {
+			name = doc.Path
+		}
+		loaded = append(loaded, document{name: s.id + "/" + name, rel: doc.Path, data: doc.Data})
+	}
+	return loaded, nil
+}
+
+func (s customSource) watch(ctx context.Context, changed func()) error {
+	return s.Watch(ctx, changed)
+}
+
+// sourceConfig is a source added by an option like WithFS.
+type sourceConfig struct {
+	source
+	// id identifies the source in errors and in options like Priority.
+	id string
+}
+
+// sourcedDocument is a loaded document with the index of its source.
+type sourcedDocument struct {
+	document
+	source int
+}
+
+// document returns the loaded document with the name, or the staged one while a rescan is
+// staged.
+func (h *Hydra) document(name string) (sourcedDocument, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stagedDocuments != nil {
+		doc, ok := h.stagedDocuments[name]
+		return doc, ok
+	}
+	doc, ok := h.documents[name]
+	return doc, ok
+}
+
+// readFile returns the contents of the configuration file or document.
+func (h *Hydra) readFile(path string) ([]byte, error) {
+	if doc, ok := h.document(path); ok {
+		return doc.data, nil
+	}
+	return os.ReadFile(path)
+}
+
+// exists reports whether the configuration file or document exists.
+func (h *Hydra) exists(path string) bool {
+	if _, ok := h.document(path); ok {
+		return true
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// format returns the format of the configuration file or document, derived from its extension.
+func (h *Hydra) format(path string) string {
+	if doc, ok := h.document(path); ok {
+		path = doc.rel
+	}
+	ext := strings.ToLower(h.configExt(path))
+	if format, ok := h.options.extensionAliases[ext]; ok {
+		return format
+	}
+	return ext
+}
+
+// sourceFiles loads the documents of the source at the index and returns their names.
+func (h *Hydra) sourceFiles(ctx context.Context, i int) ([]string, error) {
+	_, err := h.syncSource(ctx, i)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var files []string
+	for name, doc := range h.documents {
+		if doc.source == i {
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
+
+// loadSource loads the documents of the source at the index with supported formats.
+func (h *Hydra) loadSource(ctx context.Context, i int) ([]document, error) {
+	return h.options.sources[i].load(ctx, func(rel string) bool {
+		return slices.Contains(h.options.supportedExtensions, h.configExt(rel)) && !h.isOtherEnvironment(rel)
+	})
+}
+
+// syncSource loads the documents of the source at the index again and returns events for
+// documents that have been created, written or removed since they were last loaded, sorted in
+// the load order.
+func (h *Hydra) syncSource(ctx context.Context, i int) ([]fsnotify.Event, error) {
+	docs, err := h.loadSource(ctx, i)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	var events []fsnotify.Event
+	current := make(map[string]bool)
+	for _, doc := range docs {
+		current[doc.name] = true
+
+		prev, ok := h.documents[doc.name]
+		switch {
+		case !ok:
+			events = append(events, fsnotify.Event{Name: doc.name, Op: fsnotify.Create})
+		case !bytes.Equal(prev.data, doc.data):
+			events = append(events, fsnotify.Event{Name: doc.name, Op: fsnotify.Write})
+		}
+		h.documents[doc.name] = sourcedDocument{document: doc, source: i}
+	}
+	for name, doc := range h.documents {
+		if doc.source == i && !current[name] {
+			events = append(events, fsnotify.Event{Name: name, Op: fsnotify.Remove})
+			delete(h.documents, name)
+		}
+	}
+	h.mu.Unlock()
+
+	slices.SortFunc(events, func(a, b fsnotify.Event) int {
+		return h.compareLoadOrder(a.Name, b.Name)
+	})
+	return events, nil
+}
+
+// closingSource is a source holding resources, e.g. connections, which are released once hydra
+// is closed.
+type closingSource interface {
+	source
+	close() error
+}
+
+// closeSources releases the resources held by the sources.
+func (h *Hydra) closeSources() error {
+	var errs []error
+	for _, s := range h.options.sources {
+		if c, ok := s.source.(closingSource); ok {
+			err := c.close()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("close source (source: %s): %w", s.id, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// watchedSource is a source notifying changes of its documents itself instead of being polled.
+type watchedSource interface {
+	source
+	// watch blocks until the context is done or watching fails, invoking changed whenever
+	// documents of the source may have changed, including once watching has started.
+	watch(ctx context.Context, changed func()) error
+}
+
+// watchSources watches the sources notifying their changes and polls the other sources for
+// which an interval is set by PollEvery, and sends the events of changed documents until the
+// context is done or hydra is closed. Watches failing are reported and started again.
+func (h *Hydra) watchSources(ctx context.Context, events chan<- []fsnotify.Event) {
+	for i, s := range h.options.sources {
+		// watches may notify changes concurrently, while loads need to be applied in order
+		var mu sync.Mutex
+		reload := func() {
+			if h.paused.Load() {
+				// changes are caught up by Resume
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			evs, err := h.syncSource(ctx, i)
+			if err != nil && ctx.Err() != nil {
+				// stopping
+				return
+			}
+			if err != nil {
+				h.reportError(&SourceError{Source: s.id, Err: err})
+				return
+			}
+			if len(evs) == 0 {
+				return
+			}
+
+			select {
+			case events <- evs:
+			case <-ctx.Done():
+			case <-h.closed:
+			}
+		}
+
+		interval := h.options.pollIntervals[s.id]
+		if w, ok := s.source.(watchedSource); ok {
+			go func() {
+				err := h.watchSource(ctx, s.id, w, reload)
+				if errors.Is(err, ErrWatchUnsupported) && interval > 0 {
+					h.pollSource(ctx, interval, reload)
+				}
+			}()
+			continue
+		}
+		if interval > 0 {
+			go h.pollSource(ctx, interval, reload)
+		}
+	}
+}
+
+// pollSource polls the source in the interval until the context is done or hydra is closed.
+func (h *Hydra) pollSource(ctx context.Context, interval time.Duration, reload func()) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			reload()
+		case <-ctx.Done():
+			return
+		case <-h.closed:
+			return
+		}
+	}
+}
+
+// watchSource watches the source until the context is done or hydra is closed, starting the
+// watch again with an increasing backoff if it fails. ErrWatchUnsupported is returned if the
+// source can't be watched.
+func (h *Hydra) watchSource(ctx context.Context, id string, w watchedSource, changed func()) error {
+	backoff := sourceRetryBackoff
+	for {
+		started := time.Now()
+		err := w.watch(ctx, changed)
+		if ctx.Err() != nil || h.isClosed() {
+			return nil
+		}
+		if errors.Is(err, ErrWatchUnsupported) {
+			return err
+		}
+		h.reportError(&SourceError{Source: id, Err: fmt.Errorf("watch: %w", err)})
+
+		if time.Since(started) > maxSourceRetryBackoff {
+			// the watch was running fine for a while
+			backoff = sourceRetryBackoff
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil
+		case <-h.closed:
+			return nil
+		}
+		backoff = min(backoff*2, maxSourceRetryBackoff)
+	}
+}
+
+// SourceError is reported when the documents of a source, e.g. added by WithFS, can't be
+// loaded while polling, or when watching the source fails.
+type SourceError struct {
+	Source string
+	Err    error
+}
+
+func (e *SourceError) Error() string {
+	return fmt.Sprintf("load source (source: %s): %s", e.Source, e.Err)
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
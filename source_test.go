@@ -0,0 +1,171 @@
+package hydra
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memSource is a Source of documents held in memory, polled for changes.
+type memSource struct {
+	mu   sync.Mutex
+	docs []Document
+}
+
+func newMemSource(docs ...Document) *memSource {
+	return &memSource{docs: docs}
+}
+
+func (s *memSource) Load(context.Context) ([]Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Document(nil), s.docs...), nil
+}
+
+func (s *memSource) Watch(context.Context, func()) error {
+	return ErrWatchUnsupported
+}
+
+func (s *memSource) String() string {
+	return "mem"
+}
+
+func (s *memSource) set(docs ...Document) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.docs = docs
+}
+
+// eventually fails the test unless the condition is met within a few seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// start starts watching the configuration of hydra until the test ends.
+func start(t *testing.T, h *Hydra) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = h.Start(ctx, nil)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestSource(t *testing.T) {
+	src := newMemSource(Document{Path: "app.yaml", Data: []byte("x: 1\n")})
+	h, err := New(WithSource(src, PollEvery(10*time.Millisecond)), WithAutoReload())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got := h.ConfigFiles(); len(got) != 1 || got[0] != "mem/app.yaml" {
+		t.Errorf("ConfigFiles() = %v, want [mem/app.yaml]", got)
+	}
+	start(t, h)
+
+	steps := []struct {
+		docs []Document
+		want map[string]int
+	}{
+		{
+			docs: []Document{{Path: "app.yaml", Data: []byte("x: 2\n")}},
+			want: map[string]int{"x": 2},
+		},
+		{
+			docs: []Document{
+				{Path: "app.yaml", Data: []byte("x: 2\n")},
+				{Path: "db.json", Data: []byte(`{"y": 3}`)},
+			},
+			want: map[string]int{"x": 2, "y": 3},
+		},
+		{
+			// invalid documents are rejected, keeping the previous configuration
+			docs: []Document{
+				{Path: "app.yaml", Data: []byte("x: [\n")},
+				{Path: "db.json", Data: []byte(`{"y": 3}`)},
+			},
+			want: map[string]int{"x": 2, "y": 3},
+		},
+		{
+			docs: []Document{{Path: "db.json", Data: []byte(`{"y": 4}`)}},
+			want: map[string]int{"y": 4},
+		},
+	}
+	for i, step := range steps {
+		src.set(step.docs...)
+		eventually(t, "reload", func() bool {
+			for key, want := range step.want {
+				if got, _ := Get[int](h, key); got != want {
+					return false
+				}
+			}
+			return true
+		})
+		if i == len(steps)-1 {
+			if _, ok := Lookup[int](h, "x"); ok {
+				t.Error("x is set after its document was removed")
+			}
+		}
+	}
+}
+
+func TestSourceDocumentNames(t *testing.T) {
+	a := newMemSource(Document{Path: "config.yaml", Data: []byte("a: 1\n")})
+	b := newMemSource(Document{Path: "config.yaml", Data: []byte("b: 2\n")})
+	h, err := New(WithSource(a), WithSource(b), WithSource(unnamedSource{
+		src: newMemSource(Document{Name: "app", Path: "config.yaml", Data: []byte("c: 3\n")}),
+	}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	want := []string{"mem/config.yaml", "mem#2/config.yaml", "source:2/app"}
+	if got := h.ConfigFiles(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ConfigFiles() = %v, want %v", got, want)
+	}
+	for key, want := range map[string]int{"a": 1, "b": 2, "c": 3} {
+		if got, _ := Get[int](h, key); got != want {
+			t.Errorf("Get(%s) = %d, want %d", key, got, want)
+		}
+	}
+
+	// documents of the same name are tracked per source
+	b.set(Document{Path: "config.yaml", Data: []byte("b: 4\n")})
+	err = h.Reload(context.Background())
+	if err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if got, _ := Get[int](h, "a"); got != 1 {
+		t.Errorf("a after reload = %d, want 1", got)
+	}
+	if got, _ := Get[int](h, "b"); got != 4 {
+		t.Errorf("b after reload = %d, want 4", got)
+	}
+}
+
+// unnamedSource is a Source without a String method.
+type unnamedSource struct {
+	src *memSource
+}
+
+func (s unnamedSource) Load(ctx context.Context) ([]Document, error) {
+	return s.src.Load(ctx)
+}
+
+func (s unnamedSource) Watch(ctx context.Context, changed func()) error {
+	return s.src.Watch(ctx, changed)
+}
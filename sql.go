@@ -0,0 +1,103 @@
+package hydra
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// SQLConfig configures a source of configuration documents stored as rows of a database table,
+// see WithSQL.
+type SQLConfig struct {
+	DB *sql.DB
+	// Table has a row per document with the columns name, data and format, e.g. "app", the
+	// contents of the document and its format, e.g. "yaml". Defaults to "config". The columns
+	// aren't reserved words of common databases, so they're selected without quotes.
+	Table string
+	// Query selects the name, data and format of the documents instead of selecting them from
+	// the table, e.g. "SELECT setting, body, 'yaml' FROM settings WHERE app = 'myapp'".
+	Query string
+	// Notify blocks until a change of the documents is notified or the context is done, e.g. by
+	// waiting for a notification of Postgres LISTEN. If set, the documents are reloaded on
+	// notifications instead of being polled.
+	Notify func(ctx context.Context) error
+}
+
+// sqlSource provides the configuration documents stored as rows of a database table.
+type sqlSource struct {
+	config SQLConfig
+}
+
+func (s *sqlSource) load(ctx context.Context, want func(rel string) bool) ([]document, error) {
+	query := s.config.Query
+	if query == "" {
+		query = "SELECT name, data, format FROM " + sqlTable(s.config)
+	}
+
+	rows, err := s.config.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("query documents: %w", err)
+	}
+	defer rows.Close()
+
+	var docs []document
+	for rows.Next() {
+		var name, format string
+		var data []byte
+		err := rows.Scan(&name, &data, &format)
+		if err != nil {
+			return nil, fmt.Errorf("scan document: %w", err)
+		}
+
+		rel := name
+		if format != "" && path.Ext(name) != "."+strings.ToLower(format) {
+			rel = name + "." + strings.ToLower(format)
+		}
+		if !want(rel) {
+			continue
+		}
+
+		docs = append(docs, document{name: sqlSourceID(s.config) + "/" + name, rel: rel, data: data})
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("read documents: %w", err)
+	}
+	return docs, nil
+}
+
+// sqlTable returns the table of the documents.
+func sqlTable(c SQLConfig) string {
+	if c.Table == "" {
+		return "config"
+	}
+	return c.Table
+}
+
+// sqlSourceID returns the ID of the source of the documents in errors and options like
+// Priority, e.g. "sql:config", or the query if it's set.
+func sqlSourceID(c SQLConfig) string {
+	if c.Query != "" {
+		return "sql:" + c.Query
+	}
+	return "sql:" + sqlTable(c)
+}
+
+// notifiedSQLSource is a sqlSource whose changes are notified, see SQLConfig.Notify.
+type notifiedSQLSource struct {
+	*sqlSource
+}
+
+func (s notifiedSQLSource) watch(ctx context.Context, changed func()) error {
+	// changes made before waiting for notifications are caught up
+	changed()
+	for {
+		err := s.config.Notify(ctx)
+		if err != nil {
+			return fmt.Errorf("wait for notification: %w", err)
+		}
+		changed()
+	}
+}
@@ -0,0 +1,152 @@
+package hydra
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// fakeSQLDriver serves the rows of its tables to queries selecting the name, data and format of
+// a table.
+type fakeSQLDriver struct {
+	mu     sync.Mutex
+	tables map[string][][]driver.Value
+}
+
+func (d *fakeSQLDriver) Connect(context.Context) (driver.Conn, error) { return fakeSQLConn{d}, nil }
+func (d *fakeSQLDriver) Driver() driver.Driver                        { return nil }
+
+type fakeSQLConn struct{ d *fakeSQLDriver }
+
+func (c fakeSQLConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeSQLStmt{d: c.d, query: query}, nil
+}
+func (fakeSQLConn) Close() error              { return nil }
+func (fakeSQLConn) Begin() (driver.Tx, error) { return nil, errors.New("transactions unsupported") }
+
+type fakeSQLStmt struct {
+	d     *fakeSQLDriver
+	query string
+}
+
+func (fakeSQLStmt) Close() error  { return nil }
+func (fakeSQLStmt) NumInput() int { return 0 }
+func (fakeSQLStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("exec unsupported")
+}
+
+func (s fakeSQLStmt) Query([]driver.Value) (driver.Rows, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	for table, rows := range s.d.tables {
+		if s.query == "SELECT name, data, format FROM "+table {
+			return &fakeSQLRows{rows: rows}, nil
+		}
+	}
+	return nil, errors.New("syntax error")
+}
+
+type fakeSQLRows struct{ rows [][]driver.Value }
+
+func (*fakeSQLRows) Columns() []string { return []string{"name", "data", "format"} }
+func (*fakeSQLRows) Close() error      { return nil }
+
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestSQLSourceLoad(t *testing.T) {
+	rows := [][]driver.Value{
+		{"app", []byte("port: 8080\n"), "YAML"},
+		{"db.json", []byte(`{"host": "db"}`), "json"},
+		{"notes", []byte("notes"), "txt"},
+	}
+	tests := []struct {
+		name   string
+		config SQLConfig
+		want   []document
+	}{
+		{
+			name:   "default table",
+			config: SQLConfig{},
+			want: []document{
+				{name: "sql:config/app", rel: "app.yaml", data: []byte("port: 8080\n")},
+				{name: "sql:config/db.json", rel: "db.json", data: []byte(`{"host": "db"}`)},
+			},
+		},
+		{
+			name:   "table",
+			config: SQLConfig{Table: "settings"},
+			want: []document{
+				{name: "sql:settings/app", rel: "app.yaml", data: []byte("port: 8080\n")},
+				{name: "sql:settings/db.json", rel: "db.json", data: []byte(`{"host": "db"}`)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &fakeSQLDriver{tables: map[string][][]driver.Value{sqlTable(tt.config): rows}}
+			tt.config.DB = sql.OpenDB(d)
+			defer tt.config.DB.Close()
+
+			s := &sqlSource{config: tt.config}
+			docs, err := s.load(context.Background(), func(rel string) bool { return rel != "notes.txt" })
+			if err != nil {
+				t.Fatalf("load() error = %v", err)
+			}
+			if !reflect.DeepEqual(docs, tt.want) {
+				t.Errorf("load() = %+v, want %+v", docs, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithSQL(t *testing.T) {
+	d := &fakeSQLDriver{tables: map[string][][]driver.Value{
+		"config": {{"app", []byte("port: 8080\n"), "yaml"}},
+	}}
+	db := sql.OpenDB(d)
+	defer db.Close()
+
+	notified := make(chan struct{})
+	h, err := New(WithSQL(SQLConfig{
+		DB: db,
+		Notify: func(ctx context.Context) error {
+			select {
+			case <-notified:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}), WithAutoReload())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got, _ := Get[int](h, "port"); got != 8080 {
+		t.Fatalf("port = %d, want 8080", got)
+	}
+	if want := []string{"sql:config/app"}; !reflect.DeepEqual(h.ConfigFiles(), want) {
+		t.Errorf("ConfigFiles() = %q, want %q", h.ConfigFiles(), want)
+	}
+	start(t, h)
+
+	d.mu.Lock()
+	d.tables["config"] = [][]driver.Value{{"app", []byte("port: 9090\n"), "yaml"}}
+	d.mu.Unlock()
+	notified <- struct{}{}
+	eventually(t, "port 9090", func() bool {
+		got, _ := Get[int](h, "port")
+		return got == 9090
+	})
+}
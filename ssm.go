@@ -0,0 +1,146 @@
+package hydra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultSSMRefresh is how often parameters are read again by default.
+const defaultSSMRefresh = 5 * time.Minute
+
+// SSMConfig configures a source of parameters stored in AWS Systems Manager Parameter Store, see
+// WithSSM.
+type SSMConfig struct {
+	// Path selects the parameters under it, e.g. "/myapp/prod". Parameters are placed under keys
+	// by their names relative to the path, e.g. "/myapp/prod/database/host" under
+	// "database.host". Defaults to "/".
+	Path string
+	// Region of Parameter Store. Defaults to the AWS_REGION and AWS_DEFAULT_REGION environment
+	// variables.
+	Region string
+	// Endpoint of Parameter Store, e.g. of LocalStack. Defaults to the AWS_ENDPOINT_URL_SSM and
+	// AWS_ENDPOINT_URL environment variables, or Parameter Store.
+	Endpoint    string
+	Credentials AWSCredentials
+	// Refresh is how often parameters are read again to detect their changes. Defaults to 5
+	// minutes.
+	Refresh time.Duration
+	// Client sends the requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// ssmSource provides the parameters under a path as a configuration document.
+type ssmSource struct {
+	config SSMConfig
+}
+
+type ssmParameter struct {
+	Name  string
+	Type  string
+	Value string
+}
+
+func (s *ssmSource) load(ctx context.Context, want func(rel string) bool) ([]document, error) {
+	root := "/" + strings.Trim(s.config.Path, "/")
+	rel := "ssm.json"
+	if root != "/" {
+		rel = root[1:] + ".json"
+	}
+	if !want(rel) {
+		// parameters are decoded as JSON
+		return nil, nil
+	}
+
+	settings := make(map[string]any)
+	token := ""
+	for {
+		params, next, err := s.get(ctx, root, token)
+		if err != nil {
+			return nil, fmt.Errorf("get parameters (path: %s): %w", root, err)
+		}
+
+		for _, p := range params {
+			name := strings.Trim(strings.TrimPrefix(p.Name, root), "/")
+			if name == "" {
+				// the path is the name of a single parameter
+				name = p.Name[strings.LastIndex(p.Name, "/")+1:]
+			}
+
+			var value any = p.Value
+			if p.Type == "StringList" {
+				value = strings.Split(p.Value, ",")
+			}
+			setPath(settings, strings.Split(strings.ToLower(name), "/"), value)
+		}
+
+		if next == "" {
+			break
+		}
+		token = next
+	}
+
+	b, err := json.Marshal(settings)
+	if err != nil {
+		return nil, fmt.Errorf("encode parameters (path: %s): %w", root, err)
+	}
+	return []document{{name: "ssm:" + root, rel: rel, data: b}}, nil
+}
+
+// watch reads the parameters again in the refresh interval.
+func (s *ssmSource) watch(ctx context.Context, changed func()) error {
+	refresh := s.config.Refresh
+	if refresh <= 0 {
+		refresh = defaultSSMRefresh
+	}
+
+	// changes made before watching are caught up
+	changed()
+
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			changed()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// get returns a page of the parameters under the path, decrypting SecureString parameters, and
+// the token of the next page, if any.
+func (s *ssmSource) get(ctx context.Context, root, token string) ([]ssmParameter, string, error) {
+	input := map[string]any{"Path": root, "Recursive": true, "WithDecryption": true}
+	if token != "" {
+		input["NextToken"] = token
+	}
+
+	var output struct {
+		Parameters []ssmParameter
+		NextToken  string
+	}
+	err := awsJSON(ctx, s.config.Client, "ssm", s.config.Region, s.config.Endpoint, s.config.Credentials, "AmazonSSM.GetParametersByPath", input, &output)
+	if err != nil {
+		return nil, "", err
+	}
+	return output.Parameters, output.NextToken, nil
+}
+
+// setPath sets the value under the path of keys, creating the maps along it. A value in the way
+// is replaced by a map.
+func setPath(settings map[string]any, path []string, value any) {
+	for _, key := range path[:len(path)-1] {
+		m, ok := settings[key].(map[string]any)
+		if !ok {
+			m = make(map[string]any)
+			settings[key] = m
+		}
+		settings = m
+	}
+	settings[path[len(path)-1]] = value
+}
@@ -0,0 +1,167 @@
+package hydra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ssmTestServer is a Parameter Store endpoint of the region "eu-west-1", returning parameters by
+// pages of two.
+type ssmTestServer struct {
+	mu     sync.Mutex
+	params map[string]ssmParameter
+}
+
+// put sets the value of the String parameter.
+func (s *ssmTestServer) put(name, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.params[name] = ssmParameter{Name: name, Type: "String", Value: value}
+}
+
+func (s *ssmTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/ssm/aws4_request") {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"__type":"UnrecognizedClientException","message":"The security token included in the request is invalid."}`)
+		return
+	}
+	var input struct {
+		Path           string
+		Recursive      bool
+		WithDecryption bool
+		NextToken      string
+	}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil || r.Header.Get("X-Amz-Target") != "AmazonSSM.GetParametersByPath" || !input.Recursive || !input.WithDecryption {
+		http.Error(w, `{"__type":"ValidationException"}`, http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for name := range s.params {
+		if strings.HasPrefix(name, strings.TrimSuffix(input.Path, "/")+"/") {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	start := 0
+	if input.NextToken != "" {
+		fmt.Sscanf(input.NextToken, "page-%d", &start)
+	}
+	end := min(start+2, len(names))
+	output := map[string]any{"Parameters": []ssmParameter{}}
+	for _, name := range names[start:end] {
+		output["Parameters"] = append(output["Parameters"].([]ssmParameter), s.params[name])
+	}
+	if end < len(names) {
+		output["NextToken"] = fmt.Sprintf("page-%d", end)
+	}
+	json.NewEncoder(w).Encode(output)
+}
+
+func TestSSMSourceLoad(t *testing.T) {
+	server := &ssmTestServer{params: map[string]ssmParameter{
+		"/myapp/prod/database/host":     {Name: "/myapp/prod/database/host", Type: "String", Value: "db.internal"},
+		"/myapp/prod/database/Password": {Name: "/myapp/prod/database/Password", Type: "SecureString", Value: "hunter2"},
+		"/myapp/prod/hosts":             {Name: "/myapp/prod/hosts", Type: "StringList", Value: "a,b,c"},
+		"/myapp/prod/port":              {Name: "/myapp/prod/port", Type: "String", Value: "8080"},
+		"/myapp/dev/port":               {Name: "/myapp/dev/port", Type: "String", Value: "8000"},
+	}}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		config  SSMConfig
+		rel     string
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "path",
+			config: SSMConfig{Path: "/myapp/prod/"},
+			rel:    "myapp/prod.json",
+			want:   `{"database":{"host":"db.internal","password":"hunter2"},"hosts":["a","b","c"],"port":"8080"}`,
+		},
+		{
+			name:   "root",
+			config: SSMConfig{},
+			rel:    "ssm.json",
+			want:   `{"myapp":{"dev":{"port":"8000"},"prod":{"database":{"host":"db.internal","password":"hunter2"},"hosts":["a","b","c"],"port":"8080"}}}`,
+		},
+		{
+			name:   "no parameters",
+			config: SSMConfig{Path: "myapp/staging"},
+			rel:    "myapp/staging.json",
+			want:   `{}`,
+		},
+		{
+			name:    "other region",
+			config:  SSMConfig{Path: "/myapp/prod", Region: "us-east-1"},
+			wantErr: "get parameters (path: /myapp/prod): unexpected status: 400 Bad Request: UnrecognizedClientException: The security token included in the request is invalid.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// regions, endpoints and credentials default to the environment
+			t.Setenv("AWS_REGION", "eu-west-1")
+			t.Setenv("AWS_ENDPOINT_URL_SSM", srv.URL)
+			t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+			t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+			tt.config.Client = srv.Client()
+			docs, err := (&ssmSource{config: tt.config}).load(context.Background(), func(string) bool { return true })
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("load() error = %v", err)
+			}
+			if len(docs) != 1 || docs[0].rel != tt.rel || string(docs[0].data) != tt.want {
+				t.Errorf("load() = %s, want %s of %s", docs, tt.want, tt.rel)
+			}
+		})
+	}
+}
+
+func TestSSMSourceWatch(t *testing.T) {
+	server := &ssmTestServer{params: map[string]ssmParameter{}}
+	server.put("/myapp/port", "8080")
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	h, err := New(WithSSM(SSMConfig{
+		Path:        "/myapp",
+		Region:      "eu-west-1",
+		Endpoint:    srv.URL,
+		Credentials: AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret"},
+		Refresh:     20 * time.Millisecond,
+		Client:      srv.Client(),
+	}), WithAutoReload())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got, _ := Get[int](h, "port"); got != 8080 {
+		t.Fatalf("port = %d, want 8080", got)
+	}
+	start(t, h)
+
+	server.put("/myapp/port", "9090")
+	eventually(t, "port 9090", func() bool {
+		got, _ := Get[int](h, "port")
+		return got == 9090
+	})
+}
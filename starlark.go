@@ -0,0 +1,258 @@
+package hydra
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// starlarkCodec decodes Starlark files, e.g.
+//
+//	regions = ["eu", "us"]
+//	config = {
+//	    "replicas": {r: 3 if r == "eu" else 1 for r in regions},
+//	}
+//
+// The configuration is the dict of the global "config" or, if there's none, the globals not
+// starting with "_", except functions. Files are evaluated by go.starlark.net without load
+// statements or I/O, and evaluations are limited in steps, so they can't block reloads.
+// Recursion isn't allowed. The memory evaluations allocate isn't limited, so Starlark files
+// must be trusted. Encoding writes the configuration as the dict of "config".
+type starlarkCodec struct{}
+
+// starlarkMaxSteps limits the steps evaluating a Starlark file, e.g. iterations of loops.
+const starlarkMaxSteps = 1_000_000
+
+// starlarkOptions allow the statements configuration files commonly use at the top level.
+var starlarkOptions = &syntax.FileOptions{
+	Set:             true,
+	While:           true,
+	TopLevelControl: true,
+	GlobalReassign:  true,
+}
+
+// starlarkPredeclared replace built-ins of the universe. Built-ins like list preallocate the
+// elements of ranges, so ranges are limited in length to the steps an iteration may take.
+var starlarkPredeclared = starlark.StringDict{
+	"range": starlark.NewBuiltin("range", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		r, err := starlark.Call(thread, starlark.Universe["range"], args, kwargs)
+		if err != nil {
+			return nil, err
+		}
+		if n := starlark.Len(r); n > starlarkMaxSteps {
+			return nil, fmt.Errorf("range: %d elements exceed %d steps", n, starlarkMaxSteps)
+		}
+		return r, nil
+	}),
+}
+
+func (starlarkCodec) Decode(b []byte, v map[string]any) error {
+	thread := &starlark.Thread{Name: "config"}
+	thread.SetMaxExecutionSteps(starlarkMaxSteps)
+	globals, err := starlark.ExecFileOptions(starlarkOptions, thread, "config.star", b, starlarkPredeclared)
+	if err != nil {
+		return starlarkError(err)
+	}
+
+	m := make(map[string]any)
+	if config, ok := globals["config"]; ok {
+		d, ok := config.(*starlark.Dict)
+		if !ok {
+			return fmt.Errorf("config must be a dict, not %s", config.Type())
+		}
+		value, err := starExport(d)
+		if err != nil {
+			return fmt.Errorf("export config: %w", err)
+		}
+		m = value.(map[string]any)
+	} else {
+		for name, value := range globals {
+			if _, ok := value.(starlark.Callable); ok || strings.HasPrefix(name, "_") {
+				continue
+			}
+			exported, err := starExport(value)
+			if err != nil {
+				return fmt.Errorf("export global (name: %s): %w", name, err)
+			}
+			m[name] = exported
+		}
+	}
+	for key, value := range m {
+		v[key] = value
+	}
+	return nil
+}
+
+func (starlarkCodec) Encode(v map[string]any) ([]byte, error) {
+	value, err := starImport(v)
+	if err != nil {
+		return nil, err
+	}
+	return []byte("config = " + value.String() + "\n"), nil
+}
+
+// starlarkError returns the error of the evaluation with the position of the statement or
+// expression failing first, e.g. "line 2, column 5: undefined: z".
+func starlarkError(err error) error {
+	var pos syntax.Position
+	var msg string
+	var syntaxErr syntax.Error
+	var resolveErrs resolve.ErrorList
+	var evalErr *starlark.EvalError
+	switch {
+	case errors.As(err, &syntaxErr):
+		pos, msg = syntaxErr.Pos, syntaxErr.Msg
+	case errors.As(err, &resolveErrs) && len(resolveErrs) > 0:
+		pos, msg = resolveErrs[0].Pos, resolveErrs[0].Msg
+	case errors.As(err, &evalErr):
+		msg = evalErr.Msg
+		// the innermost frame of Starlark code, built-ins don't have positions
+		for i := len(evalErr.CallStack) - 1; i >= 0; i-- {
+			if evalErr.CallStack[i].Pos.Line > 0 {
+				pos = evalErr.CallStack[i].Pos
+				break
+			}
+		}
+	default:
+		return err
+	}
+	if pos.Line == 0 {
+		return errors.New(msg)
+	}
+	return fmt.Errorf("line %d, column %d: %s", pos.Line, pos.Col, msg)
+}
+
+// starExport returns the Starlark value as a configuration value. Integers not fitting into an
+// int are exported as *big.Int.
+func starExport(v starlark.Value) (any, error) {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.Int:
+		if n, ok := v.Int64(); ok && int64(int(n)) == n {
+			return int(n), nil
+		}
+		return v.BigInt(), nil
+	case starlark.Float:
+		return float64(v), nil
+	case starlark.String:
+		return string(v), nil
+	case *starlark.Dict:
+		m := make(map[string]any, v.Len())
+		for _, item := range v.Items() {
+			s, ok := item[0].(starlark.String)
+			if !ok {
+				return nil, fmt.Errorf("dict key %s is not a string", item[0])
+			}
+			value, err := starExport(item[1])
+			if err != nil {
+				return nil, err
+			}
+			m[string(s)] = value
+		}
+		return m, nil
+	case starlark.Indexable:
+		// lists, tuples and ranges
+		list := make([]any, 0, v.Len())
+		for i := range v.Len() {
+			value, err := starExport(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("%s isn't configuration", v.Type())
+}
+
+// starImport returns the configuration value as a Starlark value.
+func starImport(v any) (starlark.Value, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		d := starlark.NewDict(len(keys))
+		for _, key := range keys {
+			value, err := starImport(v[key])
+			if err != nil {
+				return nil, err
+			}
+			// setting keys of new dicts doesn't fail
+			_ = d.SetKey(starlark.String(key), value)
+		}
+		return d, nil
+	case []any:
+		elems := make([]starlark.Value, 0, len(v))
+		for _, elem := range v {
+			value, err := starImport(elem)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, value)
+		}
+		return starlark.NewList(elems), nil
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(v), nil
+	case string:
+		return starlark.String(v), nil
+	case float64:
+		return starlark.Float(v), nil
+	case float32:
+		return starlark.Float(v), nil
+	case int:
+		return starlark.MakeInt(v), nil
+	case int8, int16, int32, int64:
+		return starlark.MakeInt64(toInt64(v)), nil
+	case uint, uint8, uint16, uint32, uint64:
+		return starlark.MakeUint64(toUint64(v)), nil
+	case *big.Int:
+		return starlark.MakeBigInt(v), nil
+	}
+	return nil, fmt.Errorf("encode value: unsupported type %T", v)
+}
+
+// toInt64 returns the signed integer as an int64.
+func toInt64(v any) int64 {
+	switch v := v.(type) {
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	}
+	return 0
+}
+
+// toUint64 returns the unsigned integer as a uint64.
+func toUint64(v any) uint64 {
+	switch v := v.(type) {
+	case uint:
+		return uint64(v)
+	case uint8:
+		return uint64(v)
+	case uint16:
+		return uint64(v)
+	case uint32:
+		return uint64(v)
+	case uint64:
+		return v
+	}
+	return 0
+}
@@ -0,0 +1,135 @@
+package hydra
+
+import (
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStarlarkCodecDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]any
+	}{
+		{
+			name: "globals",
+			in:   "port = 8080\nhosts = [\"a\", \"b\"]\n_private = 1\ndef f():\n    return 1\n",
+			want: map[string]any{"port": 8080, "hosts": []any{"a", "b"}},
+		},
+		{
+			name: "config dict",
+			in:   "ignored = 1\nconfig = {\"server\": {\"port\": 80 * 100}}\n",
+			want: map[string]any{"server": map[string]any{"port": 8000}},
+		},
+		{
+			name: "functions and comprehensions",
+			in: "def port(n):\n    return 8000 + n\n" +
+				"ports = [port(n) for n in range(3) if n != 1]\n" +
+				"names = {k: v.upper() for k, v in {\"a\": \"x\"}.items()}\n",
+			want: map[string]any{"ports": []any{8000, 8002}, "names": map[string]any{"a": "X"}},
+		},
+		{
+			name: "strings",
+			in: "x = \"%s:%d\" % (\"host\", 80)\ny = \"{}-{name}\".format(1, name=\"n\")\n" +
+				"z = \",\".join([\"a\", \"b\"])\nw = \"aXbX\".replace(\"X\", \"--\")\n",
+			want: map[string]any{"x": "host:80", "y": "1-n", "z": "a,b", "w": "a--b--"},
+		},
+		{
+			name: "loops and mutation",
+			in: "l = []\nfor _i in range(3):\n    l.append(_i)\nl += [9]\nl.extend((7,))\n" +
+				"d = {}\nd[\"k\"] = len(l)\n",
+			want: map[string]any{"l": []any{0, 1, 2, 9, 7}, "d": map[string]any{"k": 5}},
+		},
+		{
+			name: "big integers and hashes",
+			in:   "big = 1 << 70\nsame = hash(\"a\") == hash(\"a\")\n",
+			want: map[string]any{"big": new(big.Int).Lsh(big.NewInt(1), 70), "same": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]any{}
+			err := starlarkCodec{}.Decode([]byte(tt.in), got)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStarlarkCodecDecodeError(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		wantErr string
+	}{
+		{name: "syntax", in: "x = [1,\ny = 2\n", wantErr: "line 2, column 4: got '=', want ']'"},
+		{name: "undefined", in: "x = 1\ny = z\n", wantErr: "line 2, column 5: undefined: z"},
+		{name: "fail", in: "\nfail(\"boom\")\n", wantErr: "line 2, column 5: fail: boom"},
+		{name: "steps", in: "x = 0\nwhile True:\n    x += 1\n", wantErr: "too many steps"},
+		{name: "recursion", in: "def f():\n    return f()\nx = f()\n", wantErr: "called recursively"},
+		{name: "repetition", in: "x = \"ab\" * (1 << 40)\n", wantErr: "repeat count 1099511627776 too large"},
+		{name: "list repetition", in: "x = [1] * (1 << 40)\n", wantErr: "repeat count 1099511627776 too large"},
+		{name: "range", in: "x = list(range(1 << 40))\n", wantErr: "exceed 1000000 steps"},
+		{name: "load", in: "load(\"other.star\", \"x\")\n", wantErr: "load not implemented"},
+		{name: "config", in: "config = [1]\n", wantErr: "config must be a dict, not list"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := starlarkCodec{}.Decode([]byte(tt.in), map[string]any{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Decode() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStarlarkCodecRoundTrip(t *testing.T) {
+	in := map[string]any{
+		"server": map[string]any{"port": 8080, "hosts": []any{"a", "b"}, "tls": true},
+		"ratio":  1.5,
+		"motd":   "line\n\"quoted\"",
+		"none":   nil,
+	}
+	b, err := starlarkCodec{}.Encode(in)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	got := map[string]any{}
+	err = starlarkCodec{}.Decode(b, got)
+	if err != nil {
+		t.Fatalf("Decode(%s) error = %v", b, err)
+	}
+	if !reflect.DeepEqual(got, in) {
+		t.Errorf("Decode(Encode()) = %#v, want %#v", got, in)
+	}
+}
+
+func TestWithStarlark(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.star"), "port = 8000 + 80\n")
+
+	h, err := New(WithPaths(dir))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+	if got := h.ConfigFiles(); len(got) != 0 {
+		t.Errorf("ConfigFiles() without WithStarlark = %v, want none", got)
+	}
+
+	h, err = New(WithPaths(dir), WithStarlark())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+	if got, err := Get[int](h, "port"); err != nil || got != 8080 {
+		t.Errorf("Get(port) = %v, %v, want 8080", got, err)
+	}
+}
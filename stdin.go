@@ -0,0 +1,43 @@
+package hydra
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// stdinSource provides the configuration document piped into the process, see WithStdin.
+type stdinSource struct {
+	file   *os.File
+	format string
+
+	// the input is read once, as it can't be read again
+	once sync.Once
+	doc  *document
+	err  error
+}
+
+func (s *stdinSource) load(_ context.Context, want func(rel string) bool) ([]document, error) {
+	s.once.Do(func() {
+		info, err := s.file.Stat()
+		if err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			// nothing is piped into a terminal
+			return
+		}
+
+		b, err := io.ReadAll(s.file)
+		if err != nil {
+			s.err = fmt.Errorf("read stdin: %w", err)
+			return
+		}
+
+		s.doc = &document{name: "stdin", rel: "stdin." + strings.ToLower(s.format), data: b}
+	})
+	if s.err != nil || s.doc == nil || !want(s.doc.rel) {
+		return nil, s.err
+	}
+	return []document{*s.doc}, nil
+}
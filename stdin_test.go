@@ -0,0 +1,94 @@
+package hydra
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// pipeStdin returns a file holding the data as if it was piped into the process.
+func pipeStdin(t *testing.T, data string) *os.File {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stdin")
+	writeFile(t, path, data)
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestStdinSourceLoad(t *testing.T) {
+	s := &stdinSource{file: pipeStdin(t, "port: 8080\n"), format: "YAML"}
+	docs, err := s.load(context.Background(), func(string) bool { return true })
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	if len(docs) != 1 || docs[0].name != "stdin" || docs[0].rel != "stdin.yaml" || string(docs[0].data) != "port: 8080\n" {
+		t.Fatalf("load() = %+v, want stdin.yaml", docs)
+	}
+
+	// the input is read once and loaded again on reloads
+	docs, err = s.load(context.Background(), func(string) bool { return true })
+	if err != nil || len(docs) != 1 || string(docs[0].data) != "port: 8080\n" {
+		t.Errorf("load() again = %+v, %v, want stdin.yaml", docs, err)
+	}
+
+	docs, err = s.load(context.Background(), func(rel string) bool { return rel != "stdin.yaml" })
+	if err != nil || len(docs) != 0 {
+		t.Errorf("load() filtered = %+v, %v, want none", docs, err)
+	}
+
+	// a closed file can't be read
+	f := pipeStdin(t, "port: 8080\n")
+	f.Close()
+	s = &stdinSource{file: f, format: "yaml"}
+	if _, err := s.load(context.Background(), func(string) bool { return true }); err == nil {
+		t.Error("load() of closed stdin succeeded")
+	}
+}
+
+func TestWithStdin(t *testing.T) {
+	stdin := os.Stdin
+	t.Cleanup(func() { os.Stdin = stdin })
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.yaml"), "port: 9090\n")
+	writeFile(t, filepath.Join(dir, "defaults.yaml"), "port: 7070\nhost: localhost\nname: defaults\n")
+
+	tests := []struct {
+		name string
+		opts []PathOption
+		want int
+	}{
+		// stdin is merged above the defaults files and below the paths
+		{name: "default", want: 9090},
+		{name: "priority", opts: []PathOption{Priority(1)}, want: 8080},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Stdin = pipeStdin(t, "port: 8080\nhost: stdin\n")
+			h, err := New(
+				WithPaths(filepath.Join(dir, "app.yaml")),
+				WithDefaultsFile(filepath.Join(dir, "defaults.yaml")),
+				WithStdin("yaml", tt.opts...),
+			)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer h.Close()
+
+			if got, _ := Get[int](h, "port"); got != tt.want {
+				t.Errorf("port = %d, want %d", got, tt.want)
+			}
+			if got, _ := Get[string](h, "host"); got != "stdin" {
+				t.Errorf("host = %s, want stdin", got)
+			}
+			if got, _ := Get[string](h, "name"); got != "defaults" {
+				t.Errorf("name = %s, want defaults", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package hydra
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// UnknownKeysError reports the keys of the merged configuration that none of the structs set
+// by WithStrictKeys consumes.
+type UnknownKeysError struct {
+	Keys []string
+	// Sources map the keys to the positions in the configuration files that set them, e.g.
+	// "config.yaml:3:5".
+	Sources map[string]string
+}
+
+func (e *UnknownKeysError) Error() string {
+	keys := make([]string, len(e.Keys))
+	for i, key := range e.Keys {
+		keys[i] = key
+		if source := e.Sources[key]; source != "" {
+			keys[i] += fmt.Sprintf(" (file: %s)", source)
+		}
+	}
+	return "config has unknown keys: " + strings.Join(keys, ", ")
+}
+
+// checkUnknownKeys returns an UnknownKeysError if the settings have keys that none of the
+// structs consumes.
+func checkUnknownKeys(structs []reflect.Type, settings map[string]any, locate func(key string) string) error {
+	var unknown []string
+	unusedKeys(structs, settings, "", &unknown)
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	slices.Sort(unknown)
+	sources := make(map[string]string, len(unknown))
+	for _, key := range unknown {
+		sources[key] = locate(key)
+	}
+	return &UnknownKeysError{Keys: unknown, Sources: sources}
+}
+
+// unusedKeys appends the keys of the value at the path that unmarshaling it into any of the
+// types leaves unused to the keys. Fields are matched like the decoder of viper.Unmarshal does,
+// by their mapstructure tags or names, case-insensitively. Values failing to decode are
+// consumed nevertheless.
+func unusedKeys(types []reflect.Type, value any, path string, keys *[]string) {
+	var elems, structs []reflect.Type
+	for _, t := range types {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Slice, reflect.Array:
+			elems = append(elems, t.Elem())
+		case reflect.Struct:
+			structs = append(structs, t)
+		default:
+			// maps and interfaces consume all keys
+			return
+		}
+	}
+
+	switch v := value.(type) {
+	case []any:
+		if len(elems) == 0 {
+			return
+		}
+		for i, elem := range v {
+			unusedKeys(elems, elem, fmt.Sprintf("%s[%d]", path, i), keys)
+		}
+	case map[string]any:
+		if len(structs) == 0 {
+			return
+		}
+		fields := make(map[string][]reflect.Type)
+		for _, t := range structs {
+			if !structFields(t, fields) {
+				return
+			}
+		}
+		for key, elem := range v {
+			full := key
+			if path != "" {
+				full = path + "." + key
+			}
+			types, ok := fields[strings.ToLower(key)]
+			if !ok {
+				*keys = append(*keys, full)
+				continue
+			}
+			unusedKeys(types, elem, full, keys)
+		}
+	}
+}
+
+// structFields adds the types of the fields of the struct to the fields by their lowercased
+// key names. It returns false if a field with the remain tag consumes all keys.
+func structFields(t reflect.Type, fields map[string][]reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		if slices.Contains(strings.Split(opts, ","), "squash") {
+			ft := f.Type
+			for ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && !structFields(ft, fields) {
+				return false
+			}
+			continue
+		}
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if slices.Contains(strings.Split(opts, ","), "remain") {
+			return false
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = append(fields[strings.ToLower(name)], f.Type)
+	}
+	return true
+}
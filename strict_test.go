@@ -0,0 +1,135 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+type strictServer struct {
+	Host    string
+	Port    int `mapstructure:"listen_port"`
+	Timeout time.Duration
+}
+
+type strictBase struct {
+	Name string
+}
+
+type strictConfig struct {
+	strictBase `mapstructure:",squash"`
+	Server     strictServer
+	Backends   []strictServer
+	Labels     map[string]string
+	Extra      any
+	Ignored    string `mapstructure:"-"`
+	internal   string
+}
+
+type strictDB struct {
+	DB struct {
+		Host string
+	}
+}
+
+type strictRemain struct {
+	Name  string
+	Other map[string]any `mapstructure:",remain"`
+}
+
+func TestUnusedKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		types    []any
+		settings map[string]any
+		want     []string
+	}{
+		{
+			name:  "consumed",
+			types: []any{strictConfig{}},
+			settings: map[string]any{
+				"name":     "app",
+				"server":   map[string]any{"host": "a", "listen_port": 80, "timeout": "1s"},
+				"backends": []any{map[string]any{"host": "b"}},
+				"labels":   map[string]any{"any": "key"},
+				"extra":    map[string]any{"any": map[string]any{"key": 1}},
+			},
+		},
+		{
+			name:  "unknown",
+			types: []any{&strictConfig{}},
+			settings: map[string]any{
+				"nmae":     "app",
+				"server":   map[string]any{"host": "a", "port": 80, "tiemout": "1s"},
+				"backends": []any{map[string]any{"host": "b"}, map[string]any{"hots": "c"}},
+				"ignored":  "x",
+				"internal": "x",
+			},
+			want: []string{"backends[1].hots", "ignored", "internal", "nmae", "server.port", "server.tiemout"},
+		},
+		{
+			name:     "several structs",
+			types:    []any{strictConfig{}, strictDB{}},
+			settings: map[string]any{"name": "app", "db": map[string]any{"host": "a", "port": 1}, "cache": true},
+			want:     []string{"cache", "db.port"},
+		},
+		{
+			name:     "remain",
+			types:    []any{strictRemain{}},
+			settings: map[string]any{"name": "app", "anything": map[string]any{"else": true}},
+		},
+		{
+			name:     "values of other types",
+			types:    []any{strictConfig{}},
+			settings: map[string]any{"server": "a:80", "backends": map[string]any{"a": 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var types []reflect.Type
+			for _, s := range tt.types {
+				types = append(types, reflect.TypeOf(s))
+			}
+			var got []string
+			unusedKeys(types, tt.settings, "", &got)
+			slices.Sort(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unusedKeys() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithStrictKeys(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yaml")
+	writeFile(t, path, "name: app\nserver:\n  host: a\n  tiemout: 1s\n")
+	_, err := New(WithPaths(dir), WithStrictKeys(strictConfig{}))
+	var unknownErr *UnknownKeysError
+	want := fmt.Sprintf("config has unknown keys: server.tiemout (file: %s:4:3)", path)
+	if !errors.As(err, &unknownErr) || err.Error() != want {
+		t.Fatalf("New() error = %v, want %q", err, want)
+	}
+
+	writeFile(t, path, "name: app\nserver:\n  host: a\n")
+	h, err := New(WithPaths(dir), WithStrictKeys(&strictConfig{}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	writeFile(t, path, "name: b\nnmae: b\n")
+	err = h.Reload(context.Background())
+	var reloadErr *ReloadError
+	if !errors.As(err, &reloadErr) || !errors.As(err, &unknownErr) || !reflect.DeepEqual(unknownErr.Keys, []string{"nmae"}) {
+		t.Fatalf("Reload() error = %v, want ReloadError of unknown nmae", err)
+	}
+	if got, _ := Get[string](h, "name"); got != "app" {
+		t.Errorf("name = %q, want app", got)
+	}
+}
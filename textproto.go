@@ -0,0 +1,194 @@
+package hydra
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// TextProtoConfig configures the schema of protobuf text format files, see WithTextProto.
+type TextProtoConfig struct {
+	// Descriptors is a FileDescriptorSet in the binary protobuf encoding containing the message
+	// and the messages and enums it uses, e.g. written by
+	// `protoc --include_imports --descriptor_set_out=config.binpb config.proto`.
+	Descriptors []byte
+	// Message is the full name of the message of the files, e.g. "myapp.v1.Config".
+	Message string
+}
+
+// textProtoCodec decodes and encodes protobuf text format files of the message, e.g.
+//
+//	server { host: "localhost" port: 8080 }
+//	features: ["a", "b"]
+//
+// Fields are checked against the message, e.g. for unknown fields and values of the wrong types.
+// Enum values are decoded as their names, map fields as maps and extensions under their names in
+// brackets, e.g. "[myapp.v1.region]". Any messages are expanded into their fields and their
+// type URL under "@type", like in the JSON mapping of protobuf.
+type textProtoCodec struct {
+	message protoreflect.MessageDescriptor
+	types   *dynamicpb.Types
+}
+
+// newTextProtoCodec returns the codec of the message of the FileDescriptorSet.
+func newTextProtoCodec(c TextProtoConfig) (textProtoCodec, error) {
+	var set descriptorpb.FileDescriptorSet
+	err := proto.Unmarshal(c.Descriptors, &set)
+	if err != nil {
+		return textProtoCodec{}, fmt.Errorf("parse protobuf descriptors: %w", err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return textProtoCodec{}, fmt.Errorf("parse protobuf descriptors: %w", err)
+	}
+
+	d, err := files.FindDescriptorByName(protoreflect.FullName(c.Message))
+	if err != nil {
+		return textProtoCodec{}, fmt.Errorf("find protobuf message (message: %s): not in descriptors", c.Message)
+	}
+	message, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return textProtoCodec{}, fmt.Errorf("find protobuf message (message: %s): not a message", c.Message)
+	}
+	return textProtoCodec{message: message, types: dynamicpb.NewTypes(files)}, nil
+}
+
+func (c textProtoCodec) Decode(b []byte, v map[string]any) error {
+	m := dynamicpb.NewMessage(c.message)
+	err := prototext.UnmarshalOptions{Resolver: c.types}.Unmarshal(b, m)
+	if err != nil {
+		return err
+	}
+
+	values, err := c.convert(m)
+	if err != nil {
+		return err
+	}
+	for key, value := range values {
+		v[key] = value
+	}
+	return nil
+}
+
+// Encode encodes the settings as the message, so they're checked against it like decoded files.
+func (c textProtoCodec) Encode(v map[string]any) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m := dynamicpb.NewMessage(c.message)
+	err = protojson.UnmarshalOptions{Resolver: c.types}.Unmarshal(b, m)
+	if err != nil {
+		return nil, err
+	}
+	return prototext.MarshalOptions{Multiline: true, Resolver: c.types}.Marshal(m)
+}
+
+// convert returns the populated fields of the message by their names.
+func (c textProtoCodec) convert(m protoreflect.Message) (map[string]any, error) {
+	if m.Descriptor().FullName() == "google.protobuf.Any" {
+		return c.convertAny(m)
+	}
+
+	values := make(map[string]any)
+	var err error
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		var value any
+		value, err = c.field(fd, v)
+		if err != nil {
+			return false
+		}
+		values[fd.TextName()] = value
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// convertAny returns the fields of the message packed in the Any message and its type URL.
+func (c textProtoCodec) convertAny(m protoreflect.Message) (map[string]any, error) {
+	fields := m.Descriptor().Fields()
+	url := m.Get(fields.ByName("type_url")).String()
+	if url == "" {
+		return map[string]any{}, nil
+	}
+
+	mt, err := c.types.FindMessageByURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("resolve any (type: %s): %w", url, err)
+	}
+	packed := mt.New()
+	err = proto.UnmarshalOptions{Resolver: c.types}.Unmarshal(m.Get(fields.ByName("value")).Bytes(), packed.Interface())
+	if err != nil {
+		return nil, fmt.Errorf("unpack any (type: %s): %w", url, err)
+	}
+
+	values, err := c.convert(packed)
+	if err != nil {
+		return nil, err
+	}
+	values["@type"] = url
+	return values, nil
+}
+
+// field returns the value of the field, with lists and maps of repeated and map fields.
+func (c textProtoCodec) field(fd protoreflect.FieldDescriptor, v protoreflect.Value) (any, error) {
+	switch {
+	case fd.IsMap():
+		values := make(map[string]any, v.Map().Len())
+		var err error
+		v.Map().Range(func(key protoreflect.MapKey, v protoreflect.Value) bool {
+			var value any
+			value, err = c.value(fd.MapValue(), v)
+			values[key.String()] = value
+			return err == nil
+		})
+		return values, err
+	case fd.IsList():
+		list := v.List()
+		values := make([]any, 0, list.Len())
+		for i := range list.Len() {
+			value, err := c.value(fd, list.Get(i))
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	}
+	return c.value(fd, v)
+}
+
+// value returns the single value of the field.
+func (c textProtoCodec) value(fd protoreflect.FieldDescriptor, v protoreflect.Value) (any, error) {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return c.convert(v.Message())
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name()), nil
+		}
+		// unknown values of open enums are kept as numbers
+		return int64(v.Enum()), nil
+	case protoreflect.BytesKind:
+		return string(v.Bytes()), nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return v.Int(), nil
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return v.Uint(), nil
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return v.Float(), nil
+	}
+	// bools and strings
+	return v.Interface(), nil
+}
@@ -0,0 +1,305 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// testDescriptors returns the FileDescriptorSet of
+//
+//	package test.v1;
+//	import "google/protobuf/any.proto";
+//	enum Level { LEVEL_UNSPECIFIED = 0; LEVEL_DEBUG = 1; }
+//	message Config {
+//	  message Server { optional string host = 1; optional int32 port = 2; }
+//	  optional Server server = 1;
+//	  repeated string features = 2;
+//	  optional Level level = 3;
+//	  map<string, int64> limits = 4;
+//	  optional bool debug = 5;
+//	  optional double ratio = 6;
+//	  optional uint32 workers = 7;
+//	  required string name = 8;
+//	  optional google.protobuf.Any plugin = 9;
+//	  extensions 100 to 199;
+//	}
+//	message Plugin { optional string name = 1; }
+//	extend Config { optional string region = 100; }
+func testDescriptors(t *testing.T) []byte {
+	t.Helper()
+	field := func(name string, number int32, label descriptorpb.FieldDescriptorProto_Label, typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(number), Label: label.Enum(), Type: typ.Enum()}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	optional, repeated, required := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_LABEL_REPEATED, descriptorpb.FieldDescriptorProto_LABEL_REQUIRED
+
+	region := field("region", 100, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")
+	region.Extendee = proto.String(".test.v1.Config")
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("test.proto"),
+		Package:    proto.String("test.v1"),
+		Dependency: []string{"google/protobuf/any.proto"},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Level"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("LEVEL_UNSPECIFIED"), Number: proto.Int32(0)},
+				{Name: proto.String("LEVEL_DEBUG"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Config"),
+				NestedType: []*descriptorpb.DescriptorProto{
+					{
+						Name: proto.String("Server"),
+						Field: []*descriptorpb.FieldDescriptorProto{
+							field("host", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+							field("port", 2, optional, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+						},
+					},
+					{
+						Name: proto.String("LimitsEntry"),
+						Field: []*descriptorpb.FieldDescriptorProto{
+							field("key", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+							field("value", 2, optional, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+						},
+						Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+					},
+				},
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("server", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".test.v1.Config.Server"),
+					field("features", 2, repeated, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("level", 3, optional, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".test.v1.Level"),
+					field("limits", 4, repeated, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".test.v1.Config.LimitsEntry"),
+					field("debug", 5, optional, descriptorpb.FieldDescriptorProto_TYPE_BOOL, ""),
+					field("ratio", 6, optional, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, ""),
+					field("workers", 7, optional, descriptorpb.FieldDescriptorProto_TYPE_UINT32, ""),
+					field("name", 8, required, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("plugin", 9, optional, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Any"),
+				},
+				ExtensionRange: []*descriptorpb.DescriptorProto_ExtensionRange{{Start: proto.Int32(100), End: proto.Int32(200)}},
+			},
+			{
+				Name:  proto.String("Plugin"),
+				Field: []*descriptorpb.FieldDescriptorProto{field("name", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")},
+			},
+		},
+		Extension: []*descriptorpb.FieldDescriptorProto{region},
+	}
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(anypb.File_google_protobuf_any_proto),
+		file,
+	}}
+	b, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func testTextProtoCodec(t *testing.T) textProtoCodec {
+	t.Helper()
+	c, err := newTextProtoCodec(TextProtoConfig{Descriptors: testDescriptors(t), Message: "test.v1.Config"})
+	if err != nil {
+		t.Fatalf("newTextProtoCodec() error = %v", err)
+	}
+	return c
+}
+
+func TestTextProtoCodecDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]any
+	}{
+		{
+			name: "fields",
+			in: `# comment
+name: "app"
+server { host: 'localhost' port: 0x1F90 }
+features: "a"
+features: "b"
+level: LEVEL_DEBUG
+limits { key: "cpu" value: 2 }
+limits [{ key: "memory" value: 1024 }]
+debug: true
+ratio: 0.5
+workers: 4
+`,
+			want: map[string]any{
+				"name":     "app",
+				"server":   map[string]any{"host": "localhost", "port": int64(8080)},
+				"features": []any{"a", "b"},
+				"level":    "LEVEL_DEBUG",
+				"limits":   map[string]any{"cpu": int64(2), "memory": int64(1024)},
+				"debug":    true,
+				"ratio":    0.5,
+				"workers":  uint64(4),
+			},
+		},
+		{
+			name: "lists and enum numbers",
+			in:   "name: \"app\" level: 1 features: [\"a\", \"b\"]",
+			want: map[string]any{"name": "app", "level": "LEVEL_DEBUG", "features": []any{"a", "b"}},
+		},
+		{
+			name: "strings",
+			in:   `name: "con" 'cat' features: "\t\x41\101é\U0001F600\"\?"`,
+			want: map[string]any{"name": "concat", "features": []any{"\tAAé😀\"?"}},
+		},
+		{
+			name: "special numbers",
+			in:   "name: \"app\" ratio: -inf",
+			want: map[string]any{"name": "app", "ratio": math.Inf(-1)},
+		},
+		{
+			name: "extension",
+			in:   "name: \"app\"\n[test.v1.region]: \"eu\"\n",
+			want: map[string]any{"name": "app", "[test.v1.region]": "eu"},
+		},
+		{
+			name: "any",
+			in:   "name: \"app\"\nplugin { [type.googleapis.com/test.v1.Plugin] { name: \"auth\" } }\n",
+			want: map[string]any{"name": "app", "plugin": map[string]any{"@type": "type.googleapis.com/test.v1.Plugin", "name": "auth"}},
+		},
+	}
+	c := testTextProtoCodec(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]any{}
+			err := c.Decode([]byte(tt.in), got)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTextProtoCodecDecodeError(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		want   string
+		line   int
+		column int
+	}{
+		{name: "missing colon", in: "name: \"app\"\nlevel 1\n", want: "(line 2:1): missing field separator", line: 2, column: 1},
+		{name: "unclosed message", in: "name: \"app\"\nserver {\n  port: 1\n", want: "unexpected EOF"},
+		{name: "unknown field", in: "name: \"app\"\nport: 1\n", want: "(line 2:1): unknown field: port", line: 2, column: 1},
+		{name: "repeated", in: "name: \"a\"\nname: \"b\"\n", want: "(line 2:1): non-repeated field \"name\" is repeated", line: 2, column: 1},
+		{name: "wrong type", in: "name: \"app\"\nserver { port: \"80\" }\n", want: "(line 2:16): invalid value for int32 type: \"80\"", line: 2, column: 16},
+		{name: "out of range", in: "name: \"app\" workers: -1", want: "(line 1:22): invalid value for uint32 type: -1", line: 1, column: 22},
+		{name: "unknown enum value", in: "name: \"app\"\nlevel: LEVEL_TRACE\n", want: "(line 2:8): invalid value for enum type: LEVEL_TRACE", line: 2, column: 8},
+		{name: "unknown extension", in: "name: \"app\"\n[test.v1.zone]: \"a\"\n", want: "(line 2:1): unknown field: [test.v1.zone]", line: 2, column: 1},
+		{name: "missing required", in: "debug: true", want: "required field test.v1.Config.name not set"},
+	}
+	c := testTextProtoCodec(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := c.Decode([]byte(tt.in), map[string]any{})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Decode() error = %v, want %q", err, tt.want)
+			}
+			if line, column := errorPosition(err, []byte(tt.in)); line != tt.line || column != tt.column {
+				t.Errorf("position = %d:%d, want %d:%d", line, column, tt.line, tt.column)
+			}
+		})
+	}
+}
+
+func TestTextProtoCodecRoundTrip(t *testing.T) {
+	in := map[string]any{
+		"name":     "app \"quoted\"\n",
+		"server":   map[string]any{"host": "localhost", "port": int64(8080)},
+		"features": []any{"a", "b"},
+		"level":    "LEVEL_DEBUG",
+		"limits":   map[string]any{"cpu": int64(2), "memory": int64(1024)},
+		"debug":    true,
+		"ratio":    0.5,
+		"workers":  uint64(4),
+		"plugin":   map[string]any{"@type": "type.googleapis.com/test.v1.Plugin", "name": "auth"},
+	}
+	c := testTextProtoCodec(t)
+	b, err := c.Encode(in)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	got := map[string]any{}
+	err = c.Decode(b, got)
+	if err != nil {
+		t.Fatalf("Decode(%s) error = %v", b, err)
+	}
+	if !reflect.DeepEqual(got, in) {
+		t.Errorf("round trip = %#v, want %#v\n%s", got, in, b)
+	}
+
+	_, err = c.Encode(map[string]any{"name": "app", "port": 1})
+	if err == nil {
+		t.Errorf("Encode() of unknown field succeeded")
+	}
+}
+
+func TestWithTextProto(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.textproto")
+	writeFile(t, path, "name: \"app\"\nlevel: LEVEL_DEBUG\n")
+	h, err := New(WithPaths(dir), WithTextProto(TextProtoConfig{Descriptors: testDescriptors(t), Message: "test.v1.Config"}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+	if got, err := Get[string](h, "level"); err != nil || got != "LEVEL_DEBUG" {
+		t.Errorf("Get(level) = %v, %v, want LEVEL_DEBUG", got, err)
+	}
+
+	writeFile(t, path, "name: \"app\"\nlevel: LEVEL_TRACE\n")
+	err = h.Reload(context.Background())
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Line != 2 || parseErr.Column != 8 {
+		t.Fatalf("Reload() error = %v, want ParseError at 2:8", err)
+	}
+	if got, _ := Get[string](h, "level"); got != "LEVEL_DEBUG" {
+		t.Errorf("level = %v after failed reload, want LEVEL_DEBUG", got)
+	}
+
+	// binary protobuf files aren't text format files
+	writeFile(t, path, "name: \"app\"\n")
+	writeFile(t, filepath.Join(dir, "app.pb"), "\x0a\x03app")
+	if err := h.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if got := h.ConfigFiles(); len(got) != 1 || got[0] != path {
+		t.Errorf("ConfigFiles() = %v, want only %s", got, path)
+	}
+
+	// text format files aren't found without a schema
+	plain, err := New(WithPaths(dir))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer plain.Close()
+	if got := plain.ConfigFiles(); len(got) != 0 {
+		t.Errorf("ConfigFiles() without WithTextProto = %v, want none", got)
+	}
+
+	_, err = New(WithPaths(dir), WithTextProto(TextProtoConfig{Descriptors: testDescriptors(t), Message: "test.v1.Missing"}))
+	if err == nil || err.Error() != "find protobuf message (message: test.v1.Missing): not in descriptors" {
+		t.Errorf("New() error = %v, want message not in descriptors", err)
+	}
+}
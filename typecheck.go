@@ -0,0 +1,26 @@
+package hydra
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/spf13/viper"
+)
+
+// checkedStruct is a type of struct set by WithStruct that configurations must decode into.
+type checkedStruct struct {
+	typ  reflect.Type
+	opts []viper.DecoderConfigOption
+}
+
+// checkStructs decodes the settings into throwaway values of the structs, returning the first
+// error, e.g. of a value of the wrong type or an unparsable duration.
+func checkStructs(structs []checkedStruct, settings map[string]any) error {
+	for _, s := range structs {
+		err := decode(copyValue(settings), reflect.New(s.typ).Interface(), s.opts...)
+		if err != nil {
+			return fmt.Errorf("decode config (type: %s): %w", s.typ, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/spf13/viper"
+)
+
+type typedConfig struct {
+	Port    int
+	Timeout time.Duration
+	Hosts   []string
+	DB      struct {
+		Pool int
+	}
+}
+
+func TestCheckStructs(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []viper.DecoderConfigOption
+		settings map[string]any
+		wantErr  string
+	}{
+		{
+			name:     "valid",
+			settings: map[string]any{"port": 8080, "timeout": "5s", "hosts": []any{"a"}, "db": map[string]any{"pool": 4}},
+		},
+		{
+			// values are weakly typed like for viper.Unmarshal
+			name:     "weakly typed",
+			settings: map[string]any{"port": "8080", "hosts": "a,b", "db": map[string]any{"pool": 4.0}},
+		},
+		{
+			name:     "wrong type",
+			settings: map[string]any{"port": "eighty"},
+			wantErr:  "decode config (type: hydra.typedConfig): ",
+		},
+		{
+			name:     "unparsable duration",
+			settings: map[string]any{"timeout": "5 seconds"},
+			wantErr:  "decode config (type: hydra.typedConfig): ",
+		},
+		{
+			name:     "nested",
+			settings: map[string]any{"db": map[string]any{"pool": []any{1}}},
+			wantErr:  "decode config (type: hydra.typedConfig): ",
+		},
+		{
+			name:     "decoder options",
+			opts:     []viper.DecoderConfigOption{func(c *mapstructure.DecoderConfig) { c.ErrorUnused = true }},
+			settings: map[string]any{"port": 8080, "other": true},
+			wantErr:  "decode config (type: hydra.typedConfig): ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := copyValue(tt.settings)
+			err := checkStructs([]checkedStruct{{typ: reflect.TypeOf(typedConfig{}), opts: tt.opts}}, tt.settings)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)) {
+				t.Fatalf("checkStructs() error = %v, want %q", err, tt.wantErr)
+			}
+			// the settings aren't changed by decoding them
+			if !reflect.DeepEqual(before, tt.settings) {
+				t.Errorf("settings = %v after checkStructs(), want %v", tt.settings, before)
+			}
+		})
+	}
+}
+
+func TestWithStruct(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yaml")
+	writeFile(t, path, "port: 8080\ntimeout: soon\n")
+	_, err := New(WithPaths(dir), WithStruct(typedConfig{}))
+	if err == nil || !strings.Contains(err.Error(), "decode config (type: hydra.typedConfig): ") {
+		t.Fatalf("New() error = %v, want error decoding typedConfig", err)
+	}
+	_, err = New(WithPaths(dir), WithStruct(new(int)))
+	if err == nil || err.Error() != "decode config (type: int): not a struct" {
+		t.Fatalf("New() error = %v, want error of int not being a struct", err)
+	}
+
+	writeFile(t, path, "port: 8080\ntimeout: 5s\n")
+	h, err := New(WithPaths(dir), WithStruct(&typedConfig{}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	steps := []struct {
+		data    string
+		wantErr bool
+		timeout time.Duration
+	}{
+		{data: "port: 8080\ntimeout: 10s\n", timeout: 10 * time.Second},
+		{data: "port: 8080\ntimeout: 10 seconds\n", wantErr: true, timeout: 10 * time.Second},
+		{data: "port: [8080]\ntimeout: 1s\n", wantErr: true, timeout: 10 * time.Second},
+		{data: "port: 8080\ntimeout: 1s\n", timeout: time.Second},
+	}
+	for i, step := range steps {
+		writeFile(t, path, step.data)
+		err := h.Reload(context.Background())
+		var reloadErr *ReloadError
+		if step.wantErr != errors.As(err, &reloadErr) || !step.wantErr && err != nil {
+			t.Fatalf("step %d: Reload() error = %v, want error %t", i, err, step.wantErr)
+		}
+		if got, _ := Get[time.Duration](h, "timeout"); got != step.timeout {
+			t.Errorf("step %d: timeout = %s, want %s", i, got, step.timeout)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+)
+
+// urlSource provides the configuration document served at a URL, see WithURL.
+type urlSource struct {
+	url string
+	// id names the document, the URL without credentials, see redactURL.
+	id     string
+	client *http.Client
+
+	mu sync.Mutex
+	// body and contentType are of the last response, returned again if the server reports the
+	// document unchanged.
+	body         []byte
+	contentType  string
+	etag         string
+	lastModified string
+}
+
+func (s *urlSource) load(ctx context.Context, want func(rel string) bool) ([]document, error) {
+	b, contentType, err := s.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rel := s.name(contentType)
+	if !want(rel) {
+		return nil, nil
+	}
+	return []document{{name: s.id, rel: rel, data: b}}, nil
+}
+
+// fetch returns the body and the content type of the response served at the URL.
+func (s *urlSource) fetch(ctx context.Context) ([]byte, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("create request: %w", err)
+	}
+	if s.body != nil {
+		// unchanged documents aren't sent again
+		if s.etag != "" {
+			req.Header.Set("If-None-Match", s.etag)
+		}
+		if s.lastModified != "" {
+			req.Header.Set("If-Modified-Since", s.lastModified)
+		}
+	}
+
+	resp, err := s.client.Do(req)
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = redactURL(urlErr.URL)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && s.body != nil:
+		return s.body, s.contentType, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, "", fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("read response: %w", err)
+	}
+
+	s.body = b
+	s.contentType = resp.Header.Get("Content-Type")
+	s.etag = resp.Header.Get("ETag")
+	s.lastModified = resp.Header.Get("Last-Modified")
+	return s.body, s.contentType, nil
+}
+
+// name returns the name of the document, whose extension determines its format. It's the last
+// element of the URL path or, if it has no extension, is derived from the content type.
+func (s *urlSource) name(contentType string) string {
+	name := "config"
+	if u, err := url.Parse(s.url); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+		name = path.Base(u.Path)
+	}
+	if path.Ext(name) != "" {
+		return name
+	}
+	return name + contentTypeExtension(contentType)
+}
+
+// redactURL returns the URL without its userinfo and with the values of query parameters
+// carrying credentials replaced, e.g. "https://config.internal/app.yaml?token=xxxxx".
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.User = nil
+	if u.RawQuery != "" {
+		query := u.Query()
+		for name, values := range query {
+			if secretParameter(name) {
+				for i := range values {
+					values[i] = "xxxxx"
+				}
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// secretParameter returns whether the query parameter carries credentials, e.g. "token",
+// "api_key" or "X-Amz-Signature" of presigned URLs.
+func secretParameter(name string) bool {
+	name = strings.ToLower(name)
+	switch name {
+	case "key", "apikey", "sig", "code", "auth", "authorization":
+		return true
+	}
+	for _, s := range []string{"token", "secret", "password", "signature", "credential", "api_key", "api-key"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// contentTypeExtension returns the extension of the format of the content type, e.g. ".json"
+// for "application/json", or "" if it isn't known.
+func contentTypeExtension(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasSuffix(mediaType, "json"):
+		return ".json"
+	case strings.HasSuffix(mediaType, "yaml"):
+		return ".yaml"
+	case strings.HasSuffix(mediaType, "toml"):
+		return ".toml"
+	default:
+		return ""
+	}
+}
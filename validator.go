@@ -0,0 +1,352 @@
+package hydra
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/spf13/viper"
+)
+
+// StructValidator validates structs the configuration is unmarshaled into, see
+// UnmarshalValidated. The *validator.Validate of github.com/go-playground/validator implements
+// it.
+type StructValidator interface {
+	Struct(s any) error
+}
+
+// validatedStruct is a type of struct the configuration is unmarshaled into by
+// UnmarshalValidated, which reloaded configurations are validated as, too.
+type validatedStruct struct {
+	typ  reflect.Type
+	opts []viper.DecoderConfigOption
+}
+
+// UnmarshalValidated unmarshals the configuration into the struct pointed to by rawVal, like
+// viper.Unmarshal, and validates it with the validator set by WithStructValidator. From then
+// on, reloads are rejected like invalid configuration files if the reloaded configuration
+// files don't pass the validation of a struct of the same type, so invalid configurations never
+// reach subscribers. Reloads are validated without environment variables and defaults of viper.
+//
+// By default, structs are validated by their "validate" tags with a subset of the tags of
+// github.com/go-playground/validator: required, omitempty, len, min, max, eq, ne, gt, gte, lt,
+// lte, oneof, email, url, ip, hostname_port and dive. Nested structs are validated too.
+func (h *Hydra) UnmarshalValidated(rawVal any, opts ...viper.DecoderConfigOption) error {
+	h.viperMu.RLock()
+	err := h.viper.Unmarshal(rawVal, opts...)
+	h.viperMu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("unmarshal config: %w", err)
+	}
+	err = h.structValidator().Struct(rawVal)
+	if err != nil {
+		return fmt.Errorf("validate config: %w", err)
+	}
+
+	typ := reflect.TypeOf(rawVal)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := slices.IndexFunc(h.validatedStructs, func(s validatedStruct) bool { return s.typ == typ })
+	if i < 0 {
+		h.validatedStructs = append(h.validatedStructs, validatedStruct{typ: typ, opts: opts})
+	} else {
+		h.validatedStructs[i].opts = opts
+	}
+	return nil
+}
+
+func (h *Hydra) structValidator() StructValidator {
+	if h.options.structValidator != nil {
+		return h.options.structValidator
+	}
+	return tagValidator{}
+}
+
+// validateStructs validates the settings as the structs registered by UnmarshalValidated.
+func (h *Hydra) validateStructs(settings map[string]any) error {
+	h.mu.Lock()
+	structs := slices.Clone(h.validatedStructs)
+	h.mu.Unlock()
+
+	for _, s := range structs {
+		v := reflect.New(s.typ.Elem())
+		err := decode(copyValue(settings), v.Interface(), s.opts...)
+		if err != nil {
+			return fmt.Errorf("unmarshal config (type: %s): %w", s.typ.Elem(), err)
+		}
+		err = h.structValidator().Struct(v.Interface())
+		if err != nil {
+			return fmt.Errorf("validate config (type: %s): %w", s.typ.Elem(), err)
+		}
+	}
+	return nil
+}
+
+// FieldError is an error of a field of a struct validated by its "validate" tag, see
+// UnmarshalValidated.
+type FieldError struct {
+	// Field is the path of the field, e.g. "Server.Port" or "Hosts[1]".
+	Field string
+	// Tag is the tag failed, e.g. "min", and Param its parameter, e.g. "1".
+	Tag   string
+	Param string
+	Value any
+}
+
+func (e *FieldError) Error() string {
+	tag := e.Tag
+	if e.Param != "" {
+		tag += "=" + e.Param
+	}
+	return fmt.Sprintf("field %s: failed on %s, got %v", e.Field, tag, e.Value)
+}
+
+// tagValidator validates structs by their "validate" tags, see UnmarshalValidated.
+type tagValidator struct{}
+
+func (tagValidator) Struct(s any) error {
+	v := reflect.ValueOf(s)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return errors.New("validate nil pointer")
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("validate %s: not a struct", v.Type())
+	}
+	var errs []error
+	err := validateStruct(v, "", &errs)
+	if err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+// validateStruct appends the errors of the fields of the struct at the path to the errors. It
+// returns an error if a tag is invalid.
+func validateStruct(v reflect.Value, path string, errs *[]error) error {
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("validate")
+		if tag == "-" {
+			continue
+		}
+		field := f.Name
+		if path != "" {
+			field = path + "." + f.Name
+		}
+		if f.Anonymous {
+			field = path
+		}
+		err := validateValue(v.Field(i), field, splitValidateTags(tag), errs)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitValidateTags splits the tag at commas. Options of oneof are separated by spaces.
+func splitValidateTags(tag string) []string {
+	if tag == "" {
+		return nil
+	}
+	return strings.Split(tag, ",")
+}
+
+// validateValue validates the value at the path by the tags, and its fields if it's a struct.
+func validateValue(v reflect.Value, path string, tags []string, errs *[]error) error {
+	for i, tag := range tags {
+		name, param, _ := strings.Cut(tag, "=")
+		switch name {
+		case "omitempty":
+			if isEmptyValue(v) {
+				return nil
+			}
+			continue
+		case "dive":
+			elem := v
+			for elem.Kind() == reflect.Pointer && !elem.IsNil() {
+				elem = elem.Elem()
+			}
+			switch elem.Kind() {
+			case reflect.Slice, reflect.Array:
+				for j := 0; j < elem.Len(); j++ {
+					err := validateValue(elem.Index(j), fmt.Sprintf("%s[%d]", path, j), tags[i+1:], errs)
+					if err != nil {
+						return err
+					}
+				}
+			case reflect.Map:
+				for it := elem.MapRange(); it.Next(); {
+					err := validateValue(it.Value(), fmt.Sprintf("%s[%v]", path, it.Key()), tags[i+1:], errs)
+					if err != nil {
+						return err
+					}
+				}
+			default:
+				return fmt.Errorf("field %s: dive on %s, not a slice or map", path, v.Type())
+			}
+			return nil
+		}
+
+		ok, err := checkTag(v, name, param)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", path, err)
+		}
+		if !ok {
+			// values of pointers are reported rather than their addresses
+			value := v
+			for value.Kind() == reflect.Pointer && !value.IsNil() {
+				value = value.Elem()
+			}
+			*errs = append(*errs, &FieldError{Field: path, Tag: name, Param: param, Value: value.Interface()})
+			// like go-playground/validator, a field fails on its first tag
+			return nil
+		}
+	}
+
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Struct && v.Type() != reflect.TypeOf(time.Time{}) {
+		return validateStruct(v, path, errs)
+	}
+	return nil
+}
+
+// isEmptyValue reports whether the value is its zero value, or an empty slice or map.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Invalid:
+		return true
+	}
+	return v.IsZero()
+}
+
+// checkTag reports whether the value passes the tag with the parameter.
+func checkTag(v reflect.Value, name, param string) (bool, error) {
+	for v.Kind() == reflect.Pointer && name != "required" {
+		if v.IsNil() {
+			return false, nil
+		}
+		v = v.Elem()
+	}
+
+	switch name {
+	case "required":
+		return !isEmptyValue(v), nil
+	case "len", "min", "max", "eq", "ne", "gt", "gte", "lt", "lte":
+		return compareTag(v, name, param)
+	case "oneof":
+		s := fmt.Sprint(v.Interface())
+		for _, option := range strings.Fields(param) {
+			if s == strings.Trim(option, "'") {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "email", "url", "ip", "hostname_port":
+	default:
+		return false, fmt.Errorf("unknown validation tag %s", name)
+	}
+
+	if v.Kind() != reflect.String {
+		return false, fmt.Errorf("%s on %s, not a string", name, v.Type())
+	}
+	s := v.String()
+	switch name {
+	case "email":
+		a, err := mail.ParseAddress(s)
+		return err == nil && a.Address == s, nil
+	case "url":
+		u, err := url.Parse(s)
+		return err == nil && u.Scheme != "" && (u.Host != "" || u.Opaque != "" || u.Path != ""), nil
+	case "hostname_port":
+		host, port, err := net.SplitHostPort(s)
+		if err != nil {
+			return false, nil
+		}
+		n, err := strconv.Atoi(port)
+		return err == nil && n > 0 && n < 65536 && !strings.ContainsAny(host, " /"), nil
+	}
+	return net.ParseIP(s) != nil, nil
+}
+
+// compareTag compares numbers by their values, durations by parameters like "1s", and strings,
+// slices and maps by their lengths.
+func compareTag(v reflect.Value, name, param string) (bool, error) {
+	var x, y float64
+	switch v.Kind() {
+	case reflect.String:
+		if name == "eq" || name == "ne" {
+			return (v.String() == param) == (name == "eq"), nil
+		}
+		x = float64(utf8.RuneCountInString(v.String()))
+	case reflect.Slice, reflect.Map, reflect.Array:
+		x = float64(v.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x = float64(v.Int())
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(param)
+			if err != nil {
+				return false, fmt.Errorf("invalid duration parameter of %s: %s", name, param)
+			}
+			return compareFloats(x, float64(d), name), nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		x = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		x = v.Float()
+	case reflect.Bool:
+		if name == "eq" || name == "ne" {
+			b, err := strconv.ParseBool(param)
+			if err != nil {
+				return false, fmt.Errorf("invalid bool parameter of %s: %s", name, param)
+			}
+			return (v.Bool() == b) == (name == "eq"), nil
+		}
+		fallthrough
+	default:
+		return false, fmt.Errorf("%s on %s", name, v.Type())
+	}
+
+	y, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return false, fmt.Errorf("invalid parameter of %s: %s", name, param)
+	}
+	return compareFloats(x, y, name), nil
+}
+
+func compareFloats(x, y float64, name string) bool {
+	switch name {
+	case "len", "eq":
+		return x == y
+	case "ne":
+		return x != y
+	case "min", "gte":
+		return x >= y
+	case "max", "lte":
+		return x <= y
+	case "gt":
+		return x > y
+	}
+	return x < y
+}
@@ -0,0 +1,270 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTagValidator(t *testing.T) {
+	type server struct {
+		Host string `validate:"required,hostname_port"`
+		URL  string `validate:"omitempty,url"`
+	}
+	type config struct {
+		Name    string         `validate:"required,min=2,max=8"`
+		Level   string         `validate:"oneof=debug info 'warn'"`
+		Port    int            `validate:"gte=1,lte=65535"`
+		Ratio   float64        `validate:"gt=0,lt=1"`
+		Timeout time.Duration  `validate:"min=1s"`
+		Email   string         `validate:"omitempty,email"`
+		IP      *string        `validate:"omitempty,ip"`
+		Debug   bool           `validate:"eq=false"`
+		Hosts   []string       `validate:"min=1,dive,ne=localhost"`
+		Labels  map[string]int `validate:"dive,len=1"`
+		Server  server
+		Backup  *server
+		Skipped string `validate:"-"`
+		hidden  string `validate:"required"`
+	}
+	valid := func() config {
+		return config{
+			Name:    "app",
+			Level:   "warn",
+			Port:    8080,
+			Ratio:   0.5,
+			Timeout: time.Second,
+			Hosts:   []string{"a"},
+			Labels:  map[string]int{"x": 1},
+			Server:  server{Host: "localhost:80"},
+		}
+	}
+	ip := func(s string) *string { return &s }
+	tests := []struct {
+		name   string
+		modify func(c *config)
+		want   []string
+	}{
+		{name: "valid", modify: func(c *config) {}},
+		{
+			name: "required",
+			modify: func(c *config) {
+				c.Name = ""
+				c.Server.Host = ""
+			},
+			want: []string{"field Name: failed on required, got ", "field Server.Host: failed on required, got "},
+		},
+		{
+			name: "bounds",
+			modify: func(c *config) {
+				c.Name = "application"
+				c.Port = 0
+				c.Ratio = 1
+				c.Timeout = time.Millisecond
+				c.Hosts = nil
+			},
+			want: []string{
+				"field Name: failed on max=8, got application",
+				"field Port: failed on gte=1, got 0",
+				"field Ratio: failed on lt=1, got 1",
+				"field Timeout: failed on min=1s, got 1ms",
+				"field Hosts: failed on min=1, got []",
+			},
+		},
+		{
+			name: "formats",
+			modify: func(c *config) {
+				c.Email = "Bob <bob@example.com>"
+				c.IP = ip("10.0.0.256")
+				c.Server.Host = "localhost"
+				c.Server.URL = "example.com"
+			},
+			want: []string{
+				"field Email: failed on email, got Bob <bob@example.com>",
+				"field IP: failed on ip, got 10.0.0.256",
+				"field Server.Host: failed on hostname_port, got localhost",
+				"field Server.URL: failed on url, got example.com",
+			},
+		},
+		{
+			name: "dive",
+			modify: func(c *config) {
+				c.Hosts = []string{"a", "localhost"}
+				c.Labels = map[string]int{"x": 2}
+			},
+			want: []string{"field Hosts[1]: failed on ne=localhost, got localhost", "field Labels[x]: failed on len=1, got 2"},
+		},
+		{
+			name: "nested pointers",
+			modify: func(c *config) {
+				c.Level = "trace"
+				c.Debug = true
+				c.Backup = &server{Host: "db:0"}
+				c.IP = ip("::1")
+			},
+			want: []string{
+				"field Level: failed on oneof=debug info 'warn', got trace",
+				"field Debug: failed on eq=false, got true",
+				"field Backup.Host: failed on hostname_port, got db:0",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.modify(&c)
+			err := tagValidator{}.Struct(&c)
+			var got []string
+			for _, err := range unjoin(err) {
+				var fieldErr *FieldError
+				if !errors.As(err, &fieldErr) {
+					t.Fatalf("Struct() error = %v, want FieldError", err)
+				}
+				got = append(got, err.Error())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Struct() errors =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+// unjoin returns the errors joined by errors.Join.
+func unjoin(err error) []error {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+func TestTagValidatorError(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   any
+		wantErr string
+	}{
+		{name: "nil", value: (*struct{})(nil), wantErr: "validate nil pointer"},
+		{name: "not a struct", value: new(int), wantErr: "validate int: not a struct"},
+		{name: "unknown tag", value: &struct {
+			Port int `validate:"positive"`
+		}{}, wantErr: "field Port: unknown validation tag positive"},
+		{name: "invalid parameter", value: &struct {
+			Port int `validate:"min=one"`
+		}{}, wantErr: "field Port: invalid parameter of min: one"},
+		{name: "invalid duration", value: &struct {
+			Timeout time.Duration `validate:"min=1"`
+		}{}, wantErr: "field Timeout: invalid duration parameter of min: 1"},
+		{name: "format of number", value: &struct {
+			Port int `validate:"email"`
+		}{}, wantErr: "field Port: email on int, not a string"},
+		{name: "dive on string", value: &struct {
+			Host string `validate:"dive,required"`
+		}{}, wantErr: "field Host: dive on string, not a slice or map"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tagValidator{}.Struct(tt.value)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Struct() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+type validatedConfig struct {
+	Server struct {
+		Port int `validate:"min=1"`
+	}
+}
+
+func TestUnmarshalValidated(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yaml")
+	writeFile(t, path, "server:\n  port: 8080\n")
+	h, err := New(WithPaths(dir))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	steps := []struct {
+		data    string
+		wantErr string
+		port    int
+	}{
+		// reloads are validated once the struct is unmarshaled
+		{data: "server:\n  port: 8081\n", port: 8081},
+		{data: "server:\n  port: 0\n", wantErr: "reload config: validate config (type: hydra.validatedConfig): field Server.Port: failed on min=1, got 0", port: 8081},
+		{data: "server:\n  port: [1]\n", wantErr: "reload config: unmarshal config (type: hydra.validatedConfig): ", port: 8081},
+		{data: "server:\n  port: 9090\n", port: 9090},
+	}
+	var c validatedConfig
+	if err := h.UnmarshalValidated(&c); err != nil || c.Server.Port != 8080 {
+		t.Fatalf("UnmarshalValidated() = %+v, %v", c, err)
+	}
+	for i, step := range steps {
+		writeFile(t, path, step.data)
+		err := h.Reload(context.Background())
+		if step.wantErr == "" && err != nil || step.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), step.wantErr)) {
+			t.Fatalf("step %d: Reload() error = %v, want %q", i, err, step.wantErr)
+		}
+		if got, _ := Get[int](h, "server.port"); got != step.port {
+			t.Errorf("step %d: server.port = %d, want %d", i, got, step.port)
+		}
+	}
+
+	// configurations already loaded fail to unmarshal, without registering the struct
+	writeFile(t, path, "server:\n  port: 0\n")
+	h, err = New(WithPaths(dir))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+	err = h.UnmarshalValidated(&c)
+	if err == nil || err.Error() != "validate config: field Server.Port: failed on min=1, got 0" {
+		t.Errorf("UnmarshalValidated() error = %v", err)
+	}
+	if len(h.validatedStructs) != 0 {
+		t.Errorf("registered %d structs, want 0", len(h.validatedStructs))
+	}
+}
+
+// portValidator rejects configurations by their port, like a validator of
+// github.com/go-playground/validator.
+type portValidator struct{}
+
+func (portValidator) Struct(s any) error {
+	if s.(*validatedConfig).Server.Port == 6666 {
+		return errors.New("port 6666 is reserved")
+	}
+	return nil
+}
+
+func TestWithStructValidator(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yaml")
+	writeFile(t, path, "server:\n  port: 0\n")
+	h, err := New(WithPaths(dir), WithStructValidator(portValidator{}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+
+	// tags aren't validated by other validators
+	var c validatedConfig
+	if err := h.UnmarshalValidated(&c); err != nil {
+		t.Fatalf("UnmarshalValidated() error = %v", err)
+	}
+	writeFile(t, path, "server:\n  port: 6666\n")
+	err = h.Reload(context.Background())
+	want := "reload config: validate config (type: hydra.validatedConfig): port 6666 is reserved"
+	if err == nil || err.Error() != want {
+		t.Errorf("Reload() error = %v, want %q", err, want)
+	}
+}
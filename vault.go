@@ -0,0 +1,182 @@
+package hydra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultVaultRefresh is how often secrets without a lease are read again by default.
+const defaultVaultRefresh = 5 * time.Minute
+
+// VaultConfig configures a source of secrets stored in the KV version 2 secrets engine of
+// HashiCorp Vault, see WithVault.
+type VaultConfig struct {
+	// Address of Vault, e.g. "https://vault.internal:8200". Defaults to the VAULT_ADDR
+	// environment variable.
+	Address string
+	// Token authorizes requests. Defaults to the VAULT_TOKEN environment variable.
+	Token string
+	// Namespace of Vault Enterprise. Defaults to the VAULT_NAMESPACE environment variable.
+	Namespace string
+	// Mount is the path the secrets engine is mounted at. Defaults to "secret".
+	Mount string
+	// Secrets maps keys of the configuration to paths of secrets, e.g. "database" to
+	// "myapp/database", placing the fields of the secret under the key, e.g. "database.password".
+	Secrets map[string]string
+	// Refresh is how often secrets are read again to detect their rotation. Secrets with a lease
+	// are read again before the lease expires, if it's sooner. Defaults to 5 minutes.
+	Refresh time.Duration
+	// Client sends the requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// vaultSource provides the secrets as configuration documents.
+type vaultSource struct {
+	config VaultConfig
+
+	mu sync.Mutex
+	// lease is the shortest lease of the secrets last read, or 0 if none has a lease.
+	lease time.Duration
+}
+
+func (s *vaultSource) load(ctx context.Context, want func(rel string) bool) ([]document, error) {
+	keys := make([]string, 0, len(s.config.Secrets))
+	for key := range s.config.Secrets {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var docs []document
+	var lease time.Duration
+	for _, key := range keys {
+		secret := strings.Trim(s.config.Secrets[key], "/")
+		rel := secret + ".json"
+		if !want(rel) {
+			// secrets are decoded as JSON
+			continue
+		}
+
+		data, d, err := s.read(ctx, secret)
+		if err != nil {
+			return nil, fmt.Errorf("read secret (path: %s): %w", secret, err)
+		}
+		if d > 0 && (lease == 0 || d < lease) {
+			lease = d
+		}
+
+		var prefix []string
+		if key = strings.ToLower(strings.Trim(key, ".")); key != "" {
+			prefix = strings.Split(key, ".")
+		}
+		b, err := json.Marshal(nest(data, prefix))
+		if err != nil {
+			return nil, fmt.Errorf("encode secret (path: %s): %w", secret, err)
+		}
+
+		docs = append(docs, document{name: "vault:" + s.mount() + "/" + secret, rel: rel, data: b})
+	}
+
+	s.mu.Lock()
+	s.lease = lease
+	s.mu.Unlock()
+
+	return docs, nil
+}
+
+// watch reads the secrets again in the refresh interval, or before their leases expire.
+func (s *vaultSource) watch(ctx context.Context, changed func()) error {
+	for {
+		refresh := s.config.Refresh
+		if refresh <= 0 {
+			refresh = defaultVaultRefresh
+		}
+
+		s.mu.Lock()
+		if s.lease > 0 {
+			// secrets are read again once two thirds of their lease have passed
+			refresh = min(refresh, s.lease*2/3)
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-time.After(refresh):
+			changed()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// read returns the data of the latest version of the secret and its lease duration.
+func (s *vaultSource) read(ctx context.Context, secret string) (map[string]any, time.Duration, error) {
+	address := s.config.Address
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+
+	u := strings.TrimSuffix(address, "/") + "/v1/" + s.mount() + "/data/" + secret
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("create request: %w", err)
+	}
+
+	token := s.config.Token
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	namespace := s.config.Namespace
+	if namespace == "" {
+		namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+	if namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	client := s.config.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var secretResp struct {
+		LeaseDuration int `json:"lease_duration"`
+		Data          struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&secretResp)
+	if err != nil {
+		return nil, 0, fmt.Errorf("decode response: %w", err)
+	}
+
+	data := secretResp.Data.Data
+	if data == nil {
+		// the latest version of the secret is deleted
+		data = make(map[string]any)
+	}
+	return data, time.Duration(secretResp.LeaseDuration) * time.Second, nil
+}
+
+func (s *vaultSource) mount() string {
+	if s.config.Mount == "" {
+		return "secret"
+	}
+	return strings.Trim(s.config.Mount, "/")
+}
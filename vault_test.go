@@ -0,0 +1,168 @@
+package hydra
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// vaultTestServer is the KV version 2 secrets engine of Vault mounted at "secret", whose
+// secrets are kept by path.
+type vaultTestServer struct {
+	// namespace is the namespace required, if set.
+	namespace string
+
+	mu      sync.Mutex
+	secrets map[string]map[string]any
+	// lease is the lease duration of the secrets in seconds.
+	lease int
+}
+
+// put sets the data of the secret.
+func (s *vaultTestServer) put(path string, data map[string]any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.secrets[path] = data
+}
+
+func (s *vaultTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Vault-Token") != "s3cret" || r.Header.Get("X-Vault-Namespace") != s.namespace {
+		http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+		return
+	}
+	path, ok := strings.CutPrefix(r.URL.Path, "/v1/secret/data/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.secrets[path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"lease_duration": s.lease,
+		"data":           map[string]any{"data": data, "metadata": map[string]any{"version": 1}},
+	})
+}
+
+func TestVaultSourceLoad(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    VaultConfig
+		namespace string
+		docs      []document
+		lease     time.Duration
+		wantErr   string
+	}{
+		{
+			name:   "nested keys",
+			config: VaultConfig{Secrets: map[string]string{"Database.Primary": "/myapp/database/", "api": "myapp/api"}},
+			docs: []document{
+				{name: "vault:secret/myapp/database", rel: "myapp/database.json", data: []byte(`{"database":{"primary":{"password":"hunter2"}}}`)},
+				{name: "vault:secret/myapp/api", rel: "myapp/api.json", data: []byte(`{"api":{"key":"abc"}}`)},
+			},
+		},
+		{
+			name:   "root key",
+			config: VaultConfig{Secrets: map[string]string{"": "myapp/api"}},
+			docs:   []document{{name: "vault:secret/myapp/api", rel: "myapp/api.json", data: []byte(`{"key":"abc"}`)}},
+		},
+		{
+			name:   "deleted secret",
+			config: VaultConfig{Secrets: map[string]string{"old": "myapp/deleted"}},
+			docs:   []document{{name: "vault:secret/myapp/deleted", rel: "myapp/deleted.json", data: []byte(`{"old":{}}`)}},
+		},
+		{
+			name:      "namespace",
+			config:    VaultConfig{Namespace: "team", Secrets: map[string]string{"api": "myapp/api"}},
+			namespace: "team",
+			docs:      []document{{name: "vault:secret/myapp/api", rel: "myapp/api.json", data: []byte(`{"api":{"key":"abc"}}`)}},
+		},
+		{
+			name:    "missing secret",
+			config:  VaultConfig{Secrets: map[string]string{"api": "myapp/missing"}},
+			wantErr: "read secret (path: myapp/missing): unexpected status: 404 Not Found",
+		},
+		{
+			name:    "forbidden",
+			config:  VaultConfig{Token: "wrong", Secrets: map[string]string{"api": "myapp/api"}},
+			wantErr: "read secret (path: myapp/api): unexpected status: 403 Forbidden",
+		},
+		{
+			name:    "other mount",
+			config:  VaultConfig{Mount: "/kv/", Secrets: map[string]string{"api": "myapp/api"}},
+			wantErr: "read secret (path: myapp/api): unexpected status: 404 Not Found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &vaultTestServer{
+				namespace: tt.namespace,
+				secrets: map[string]map[string]any{
+					"myapp/database": {"password": "hunter2"},
+					"myapp/api":      {"key": "abc"},
+					"myapp/deleted":  nil,
+				},
+			}
+			srv := httptest.NewServer(server)
+			defer srv.Close()
+
+			// addresses and tokens default to the environment
+			t.Setenv("VAULT_ADDR", srv.URL)
+			t.Setenv("VAULT_TOKEN", "s3cret")
+			tt.config.Client = srv.Client()
+			docs, err := (&vaultSource{config: tt.config}).load(context.Background(), func(string) bool { return true })
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("load() error = %v", err)
+			}
+			if !reflect.DeepEqual(docs, tt.docs) {
+				t.Errorf("load() = %s, want %s", docs, tt.docs)
+			}
+		})
+	}
+}
+
+func TestVaultSourceWatch(t *testing.T) {
+	server := &vaultTestServer{secrets: map[string]map[string]any{"myapp/database": {"password": "hunter2"}}, lease: 1}
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	// secrets with a lease are read again before the lease expires rather than in the refresh
+	// interval
+	h, err := New(WithVault(VaultConfig{
+		Address: srv.URL,
+		Token:   "s3cret",
+		Secrets: map[string]string{"database": "myapp/database"},
+		Refresh: time.Hour,
+		Client:  srv.Client(),
+	}), WithAutoReload())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got, _ := Get[string](h, "database.password"); got != "hunter2" {
+		t.Fatalf("database.password = %q, want hunter2", got)
+	}
+	start(t, h)
+
+	server.put("myapp/database", map[string]any{"password": "correct horse"})
+	eventually(t, "secret rotated", func() bool {
+		got, _ := Get[string](h, "database.password")
+		return got == "correct horse"
+	})
+}
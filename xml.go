@@ -0,0 +1,238 @@
+package hydra
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// defaultXMLTextKey is the key of the text of elements by default, see XMLConfig.
+const defaultXMLTextKey = "#text"
+
+// XMLConfig configures how elements and attributes of XML files are mapped to keys, see
+// WithXML. By default, child elements and attributes of an element are both keys of the
+// element, e.g. `<logger name="app"><level>info</level></logger>` as "logger.name" and
+// "logger.level", and the root element isn't a key.
+type XMLConfig struct {
+	// AttributePrefix is prepended to the keys of attributes, e.g. "-" to tell them apart from
+	// child elements of the same names.
+	AttributePrefix string
+	// TextKey is the key of the text of elements with attributes or child elements, e.g. "30"
+	// of `<timeout unit="s">30</timeout>`. Defaults to "#text". Text of elements without
+	// attributes or child elements are their values.
+	TextKey string
+	// KeepRoot places the configuration under the key of the root element, e.g.
+	// "configuration" for log4j's `<Configuration>`.
+	KeepRoot bool
+	// Lists are the names of elements decoded as lists even if they occur once, e.g.
+	// "appender". Repeated elements are decoded as lists anyway.
+	Lists []string
+}
+
+// xmlCodec decodes and encodes XML files as configured by an XMLConfig.
+type xmlCodec struct {
+	config XMLConfig
+}
+
+// xmlElement is an element of an XML document.
+type xmlElement struct {
+	name     string
+	attrs    []xml.Attr
+	children []*xmlElement
+	text     strings.Builder
+}
+
+func (c xmlCodec) Decode(b []byte, v map[string]any) error {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	// configuration files declare encodings rarely, and mostly ones compatible with UTF-8
+	d.CharsetReader = func(charset string, r io.Reader) (io.Reader, error) {
+		if strings.EqualFold(charset, "utf-8") || strings.EqualFold(charset, "us-ascii") || strings.EqualFold(charset, "iso-8859-1") {
+			return r, nil
+		}
+		return nil, fmt.Errorf("unsupported charset: %s", charset)
+	}
+
+	var root *xmlElement
+	var stack []*xmlElement
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			el := &xmlElement{name: tok.Name.Local, attrs: tok.Attr}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, el)
+			} else if root != nil {
+				return errors.New("multiple root elements")
+			} else {
+				root = el
+			}
+			stack = append(stack, el)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(tok)
+			}
+		}
+	}
+	if root == nil {
+		// empty documents have no configuration
+		return nil
+	}
+
+	value := c.value(root)
+	settings, ok := value.(map[string]any)
+	if c.config.KeepRoot || !ok {
+		settings = map[string]any{root.name: value}
+	}
+	for key, value := range settings {
+		v[key] = value
+	}
+	return nil
+}
+
+// value returns the text of the element, or the keys of its attributes, child elements and
+// text.
+func (c xmlCodec) value(el *xmlElement) any {
+	text := strings.TrimSpace(el.text.String())
+	var attrs []xml.Attr
+	for _, attr := range el.attrs {
+		if attr.Name.Space != "xmlns" && attr.Name.Local != "xmlns" {
+			// namespace declarations aren't configuration
+			attrs = append(attrs, attr)
+		}
+	}
+	if len(attrs) == 0 && len(el.children) == 0 {
+		return text
+	}
+
+	m := make(map[string]any)
+	for _, attr := range attrs {
+		m[c.config.AttributePrefix+attr.Name.Local] = attr.Value
+	}
+	for _, child := range el.children {
+		value := c.value(child)
+		switch prev := m[child.name].(type) {
+		case []any:
+			m[child.name] = append(prev, value)
+		case nil:
+			if slices.Contains(c.config.Lists, child.name) {
+				m[child.name] = []any{value}
+			} else {
+				m[child.name] = value
+			}
+		default:
+			// repeated elements are lists
+			m[child.name] = []any{prev, value}
+		}
+	}
+	if text != "" {
+		m[c.textKey()] = text
+	}
+	return m
+}
+
+func (c xmlCodec) textKey() string {
+	if c.config.TextKey != "" {
+		return c.config.TextKey
+	}
+	return defaultXMLTextKey
+}
+
+func (c xmlCodec) Encode(v map[string]any) ([]byte, error) {
+	var b bytes.Buffer
+	e := xml.NewEncoder(&b)
+	e.Indent("", "  ")
+
+	root, value := "config", any(v)
+	if c.config.KeepRoot && len(v) == 1 {
+		for key, rootValue := range v {
+			root, value = key, rootValue
+		}
+	}
+	err := c.encode(e, root, value)
+	if err == nil {
+		err = e.Flush()
+	}
+	if err != nil {
+		return nil, err
+	}
+	b.WriteString("\n")
+	return b.Bytes(), nil
+}
+
+// encode encodes the value as the element, encoding keys with the attribute prefix as
+// attributes, lists as repeated elements and the text key as text.
+func (c xmlCodec) encode(e *xml.Encoder, name string, value any) error {
+	if list, ok := value.([]any); ok {
+		for _, item := range list {
+			err := c.encode(e, name, item)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	m, ok := value.(map[string]any)
+	if !ok {
+		text, err := cast.ToStringE(value)
+		if err != nil {
+			return fmt.Errorf("encode element (name: %s): %w", name, err)
+		}
+		return e.EncodeElement(text, start)
+	}
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var children []string
+	text := ""
+	for _, key := range keys {
+		attr, isAttr := strings.CutPrefix(key, c.config.AttributePrefix)
+		switch {
+		case key == c.textKey():
+			text = cast.ToString(m[key])
+		case isAttr && c.config.AttributePrefix != "":
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: attr}, Value: cast.ToString(m[key])})
+		default:
+			children = append(children, key)
+		}
+	}
+
+	err := e.EncodeToken(start)
+	if err != nil {
+		return err
+	}
+	if text != "" {
+		err = e.EncodeToken(xml.CharData(text))
+		if err != nil {
+			return err
+		}
+	}
+	for _, key := range children {
+		err := c.encode(e, key, m[key])
+		if err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
@@ -0,0 +1,167 @@
+package hydra
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestXMLCodecDecode(t *testing.T) {
+	tests := []struct {
+		name   string
+		config XMLConfig
+		in     string
+		want   map[string]any
+	}{
+		{
+			name: "elements and attributes",
+			in:   `<config><logger name="app"><level>info</level></logger></config>`,
+			want: map[string]any{"logger": map[string]any{"name": "app", "level": "info"}},
+		},
+		{
+			name:   "attribute prefix",
+			config: XMLConfig{AttributePrefix: "-"},
+			in:     `<config><server port="80"><port>8080</port></server></config>`,
+			want:   map[string]any{"server": map[string]any{"-port": "80", "port": "8080"}},
+		},
+		{
+			name: "text of elements with attributes",
+			in:   `<config><timeout unit="s">30</timeout></config>`,
+			want: map[string]any{"timeout": map[string]any{"unit": "s", "#text": "30"}},
+		},
+		{
+			name:   "text key",
+			config: XMLConfig{TextKey: "value"},
+			in:     `<config><timeout unit="s">30</timeout></config>`,
+			want:   map[string]any{"timeout": map[string]any{"unit": "s", "value": "30"}},
+		},
+		{
+			name:   "keep root",
+			config: XMLConfig{KeepRoot: true},
+			in:     `<?xml version="1.0" encoding="UTF-8"?><Configuration status="warn"></Configuration>`,
+			want:   map[string]any{"Configuration": map[string]any{"status": "warn"}},
+		},
+		{
+			name: "repeated elements",
+			in:   `<config><host>a</host><host>b</host><host>c</host></config>`,
+			want: map[string]any{"host": []any{"a", "b", "c"}},
+		},
+		{
+			name:   "lists",
+			config: XMLConfig{Lists: []string{"appender"}},
+			in:     `<config><appender name="console"/></config>`,
+			want:   map[string]any{"appender": []any{map[string]any{"name": "console"}}},
+		},
+		{
+			name: "namespaces",
+			in:   `<config xmlns="urn:x" xmlns:a="urn:a"><a:name>app</a:name></config>`,
+			want: map[string]any{"name": "app"},
+		},
+		{
+			name: "text root",
+			in:   `<name>app</name>`,
+			want: map[string]any{"name": "app"},
+		},
+		{
+			name: "empty",
+			in:   "",
+			want: map[string]any{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]any{}
+			err := xmlCodec{config: tt.config}.Decode([]byte(tt.in), got)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestXMLCodecDecodeError(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+		line int
+	}{
+		{name: "syntax", in: "<config>\n<a>1</b>\n</config>", want: "element <a> closed by </b>", line: 2},
+		{name: "unclosed", in: "<config>\n<a>1</a>\n", want: "unexpected EOF", line: 3},
+		{name: "multiple roots", in: "<a/><b/>", want: "multiple root elements"},
+		{name: "charset", in: `<?xml version="1.0" encoding="EBCDIC"?><a/>`, want: "unsupported charset: EBCDIC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := xmlCodec{}.Decode([]byte(tt.in), map[string]any{})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Decode() error = %v, want %q", err, tt.want)
+			}
+			if line, _ := errorPosition(err, []byte(tt.in)); line != tt.line {
+				t.Errorf("line of %q = %d, want %d", err, line, tt.line)
+			}
+		})
+	}
+}
+
+func TestXMLCodecRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		config XMLConfig
+		in     map[string]any
+	}{
+		{
+			name: "elements",
+			in: map[string]any{
+				"name":  "app",
+				"hosts": []any{"a", "b"},
+				"db":    map[string]any{"host": "localhost", "port": "5432"},
+			},
+		},
+		{
+			name:   "attributes and text",
+			config: XMLConfig{AttributePrefix: "@", KeepRoot: true},
+			in: map[string]any{"server": map[string]any{
+				"@name":   "web",
+				"timeout": map[string]any{"@unit": "s", "#text": "30"},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := xmlCodec{config: tt.config}
+			b, err := c.Encode(tt.in)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			got := map[string]any{}
+			err = c.Decode(b, got)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.in) {
+				t.Errorf("Decode(Encode()) = %v, want %v\n%s", got, tt.in, b)
+			}
+		})
+	}
+}
+
+func TestWithXML(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "log4j2.xml"), `<Configuration status="warn"><Appenders><Console name="out"/></Appenders></Configuration>`)
+	h, err := New(WithPaths(dir), WithXML(XMLConfig{KeepRoot: true, Lists: []string{"Console"}}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer h.Close()
+	if got, _ := Get[string](h, "configuration.status"); got != "warn" {
+		t.Errorf("configuration.status = %q, want warn", got)
+	}
+	if got, _ := Get[[]map[string]string](h, "configuration.appenders.console"); len(got) != 1 || got[0]["name"] != "out" {
+		t.Errorf("configuration.appenders.console = %v, want [map[name:out]]", got)
+	}
+}
@@ -0,0 +1,97 @@
+package hydra
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// YAMLDocumentMode decides how YAML files with multiple documents separated by "---", e.g.
+// generated by kustomize or helm, are decoded, see WithYAMLDocuments.
+type YAMLDocumentMode int
+
+const (
+	// YAMLFirstDocument decodes the first document only, which is viper's behavior.
+	YAMLFirstDocument YAMLDocumentMode = iota
+	// YAMLMergeDocuments merges the documents in order like configuration files, so later
+	// documents take precedence, see WithMergeStrategy. Conflicts between documents are allowed.
+	YAMLMergeDocuments
+	// YAMLNamespaceDocuments places the documents under the keys of their indexes, e.g. "0.kind"
+	// and "1.kind". Empty documents are skipped but count.
+	YAMLNamespaceDocuments
+)
+
+// yamlCodec decodes and encodes YAML files with multiple documents as decided by the mode.
+type yamlCodec struct {
+	mode  YAMLDocumentMode
+	merge MergeStrategy
+}
+
+func (c yamlCodec) Decode(b []byte, v map[string]any) error {
+	m := &merger{MergeStrategy: c.merge, origins: make(map[string]string)}
+	m.Conflicts = AllowConflicts
+
+	d := yaml.NewDecoder(bytes.NewReader(b))
+	for i := 0; ; i++ {
+		var doc map[string]any
+		err := d.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("decode document (index: %d): %w", i, err)
+		}
+		if doc == nil {
+			// empty documents, e.g. before a leading "---"
+			continue
+		}
+
+		switch c.mode {
+		case YAMLNamespaceDocuments:
+			v[strconv.Itoa(i)] = doc
+		case YAMLMergeDocuments:
+			// conflicts are allowed, so merging doesn't fail
+			_ = m.merge(v, doc, strconv.Itoa(i))
+		default:
+			for key, value := range doc {
+				v[key] = value
+			}
+			return nil
+		}
+	}
+}
+
+func (c yamlCodec) Encode(v map[string]any) ([]byte, error) {
+	if c.mode != YAMLNamespaceDocuments {
+		return yaml.Marshal(v)
+	}
+
+	indexes := make([]int, 0, len(v))
+	for key := range v {
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 {
+			return nil, fmt.Errorf("encode document (key: %s): key is not a document index", key)
+		}
+		indexes = append(indexes, i)
+	}
+	slices.Sort(indexes)
+
+	var b bytes.Buffer
+	e := yaml.NewEncoder(&b)
+	for _, i := range indexes {
+		err := e.Encode(v[strconv.Itoa(i)])
+		if err != nil {
+			return nil, fmt.Errorf("encode document (index: %d): %w", i, err)
+		}
+	}
+	err := e.Close()
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,196 @@
+package hydra
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestYAMLCodecDecode(t *testing.T) {
+	const docs = "---\n# empty\n---\nkind: Service\nspec: {port: 80, hosts: [a]}\n---\nkind: Deployment\nspec: {replicas: 2, hosts: [b]}\n"
+	tests := []struct {
+		name  string
+		codec yamlCodec
+		in    string
+		want  map[string]any
+	}{
+		{
+			name:  "first document",
+			codec: yamlCodec{mode: YAMLFirstDocument},
+			in:    docs,
+			want:  map[string]any{"kind": "Service", "spec": map[string]any{"port": 80, "hosts": []any{"a"}}},
+		},
+		{
+			name:  "merge documents",
+			codec: yamlCodec{mode: YAMLMergeDocuments},
+			in:    docs,
+			want: map[string]any{
+				"kind": "Deployment",
+				"spec": map[string]any{"port": 80, "replicas": 2, "hosts": []any{"b"}},
+			},
+		},
+		{
+			name:  "merge documents appending slices",
+			codec: yamlCodec{mode: YAMLMergeDocuments, merge: MergeStrategy{Slices: AppendSlices}},
+			in:    docs,
+			want: map[string]any{
+				"kind": "Deployment",
+				"spec": map[string]any{"port": 80, "replicas": 2, "hosts": []any{"a", "b"}},
+			},
+		},
+		{
+			name:  "namespace documents",
+			codec: yamlCodec{mode: YAMLNamespaceDocuments},
+			in:    docs,
+			want: map[string]any{
+				"1": map[string]any{"kind": "Service", "spec": map[string]any{"port": 80, "hosts": []any{"a"}}},
+				"2": map[string]any{"kind": "Deployment", "spec": map[string]any{"replicas": 2, "hosts": []any{"b"}}},
+			},
+		},
+		{
+			name:  "single document",
+			codec: yamlCodec{mode: YAMLNamespaceDocuments},
+			in:    "kind: Service\n",
+			want:  map[string]any{"0": map[string]any{"kind": "Service"}},
+		},
+		{
+			name:  "empty",
+			codec: yamlCodec{mode: YAMLMergeDocuments},
+			in:    "",
+			want:  map[string]any{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]any{}
+			err := tt.codec.Decode([]byte(tt.in), got)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestYAMLCodecDecodeError(t *testing.T) {
+	tests := []struct {
+		name string
+		mode YAMLDocumentMode
+		in   string
+		want string
+	}{
+		{
+			name: "syntax",
+			mode: YAMLMergeDocuments,
+			in:   "a: 1\n---\nb: [1,\n",
+			want: "decode document (index: 1): yaml: line 3:",
+		},
+		{
+			name: "not a mapping",
+			mode: YAMLNamespaceDocuments,
+			in:   "a: 1\n---\n- b\n",
+			want: "decode document (index: 1): yaml: unmarshal errors:\n  line 3:",
+		},
+		{
+			name: "first document",
+			mode: YAMLFirstDocument,
+			in:   "a: [1,\n---\nb: 2\n",
+			want: "decode document (index: 0): yaml: line 1:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := yamlCodec{mode: tt.mode}.Decode([]byte(tt.in), map[string]any{})
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("Decode() error = %v, want prefix %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestYAMLCodecRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		mode YAMLDocumentMode
+		in   map[string]any
+	}{
+		{
+			name: "first document",
+			mode: YAMLFirstDocument,
+			in:   map[string]any{"kind": "Service", "spec": map[string]any{"port": 80}},
+		},
+		{
+			name: "namespace documents",
+			mode: YAMLNamespaceDocuments,
+			in: map[string]any{
+				"0":  map[string]any{"kind": "Service"},
+				"1":  map[string]any{"kind": "Deployment", "spec": map[string]any{"replicas": 2}},
+				"2":  map[string]any{"kind": "ConfigMap"},
+				"10": map[string]any{"kind": "Secret"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := yamlCodec{mode: tt.mode}
+			b, err := c.Encode(tt.in)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			got := map[string]any{}
+			err = c.Decode(b, got)
+			if err != nil {
+				t.Fatalf("Decode(%s) error = %v", b, err)
+			}
+			want := tt.in
+			if tt.mode == YAMLNamespaceDocuments {
+				// documents are renumbered in order
+				want = map[string]any{"0": tt.in["0"], "1": tt.in["1"], "2": tt.in["2"], "3": tt.in["10"]}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("round trip = %v, want %v\n%s", got, want, b)
+			}
+		})
+	}
+}
+
+func TestYAMLCodecEncodeError(t *testing.T) {
+	for _, key := range []string{"kind", "-1"} {
+		_, err := yamlCodec{mode: YAMLNamespaceDocuments}.Encode(map[string]any{"0": map[string]any{}, key: 1})
+		want := "encode document (key: " + key + "): key is not a document index"
+		if err == nil || err.Error() != want {
+			t.Errorf("Encode(%s) error = %v, want %q", key, err, want)
+		}
+	}
+}
+
+func TestWithYAMLDocuments(t *testing.T) {
+	tests := []struct {
+		name string
+		mode YAMLDocumentMode
+		key  string
+		want any
+	}{
+		{name: "first document", mode: YAMLFirstDocument, key: "kind", want: "Service"},
+		{name: "merge documents", mode: YAMLMergeDocuments, key: "kind", want: "Deployment"},
+		{name: "namespace documents", mode: YAMLNamespaceDocuments, key: "1.kind", want: "Deployment"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, filepath.Join(dir, "app.yaml"), "kind: Service\n---\nkind: Deployment\n")
+			h, err := New(WithPaths(dir), WithYAMLDocuments(tt.mode))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer h.Close()
+			got, err := Get[any](h, tt.key)
+			if err != nil || got != tt.want {
+				t.Errorf("Get(%s) = %v, %v, want %v", tt.key, got, err, tt.want)
+			}
+		})
+	}
+}
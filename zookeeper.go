@@ -0,0 +1,449 @@
+package hydra
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultZooKeeperSessionTimeout is the session timeout requested by default.
+	defaultZooKeeperSessionTimeout = 10 * time.Second
+
+	// operations of the ZooKeeper protocol
+	zkOpExists       = 3
+	zkOpGetData      = 4
+	zkOpPing         = 11
+	zkOpGetChildren2 = 12
+	zkOpAuth         = 100
+
+	// xids of packets that aren't responses of requests
+	zkXidNotification = -1
+	zkXidPing         = -2
+	zkXidAuth         = -4
+
+	// zkErrNoNode is the error code of a znode that doesn't exist.
+	zkErrNoNode = -101
+)
+
+// ZooKeeperConfig configures a source of configuration documents stored as znodes of a ZooKeeper
+// subtree, see WithZooKeeper.
+type ZooKeeperConfig struct {
+	// Servers of the ensemble, e.g. "zk1:2181", which are connected to in order until one
+	// accepts the connection.
+	Servers []string
+	// Path of the znode whose subtree is loaded, e.g. "/config/myapp". The data of the znodes is
+	// loaded as documents, and their paths relative to the path are used like relative paths,
+	// see ByRelativePath, with their extensions determining their formats.
+	Path string
+	// Username and Password authenticate the session with the digest scheme, if set.
+	Username string
+	Password string
+	// SessionTimeout is the session timeout requested. Defaults to 10 seconds.
+	SessionTimeout time.Duration
+}
+
+// zooKeeperSource provides the data of the znodes of a subtree as configuration documents.
+type zooKeeperSource struct {
+	config ZooKeeperConfig
+}
+
+func (s *zooKeeperSource) load(ctx context.Context, want func(rel string) bool) ([]document, error) {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	docs, err := s.walk(conn, want, false)
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return docs, err
+}
+
+// watch sets watches on the znodes of the subtree, which are notified once when a znode
+// changes, so they're set again after each notification.
+func (s *zooKeeperSource) watch(ctx context.Context, changed func()) error {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	// sessions expire without requests, so they're kept alive by pings
+	go func() {
+		t := time.NewTicker(conn.timeout / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if conn.send(zkXidPing, zkOpPing, nil) != nil {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		_, err := s.walk(conn, func(string) bool { return true }, true)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		// changes made before the watches were set are caught up
+		changed()
+
+		for !conn.notified {
+			_, err := conn.read(0)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return fmt.Errorf("read notification: %w", err)
+			}
+		}
+		conn.notified = false
+	}
+}
+
+// walk returns the data of the znodes of the subtree accepted by want, setting watches on all
+// znodes if watch is set.
+func (s *zooKeeperSource) walk(conn *zkConn, want func(rel string) bool, watch bool) ([]document, error) {
+	root := "/" + strings.Trim(s.config.Path, "/")
+
+	var docs []document
+	var visit func(node string) error
+	visit = func(node string) error {
+		children, err := conn.getChildren(node, watch)
+		if errors.Is(err, errZKNoNode) {
+			// removed meanwhile, which is notified to the watch of its parent
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("get children (path: %s): %w", node, err)
+		}
+
+		rel := strings.TrimPrefix(strings.TrimPrefix(node, root), "/")
+		if rel == "" {
+			// the path is the znode of a single document
+			rel = path.Base(node)
+		}
+		if watch || want(rel) {
+			data, err := conn.getData(node, watch)
+			if err != nil && !errors.Is(err, errZKNoNode) {
+				return fmt.Errorf("get data (path: %s): %w", node, err)
+			}
+			if len(data) > 0 && !watch {
+				docs = append(docs, document{name: "zk:" + node, rel: rel, data: data})
+			}
+		}
+
+		for _, child := range children {
+			err := visit(path.Join(node, child))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// a watch is set on a root that doesn't exist yet, notified once it's created
+	_, err := conn.call(zkOpExists, appendZKBool(appendZKString(nil, root), watch))
+	if errors.Is(err, errZKNoNode) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("check existence (path: %s): %w", root, err)
+	}
+
+	err = visit(root)
+	return docs, err
+}
+
+// dial connects to the first server of the ensemble accepting the connection and starts a
+// session.
+func (s *zooKeeperSource) dial(ctx context.Context) (*zkConn, error) {
+	timeout := s.config.SessionTimeout
+	if timeout <= 0 {
+		timeout = defaultZooKeeperSessionTimeout
+	}
+
+	var errs []error
+	for _, server := range s.config.Servers {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", server)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("connect (server: %s): %w", server, err))
+			continue
+		}
+
+		// servers not responding are given up on like expired sessions
+		conn.SetDeadline(time.Now().Add(timeout))
+		c := &zkConn{Conn: conn, r: bufio.NewReader(conn)}
+		err = c.connect(timeout)
+		if err == nil && s.config.Username != "" {
+			err = c.auth("digest", s.config.Username+":"+s.config.Password)
+		}
+		conn.SetDeadline(time.Time{})
+		if err != nil {
+			conn.Close()
+			errs = append(errs, fmt.Errorf("start session (server: %s): %w", server, err))
+			continue
+		}
+		return c, nil
+	}
+	if len(errs) == 0 {
+		return nil, errors.New("no servers")
+	}
+	return nil, errors.Join(errs...)
+}
+
+var errZKNoNode = errors.New("znode doesn't exist")
+
+// zkConn is a connection of a session speaking the ZooKeeper protocol.
+type zkConn struct {
+	net.Conn
+	r *bufio.Reader
+	// timeout is the session timeout negotiated.
+	timeout time.Duration
+	// notified is set once a watch is notified.
+	notified bool
+
+	// mu guards writes, which are sent concurrently by pings.
+	mu  sync.Mutex
+	xid int32
+}
+
+// connect starts a session.
+func (c *zkConn) connect(timeout time.Duration) error {
+	var req []byte
+	req = binary.BigEndian.AppendUint32(req, 0) // protocol version
+	req = binary.BigEndian.AppendUint64(req, 0) // last zxid seen
+	req = binary.BigEndian.AppendUint32(req, uint32(timeout/time.Millisecond))
+	req = binary.BigEndian.AppendUint64(req, 0) // session ID
+	req = appendZKBuffer(req, make([]byte, 16))
+
+	err := c.write(req)
+	if err != nil {
+		return err
+	}
+	b, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+
+	r := zkReader{b: b}
+	r.int32() // protocol version
+	negotiated := r.int32()
+	if r.err != nil {
+		return r.err
+	}
+	if negotiated <= 0 {
+		return errors.New("session expired")
+	}
+	c.timeout = time.Duration(negotiated) * time.Millisecond
+	return nil
+}
+
+// auth adds the authentication of the scheme to the session.
+func (c *zkConn) auth(scheme, auth string) error {
+	var req []byte
+	req = binary.BigEndian.AppendUint32(req, 0) // type
+	req = appendZKString(req, scheme)
+	req = appendZKBuffer(req, []byte(auth))
+
+	err := c.send(zkXidAuth, zkOpAuth, req)
+	if err != nil {
+		return err
+	}
+	_, err = c.read(zkXidAuth)
+	return err
+}
+
+// getChildren returns the names of the children of the znode, setting a watch if set.
+func (c *zkConn) getChildren(node string, watch bool) ([]string, error) {
+	b, err := c.call(zkOpGetChildren2, appendZKBool(appendZKString(nil, node), watch))
+	if err != nil {
+		return nil, err
+	}
+
+	r := zkReader{b: b}
+	children := make([]string, max(r.int32(), 0))
+	for i := range children {
+		children[i] = string(r.buffer())
+	}
+	return children, r.err
+}
+
+// getData returns the data of the znode, setting a watch if set.
+func (c *zkConn) getData(node string, watch bool) ([]byte, error) {
+	b, err := c.call(zkOpGetData, appendZKBool(appendZKString(nil, node), watch))
+	if err != nil {
+		return nil, err
+	}
+
+	r := zkReader{b: b}
+	data := r.buffer()
+	return data, r.err
+}
+
+// call sends the request and returns the body of its response.
+func (c *zkConn) call(op int32, req []byte) ([]byte, error) {
+	c.mu.Lock()
+	c.xid++
+	xid := c.xid
+	c.mu.Unlock()
+
+	err := c.send(xid, op, req)
+	if err != nil {
+		return nil, err
+	}
+	return c.read(xid)
+}
+
+// send sends the request with its header.
+func (c *zkConn) send(xid, op int32, req []byte) error {
+	var b []byte
+	b = binary.BigEndian.AppendUint32(b, uint32(xid))
+	b = binary.BigEndian.AppendUint32(b, uint32(op))
+	return c.write(append(b, req...))
+}
+
+// write writes the packet prefixed by its length.
+func (c *zkConn) write(packet []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(packet)))
+	_, err := c.Conn.Write(append(b, packet...))
+	return err
+}
+
+// read reads packets until the response of the xid and returns its body. Responses of pings
+// are skipped, and notifications of watches are recorded. If the xid is 0, it returns after
+// the next packet.
+func (c *zkConn) read(xid int32) ([]byte, error) {
+	for {
+		b, err := c.readPacket()
+		if err != nil {
+			return nil, err
+		}
+
+		r := zkReader{b: b}
+		got := r.int32()
+		r.int64() // zxid
+		code := r.int32()
+		if r.err != nil {
+			return nil, r.err
+		}
+
+		switch {
+		case got == zkXidNotification:
+			c.notified = true
+		case got == xid && code == zkErrNoNode:
+			return nil, errZKNoNode
+		case got == xid && code != 0:
+			return nil, fmt.Errorf("zookeeper error %d", code)
+		case got == xid:
+			return r.b, nil
+		}
+		if xid == 0 {
+			return nil, nil
+		}
+	}
+}
+
+// readPacket reads a packet prefixed by its length.
+func (c *zkConn) readPacket() ([]byte, error) {
+	var n [4]byte
+	_, err := io.ReadFull(c.r, n[:])
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, binary.BigEndian.Uint32(n[:]))
+	_, err = io.ReadFull(c.r, b)
+	return b, err
+}
+
+func appendZKBuffer(b, buf []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(buf)))
+	return append(b, buf...)
+}
+
+func appendZKString(b []byte, s string) []byte {
+	return appendZKBuffer(b, []byte(s))
+}
+
+func appendZKBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 1)
+	}
+	return append(b, 0)
+}
+
+// zkReader decodes the fields of a packet, recording the first error.
+type zkReader struct {
+	b   []byte
+	err error
+}
+
+func (r *zkReader) int32() int32 {
+	if r.err != nil || len(r.b) < 4 {
+		r.fail()
+		return 0
+	}
+	v := int32(binary.BigEndian.Uint32(r.b))
+	r.b = r.b[4:]
+	return v
+}
+
+func (r *zkReader) int64() int64 {
+	if r.err != nil || len(r.b) < 8 {
+		r.fail()
+		return 0
+	}
+	v := int64(binary.BigEndian.Uint64(r.b))
+	r.b = r.b[8:]
+	return v
+}
+
+// buffer returns a buffer, which is nil if its length is -1.
+func (r *zkReader) buffer() []byte {
+	n := r.int32()
+	if r.err != nil || n < 0 {
+		return nil
+	}
+	if len(r.b) < int(n) {
+		r.fail()
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *zkReader) fail() {
+	if r.err == nil {
+		r.err = errors.New("truncated packet")
+	}
+}
@@ -0,0 +1,334 @@
+package hydra
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// zkTestServer is a ZooKeeper server of a single ensemble member speaking enough of the
+// protocol for zooKeeperSource, whose znodes are kept by their paths.
+type zkTestServer struct {
+	ln net.Listener
+	// auth is the digest authentication required, e.g. "user:pass", if set.
+	auth string
+
+	mu    sync.Mutex
+	nodes map[string][]byte
+	conns []*zkTestConn
+}
+
+type zkTestConn struct {
+	net.Conn
+	mu sync.Mutex
+	// watched are the paths of the znodes watched, which are notified once.
+	watched map[string]bool
+}
+
+// newZKTestServer returns a server listening for connections, which are accepted once it's
+// started, so its options can be set before.
+func newZKTestServer(t *testing.T, nodes map[string]string) *zkTestServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &zkTestServer{ln: ln, nodes: make(map[string][]byte)}
+	for node, data := range nodes {
+		s.nodes[node] = []byte(data)
+	}
+	t.Cleanup(func() {
+		ln.Close()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, c := range s.conns {
+			c.Close()
+		}
+	})
+	return s
+}
+
+// start accepts connections.
+func (s *zkTestServer) start() {
+	go func() {
+		for {
+			conn, err := s.ln.Accept()
+			if err != nil {
+				return
+			}
+			c := &zkTestConn{Conn: conn, watched: make(map[string]bool)}
+			s.mu.Lock()
+			s.conns = append(s.conns, c)
+			s.mu.Unlock()
+			go s.serve(c)
+		}
+	}()
+}
+
+// set sets the data of the znode, or removes it if data is nil, and notifies the watches of the
+// znode and its parent.
+func (s *zkTestServer) set(node string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if data == nil {
+		delete(s.nodes, node)
+	} else {
+		s.nodes[node] = data
+	}
+	for _, c := range s.conns {
+		c.mu.Lock()
+		for _, watched := range []string{node, path.Dir(node)} {
+			if !c.watched[watched] {
+				continue
+			}
+			delete(c.watched, watched)
+			// type 3 is NodeDataChanged, state 3 is SyncConnected
+			event := binary.BigEndian.AppendUint32(nil, 3)
+			event = binary.BigEndian.AppendUint32(event, 3)
+			c.respond(zkXidNotification, 0, appendZKString(event, watched))
+		}
+		c.mu.Unlock()
+	}
+}
+
+// respond writes the response with its header, with c.mu held.
+func (c *zkTestConn) respond(xid, code int32, body []byte) {
+	b := binary.BigEndian.AppendUint32(nil, uint32(xid))
+	b = binary.BigEndian.AppendUint64(b, 0) // zxid
+	b = binary.BigEndian.AppendUint32(b, uint32(code))
+	b = append(b, body...)
+	_, _ = c.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(b))), b...))
+}
+
+func (s *zkTestServer) serve(c *zkTestConn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	read := func() ([]byte, error) {
+		var n [4]byte
+		if _, err := io.ReadFull(r, n[:]); err != nil {
+			return nil, err
+		}
+		b := make([]byte, binary.BigEndian.Uint32(n[:]))
+		_, err := io.ReadFull(r, b)
+		return b, err
+	}
+
+	b, err := read()
+	if err != nil {
+		return
+	}
+	req := zkReader{b: b}
+	req.int32() // protocol version
+	req.int64() // last zxid seen
+	timeout := req.int32()
+	resp := binary.BigEndian.AppendUint32(nil, 0)
+	resp = binary.BigEndian.AppendUint32(resp, uint32(timeout))
+	resp = binary.BigEndian.AppendUint64(resp, 1) // session ID
+	resp = appendZKBuffer(resp, make([]byte, 16))
+	c.mu.Lock()
+	_, _ = c.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(resp))), resp...))
+	c.mu.Unlock()
+
+	for {
+		b, err := read()
+		if err != nil {
+			return
+		}
+		req := zkReader{b: b}
+		xid, op := req.int32(), req.int32()
+
+		s.mu.Lock()
+		c.mu.Lock()
+		var code int32
+		var body []byte
+		switch op {
+		case zkOpAuth:
+			req.int32() // type
+			req.buffer()
+			if string(req.buffer()) != s.auth {
+				code = -115 // AuthFailed
+			}
+		case zkOpPing:
+		case zkOpExists, zkOpGetChildren2, zkOpGetData:
+			node := string(req.buffer())
+			if watch := req.b[0] == 1; watch {
+				c.watched[node] = true
+			}
+			data, ok := s.nodes[node]
+			var children []string
+			for n := range s.nodes {
+				if path.Dir(n) == node && n != node {
+					children = append(children, path.Base(n))
+				}
+			}
+			slices.Sort(children)
+			switch {
+			case !ok:
+				code = zkErrNoNode
+			case op == zkOpGetChildren2:
+				body = binary.BigEndian.AppendUint32(nil, uint32(len(children)))
+				for _, child := range children {
+					body = appendZKString(body, child)
+				}
+			case op == zkOpGetData:
+				body = appendZKBuffer(nil, data)
+			}
+		default:
+			code = -6 // Unimplemented
+		}
+		c.respond(xid, code, body)
+		c.mu.Unlock()
+		s.mu.Unlock()
+	}
+}
+
+func TestZooKeeperSourceLoad(t *testing.T) {
+	nodes := map[string]string{
+		"/config":                  "",
+		"/config/myapp":            "",
+		"/config/myapp/app.yaml":   "port: 8080\n",
+		"/config/myapp/db":         "",
+		"/config/myapp/db/db.json": `{"host": "localhost"}`,
+		"/config/myapp/empty.yaml": "",
+		"/config/other":            "",
+		"/config/other/app.yaml":   "port: 1\n",
+	}
+	tests := []struct {
+		name    string
+		config  ZooKeeperConfig
+		auth    string
+		want    func(rel string) bool
+		docs    []document
+		wantErr string
+	}{
+		{
+			name:   "subtree",
+			config: ZooKeeperConfig{Path: "/config/myapp/"},
+			docs: []document{
+				{name: "zk:/config/myapp/app.yaml", rel: "app.yaml", data: []byte("port: 8080\n")},
+				{name: "zk:/config/myapp/db/db.json", rel: "db/db.json", data: []byte(`{"host": "localhost"}`)},
+			},
+		},
+		{
+			name:   "filtered",
+			config: ZooKeeperConfig{Path: "/config/myapp"},
+			want:   func(rel string) bool { return strings.HasSuffix(rel, ".json") },
+			docs:   []document{{name: "zk:/config/myapp/db/db.json", rel: "db/db.json", data: []byte(`{"host": "localhost"}`)}},
+		},
+		{
+			name:   "single znode",
+			config: ZooKeeperConfig{Path: "config/myapp/app.yaml"},
+			docs:   []document{{name: "zk:/config/myapp/app.yaml", rel: "app.yaml", data: []byte("port: 8080\n")}},
+		},
+		{
+			name:   "missing",
+			config: ZooKeeperConfig{Path: "/config/missing"},
+		},
+		{
+			name:   "authenticated",
+			config: ZooKeeperConfig{Path: "/config/other", Username: "user", Password: "pass"},
+			auth:   "user:pass",
+			docs:   []document{{name: "zk:/config/other/app.yaml", rel: "app.yaml", data: []byte("port: 1\n")}},
+		},
+		{
+			name:    "authentication failed",
+			config:  ZooKeeperConfig{Path: "/config/other", Username: "user", Password: "wrong"},
+			auth:    "user:pass",
+			wantErr: "start session (server: SERVER): zookeeper error -115",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newZKTestServer(t, nodes)
+			s.auth = tt.auth
+			s.start()
+
+			// servers refusing connections are skipped
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			refused := ln.Addr().String()
+			ln.Close()
+			tt.config.Servers = []string{refused, s.ln.Addr().String()}
+
+			want := tt.want
+			if want == nil {
+				want = func(string) bool { return true }
+			}
+			src := &zooKeeperSource{config: tt.config}
+			docs, err := src.load(context.Background(), want)
+			if tt.wantErr != "" {
+				wantErr := strings.ReplaceAll(tt.wantErr, "SERVER", s.ln.Addr().String())
+				if err == nil || !strings.HasSuffix(err.Error(), wantErr) {
+					t.Fatalf("load() error = %v, want suffix %q", err, wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("load() error = %v", err)
+			}
+			if !reflect.DeepEqual(docs, tt.docs) {
+				t.Errorf("load() = %+v, want %+v", docs, tt.docs)
+			}
+		})
+	}
+}
+
+func TestZooKeeperSourceNoServers(t *testing.T) {
+	_, err := (&zooKeeperSource{}).load(context.Background(), func(string) bool { return true })
+	if err == nil || err.Error() != "no servers" {
+		t.Errorf("load() error = %v, want no servers", err)
+	}
+}
+
+func TestZooKeeperSourceWatch(t *testing.T) {
+	s := newZKTestServer(t, map[string]string{
+		"/myapp":          "",
+		"/myapp/app.yaml": "port: 8080\n",
+	})
+	s.start()
+	h, err := New(WithZooKeeper(ZooKeeperConfig{Servers: []string{s.ln.Addr().String()}, Path: "/myapp"}), WithAutoReload())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got, _ := Get[int](h, "port"); got != 8080 {
+		t.Fatalf("port = %d, want 8080", got)
+	}
+	start(t, h)
+
+	steps := []struct {
+		node string
+		data []byte
+		key  string
+		want any
+	}{
+		{node: "/myapp/app.yaml", data: []byte("port: 9090\n"), key: "port", want: 9090},
+		{node: "/myapp/db.yaml", data: []byte("db: postgres\n"), key: "db", want: "postgres"},
+		{node: "/myapp/app.yaml", data: nil, key: "port", want: nil},
+	}
+	for i, step := range steps {
+		s.set(step.node, step.data)
+		eventually(t, step.key+" changed", func() bool {
+			got, err := Get[any](h, step.key)
+			if step.want == nil {
+				return errors.Is(err, ErrKeyNotSet)
+			}
+			return got == step.want
+		})
+		if i == len(steps)-1 {
+			if got, _ := Get[string](h, "db"); got != "postgres" {
+				t.Errorf("db = %q after removing app.yaml, want postgres", got)
+			}
+		}
+	}
+}